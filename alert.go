@@ -0,0 +1,90 @@
+// alert.go checks the counts of errors and broken pages found in a run
+// against user supplied thresholds and optionally posts an alert to a
+// webhook when they are exceeded, for monitoring sites from cron.
+// postJSON is also used by the webhook OutputSink.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WEBHOOKTIMEOUT is the longest an alert webhook post may take
+const WEBHOOKTIMEOUT time.Duration = 10 * time.Second
+
+// exceeded reports which thresholds have been exceeded by the stats.
+// A negative threshold is not checked.
+func (s Stats) exceeded(maxErrors, maxBroken int) []string {
+	failures := []string{}
+	if maxErrors >= 0 && s.Errors > maxErrors {
+		failures = append(failures, fmt.Sprintf("%d errors exceeds maximum of %d", s.Errors, maxErrors))
+	}
+	if maxBroken >= 0 && s.Broken > maxBroken {
+		failures = append(failures, fmt.Sprintf("%d broken pages exceeds maximum of %d", s.Broken, maxBroken))
+	}
+	return failures
+}
+
+// alertOnThresholds reports the thresholds in options exceeded by the
+// stats to diagnostics and, if a webhook is set, posts an alert. It
+// reports whether any thresholds were exceeded.
+func alertOnThresholds(options Options, stats Stats) bool {
+	failures := stats.exceeded(options.MaxErrors, options.MaxBroken)
+	if len(failures) == 0 {
+		return false
+	}
+	for _, f := range failures {
+		fmt.Fprintln(diagnostics, f)
+	}
+	if options.Webhook != "" {
+		err := postAlert(&http.Client{Timeout: WEBHOOKTIMEOUT}, options.Webhook, alert{
+			BaseURL:    options.Args.BaseURL,
+			Pages:      stats.Pages,
+			Errors:     stats.Errors,
+			Broken:     stats.Broken,
+			Violations: stats.Violations,
+			Failures:   failures,
+		})
+		if err != nil {
+			fmt.Fprintln(diagnostics, err)
+		}
+	}
+	return true
+}
+
+// alert is the json payload posted to an alert webhook
+type alert struct {
+	BaseURL    string   `json:"baseurl"`
+	Pages      int      `json:"pages"`
+	Errors     int      `json:"errors"`
+	Broken     int      `json:"broken"`
+	Violations int      `json:"violations"`
+	Failures   []string `json:"failures"`
+}
+
+// postAlert posts an alert as json to the webhook url
+func postAlert(client *http.Client, webhook string, a alert) error {
+	return postJSON(client, webhook, a)
+}
+
+// postJSON posts v as json to the webhook url, returning an error if
+// the post fails or the webhook does not return a 2xx status.
+func postJSON(client *http.Client, webhook string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("webhook encoding error: %w", err)
+	}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
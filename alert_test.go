@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatsExceeded(t *testing.T) {
+
+	tests := []struct {
+		stats     Stats
+		maxErrors int
+		maxBroken int
+		failures  []string
+	}{
+		{
+			stats:     Stats{Pages: 10, Errors: 5, Broken: 5},
+			maxErrors: -1, // not checked
+			maxBroken: -1,
+			failures:  []string{},
+		},
+		{
+			stats:     Stats{Pages: 10, Errors: 0, Broken: 0},
+			maxErrors: 0,
+			maxBroken: 0,
+			failures:  []string{},
+		},
+		{
+			stats:     Stats{Pages: 10, Errors: 1, Broken: 2},
+			maxErrors: 0,
+			maxBroken: 2,
+			failures:  []string{"1 errors exceeds maximum of 0"},
+		},
+		{
+			stats:     Stats{Pages: 10, Errors: 1, Broken: 3},
+			maxErrors: 1,
+			maxBroken: 2,
+			failures:  []string{"3 broken pages exceeds maximum of 2"},
+		},
+		{
+			stats:     Stats{Pages: 10, Errors: 4, Broken: 3},
+			maxErrors: 1,
+			maxBroken: 2,
+			failures: []string{
+				"4 errors exceeds maximum of 1",
+				"3 broken pages exceeds maximum of 2",
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			got := tt.stats.exceeded(tt.maxErrors, tt.maxBroken)
+			if diff := cmp.Diff(tt.failures, got); diff != "" {
+				t.Errorf("failures mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPostAlert(t *testing.T) {
+
+	var received alert
+	serverStatus := http.StatusOK
+	httpHandler := http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+				t.Errorf("could not decode alert: %v", err)
+			}
+			w.WriteHeader(serverStatus)
+		},
+	)
+	server := httptest.NewServer(httpHandler)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 300 * time.Millisecond}
+	a := alert{
+		BaseURL:  "https://example.com",
+		Pages:    10,
+		Errors:   4,
+		Failures: []string{"4 errors exceeds maximum of 1"},
+	}
+
+	tests := []struct {
+		name   string
+		status int
+		isErr  bool
+	}{
+		{"ok", http.StatusOK, false},
+		{"accepted", http.StatusAccepted, false},
+		{"server_error", http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverStatus = tt.status
+			received = alert{}
+			err := postAlert(client, server.URL, a)
+			if got, want := (err != nil), tt.isErr; got != want {
+				t.Fatalf("error got %v want error %t", err, want)
+			}
+			if diff := cmp.Diff(a, received); diff != "" {
+				t.Errorf("alert mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("no_server", func(t *testing.T) {
+		if err := postAlert(client, "http://127.0.0.1:1", a); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
@@ -0,0 +1,84 @@
+// amp.go detects the AMP (Accelerated Mobile Pages) alternates of
+// pages, given by link elements with rel="amphtml", and checks that
+// AMP pages which are crawled still contain the search terms found on
+// their canonical pages, as the two versions are often maintained
+// separately and drift apart.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// AMPVIOLATION is the kind of the Violation recorded for an AMP page
+// missing a search term found on its canonical page
+const AMPVIOLATION = "amp"
+
+// isAMPRel reports whether a rel attribute includes amphtml
+func isAMPRel(rel string) bool {
+	return slices.Contains(strings.Fields(strings.ToLower(rel)), "amphtml")
+}
+
+// ampCanonical is the canonical page of an AMP page and the search
+// terms found on it
+type ampCanonical struct {
+	url   string
+	terms []string
+}
+
+// ampPages records the canonical pages of the AMP pages waiting to be
+// fetched, by the url of the AMP page. It is safe for concurrent use.
+type ampPages struct {
+	mu    sync.Mutex
+	pages map[string]ampCanonical
+}
+
+// add records that ampURL is the AMP page of the page of result r
+func (a *ampPages) add(ampURL string, r Result) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pages == nil {
+		a.pages = map[string]ampCanonical{}
+	}
+	if _, ok := a.pages[ampURL]; !ok {
+		a.pages[ampURL] = ampCanonical{r.url, matchedTerms(r.matches)}
+	}
+}
+
+// check returns the violations of the result r of an AMP page recorded
+// with add, one for each search term found on its canonical page but
+// not on the AMP page. Results of other pages have none.
+func (a *ampPages) check(r Result) []Violation {
+	a.mu.Lock()
+	canonical, ok := a.pages[r.url]
+	delete(a.pages, r.url)
+	a.mu.Unlock()
+	if !ok || r.err != nil {
+		return nil
+	}
+	found := matchedTerms(r.matches)
+	violations := []Violation{}
+	for _, term := range canonical.terms {
+		if !slices.Contains(found, term) {
+			violations = append(violations, Violation{
+				AMPVIOLATION,
+				fmt.Sprintf("AMP page does not contain %q, found on %s", term, canonical.url),
+			})
+		}
+	}
+	return violations
+}
+
+// matchedTerms returns the search terms matched, without duplicates
+func matchedTerms(matches []SearchMatch) []string {
+	terms := []string{}
+	for _, m := range matches {
+		if !slices.Contains(terms, m.match) {
+			terms = append(terms, m.match)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePageAMP(t *testing.T) {
+
+	u, _ := url.Parse("https://example.com/news/story")
+	body := `<head>
+<link rel="canonical" href="/news/story">
+<link rel="AMPHTML" href="/news/story?amp=1#top">
+<link rel="amphtml" href="/other">
+</head>`
+	page, err := parsePage([]byte(body), u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := page.amp, "https://example.com/news/story?amp=1"; got != want {
+		t.Errorf("got amp %q want %q", got, want)
+	}
+}
+
+func TestAMPPages(t *testing.T) {
+
+	var a ampPages
+	a.add("https://example.com/a?amp=1", Result{
+		url:     "https://example.com/a",
+		matches: []SearchMatch{{1, "hello", 0}, {2, "world", 0}, {3, "hello", 0}},
+	})
+	if got := a.check(Result{url: "https://example.com/b"}); len(got) != 0 {
+		t.Errorf("page without an AMP canonical got violations %v", got)
+	}
+	got := a.check(Result{url: "https://example.com/a?amp=1", matches: []SearchMatch{{1, "world", 0}}})
+	want := []Violation{{AMPVIOLATION, `AMP page does not contain "hello", found on https://example.com/a`}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("violations mismatch (-want +got):\n%s", diff)
+	}
+	if got := a.check(Result{url: "https://example.com/a?amp=1"}); len(got) != 0 {
+		t.Errorf("second check got violations %v", got)
+	}
+}
+
+func TestDispatcherAMP(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch {
+		case r.URL.Query().Get("amp") == "1":
+			fmt.Fprint(w, "<p>hello</p>")
+		case r.URL.Path == "/":
+			fmt.Fprint(w, `<link rel="amphtml" href="/?amp=1"><p>hello world</p>`)
+		}
+	}))
+	defer server.Close()
+
+	for _, amp := range []bool{false, true} {
+		client := NewGetClient(HTTPWORKERS, time.Second)
+		client.amp = amp
+		d := NewDispatch(server.URL,
+			WithRate(1000),
+			WithSearchTerms("hello", "world"),
+			WithDispatcherTimeout(200*time.Millisecond),
+			WithClient(client),
+		)
+		results := map[string]Result{}
+		for r := range d.Dispatcher() {
+			results[r.url] = r
+		}
+		if got := results[server.URL].amp; got != server.URL+"/?amp=1" {
+			t.Errorf("amp %t: got amp alternate %q", amp, got)
+		}
+		ampResult, fetched := results[server.URL+"/?amp=1"]
+		if fetched != amp {
+			t.Fatalf("amp %t: AMP page fetched %t", amp, fetched)
+		}
+		if !amp {
+			continue
+		}
+		want := []Violation{{AMPVIOLATION, fmt.Sprintf(`AMP page does not contain "world", found on %s`, server.URL)}}
+		if diff := cmp.Diff(want, ampResult.violations); diff != "" {
+			t.Errorf("violations mismatch (-want +got):\n%s", diff)
+		}
+		if got := d.Stats().Violations; got != 1 {
+			t.Errorf("got %d violations want 1", got)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// anchor.go records the text of the anchors linking to pages and the
+// landmark element, such as nav or footer, enclosing them, so that a
+// broken link can be found on the page linking to it.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// landmarkElements are the html elements reported as enclosing a link
+var landmarkElements = map[string]bool{
+	"header": true, "nav": true, "main": true, "aside": true, "footer": true,
+}
+
+// linkAnchor is the text of an anchor and its innermost enclosing
+// landmark element, if any
+type linkAnchor struct {
+	text    string
+	element string
+}
+
+// String describes a linkAnchor, for example `"Contact us" in footer`
+func (a linkAnchor) String() string {
+	switch {
+	case a.text != "" && a.element != "":
+		return fmt.Sprintf("%q in %s", a.text, a.element)
+	case a.element != "":
+		return "in " + a.element
+	}
+	return fmt.Sprintf("%q", a.text)
+}
+
+// isZero reports whether nothing is known of the anchor
+func (a linkAnchor) isZero() bool {
+	return a == linkAnchor{}
+}
+
+// linkAnchors are the first anchors of the links found on a page, by
+// link
+type linkAnchors map[string]linkAnchor
+
+// anchorText collapses the whitespace of the text of an anchor
+func anchorText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// landmarks is the stack of the landmark elements open at a point in an
+// html page
+type landmarks []string
+
+// open pushes name if it is a landmark element, unless PAGEMAXDEPTH
+// landmark elements are open
+func (l *landmarks) open(name string) {
+	if landmarkElements[name] && len(*l) < PAGEMAXDEPTH {
+		*l = append(*l, name)
+	}
+}
+
+// close pops the innermost open landmark element named name, and any
+// opened within it which were not closed
+func (l *landmarks) close(name string) {
+	if !landmarkElements[name] {
+		return
+	}
+	for i := len(*l) - 1; i >= 0; i-- {
+		if (*l)[i] == name {
+			*l = (*l)[:i]
+			return
+		}
+	}
+}
+
+// innermost returns the innermost open landmark element, or ""
+func (l landmarks) innermost() string {
+	if len(l) == 0 {
+		return ""
+	}
+	return l[len(l)-1]
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLinkAnchorString(t *testing.T) {
+	tests := []struct {
+		anchor linkAnchor
+		want   string
+	}{
+		{linkAnchor{"Contact us", "footer"}, `"Contact us" in footer`},
+		{linkAnchor{"Contact us", ""}, `"Contact us"`},
+		{linkAnchor{"", "nav"}, "in nav"},
+	}
+	for _, tt := range tests {
+		if got := tt.anchor.String(); got != tt.want {
+			t.Errorf("got %s want %s", got, tt.want)
+		}
+	}
+}
+
+func TestLandmarks(t *testing.T) {
+	l := landmarks{}
+	l.open("main")
+	l.open("div")
+	l.open("nav")
+	l.open("aside")
+	if got, want := l.innermost(), "aside"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+	l.close("nav") // also closes the unclosed aside
+	l.close("div")
+	if got, want := l.innermost(), "main"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+	l.close("footer") // not open
+	l.close("main")
+	if got, want := l.innermost(), ""; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestParsePageAnchors(t *testing.T) {
+	body := []byte(`<html><body>
+<header><nav><a href="/about">About
+  us</a></nav></header>
+<main><p><a href="/post"><b>Latest</b> post</a></p>
+<a href="/about">About again</a></main>
+<footer><a href="/contact" aria-label="Contact"><img src="mail.png"></a></footer>
+<a href="/top">Top</a>
+</body></html>`)
+	u, _ := url.Parse("https://e.com/")
+	page, err := parsePage(body, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := linkAnchors{
+		"https://e.com/about":   {"About us", "nav"}, // the first anchor
+		"https://e.com/post":    {"Latest post", "main"},
+		"https://e.com/contact": {"Contact", "footer"},
+		"https://e.com/top":     {"Top", ""},
+	}
+	if diff := cmp.Diff(want, page.anchors, cmp.AllowUnexported(linkAnchor{})); diff != "" {
+		t.Errorf("anchors mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,188 @@
+// apikeys.go restricts serve mode to clients holding an api key, so that
+// a shared webchk service can be exposed to several teams. Each key may
+// be restricted to the sites it can see and to a rate of requests. The
+// dashboard's static assets remain public; the events, reports and
+// history need a key.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrNoAPIKeyValue reports an api key without a value
+	ErrNoAPIKeyValue = errors.New("api key has no key")
+	// ErrDuplicateAPIKey reports an api key given more than once
+	ErrDuplicateAPIKey = errors.New("api key is given more than once")
+	// ErrSiteForbidden reports a request for the results of a site which
+	// the api key may not see
+	ErrSiteForbidden = errors.New("this api key may not see the results of this site")
+)
+
+// APIKeyParam is the query parameter in which clients which cannot set
+// headers, such as the EventSource of a browser, may give their api key
+const APIKeyParam = "key"
+
+// apiKey is a key to the serve mode server. A key without sites may see
+// every site, and a key without a rate may make any number of requests.
+type apiKey struct {
+	Name  string   `yaml:"name"`
+	Key   string   `yaml:"key"`
+	Sites []string `yaml:"sites"` // glob patterns of the base urls
+	Rate  float64  `yaml:"rate"`  // requests a minute
+	limit *rate.Limiter
+}
+
+// allows reports whether the key may see the results of baseURL
+func (k *apiKey) allows(baseURL string) bool {
+	if len(k.Sites) == 0 {
+		return true
+	}
+	for _, pattern := range k.Sites {
+		if ok, _ := path.Match(pattern, baseURL); ok || pattern == baseURL {
+			return true
+		}
+	}
+	return false
+}
+
+// keyring holds the api keys of the server
+type keyring struct {
+	keys []*apiKey
+}
+
+// loadAPIKeys loads the api keys from a yaml file. Each key may make a
+// minute's allowance of requests at once.
+func loadAPIKeys(filename string) (*keyring, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read api keys file: %w", err)
+	}
+	var keys []*apiKey
+	if err := yaml.Unmarshal(contents, &keys); err != nil {
+		return nil, fmt.Errorf("could not parse api keys file: %w", err)
+	}
+	seen := map[string]bool{}
+	for i, k := range keys {
+		switch {
+		case k.Key == "":
+			return nil, fmt.Errorf("api key %d %q: %w", i+1, k.Name, ErrNoAPIKeyValue)
+		case seen[k.Key]:
+			return nil, fmt.Errorf("api key %d %q: %w", i+1, k.Name, ErrDuplicateAPIKey)
+		}
+		seen[k.Key] = true
+		for _, pattern := range k.Sites {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("api key %d %q: site %q: %w", i+1, k.Name, pattern, err)
+			}
+		}
+		if k.Rate > 0 {
+			k.limit = rate.NewLimiter(rate.Limit(k.Rate/60), max(1, int(k.Rate)))
+		}
+	}
+	return &keyring{keys: keys}, nil
+}
+
+// lookup returns the api key of the request, given as a bearer token in
+// the Authorization header, in the X-API-Key header or as the
+// APIKeyParam query parameter, or nil if it has none or an unknown key.
+// Keys are compared in constant time.
+func (kr *keyring) lookup(r *http.Request) *apiKey {
+	given := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		given = bearer
+	}
+	if given == "" {
+		given = r.URL.Query().Get(APIKeyParam)
+	}
+	if given == "" {
+		return nil
+	}
+	var found *apiKey
+	for _, k := range kr.keys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(given)) == 1 {
+			found = k
+		}
+	}
+	return found
+}
+
+// apiKeyContext is the context key of the api key of a request
+type apiKeyContext struct{}
+
+// requireKey serves requests to next only with a known api key within
+// its rate, which is then available to next from requestKey. Without a
+// keyring every request is served.
+func (kr *keyring) requireKey(next http.HandlerFunc) http.HandlerFunc {
+	if kr == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		k := kr.lookup(r)
+		if k == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="webchk"`)
+			http.Error(w, "a valid api key is needed", http.StatusUnauthorized)
+			return
+		}
+		if k.limit != nil {
+			reservation := k.limit.Reserve()
+			if delay := reservation.Delay(); delay > 0 {
+				reservation.Cancel()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				http.Error(w, fmt.Sprintf("api key %q is limited to %g requests a minute", k.Name, k.Rate), http.StatusTooManyRequests)
+				return
+			}
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContext{}, k)))
+	}
+}
+
+// requestKey returns the api key of a request served by requireKey, or
+// nil if the server has no keys
+func requestKey(r *http.Request) *apiKey {
+	k, _ := r.Context().Value(apiKeyContext{}).(*apiKey)
+	return k
+}
+
+// allowsSite reports whether the request may see the results of
+// baseURL
+func allowsSite(r *http.Request, baseURL string) bool {
+	k := requestKey(r)
+	return k == nil || k.allows(baseURL)
+}
+
+// allowsRun reports ErrSiteForbidden if the request may not see the
+// results of run id. Runs which are not found are left to the query of
+// the run to report, while any other error in finding the site of the
+// run is returned, so that the request is refused.
+func allowsRun(h *history, r *http.Request, id int64) error {
+	if requestKey(r) == nil {
+		return nil
+	}
+	var baseURL string
+	err := h.db.QueryRow("SELECT baseurl FROM runs WHERE id = ?", id).Scan(&baseURL)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	case err != nil:
+		return fmt.Errorf("could not find the site of run %d: %w", id, err)
+	}
+	if !allowsSite(r, baseURL) {
+		return fmt.Errorf("run %d of %s: %w", id, baseURL, ErrSiteForbidden)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeAPIKeys writes an api keys file, returning its name
+func writeAPIKeys(t *testing.T, contents string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "keys.yaml")
+	if err := os.WriteFile(filename, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		contents string
+		keys     int
+		err      error
+	}{
+		{"ok", "- {name: ops, key: k1}\n- {name: web, key: k2, sites: ['https://*.example.com'], rate: 30}\n", 2, nil},
+		{"no key", "- {name: ops}\n", 0, ErrNoAPIKeyValue},
+		{"duplicate", "- {name: ops, key: k1}\n- {name: web, key: k1}\n", 0, ErrDuplicateAPIKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := loadAPIKeys(writeAPIKeys(t, tt.contents))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v want %v", err, tt.err)
+			}
+			if err == nil && len(kr.keys) != tt.keys {
+				t.Errorf("got %d want %d keys", len(kr.keys), tt.keys)
+			}
+		})
+	}
+	if _, err := loadAPIKeys(writeAPIKeys(t, "- {name: ops, key: k1, sites: ['[']}\n")); err == nil {
+		t.Error("expected an error for a malformed site pattern")
+	}
+	if _, err := loadAPIKeys(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestAPIKeyAllows(t *testing.T) {
+
+	k := &apiKey{Sites: []string{"https://*.example.com", "https://example.org/blog"}}
+	for baseURL, want := range map[string]bool{
+		"https://www.example.com":  true,
+		"https://example.com":      false,
+		"https://example.org/blog": true,
+		"https://example.org":      false,
+	} {
+		if got := k.allows(baseURL); got != want {
+			t.Errorf("%s got %t want %t", baseURL, got, want)
+		}
+	}
+	if !(&apiKey{}).allows("https://example.net") {
+		t.Error("a key without sites should see every site")
+	}
+}
+
+func TestServerAPIKeys(t *testing.T) {
+
+	keys, err := loadAPIKeys(writeAPIKeys(t, `
+- name: ops
+  key: ops-key
+- name: org
+  key: org-key
+  sites: ["https://example.org"]
+- name: slow
+  key: slow-key
+  rate: 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Output: []string{"sqlite:" + historyDB(t)}}
+	options.Args.BaseURL = "https://example.com"
+	ts := httptest.NewServer(newServer("", options, keys).http.Handler)
+	defer ts.Close()
+
+	get := func(path string, header ...string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header []string
+		status int
+	}{
+		{"dashboard is public", "/", nil, http.StatusOK},
+		{"no key", "/report.json", nil, http.StatusUnauthorized},
+		{"unknown key", "/report.json", []string{"X-API-Key", "nope"}, http.StatusUnauthorized},
+		{"bearer", "/report.json", []string{"Authorization", "Bearer ops-key"}, http.StatusOK},
+		{"header", "/report.csv", []string{"X-API-Key", "ops-key"}, http.StatusOK},
+		{"query", "/report.json?key=ops-key", nil, http.StatusOK},
+		{"other site", "/report.json?key=org-key", nil, http.StatusForbidden},
+		{"other site events", "/events?key=org-key", nil, http.StatusForbidden},
+		{"history no key", "/history/runs", nil, http.StatusUnauthorized},
+		{"run of own site", "/history/runs/2?key=org-key", nil, http.StatusOK},
+		{"run of other site", "/history/runs/1?key=org-key", nil, http.StatusForbidden},
+		{"changes of other site", "/history/runs/3/changes?key=org-key", nil, http.StatusForbidden},
+		{"missing run", "/history/runs/99?key=org-key", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		resp := get(tt.path, tt.header...)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status got %d want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if tt.status == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate header", tt.name)
+		}
+	}
+
+	// the runs listed are those of the sites the key may see
+	for key, want := range map[string]int{"ops-key": 3, "org-key": 1} {
+		resp := get("/history/runs?key=" + key)
+		var runs []runSummary
+		if err := json.NewDecoder(resp.Body).Decode(&runs); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if len(runs) != want {
+			t.Errorf("%s got %d want %d runs", key, len(runs), want)
+		}
+	}
+
+	// the slow key may make two requests at once, and must then wait
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		resp := get("/report.json?key=slow-key")
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("request %d status got %d want %d", i, resp.StatusCode, want)
+		}
+		if want == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != "30" {
+			t.Errorf("Retry-After got %q want 30", resp.Header.Get("Retry-After"))
+		}
+	}
+}
+
+func TestAllowsRunDBError(t *testing.T) {
+
+	h, err := openHistory(historyDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &apiKey{Name: "org", Key: "org-key", Sites: []string{"https://example.org"}}
+	r := httptest.NewRequest("GET", "/history/runs/2", nil)
+	r = r.WithContext(context.WithValue(r.Context(), apiKeyContext{}, key))
+
+	if err := allowsRun(h, r, 2); err != nil {
+		t.Errorf("run of own site: unexpected error %v", err)
+	}
+	if err := allowsRun(h, r, 99); err != nil {
+		t.Errorf("missing run: unexpected error %v", err)
+	}
+	if err := allowsRun(h, r, 1); !errors.Is(err, ErrSiteForbidden) {
+		t.Errorf("run of other site: got %v want %v", err, ErrSiteForbidden)
+	}
+
+	// a failing database refuses the request rather than allowing it
+	if err := h.close(); err != nil {
+		t.Fatal(err)
+	}
+	err = allowsRun(h, r, 1)
+	if err == nil || errors.Is(err, ErrSiteForbidden) {
+		t.Errorf("closed database: got %v want a database error", err)
+	}
+}
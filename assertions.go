@@ -0,0 +1,211 @@
+// assertions.go loads per-url assertions from a yaml file and checks
+// crawled pages against them, allowing webchk to be used as a
+// lightweight site contract tester.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Assertion describes the expectations for urls matching Pattern, a
+// regular expression matched against the full url. A zero Status is
+// not checked. Contains and NotContains are case-insensitive text
+// checks made against the page body. Headers are checks made against
+// the response headers.
+type Assertion struct {
+	Pattern     string            `yaml:"pattern"`
+	Status      int               `yaml:"status"`
+	Contains    []string          `yaml:"contains"`
+	NotContains []string          `yaml:"notcontains"`
+	Headers     []HeaderAssertion `yaml:"headers"`
+	re          *regexp.Regexp
+}
+
+// HeaderAssertion describes the expectations for the response header
+// Name. By default the header must be present; if Absent is set it
+// must not be. Contains is a case-insensitive check of the header
+// value. Param names a numeric parameter within a comma separated
+// header value, such as "max-age" in "public, max-age=3600", which is
+// checked against Min and/or Max.
+type HeaderAssertion struct {
+	Name     string `yaml:"name"`
+	Absent   bool   `yaml:"absent"`
+	Contains string `yaml:"contains"`
+	Param    string `yaml:"param"`
+	Min      *int64 `yaml:"min"`
+	Max      *int64 `yaml:"max"`
+}
+
+// assertions is a slice of Assertion. A url may match more than one
+// Assertion, in which case all matching Assertions are checked.
+type assertions []Assertion
+
+// Violation is a failed assertion. Kind is used to summarise
+// violations, for example "status" or "header Cache-Control".
+type Violation struct {
+	Kind    string
+	Message string
+}
+
+// String prints a Violation
+func (v Violation) String() string {
+	return v.Message
+}
+
+var (
+	// ErrNoAssertionPattern reports an assertion without a pattern
+	ErrNoAssertionPattern = errors.New("assertion has no pattern")
+	// ErrNoHeaderName reports a header assertion without a name
+	ErrNoHeaderName = errors.New("header assertion has no name")
+)
+
+// loadAssertions loads and compiles assertions from a yaml file
+// containing a list of assertions. See the README for an example.
+func loadAssertions(filename string) (assertions, error) {
+	a := assertions{}
+	f, err := os.ReadFile(filename)
+	if err != nil {
+		return a, fmt.Errorf("could not read assertions file: %w", err)
+	}
+	if err := yaml.Unmarshal(f, &a); err != nil {
+		return a, fmt.Errorf("could not parse assertions file: %w", err)
+	}
+	for i := range a {
+		if a[i].Pattern == "" {
+			return a, fmt.Errorf("assertion %d: %w", i+1, ErrNoAssertionPattern)
+		}
+		a[i].re, err = regexp.Compile(a[i].Pattern)
+		if err != nil {
+			return a, fmt.Errorf("assertion %d pattern error: %w", i+1, err)
+		}
+		for _, h := range a[i].Headers {
+			if h.Name == "" {
+				return a, fmt.Errorf("assertion %d: %w", i+1, ErrNoHeaderName)
+			}
+		}
+	}
+	return a, nil
+}
+
+// checkStatus reports violations of the expected status for url
+func (a assertions) checkStatus(url string, status int) []Violation {
+	violations := []Violation{}
+	for _, as := range a {
+		if !as.re.MatchString(url) {
+			continue
+		}
+		if as.Status != 0 && as.Status != status {
+			violations = append(violations, Violation{
+				"status",
+				fmt.Sprintf("status %d want %d (%s)", status, as.Status, as.Pattern),
+			})
+		}
+	}
+	return violations
+}
+
+// checkHeaders reports violations of the header assertions for url
+func (a assertions) checkHeaders(url string, header http.Header) []Violation {
+	violations := []Violation{}
+	for _, as := range a {
+		if !as.re.MatchString(url) {
+			continue
+		}
+		for _, h := range as.Headers {
+			if msg := h.check(header); msg != "" {
+				violations = append(violations, Violation{
+					"header " + http.CanonicalHeaderKey(h.Name),
+					fmt.Sprintf("header %s %s (%s)", http.CanonicalHeaderKey(h.Name), msg, as.Pattern),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// check checks a header assertion against the response headers,
+// returning a description of the problem or an empty string.
+func (h HeaderAssertion) check(header http.Header) string {
+	values, present := header[http.CanonicalHeaderKey(h.Name)]
+	value := strings.Join(values, ", ")
+	switch {
+	case h.Absent && present:
+		return fmt.Sprintf("present %q", value)
+	case h.Absent:
+		return ""
+	case !present:
+		return "missing"
+	}
+	if h.Contains != "" && !strings.Contains(strings.ToLower(value), strings.ToLower(h.Contains)) {
+		return fmt.Sprintf("%q does not contain %q", value, h.Contains)
+	}
+	if h.Param == "" {
+		return ""
+	}
+	n, ok := headerParam(value, h.Param)
+	switch {
+	case !ok:
+		return fmt.Sprintf("%q has no numeric %s", value, h.Param)
+	case h.Min != nil && n < *h.Min:
+		return fmt.Sprintf("%s %d < %d", h.Param, n, *h.Min)
+	case h.Max != nil && n > *h.Max:
+		return fmt.Sprintf("%s %d > %d", h.Param, n, *h.Max)
+	}
+	return ""
+}
+
+// headerParam extracts the numeric parameter param from a comma
+// separated header value such as "public, max-age=3600".
+func headerParam(value, param string) (int64, bool) {
+	for _, part := range strings.Split(value, ",") {
+		k, v, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found || !strings.EqualFold(k, param) {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.Trim(v, `"`), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
+
+// checkBody reports missing required text and present forbidden text
+// in the body of url
+func (a assertions) checkBody(url string, body []byte) []Violation {
+	violations := []Violation{}
+	lowerBody := bytes.ToLower(body)
+	for _, as := range a {
+		if !as.re.MatchString(url) {
+			continue
+		}
+		for _, c := range as.Contains {
+			if !bytes.Contains(lowerBody, bytes.ToLower([]byte(c))) {
+				violations = append(violations, Violation{
+					"missing text",
+					fmt.Sprintf("missing text %q (%s)", c, as.Pattern),
+				})
+			}
+		}
+		for _, c := range as.NotContains {
+			if bytes.Contains(lowerBody, bytes.ToLower([]byte(c))) {
+				violations = append(violations, Violation{
+					"forbidden text",
+					fmt.Sprintf("forbidden text %q (%s)", c, as.Pattern),
+				})
+			}
+		}
+	}
+	return violations
+}
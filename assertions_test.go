@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadAssertions(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		yaml    string
+		number  int
+		wantErr error
+		isErr   bool
+	}{
+		{
+			name: "ok",
+			yaml: `
+- pattern: "/blog/"
+  status: 200
+  contains: ["subscribe"]
+  notcontains: ["lorem ipsum"]
+- pattern: "/old$"
+  status: 404
+`,
+			number: 2,
+		},
+		{
+			name:   "empty",
+			yaml:   "",
+			number: 0,
+		},
+		{
+			name:    "no_pattern",
+			yaml:    "- status: 200\n",
+			wantErr: ErrNoAssertionPattern,
+			isErr:   true,
+		},
+		{
+			name:    "no_header_name",
+			yaml:    "- pattern: \"/\"\n  headers:\n    - contains: \"max-age\"\n",
+			wantErr: ErrNoHeaderName,
+			isErr:   true,
+		},
+		{
+			name:  "bad_regexp",
+			yaml:  "- pattern: \"/blog/[\"\n",
+			isErr: true,
+		},
+		{
+			name:  "bad_yaml",
+			yaml:  "- pattern: [\n",
+			isErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "assertions.yaml")
+			if err := os.WriteFile(filename, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			a, err := loadAssertions(filename)
+			if err != nil {
+				if !tt.isErr {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("got error %v want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if tt.isErr {
+				t.Fatal("expected error")
+			}
+			if got, want := len(a), tt.number; got != want {
+				t.Errorf("got %d want %d assertions", got, want)
+			}
+		})
+	}
+
+	t.Run("no_file", func(t *testing.T) {
+		_, err := loadAssertions(filepath.Join(t.TempDir(), "missing.yaml"))
+		if err == nil {
+			t.Error("expected error for missing file")
+		}
+	})
+}
+
+func TestAssertionChecks(t *testing.T) {
+
+	filename := filepath.Join(t.TempDir(), "assertions.yaml")
+	yaml := `
+- pattern: "/blog/"
+  status: 200
+  contains: ["Subscribe"]
+  notcontains: ["lorem ipsum"]
+- pattern: "/old$"
+  status: 404
+`
+	if err := os.WriteFile(filename, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := loadAssertions(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url        string
+		status     int
+		body       string
+		violations []Violation
+	}{
+		{
+			url:        "https://example.com/about",
+			status:     500,
+			body:       "lorem ipsum",
+			violations: []Violation{}, // no matching assertions
+		},
+		{
+			url:        "https://example.com/blog/1",
+			status:     200,
+			body:       "please SUBSCRIBE",
+			violations: []Violation{},
+		},
+		{
+			url:    "https://example.com/blog/2",
+			status: 200,
+			body:   "Lorem Ipsum",
+			violations: []Violation{
+				{"missing text", `missing text "Subscribe" (/blog/)`},
+				{"forbidden text", `forbidden text "lorem ipsum" (/blog/)`},
+			},
+		},
+		{
+			url:        "https://example.com/old",
+			status:     200,
+			body:       "",
+			violations: []Violation{{"status", "status 200 want 404 (/old$)"}},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			got := a.checkStatus(tt.url, tt.status)
+			got = append(got, a.checkBody(tt.url, []byte(tt.body))...)
+			if diff := cmp.Diff(tt.violations, got); diff != "" {
+				t.Errorf("violations mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHeaderAssertions(t *testing.T) {
+
+	filename := filepath.Join(t.TempDir(), "assertions.yaml")
+	yaml := `
+- pattern: "/static/"
+  headers:
+    - name: cache-control
+      param: max-age
+      min: 86400
+      max: 604800
+    - name: X-Powered-By
+      absent: true
+- pattern: "/"
+  headers:
+    - name: Content-Type
+      contains: "UTF-8"
+`
+	if err := os.WriteFile(filename, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := loadAssertions(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url        string
+		header     http.Header
+		violations []Violation
+	}{
+		{
+			url: "https://example.com/static/1.css",
+			header: http.Header{
+				"Cache-Control": {"public, max-age=86400"},
+				"Content-Type":  {"text/css; charset=utf-8"},
+			},
+			violations: []Violation{},
+		},
+		{
+			url: "https://example.com/static/2.css",
+			header: http.Header{
+				"Cache-Control": {"public, max-age=60"},
+				"Content-Type":  {"text/css; charset=utf-8"},
+				"X-Powered-By":  {"php"},
+			},
+			violations: []Violation{
+				{"header Cache-Control", "header Cache-Control max-age 60 < 86400 (/static/)"},
+				{"header X-Powered-By", `header X-Powered-By present "php" (/static/)`},
+			},
+		},
+		{
+			url: "https://example.com/static/3.css",
+			header: http.Header{
+				"Cache-Control": {"max-age=\"31536000\""},
+				"Content-Type":  {"text/css; charset=utf-8"},
+			},
+			violations: []Violation{
+				{"header Cache-Control", "header Cache-Control max-age 31536000 > 604800 (/static/)"},
+			},
+		},
+		{
+			url: "https://example.com/static/4.css",
+			header: http.Header{
+				"Cache-Control": {"no-store"},
+			},
+			violations: []Violation{
+				{"header Cache-Control", `header Cache-Control "no-store" has no numeric max-age (/static/)`},
+				{"header Content-Type", "header Content-Type missing (/)"},
+			},
+		},
+		{
+			url: "https://example.com/about",
+			header: http.Header{
+				"Content-Type": {"text/html; charset=iso-8859-1"},
+			},
+			violations: []Violation{
+				{"header Content-Type", `header Content-Type "text/html; charset=iso-8859-1" does not contain "UTF-8" (/)`},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			got := a.checkHeaders(tt.url, tt.header)
+			if diff := cmp.Diff(tt.violations, got); diff != "" {
+				t.Errorf("violations mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
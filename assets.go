@@ -0,0 +1,66 @@
+// assets.go extracts links from stylesheets and scripts, so that the
+// images, fonts and other assets they refer to are checked as well as
+// the pages of a site.
+
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// cssURL matches url(...) references in css, quoted or not
+	cssURL = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^'")\s]*))\s*\)`)
+	// cssImport matches @import rules given a quoted url
+	cssImport = regexp.MustCompile(`@import\s+(?:"([^"]*)"|'([^']*)')`)
+	// absoluteURL matches absolute http and https urls, such as those
+	// in string literals in scripts
+	absoluteURL = regexp.MustCompile(`https?://[^\s"'<>\x60\\)]+`)
+)
+
+// assetType returns "css" or "js" for the content types of stylesheets
+// and scripts, or an empty string for other content types
+func assetType(contentType string) string {
+	switch {
+	case strings.Contains(contentType, "text/css"):
+		return "css"
+	case strings.Contains(contentType, "javascript"), strings.Contains(contentType, "ecmascript"):
+		return "js"
+	}
+	return ""
+}
+
+// parseAsset extracts the links from a stylesheet or script of the
+// given content type, resolved against its url, sorted without
+// duplicates. Links in stylesheets are taken from url(...) references
+// and @import rules, while only absolute urls are taken from scripts.
+func parseAsset(body []byte, url *url.URL, contentType string) []string {
+	refs := []string{}
+	switch assetType(contentType) {
+	case "css":
+		for _, re := range []*regexp.Regexp{cssURL, cssImport} {
+			for _, m := range re.FindAllSubmatch(body, -1) {
+				refs = append(refs, string(slices.Concat(m[1:]...))) // only one group matches
+			}
+		}
+	case "js":
+		for _, m := range absoluteURL.FindAll(body, -1) {
+			refs = append(refs, string(m))
+		}
+	}
+	links := []string{}
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || strings.HasPrefix(ref, "data:") {
+			continue
+		}
+		if link, ok := resolveLink(url, ref); ok {
+			links = append(links, link)
+		}
+	}
+	slices.Sort(links)
+	return slices.Compact(links)
+}
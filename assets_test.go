@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAssetType(t *testing.T) {
+
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{"text/css; charset=utf-8", "css"},
+		{"application/javascript", "js"},
+		{"text/javascript", "js"},
+		{"application/ecmascript", "js"},
+		{"text/html", ""},
+		{"image/png", ""},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			if got := assetType(tt.contentType); got != tt.want {
+				t.Errorf("%s got %q want %q", tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAsset(t *testing.T) {
+
+	assetURL, err := url.Parse("https://e.com/css/site.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		body        string
+		contentType string
+		links       []string
+	}{
+		{
+			body:        `body { background: url(../img/bg.png) }`,
+			contentType: "text/css",
+			links:       []string{"https://e.com/img/bg.png"},
+		},
+		{
+			body: `@font-face { src: url("fonts/a.woff2?v=2") format("woff2"), url( 'fonts/a.woff' ) }
+				@import "print.css";
+				@import url(https://cdn.example.com/reset.css);
+				.x { background: url(data:image/png;base64,AAAA) }
+				.y { background: url("../img/bg.png") }`,
+			contentType: "text/css",
+			links: []string{
+				"https://cdn.example.com/reset.css",
+				"https://e.com/css/fonts/a.woff",
+				"https://e.com/css/fonts/a.woff2",
+				"https://e.com/css/print.css",
+				"https://e.com/img/bg.png",
+			},
+		},
+		{
+			body:        `fetch("https://e.com/api/items"); const logo = 'https://e.com/img/logo.svg'; load("/relative.js")`,
+			contentType: "application/javascript",
+			links:       []string{"https://e.com/api/items", "https://e.com/img/logo.svg"},
+		},
+		{
+			body:        `url(a.png)`,
+			contentType: "text/plain",
+			links:       []string{},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			links := parseAsset([]byte(tt.body), assetURL, tt.contentType)
+			if diff := cmp.Diff(tt.links, links); diff != "" {
+				t.Errorf("links mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParsePageAssets(t *testing.T) {
+
+	body := []byte(`<html><head>
+<link rel="stylesheet" href="/css/site.css">
+<script src="/js/app.js"></script>
+</head><body><a href="/about">about</a></body></html>`)
+	pageURL, err := url.Parse("https://e.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := parsePageAssets(body, pageURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := page.links
+	want := []string{"https://e.com/about", "https://e.com/css/site.css", "https://e.com/js/app.js"}
+	if diff := cmp.Diff(want, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+	page, _ = parsePage(body, pageURL, nil)
+	links = page.links
+	if diff := cmp.Diff([]string{"https://e.com/about"}, links); diff != "" {
+		t.Errorf("page links mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetURLAssets(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		fmt.Fprint(w, `body { background: url(/bg.png) }`)
+	}))
+	defer server.Close()
+
+	g := NewGetClient(1, time.Second)
+	r, links := g.getURL(server.URL+"/site.css", "/", nil)
+	if r.err != NonHTMLPageType || len(links) != 0 {
+		t.Errorf("without assets got error %v links %v", r.err, links)
+	}
+
+	g.withAssets()
+	r, links = g.getURL(server.URL+"/site.css", "/", nil)
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if diff := cmp.Diff([]string{server.URL + "/bg.png"}, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := r.size, 33; got != want {
+		t.Errorf("size got %d want %d", got, want)
+	}
+}
+
+func TestFollowURLsNoSkip(t *testing.T) {
+
+	f := followURLs(hostScope("http://x.com"), newVisitedSet(), nil, urlSchemesToFollow)
+	if !f("http://x.com/1.png") {
+		t.Error("png should be followed when no suffixes are skipped")
+	}
+}
@@ -13,6 +13,7 @@ TARGET=$1
 BASEBIN=$2
 
 THISDIR=$(dirname "$0")
+VERSION=$(git describe --tags --always 2>/dev/null || echo development)
 
 LINUX='linux:0:amd64:linux-amd64'
 WIN='windows:0:amd64:win-amd64.exe'
@@ -25,5 +26,5 @@ for II in $LINUX $WIN $MACAMD $MACARM; do
 	arch=$(echo $II | cut -d":" -f3)
 	suffix=$(echo $II | cut -d":" -f4)
 	# echo $os $arch $suffix;
-	GOOS=${os} GOARCH=${arch} CGO_ENABLED=${cgo} go build -o ${THISDIR}/${BASEBIN}-${suffix} ${TARGET}
+	GOOS=${os} GOARCH=${arch} CGO_ENABLED=${cgo} go build -ldflags "-X main.version=${VERSION}" -o ${THISDIR}/${BASEBIN}-${suffix} ${TARGET}
 done
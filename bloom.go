@@ -0,0 +1,93 @@
+// bloom.go provides a VisitedSet using a bloom filter, which records
+// the urls seen during a crawl in a fixed amount of memory at the cost
+// of occasionally skipping a url which has not been seen.
+
+package main
+
+import (
+	"hash/maphash"
+	"math"
+	"strings"
+	"sync/atomic"
+)
+
+// BLOOMFALSEPOSITIVES is the proportion of new urls a bloom filter
+// holding the number of urls it was sized for skips as seen before
+const BLOOMFALSEPOSITIVES = 0.001
+
+// bloomFilter is a VisitedSet holding urls as bits set by k hashes in a
+// bit array of m bits. Urls are compared without a trailing slash.
+type bloomFilter struct {
+	bits         []atomic.Uint64
+	m, k         uint64
+	seed1, seed2 maphash.Seed
+	size         int          // number of urls the filter is sized for
+	count        atomic.Int64 // number of urls added
+}
+
+// newBloomFilter makes a bloomFilter sized to hold n urls with the
+// given false positive rate
+func newBloomFilter(n int, falsePositives float64) *bloomFilter {
+	n = max(n, 1)
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositives) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	return &bloomFilter{
+		bits:  make([]atomic.Uint64, (m+63)/64),
+		m:     m,
+		k:     max(k, 1),
+		seed1: maphash.MakeSeed(),
+		seed2: maphash.MakeSeed(),
+		size:  n,
+	}
+}
+
+// positions calls f with the k bit positions for u, stopping if f
+// returns false
+func (b *bloomFilter) positions(u string, f func(word, mask uint64) bool) {
+	u = strings.TrimSuffix(u, "/")
+	h1, h2 := maphash.String(b.seed1, u), maphash.String(b.seed2, u)|1
+	for i := range b.k {
+		p := (h1 + i*h2) % b.m
+		if !f(p/64, 1<<(p%64)) {
+			return
+		}
+	}
+}
+
+// Follow reports whether u has not been seen before, recording it
+func (b *bloomFilter) Follow(u string) bool {
+	added := false
+	b.positions(u, func(word, mask uint64) bool {
+		for {
+			old := b.bits[word].Load()
+			if old&mask != 0 {
+				return true
+			}
+			if b.bits[word].CompareAndSwap(old, old|mask) {
+				added = true
+				return true
+			}
+		}
+	})
+	if added {
+		b.count.Add(1)
+	}
+	return added
+}
+
+// Seen reports whether u has probably been seen before
+func (b *bloomFilter) Seen(u string) bool {
+	seen := true
+	b.positions(u, func(word, mask uint64) bool {
+		seen = b.bits[word].Load()&mask != 0
+		return seen
+	})
+	return seen
+}
+
+// overfull reports whether the filter holds more urls than it was sized
+// for, so that more new urls than expected are being skipped
+func (b *bloomFilter) overfull() bool {
+	return b.count.Load() > int64(b.size)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/goleak"
+)
+
+func TestBloomFilterSize(t *testing.T) {
+
+	tests := []struct {
+		n    int
+		m, k uint64
+	}{
+		{n: 0, m: 64, k: 44}, // at least one word
+		{n: 1000, m: 14378, k: 10},
+		{n: 1_000_000, m: 14377588, k: 10},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			b := newBloomFilter(tt.n, BLOOMFALSEPOSITIVES)
+			if b.m != tt.m || b.k != tt.k {
+				t.Errorf("got m %d k %d want m %d k %d", b.m, b.k, tt.m, tt.k)
+			}
+			if got, want := len(b.bits), int((tt.m+63)/64); got != want {
+				t.Errorf("got %d want %d words", got, want)
+			}
+		})
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+
+	const n = 10000
+	b := newBloomFilter(n, BLOOMFALSEPOSITIVES)
+	if b.Seen("https://example.com/a") {
+		t.Fatal("empty filter should not have seen url")
+	}
+	if !b.Follow("https://example.com/a/") {
+		t.Error("new url should be followed")
+	}
+	if b.Follow("https://example.com/a") {
+		t.Error("url without slash should have been seen")
+	}
+
+	for i := range n - 1 {
+		b.Follow(fmt.Sprintf("https://example.com/%d", i))
+	}
+	for i := range n - 1 {
+		if u := fmt.Sprintf("https://example.com/%d", i); !b.Seen(u) {
+			t.Fatalf("%s should have been seen", u)
+		}
+	}
+	if b.overfull() {
+		t.Error("filter should not be overfull")
+	}
+
+	// about 10 of these will be false positives
+	falsePositives := 0
+	for i := range n {
+		if b.Seen(fmt.Sprintf("https://example.com/new/%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 3*n*BLOOMFALSEPOSITIVES {
+		t.Errorf("got %d false positives from %d new urls", falsePositives, n)
+	}
+
+	for i := range n / 10 { // false positives are not counted as added
+		b.Follow(fmt.Sprintf("https://example.com/more/%d", i))
+	}
+	if !b.overfull() {
+		t.Error("filter should be overfull")
+	}
+}
+
+func TestDispatcherBloomFilter(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		links := []string{"https://example.com/a", "https://example.com/b", "https://example.com/a/"}
+		return Result{url: url, status: 200, matches: []SearchMatch{}}, links
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	d := NewDispatch("https://example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+		WithVisitedSet(newBloomFilter(100, BLOOMFALSEPOSITIVES)),
+	)
+	urls := []string{}
+	for r := range d.Dispatcher() {
+		urls = append(urls, r.url)
+	}
+	slices.Sort(urls)
+	want := []string{"https://example.com", "https://example.com/a", "https://example.com/b"}
+	if diff := cmp.Diff(want, urls); diff != "" {
+		t.Errorf("urls mismatch (-want +got):\n%s", diff)
+	}
+}
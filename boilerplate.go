@@ -0,0 +1,76 @@
+// boilerplate.go detects the lines of html repeated across many pages
+// of a site, such as navigation and footers, so that matches in them
+// can be excluded.
+
+package main
+
+import (
+	"bytes"
+	"hash/maphash"
+	"sync"
+)
+
+// BOILERPLATEPAGES is the number of pages which must be seen before any
+// line is treated as boilerplate
+const BOILERPLATEPAGES = 10
+
+// boilerplateFilter excludes matches on lines which have been seen on
+// at least fraction of the pages so far. As lines only become
+// boilerplate once they have been seen on enough pages, the first pages
+// of a crawl are matched in full. boilerplateFilter is safe for
+// concurrent use.
+type boilerplateFilter struct {
+	fraction float64
+	seed     maphash.Seed
+	mu       sync.Mutex
+	pages    int
+	lines    map[uint64]int // pages seen by line hash
+}
+
+// newBoilerplateFilter makes a new boilerplateFilter for lines repeated
+// on fraction of the pages, or nil if fraction is not positive
+func newBoilerplateFilter(fraction float64) *boilerplateFilter {
+	if fraction <= 0 {
+		return nil
+	}
+	return &boilerplateFilter{fraction: fraction, seed: maphash.MakeSeed(), lines: map[uint64]int{}}
+}
+
+// filter records the lines of a page, returning the matches which are
+// not on boilerplate lines. Lines are compared without leading or
+// trailing space, and blank lines are ignored.
+func (b *boilerplateFilter) filter(body []byte, matches []SearchMatch) []SearchMatch {
+	if b == nil {
+		return matches
+	}
+	hashes := map[int]uint64{} // by line number
+	unique := map[uint64]bool{}
+	for i, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		h := maphash.Bytes(b.seed, line)
+		hashes[i+1] = h
+		unique[h] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pages++
+	for h := range unique {
+		b.lines[h]++
+	}
+	if b.pages < BOILERPLATEPAGES {
+		return matches
+	}
+	threshold := b.fraction * float64(b.pages)
+	kept := []SearchMatch{}
+	for _, m := range matches {
+		if h, ok := hashes[m.line]; ok && float64(b.lines[h]) >= threshold {
+			continue // boilerplate
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBoilerplateFilter(t *testing.T) {
+
+	// every page has the footer and every other page the banner, each
+	// with a match, and a line of content of its own with a match
+	page := func(i int) ([]byte, []SearchMatch) {
+		banner := ""
+		if i%2 == 0 {
+			banner = "<p>welcome banner</p>"
+		}
+		body := fmt.Sprintf("<html>\n%s\n<p>welcome to page %d</p>\n  <footer>welcome</footer>\n</html>", banner, i)
+		return []byte(body), []SearchMatch{{2, "welcome", 0}, {3, "welcome", 0}, {4, "welcome", 0}}
+	}
+	lines := func(matches []SearchMatch) []int {
+		l := []int{}
+		for _, m := range matches {
+			l = append(l, m.line)
+		}
+		return l
+	}
+
+	tests := []struct {
+		fraction float64
+		want     []int // lines matched on the last page
+	}{
+		{0.9, []int{2, 3}},
+		{0.5, []int{3}},
+		{1, []int{2, 3}},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			b := newBoilerplateFilter(tt.fraction)
+			for p := range BOILERPLATEPAGES - 1 {
+				body, matches := page(p)
+				if got := b.filter(body, matches); len(got) != len(matches) {
+					t.Fatalf("page %d got %v before boilerplate is detected", p, lines(got))
+				}
+			}
+			body, matches := page(BOILERPLATEPAGES * 2) // with the banner
+			got := lines(b.filter(body, matches))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got lines %v want %v", got, tt.want)
+			}
+		})
+	}
+
+	var none *boilerplateFilter
+	if got := none.filter([]byte("x"), []SearchMatch{{1, "x", 0}}); len(got) != 1 {
+		t.Errorf("nil filter dropped matches")
+	}
+}
@@ -0,0 +1,88 @@
+// budget.go provides a URLFilter limiting the number of urls followed
+// under particular paths, so that noisy sections of a site such as tag
+// pages or archives do not dominate a crawl.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrBudgetFormat reports a budget which is not of the form prefix=n
+var ErrBudgetFormat = errors.New("budget should be a path prefix starting with / and a count of 0 or more, for example /blog/=200")
+
+// budget is the limit on urls followed under a path prefix
+type budget struct {
+	prefix   string
+	limit    int
+	followed int
+	skipped  int
+}
+
+// budgetFilter is a URLFilter which follows at most a limited number of
+// urls whose path starts with each budget's prefix. Where more than one
+// prefix matches, the longest is used. Urls not matching any prefix are
+// always followed. A budgetFilter is not safe for concurrent use, which
+// is not needed as the Dispatcher consults filters from a single
+// goroutine.
+type budgetFilter struct {
+	budgets []*budget // longest prefix first
+}
+
+// newBudgetFilter makes a budgetFilter from specifications of the form
+// prefix=n
+func newBudgetFilter(specs []string) (*budgetFilter, error) {
+	b := &budgetFilter{}
+	for _, spec := range specs {
+		prefix, count, ok := strings.Cut(spec, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("budget %q: %w", spec, ErrBudgetFormat)
+		}
+		limit, err := strconv.Atoi(count)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("budget %q: %w", spec, ErrBudgetFormat)
+		}
+		b.budgets = append(b.budgets, &budget{prefix: prefix, limit: limit})
+	}
+	sort.SliceStable(b.budgets, func(i, j int) bool {
+		return len(b.budgets[i].prefix) > len(b.budgets[j].prefix)
+	})
+	return b, nil
+}
+
+// Follow reports whether the budget for the path of u, if any, has not
+// yet been used up
+func (b *budgetFilter) Follow(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return true // leave bad urls to be reported when fetched
+	}
+	for _, bg := range b.budgets {
+		if !strings.HasPrefix(parsed.Path, bg.prefix) {
+			continue
+		}
+		if bg.followed >= bg.limit {
+			bg.skipped++
+			return false
+		}
+		bg.followed++
+		return true
+	}
+	return true
+}
+
+// report writes a line to w for each budget which was used up, with the
+// number of urls skipped as a result
+func (b *budgetFilter) report(w io.Writer) {
+	for _, bg := range b.budgets {
+		if bg.skipped > 0 {
+			fmt.Fprintf(w, "budget %s=%d used up: %d urls skipped\n", bg.prefix, bg.limit, bg.skipped)
+		}
+	}
+}
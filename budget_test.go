@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewBudgetFilter(t *testing.T) {
+
+	tests := []struct {
+		specs []string
+		isErr bool
+	}{
+		{specs: nil},
+		{specs: []string{"/blog/=200", "/tags/=0"}},
+		{specs: []string{"/blog/"}, isErr: true},
+		{specs: []string{"blog/=200"}, isErr: true},
+		{specs: []string{"/blog/=many"}, isErr: true},
+		{specs: []string{"/blog/=-1"}, isErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			_, err := newBudgetFilter(tt.specs)
+			if err != nil {
+				if !tt.isErr {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if !errors.Is(err, ErrBudgetFormat) {
+					t.Errorf("got error %v want %v", err, ErrBudgetFormat)
+				}
+				return
+			}
+			if tt.isErr {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestBudgetFilter(t *testing.T) {
+
+	b, err := newBudgetFilter([]string{"/blog/=2", "/blog/tags/=1", "/archive=0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls := []string{
+		"https://example.com/about",
+		"https://example.com/blog/a",
+		"https://example.com/blog/tags/x",
+		"https://example.com/blog/tags/y", // tags budget used up
+		"https://example.com/blog/b",
+		"https://example.com/blog/c", // blog budget used up
+		"https://example.com/archive/2020",
+		"https://example.com/contact",
+	}
+	got := []bool{}
+	for _, u := range urls {
+		got = append(got, b.Follow(u))
+	}
+	want := []bool{true, true, true, false, true, false, false, true}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("follow mismatch (-want +got):\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	b.report(&buf)
+	wantReport := `budget /blog/tags/=1 used up: 1 urls skipped
+budget /archive=0 used up: 1 urls skipped
+budget /blog/=2 used up: 1 urls skipped
+`
+	if diff := cmp.Diff(wantReport, buf.String()); diff != "" {
+		t.Errorf("report mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,260 @@
+// cache.go provides an http.RoundTripper caching responses on disk and
+// honouring Cache-Control, so that repeated crawls reuse responses which
+// are still fresh and revalidate stale ones with conditional requests.
+// The Cache interface and on-disk format, responses dumped by
+// httputil.DumpResponse in files named by the md5 of the url, match
+// those of github.com/gregjones/httpcache and its diskcache, so the two
+// can share a cache directory. Pages fetched with an Accept-Language
+// header are stored by the url and language, as their content differs
+// for each language.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XFROMCACHE is the header set on responses served from the cache
+const XFROMCACHE = "X-From-Cache"
+
+// Cache stores responses by key
+type Cache interface {
+	Get(key string) (resp []byte, ok bool)
+	Set(key string, resp []byte)
+	Delete(key string)
+}
+
+// diskCache is a Cache storing each response in a file in dir
+type diskCache struct {
+	dir string
+}
+
+// newDiskCache makes a diskCache in dir, creating it if necessary
+func newDiskCache(dir string) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not make cache directory: %w", err)
+	}
+	return &diskCache{dir: dir}, nil
+}
+
+// filename returns the name of the file for key
+func (c *diskCache) filename(key string) string {
+	sum := md5.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns the response stored for key, if any
+func (c *diskCache) Get(key string) ([]byte, bool) {
+	resp, err := os.ReadFile(c.filename(key))
+	return resp, err == nil
+}
+
+// Set stores resp for key, replacing the file atomically as workers
+// share the cache. A response which cannot be stored is simply not
+// cached.
+func (c *diskCache) Set(key string, resp []byte) {
+	f, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(resp)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.filename(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// Delete removes the response stored for key
+func (c *diskCache) Delete(key string) {
+	os.Remove(c.filename(key))
+}
+
+// cachingTransport is an http.RoundTripper serving GET requests from a
+// Cache while the cached responses are fresh according to their
+// Cache-Control or Expires headers, and otherwise revalidating them
+// with their ETag or Last-Modified validators
+type cachingTransport struct {
+	transport http.RoundTripper
+	cache     Cache
+	now       func() time.Time
+}
+
+// newCachingTransport makes a cachingTransport caching the responses
+// from transport, or http.DefaultTransport if transport is nil
+func newCachingTransport(transport http.RoundTripper, cache Cache) *cachingTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &cachingTransport{transport: transport, cache: cache, now: time.Now}
+}
+
+// RoundTrip meets the http.RoundTripper interface
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.transport.RoundTrip(req)
+	}
+	key := cacheKey(req)
+
+	cached := t.cached(key, req)
+	if cached != nil {
+		if t.fresh(req, cached) {
+			cached.Header.Set(XFROMCACHE, "1")
+			return cached, nil
+		}
+		// revalidate the stale response, on a copy of the request
+		req = req.Clone(req.Context())
+		if etag := cached.Header.Get("Etag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			req.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		// refresh the cached response with the revalidated headers
+		for name, values := range resp.Header {
+			if !hopByHopHeader(name) {
+				cached.Header[name] = values
+			}
+		}
+		cached.Header.Del(XFROMCACHE)
+		t.store(key, cached)
+		cached.Header.Set(XFROMCACHE, "1")
+		return cached, nil
+	}
+	if resp.StatusCode == http.StatusOK && storable(resp) {
+		t.store(key, resp)
+	} else {
+		t.cache.Delete(key)
+	}
+	return resp, nil
+}
+
+// cacheKey returns the key a response to the GET request req is cached
+// by: its url, followed by its Accept-Language header if it has one
+func cacheKey(req *http.Request) string {
+	key := req.URL.String()
+	if language := req.Header.Get("Accept-Language"); language != "" {
+		key += " " + language
+	}
+	return key
+}
+
+// cached returns the cached response for key, if any
+func (t *cachingTransport) cached(key string, req *http.Request) *http.Response {
+	b, ok := t.cache.Get(key)
+	if !ok {
+		return nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+	if err != nil {
+		t.cache.Delete(key)
+		return nil
+	}
+	return resp
+}
+
+// store stores resp, whose body is read and replaced
+func (t *cachingTransport) store(key string, resp *http.Response) {
+	b, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+	t.cache.Set(key, b)
+}
+
+// fresh reports whether the cached response may be used without
+// revalidation
+func (t *cachingTransport) fresh(req *http.Request, resp *http.Response) bool {
+	reqCC, respCC := cacheControl(req.Header), cacheControl(resp.Header)
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	if _, ok := respCC["no-cache"]; ok {
+		return false
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return false
+	}
+	age := t.now().Sub(date)
+
+	var lifetime time.Duration
+	if maxAge, ok := respCC["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return false
+		}
+		lifetime = time.Duration(seconds) * time.Second
+	} else if expires, err := http.ParseTime(resp.Header.Get("Expires")); err == nil {
+		lifetime = expires.Sub(date)
+	}
+	if maxAge, ok := reqCC["max-age"]; ok {
+		if seconds, err := strconv.Atoi(maxAge); err == nil {
+			lifetime = min(lifetime, time.Duration(seconds)*time.Second)
+		}
+	}
+	return lifetime > age
+}
+
+// storable reports whether a response may be cached: it must not be
+// marked no-store and must vary only by request headers which are
+// always the same for a crawl
+func storable(resp *http.Response) bool {
+	if _, ok := cacheControl(resp.Header)["no-store"]; ok {
+		return false
+	}
+	if resp.Request != nil {
+		if _, ok := cacheControl(resp.Request.Header)["no-store"]; ok {
+			return false
+		}
+	}
+	return resp.Header.Get("Vary") != "*"
+}
+
+// cacheControl parses the Cache-Control directives in header
+func cacheControl(header http.Header) map[string]string {
+	cc := map[string]string{}
+	for _, part := range strings.Split(header.Get("Cache-Control"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return cc
+}
+
+// hopByHopHeader reports whether header applies only to a single
+// connection, and so is not stored
+func hopByHopHeader(header string) bool {
+	switch http.CanonicalHeaderKey(header) {
+	case "Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+		"Te", "Trailers", "Transfer-Encoding", "Upgrade":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+
+	dir := filepath.Join(t.TempDir(), "cache")
+	c, err := newDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("https://example.com"); ok {
+		t.Error("empty cache should miss")
+	}
+	c.Set("https://example.com", []byte("response"))
+	if got, ok := c.Get("https://example.com"); !ok || string(got) != "response" {
+		t.Errorf("got %q %t", got, ok)
+	}
+	// httpcache's diskcache names files by the md5 of the key
+	if _, err := os.Stat(filepath.Join(dir, "c984d06aafbecf6bc55569f964148ea3")); err != nil {
+		t.Error(err)
+	}
+	c.Delete("https://example.com")
+	if _, ok := c.Get("https://example.com"); ok {
+		t.Error("deleted key should miss")
+	}
+}
+
+func TestCachingTransport(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		header    map[string]string
+		requests  int  // requests reaching the server for two gets
+		fromCache bool // for the second get
+	}{
+		{"fresh", map[string]string{"Cache-Control": "max-age=60"}, 1, true},
+		{"expires", map[string]string{"Expires": time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}, 1, true},
+		{"revalidate etag", map[string]string{"Cache-Control": "no-cache", "Etag": `"v1"`}, 2, true},
+		{"revalidate last modified", map[string]string{"Last-Modified": "Wed, 01 May 2024 12:00:00 GMT"}, 2, true},
+		{"changed", map[string]string{"Cache-Control": "max-age=0"}, 2, false},
+		{"no store", map[string]string{"Cache-Control": "no-store, max-age=60"}, 2, false},
+		{"vary", map[string]string{"Cache-Control": "max-age=60", "Vary": "*"}, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				modified := tt.header["Last-Modified"]
+				if r.Header.Get("If-None-Match") == `"v1"` ||
+					(modified != "" && r.Header.Get("If-Modified-Since") == modified) {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				fmt.Fprintf(w, "response %d", requests)
+			}))
+			defer server.Close()
+
+			cache, err := newDiskCache(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: newCachingTransport(nil, cache)}
+			var resp *http.Response
+			var body []byte
+			for range 2 {
+				resp, err = client.Get(server.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if requests != tt.requests {
+				t.Errorf("got %d want %d requests to the server", requests, tt.requests)
+			}
+			if got := resp.Header.Get(XFROMCACHE) == "1"; got != tt.fromCache {
+				t.Errorf("from cache got %t want %t", got, tt.fromCache)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("got status %d", resp.StatusCode)
+			}
+			want := fmt.Sprintf("response %d", tt.requests)
+			if tt.fromCache {
+				want = "response 1"
+			}
+			if string(body) != want {
+				t.Errorf("got body %q want %q", body, want)
+			}
+		})
+	}
+}
+
+func TestCachingTransportStale(t *testing.T) {
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprintf(w, "response %d", requests)
+	}))
+	defer server.Close()
+
+	cache, err := newDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := newCachingTransport(nil, cache)
+	client := &http.Client{Transport: transport}
+	for i, advance := range []time.Duration{0, 30 * time.Second, 2 * time.Minute} {
+		transport.now = func() time.Time { return time.Now().Add(advance) }
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got, want := requests, []int{1, 1, 2}[i]; got != want {
+			t.Errorf("after %s got %d want %d requests", advance, got, want)
+		}
+	}
+}
+
+func TestCachingTransportLanguages(t *testing.T) {
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "response in %q", r.Header.Get("Accept-Language"))
+	}))
+	defer server.Close()
+
+	cache, err := newDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: newCachingTransport(nil, cache)}
+	for _, language := range []string{"de", "en", "", "de", "en", ""} {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if language != "" {
+			req.Header.Set("Accept-Language", language)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if got, want := string(body), fmt.Sprintf("response in %q", language); got != want {
+			t.Errorf("got %s want %s", got, want)
+		}
+	}
+	if got, want := requests, 3; got != want {
+		t.Errorf("got %d want %d requests to the server", got, want)
+	}
+}
@@ -0,0 +1,248 @@
+// changes.go monitors a site for changes. A checksum of the normalised
+// visible text of each page is recorded with the sqlite output, and the
+// pages which changed, were added or were removed since the previous
+// run of the site are reported from the database, so that a site can
+// be watched for changes without any search terms. The visible text
+// itself may also be recorded, to show the changes to each page as a
+// unified diff.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// contentChecksum returns the hex encoded sha256 checksum of the
+// visible text of an html page, with runs of whitespace made single
+// spaces, so that changes to markup alone do not change it
+func contentChecksum(body []byte) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(visibleText(body)), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// pageChanges are the urls whose pages changed, were added or were
+// removed in a run since the previous run of the same site, each sorted
+type pageChanges struct {
+	Run      int64    `json:"run"`
+	Previous int64    `json:"previous"` // 0 if there is no previous run
+	Changed  []string `json:"changed"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	// Diffs are the unified diffs of the visible text of the changed
+	// pages, by url, for pages whose text was recorded in both runs
+	Diffs map[string]string `json:"diffs,omitempty"`
+}
+
+// latestRun returns the id of the latest run of baseURL
+func (h *history) latestRun(baseURL string) (int64, error) {
+	var id int64
+	err := h.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM runs WHERE baseurl = ?", baseURL).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("history query error: %w", err)
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("run of %s: %w", baseURL, ErrRunNotFound)
+	}
+	return id, nil
+}
+
+// checksums returns the checksums of the results of run id by url,
+// which are empty for results without a checksum
+func (h *history) checksums(id int64) (map[string]string, error) {
+	checksum := "''"
+	if ok, err := hasColumn(h.db, "results", "checksum"); err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	} else if ok {
+		checksum = "COALESCE(checksum, '')"
+	}
+	rows, err := h.db.Query("SELECT url, "+checksum+" FROM results WHERE run_id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	}
+	defer rows.Close()
+	sums := map[string]string{}
+	for rows.Next() {
+		var url, sum string
+		if err := rows.Scan(&url, &sum); err != nil {
+			return nil, fmt.Errorf("history query error: %w", err)
+		}
+		sums[url] = sum
+	}
+	return sums, rows.Err()
+}
+
+// changes returns the changes in run id since the previous run of the
+// same site. Pages are only compared if both runs recorded a checksum.
+func (h *history) changes(id int64) (pageChanges, error) {
+	c := pageChanges{Run: id, Changed: []string{}, Added: []string{}, Removed: []string{}}
+	var baseURL string
+	err := h.db.QueryRow("SELECT baseurl FROM runs WHERE id = ?", id).Scan(&baseURL)
+	if err != nil {
+		return c, fmt.Errorf("run %d: %w", id, ErrRunNotFound)
+	}
+	err = h.db.QueryRow(
+		"SELECT COALESCE(MAX(id), 0) FROM runs WHERE baseurl = ? AND id < ?", baseURL, id,
+	).Scan(&c.Previous)
+	if err != nil {
+		return c, fmt.Errorf("history query error: %w", err)
+	}
+	if c.Previous == 0 {
+		return c, nil
+	}
+	current, err := h.checksums(id)
+	if err != nil {
+		return c, err
+	}
+	previous, err := h.checksums(c.Previous)
+	if err != nil {
+		return c, err
+	}
+	for url, sum := range current {
+		before, ok := previous[url]
+		switch {
+		case !ok:
+			c.Added = append(c.Added, url)
+		case sum != "" && before != "" && sum != before:
+			c.Changed = append(c.Changed, url)
+		}
+	}
+	for url := range previous {
+		if _, ok := current[url]; !ok {
+			c.Removed = append(c.Removed, url)
+		}
+	}
+	slices.Sort(c.Changed)
+	slices.Sort(c.Added)
+	slices.Sort(c.Removed)
+	return c, h.diffs(&c)
+}
+
+// text returns the visible text recorded for url in run id as lines, or
+// nil if none was recorded
+func (h *history) text(id int64, url string) ([]string, error) {
+	var text string
+	err := h.db.QueryRow(
+		"SELECT COALESCE(text, '') FROM results WHERE run_id = ? AND url = ?", id, url,
+	).Scan(&text)
+	if err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	}
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+// diffs adds the unified diffs of the text of the changed pages of c
+// recorded in both runs
+func (h *history) diffs(c *pageChanges) error {
+	if ok, err := hasColumn(h.db, "results", "text"); err != nil || !ok {
+		return err
+	}
+	for _, url := range c.Changed {
+		before, err := h.text(c.Previous, url)
+		if err != nil {
+			return err
+		}
+		after, err := h.text(c.Run, url)
+		if err != nil {
+			return err
+		}
+		if before == nil || after == nil {
+			continue
+		}
+		if c.Diffs == nil {
+			c.Diffs = map[string]string{}
+		}
+		c.Diffs[url] = unifiedDiff(
+			fmt.Sprintf("%s\trun %d", url, c.Previous),
+			fmt.Sprintf("%s\trun %d", url, c.Run),
+			before, after,
+		)
+	}
+	return nil
+}
+
+// writeDiffs writes the diffs of the changed pages to the file
+// filename, in the order of their urls
+func (c pageChanges) writeDiffs(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("could not create diff file: %w", err)
+	}
+	for _, url := range c.Changed {
+		if _, err := io.WriteString(f, c.Diffs[url]); err != nil {
+			f.Close()
+			return fmt.Errorf("could not write diff file: %w", err)
+		}
+	}
+	return f.Close()
+}
+
+// write writes a summary of the changes to w, followed by a line for
+// each page marked "~" if changed, "+" if added and "-" if removed
+func (c pageChanges) write(w io.Writer, baseURL string) error {
+	if c.Previous == 0 {
+		_, err := fmt.Fprintf(w, "no previous run of %s to compare with\n", baseURL)
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "changes to %s since run %d: %d changed, %d added, %d removed\n",
+		baseURL, c.Previous, len(c.Changed), len(c.Added), len(c.Removed))
+	for _, l := range []struct {
+		mark string
+		urls []string
+	}{{"~", c.Changed}, {"+", c.Added}, {"-", c.Removed}} {
+		for _, u := range l.urls {
+			fmt.Fprintf(&b, "%s %s\n", l.mark, u)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// reportChanges writes the changes in the latest run of baseURL recorded
+// in the sqlite database at filename to w and, unless diffFile is "",
+// the diffs of the text of the changed pages to diffFile
+func reportChanges(w io.Writer, filename, baseURL, diffFile string) error {
+	h, err := openHistory(filename)
+	if err != nil {
+		return err
+	}
+	defer h.close()
+	id, err := h.latestRun(baseURL)
+	if err != nil {
+		return err
+	}
+	c, err := h.changes(id)
+	if err != nil {
+		return err
+	}
+	if diffFile != "" {
+		if err := c.writeDiffs(diffFile); err != nil {
+			return err
+		}
+	}
+	return c.write(w, baseURL)
+}
+
+// historyChanges returns the changes in the run given by the id path
+// parameter since the previous run
+func historyChanges(h *history, r *http.Request) (any, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("run %q: %w", r.PathValue("id"), ErrRunNotFound)
+	}
+	if err := allowsRun(h, r, id); err != nil {
+		return nil, err
+	}
+	return h.changes(id)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestContentChecksum(t *testing.T) {
+	page := contentChecksum([]byte(`<html><body><p>Hello   there</p><script>x = 1</script></body></html>`))
+	tests := []struct {
+		body string
+		same bool
+	}{
+		{`<html><body><div class="new"><p>Hello</p>
+			there</div></body></html>`, true}, // markup and whitespace only
+		{`<html><body><p>Hello there</p><script>x = 2</script></body></html>`, true},
+		{`<html><body><p>Hello where</p></body></html>`, false},
+	}
+	for i, tt := range tests {
+		if got := contentChecksum([]byte(tt.body)) == page; got != tt.same {
+			t.Errorf("test %d got same %t want %t", i, got, tt.same)
+		}
+	}
+}
+
+// changesDB makes a database with a run of example.com for each map of
+// checksums by url
+func changesDB(t *testing.T, runs ...map[string]string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "webchk.db")
+	for _, run := range runs {
+		options := Options{}
+		options.Args.BaseURL = "https://example.com"
+		sink, err := newSQLiteSink(filename, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := make(chan Result, len(run))
+		for url, checksum := range run {
+			results <- Result{url: url, checksum: checksum}
+		}
+		close(results)
+		if _, err := drain(results, sink, fakeStatser{Start: time.Now(), End: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filename
+}
+
+func TestChanges(t *testing.T) {
+
+	filename := changesDB(t,
+		map[string]string{"/": "a", "/about": "b", "/old": "c", "/pdf": ""},
+		map[string]string{"/": "a", "/about": "B", "/new": "d", "/pdf": ""},
+	)
+	h, err := openHistory(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+
+	id, err := h.latestRun("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := h.changes(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pageChanges{
+		Run:      2,
+		Previous: 1,
+		Changed:  []string{"/about"},
+		Added:    []string{"/new"},
+		Removed:  []string{"/old"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("changes mismatch (-want +got):\n%s", diff)
+	}
+
+	first, err := h.changes(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := first.Previous, int64(0); got != want {
+		t.Errorf("first run previous got %d want %d", got, want)
+	}
+	if _, err := h.changes(99); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("got error %v want %v", err, ErrRunNotFound)
+	}
+	if _, err := h.latestRun("https://example.org"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("got error %v want %v", err, ErrRunNotFound)
+	}
+}
+
+func TestReportChanges(t *testing.T) {
+
+	tests := []struct {
+		runs []map[string]string
+		want string
+	}{
+		{
+			runs: []map[string]string{{"/": "a"}},
+			want: "no previous run of https://example.com to compare with\n",
+		},
+		{
+			runs: []map[string]string{{"/": "a", "/b": "b"}, {"/": "x", "/c": "c"}},
+			want: "changes to https://example.com since run 1: 1 changed, 1 added, 1 removed\n" +
+				"~ /\n+ /c\n- /b\n",
+		},
+	}
+	for i, tt := range tests {
+		var buf bytes.Buffer
+		if err := reportChanges(&buf, changesDB(t, tt.runs...), "https://example.com", ""); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tt.want, buf.String()); diff != "" {
+			t.Errorf("test %d report mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestChangesDiff(t *testing.T) {
+
+	filename := filepath.Join(t.TempDir(), "webchk.db")
+	for _, text := range []string{"Welcome\nOpen 9 to 5", "Welcome\nOpen 10 to 4"} {
+		options := Options{}
+		options.Args.BaseURL = "https://example.com"
+		sink, err := newSQLiteSink(filename, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := make(chan Result, 1)
+		results <- Result{url: "/", checksum: text, text: text}
+		close(results)
+		if _, err := drain(results, sink, fakeStatser{Start: time.Now(), End: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diffFile := filepath.Join(t.TempDir(), "changes.diff")
+	var buf bytes.Buffer
+	if err := reportChanges(&buf, filename, "https://example.com", diffFile); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(diffFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- /\trun 1\n+++ /\trun 2\n@@ -1,2 +1,2 @@\n Welcome\n-Open 9 to 5\n+Open 10 to 4\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("diff mismatch (-want +got):\n%s", diff)
+	}
+}
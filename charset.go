@@ -0,0 +1,30 @@
+// charset.go decodes pages from a character set given on the command
+// line, whatever the charset a site declares, so that legacy sites
+// which mislabel their encoding can be searched accurately.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/html/charset"
+)
+
+// ErrUnknownCharset reports a charset which is not known
+var ErrUnknownCharset = errors.New("unknown charset; use a name or label such as windows-1252, iso-8859-15 or shift_jis")
+
+// charsetDecoder decodes a page from a charset to utf-8
+type charsetDecoder func(body []byte) ([]byte, error)
+
+// newCharsetDecoder makes a charsetDecoder for the charset with the
+// WHATWG name or label given, such as latin1 for windows-1252
+func newCharsetDecoder(label string) (charsetDecoder, error) {
+	e, _ := charset.Lookup(label)
+	if e == nil {
+		return nil, fmt.Errorf("charset %q: %w", label, ErrUnknownCharset)
+	}
+	return func(body []byte) ([]byte, error) {
+		return e.NewDecoder().Bytes(body)
+	}, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewCharsetDecoder(t *testing.T) {
+	for _, tt := range []struct{ label, in, want string }{
+		{"windows-1252", "caf\xe9 \x93quoted\x94", "café “quoted”"},
+		{"latin1", "caf\xe9", "café"}, // a label of windows-1252
+		{"ISO-8859-15", "\xa4", "€"},
+		{"shift_jis", "\x93\xfa\x96\x7b", "日本"},
+		{"utf-8", "café", "café"},
+	} {
+		decode, err := newCharsetDecoder(tt.label)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.label, err)
+		}
+		got, err := decode([]byte(tt.in))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.label, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q want %q", tt.label, got, tt.want)
+		}
+	}
+	if _, err := newCharsetDecoder("klingon"); !errors.Is(err, ErrUnknownCharset) {
+		t.Errorf("got error %v want %v", err, ErrUnknownCharset)
+	}
+}
+
+func TestGetURLAssumedCharset(t *testing.T) {
+
+	// a windows-1252 page claiming to be utf-8
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<p>menu</p>\n<p>caf\xe9 cr\xe8me</p>")
+	}))
+	defer server.Close()
+
+	g := NewGetClient(1, 0)
+	result, _ := g.get(server.URL, "/", []string{"café"})
+	if got := len(result.matches); got != 0 {
+		t.Errorf("got %d matches in the undecoded page want 0", got)
+	}
+
+	g.decode, _ = newCharsetDecoder("windows-1252")
+	result, _ = g.get(server.URL, "/", []string{"café", "CRÈME"})
+	want := []SearchMatch{{2, "café", 15}, {2, "CRÈME", 21}}
+	if diff := cmp.Diff(want, result.matches, cmp.AllowUnexported(SearchMatch{})); diff != "" {
+		t.Errorf("matches mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClickHouseSink(t *testing.T) {
+
+	var mu sync.Mutex
+	queries := []string{}
+	rows := map[string][]map[string]any{}
+	httpHandler := http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if got, want := r.URL.Query().Get("database"), "analytics"; got != want {
+				t.Errorf("database got %q want %q", got, want)
+			}
+			query := r.URL.Query().Get("query")
+			queries = append(queries, query)
+			table, ok := strings.CutPrefix(query, "INSERT INTO ")
+			if !ok {
+				return
+			}
+			table, _, _ = strings.Cut(table, " ")
+			scanner := bufio.NewScanner(r.Body)
+			for scanner.Scan() {
+				row := map[string]any{}
+				if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+					t.Errorf("could not decode row %q: %v", scanner.Text(), err)
+				}
+				rows[table] = append(rows[table], row)
+			}
+		},
+	)
+	server := httptest.NewServer(httpHandler)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 300 * time.Millisecond}
+	options := Options{Tags: []string{"env=prod"}}
+	sink, err := newClickHouseSink(client, server.URL+"/?database=analytics", options)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := len(queries), len(clickhouseSchema); got != want {
+		t.Fatalf("got %d want %d schema queries", got, want)
+	}
+	if _, err := drain(testResults(), sink, fakeStatser{Pages: 3, Termination: TerminationIdle}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := queries[len(queries)-1], "INSERT INTO webchk_runs FORMAT JSONEachRow"; got != want {
+		t.Errorf("last query got %q want %q", got, want)
+	}
+	if got, want := len(rows["webchk_results"]), 3; got != want {
+		t.Fatalf("got %d want %d results", got, want)
+	}
+	if got, want := rows["webchk_results"][1]["status"], float64(404); got != want {
+		t.Errorf("status got %v want %v", got, want)
+	}
+	if got, want := fmt.Sprint(rows["webchk_results"][0]["tags"]), "map[env:prod]"; got != want {
+		t.Errorf("tags got %s want %s", got, want)
+	}
+	if got, want := len(rows["webchk_runs"]), 1; got != want {
+		t.Fatalf("got %d want %d runs", got, want)
+	}
+	if got, want := rows["webchk_runs"][0]["termination"], TerminationIdle; got != want {
+		t.Errorf("termination got %v want %v", got, want)
+	}
+}
+
+func TestClickHouseSinkError(t *testing.T) {
+
+	httpHandler := http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Code: 516. Authentication failed", http.StatusUnauthorized)
+		},
+	)
+	server := httptest.NewServer(httpHandler)
+	defer server.Close()
+
+	_, err := newClickHouseSink(&http.Client{Timeout: 300 * time.Millisecond}, server.URL, Options{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if got, want := err.Error(), "could not create clickhouse schema: clickhouse status 401: Code: 516. Authentication failed"; got != want {
+		t.Errorf("got error %q want %q", got, want)
+	}
+}
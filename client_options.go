@@ -0,0 +1,44 @@
+// client_options.go provides the functional options used to configure
+// the http.Transport of a getClient made with NewGetClient, so that
+// library users can change how connections are made without replacing
+// the getClient.
+
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// ClientOption is a functional option for configuring the transport of
+// a getClient
+type ClientOption func(*http.Transport)
+
+// DialContextFunc makes network connections, with the signature of
+// net.Dialer.DialContext
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// WithDialContext sets the function making the connections for http
+// requests, such as one routing them through an ssh tunnel or service
+// mesh. Connections to proxies are made with dial too.
+func WithDialContext(dial DialContextFunc) ClientOption {
+	return func(t *http.Transport) {
+		t.DialContext = dial
+	}
+}
+
+// WithTransportFunc calls f with the transport, for settings without
+// an option of their own
+func WithTransportFunc(f func(*http.Transport)) ClientOption {
+	return ClientOption(f)
+}
+
+// unixSocketDialer returns a DialContextFunc connecting to the unix
+// socket at path whatever the address dialled
+func unixSocketDialer(path string) DialContextFunc {
+	dialer := &net.Dialer{}
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+}
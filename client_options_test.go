@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithDialContext(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintln(w, "hello world")
+		},
+	))
+	defer server.Close()
+
+	// route connections for any address to the test server, as a tunnel
+	// would
+	var dialled atomic.Int32
+	dialer := &net.Dialer{}
+	dial := func(ctx context.Context, network, _ string) (net.Conn, error) {
+		dialled.Add(1)
+		return dialer.DialContext(ctx, network, server.Listener.Addr().String())
+	}
+
+	g := NewGetClient(1, 300*time.Millisecond, WithDialContext(dial))
+	result, _ := g.get("http://tunnelled.internal/", "/", []string{"hello"})
+	if result.err != nil {
+		t.Fatalf("unexpected error %v", result.err)
+	}
+	if got, want := dialled.Load(), int32(1); got != want {
+		t.Errorf("got %d want %d dials", got, want)
+	}
+	if got, want := len(result.matches), 1; got != want {
+		t.Errorf("got %d want %d matches", got, want)
+	}
+}
+
+func TestWithTransportFunc(t *testing.T) {
+	g := NewGetClient(3, 0, WithTransportFunc(func(t *http.Transport) {
+		t.MaxIdleConns = 7
+	}))
+	transport, ok := g.client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport is a %T", g.client.Transport)
+	}
+	if got, want := transport.MaxIdleConns, 7; got != want {
+		t.Errorf("got %d want %d idle connections", got, want)
+	}
+	if got, want := transport.MaxConnsPerHost, 3; got != want {
+		t.Errorf("got %d want %d connections per host", got, want)
+	}
+}
@@ -0,0 +1,381 @@
+// crawl.go sets up and runs a single crawl from the command line
+// options, so that crawls can be run once or repeatedly in serve mode.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// crawl crawls options.Args.BaseURL with the given options, writing
+// the results to the outputs set in the options together with any
+// further sinks, and returns the Stats of the crawl. The connections of
+// the crawl are kept in pool, if given, for later crawls of the site.
+// An error is returned if the crawl could not be set up; errors writing
+// results are reported to diagnostics.
+func crawl(options Options, pool *transportPool, sinks ...OutputSink) (Stats, error) {
+	// make new httpClient
+	var err error
+	clientOptions := []ClientOption{}
+	switch {
+	case options.UnixSocket != "":
+		clientOptions = append(clientOptions, WithDialContext(unixSocketDialer(options.UnixSocket)))
+	default:
+		var cache *dnsCache
+		if options.DNSCacheTTL >= 0 {
+			cache = newDNSCache(options.DNSCacheTTL)
+		}
+		connector := newConnector(options.ConnTimeout, options.IPv4Only, cache)
+		clientOptions = append(clientOptions, WithDialContext(connector.DialContext))
+	}
+	httpClient := NewGetClient(options.HTTPWorkers, HTTPTIMEOUT, clientOptions...)
+	httpClient.withHostHeader(options.HostHeader, options.Args.BaseURL)
+	// set up the new transport before it is pooled, as a pooled
+	// transport, already set up, may be in use by other crawls
+	poolKey := options.poolKey()
+	if options.PAC != "" && !pool.has(poolKey) {
+		pac, err := loadPAC(options.PAC)
+		if err != nil {
+			return Stats{}, err
+		}
+		httpClient.withProxy(pac.proxy)
+	}
+	httpClient.client.Transport = pool.transport(poolKey, httpClient.client.Transport.(*http.Transport))
+	if options.Assertions != "" {
+		httpClient.assertions, err = loadAssertions(options.Assertions)
+		if err != nil {
+			return Stats{}, err
+		}
+	}
+	httpClient.languages = parseLanguages(options.Lang)
+	httpClient.caps = newMatchCaps(options.PageMatches, options.TermMatches)
+	httpClient.fold = options.Fold
+	httpClient.boilerplate = newBoilerplateFilter(options.Boilerplate)
+	httpClient.readability = options.Readability
+	httpClient.amp = options.AMP
+	httpClient.checksums = options.Changes
+	httpClient.texts = options.Diff != ""
+	if options.Charset != "" {
+		httpClient.decode, err = newCharsetDecoder(options.Charset)
+		if err != nil {
+			return Stats{}, err
+		}
+	}
+	if options.Spellcheck != "" {
+		httpClient.spell, err = newSpellChecker(options.Spellcheck, options.Dictionary)
+		if err != nil {
+			return Stats{}, err
+		}
+	}
+	if options.Redirects > 0 {
+		httpClient.withMaxRedirects(options.Redirects)
+	}
+	if options.Assets {
+		httpClient.withAssets()
+	}
+	if options.FirstMatch {
+		httpClient.withFirstMatch()
+	}
+	if options.JSONLinks {
+		paths, err := parseJSONPaths(options.JSONPath)
+		if err != nil {
+			return Stats{}, err
+		}
+		httpClient.withJSONLinks(paths)
+	}
+	// replay the responses recorded in fixtures in place of the
+	// network, or record them, beneath everything else
+	switch {
+	case options.Replay != "":
+		if _, err := os.Stat(options.Replay); err != nil {
+			return Stats{}, fmt.Errorf("could not replay fixtures: %w", err)
+		}
+		fixtures, err := newDiskCache(options.Replay)
+		if err != nil {
+			return Stats{}, err
+		}
+		httpClient.client.Transport = newReplayTransport(fixtures)
+	case options.Record != "":
+		fixtures, err := newDiskCache(options.Record)
+		if err != nil {
+			return Stats{}, err
+		}
+		httpClient.client.Transport = newRecordingTransport(httpClient.client.Transport, fixtures)
+	}
+	// record the network traffic, so beneath any cache
+	var har *harRecorder
+	if options.HAR != "" {
+		har = newHARRecorder(httpClient.client.Transport, options.HARBodies)
+		httpClient.client.Transport = har
+	}
+	if options.NTLMUser != "" {
+		credentials := parseNTLMUser(options.NTLMUser, os.Getenv(NTLMPASSWORDENV))
+		httpClient.client.Transport = newNTLMTransport(httpClient.client.Transport, credentials)
+	}
+	if options.Cache != "" {
+		cache, err := newDiskCache(options.Cache)
+		if err != nil {
+			return Stats{}, err
+		}
+		httpClient.client.Transport = newCachingTransport(httpClient.client.Transport, cache)
+	}
+	verbose := newVerboseLog(diagnostics, options.Verbose.level())
+	if verbose != nil {
+		httpClient.client.Transport = newVerboseTransport(httpClient.client.Transport, verbose)
+	}
+	// add the headers of the profile above everything, so that they are
+	// logged, recorded and cached with the requests
+	if options.Profile != "" {
+		httpClient.client.Transport = newProfileTransport(httpClient.client.Transport, options.Profile)
+	}
+	// make the optional exec hook
+	var hook *execHook
+	if options.Exec != "" {
+		hook, err = newExecHook(options.Exec, diagnostics)
+		if err != nil {
+			return Stats{}, err
+		}
+	}
+	// make the optional link rewrite rules
+	rewrites, err := newRewriteRules(options.Rewrite)
+	if err != nil {
+		return Stats{}, err
+	}
+	indexDocs := parseIndexDocuments(options.IndexDocs)
+	scope, err := newURLScope(options.Scope, options.Args.BaseURL)
+	if err != nil {
+		return Stats{}, err
+	}
+	httpClient.withRedirectScope(scope)
+	// read the robots.txt file of the site, for the urls it disallows
+	// and the crawl delay it asks for
+	robots, err := httpClient.robots(options.Args.BaseURL)
+	if err != nil {
+		fmt.Fprintln(diagnostics, err)
+	}
+	policy := newRobotsPolicy(options.Args.BaseURL, robots)
+	// make the optional url filters; budgets come last so that only
+	// urls which are followed count towards them
+	filters := []URLFilter{}
+	if !options.NoRobots {
+		filters = append(filters, policy)
+	}
+	if options.IncludeFile != "" {
+		patterns, err := loadURLPatterns(options.IncludeFile)
+		if err != nil {
+			return Stats{}, err
+		}
+		filters = append(filters, includeFilter(patterns))
+	}
+	if options.ExcludeFile != "" {
+		patterns, err := loadURLPatterns(options.ExcludeFile)
+		if err != nil {
+			return Stats{}, err
+		}
+		filters = append(filters, excludeFilter(patterns))
+	}
+	budgets, err := newBudgetFilter(options.Budget)
+	if err != nil {
+		return Stats{}, err
+	}
+	filters = append(filters, budgets)
+	// make the optional bounded memory visited set
+	var visited VisitedSet = newVisitedSet()
+	var bloom *bloomFilter
+	if options.Bloom > 0 {
+		bloom = newBloomFilter(options.Bloom, BLOOMFALSEPOSITIVES)
+		visited = bloom
+	}
+	// make the optional frontier journal, reading the frontier to
+	// resume from before it is appended to
+	var frontierOptions []DispatchOption
+	var frontierJournal *journal
+	if options.Journal != "" {
+		if options.Resume {
+			fr, err := readJournal(options.Journal)
+			if err != nil {
+				return Stats{}, err
+			}
+			fmt.Fprintf(diagnostics, "resuming crawl with %d of %d urls pending\n", len(fr.pending), len(fr.queued))
+			frontierOptions = append(frontierOptions, WithResume(fr))
+		}
+		frontierJournal, err = openJournal(options.Journal)
+		if err != nil {
+			return Stats{}, err
+		}
+		defer func() {
+			if err := frontierJournal.close(); err != nil {
+				fmt.Fprintln(diagnostics, err)
+			}
+		}()
+		frontierOptions = append(frontierOptions, WithJournal(frontierJournal))
+	}
+	// make the output sinks; an estimate only measures a sample crawl,
+	// so replaces the usual outputs and skips the exec hook
+	var sink OutputSink
+	if options.Estimate > 0 {
+		sink = newEstimateSink(closingWriter{Writer: output}, options)
+		hook = nil
+	} else {
+		outputs := options.Output
+		if options.JSON {
+			outputs = append(outputs, "json")
+		}
+		if len(outputs) == 0 {
+			outputs = []string{"text"}
+		}
+		outputSinks, err := newOutputSinks(outputs, options)
+		if err != nil {
+			return Stats{}, err
+		}
+		if len(options.EmailTo) > 0 {
+			email, err := newEmailSink(options)
+			if err != nil {
+				return Stats{}, err
+			}
+			outputs = append(outputs, "email")
+			outputSinks = append(outputSinks, email)
+		}
+		// several outputs are written concurrently and independently
+		sink = outputSinks[0]
+		if len(outputSinks) > 1 {
+			sink = newFanoutSink(outputs, outputSinks)
+		}
+		if options.Sort {
+			sink = &sortingSink{sink: sink}
+		}
+	}
+	if len(sinks) > 0 {
+		sink = append(multiSink{sink}, sinks...)
+	}
+	if options.NoIndex == NOINDEXHIDE {
+		sink = noindexSink{sink}
+	}
+	var audit *robotsAudit
+	if options.NoRobots {
+		audit = &robotsAudit{sink: sink, policy: policy}
+		sink = audit
+	}
+	var dynamic *dynamicAudit
+	if options.Dynamic > 0 {
+		dynamic = newDynamicAudit(sink, options.Dynamic)
+		sink = dynamic
+	}
+	dispatchOptions := []DispatchOption{
+		WithWorkers(options.Workers),
+		WithBufferSize(options.BufferSize),
+		WithBufferGrace(options.BufferGrace),
+		WithResultsBufferSize(options.ResultsSize),
+		WithRate(options.QuerySec),
+		WithSearchTerms(options.SearchTerms...),
+		WithDispatcherTimeout(options.IdleTimeout),
+		WithTimeout(options.Timeout),
+		WithClient(httpClient),
+		WithHeartbeat(options.Heartbeat),
+		WithVerbose(verbose),
+		WithMaxPages(options.Estimate),
+		WithFilters(filters...),
+		WithRewriters(rewrites, indexDocs),
+		WithVisitedSet(visited),
+		WithHostErrorBudget(options.HostErrors),
+		WithScope(scope),
+		WithAcceptLanguages(acceptLanguages(options.AcceptLang)...),
+	}
+	if options.Window != "" {
+		window, err := parseTimeWindow(options.Window)
+		if err != nil {
+			return Stats{}, err
+		}
+		dispatchOptions = append(dispatchOptions, WithWindow(window))
+	}
+	if options.Assets {
+		dispatchOptions = append(dispatchOptions, WithSkipSuffixes()) // check images too
+	}
+	if len(options.Schemes) > 0 {
+		dispatchOptions = append(dispatchOptions, WithSchemes(parseSchemes(options.Schemes)...))
+	}
+	seedURLs := []string{options.Args.BaseURL}
+	if options.SitemapOnly {
+		dispatchOptions = append(dispatchOptions, WithNoFollow())
+	}
+	seeds := []refLink{}
+	if (options.Sitemaps || options.SitemapOnly) && !options.Resume {
+		sitemapSeeds, err := httpClient.sitemapSeeds(options.Args.BaseURL)
+		if err != nil {
+			fmt.Fprintln(diagnostics, err)
+		}
+		fmt.Fprintf(diagnostics, "seeding crawl with %d urls from sitemaps\n", len(sitemapSeeds))
+		for i, s := range sitemapSeeds {
+			sitemapSeeds[i].url = indexDocs.Rewrite(s.url)
+		}
+		seeds = append(seeds, sitemapSeeds...)
+	}
+	if options.Seeds != "" {
+		requests, err := loadSeedRequests(options.Seeds)
+		if err != nil {
+			return Stats{}, err
+		}
+		httpClient.seeds = requests // also for the seeds of a resumed crawl
+		if !options.Resume {
+			seeds = append(seeds, requests.links(options.Seeds)...)
+		}
+	}
+	dispatchOptions = append(dispatchOptions, WithSeeds(seeds...))
+	for _, s := range seeds {
+		seedURLs = append(seedURLs, s.url)
+	}
+	var crawlDelay time.Duration
+	if !options.IgnoreDelay {
+		crawlDelay = robots.crawlDelay()
+		dispatchOptions = append(dispatchOptions, WithCrawlDelay(crawlDelay))
+	}
+	dispatchOptions = append(dispatchOptions, frontierOptions...)
+	// initialise a dispatcher
+	d := NewDispatch(options.Args.BaseURL, dispatchOptions...)
+	if crawlDelay > 0 {
+		fmt.Fprintf(diagnostics, "robots.txt crawl-delay of %s: requesting at most %.3g pages per second\n", crawlDelay, float64(d.rate()))
+	}
+	// receive channel from Dispatcher
+	results := d.Dispatcher()
+	if hook != nil {
+		results = hook.pipe(results)
+	}
+	// write results from channel to the output sinks
+	stats, err := drain(results, sink, d)
+	if err != nil {
+		fmt.Fprintln(diagnostics, err)
+	}
+	if har != nil {
+		if err := har.write(options.HAR); err != nil {
+			fmt.Fprintln(diagnostics, err)
+		}
+	}
+	if stats.Dropped > 0 {
+		fmt.Fprintln(diagnostics, stats.bufferAdvice(d.linkBufferSize))
+	}
+	budgets.report(diagnostics)
+	d.hostErrors.report(diagnostics)
+	if audit != nil {
+		audit.report(diagnostics)
+	}
+	if dynamic != nil {
+		dynamic.report(diagnostics, httpClient)
+	}
+	if options.Changes {
+		if err := reportChanges(diagnostics, options.sqliteOutput(), options.Args.BaseURL, options.Diff); err != nil {
+			fmt.Fprintln(diagnostics, err)
+		}
+	}
+	if options.Manifest != "" {
+		if err := newRunManifest(options, seedURLs, stats).write(options.Manifest); err != nil {
+			fmt.Fprintln(diagnostics, err)
+		}
+	}
+	if bloom != nil && bloom.overfull() {
+		fmt.Fprintf(diagnostics, "more than %d urls were visited, so more new urls than expected may have been skipped; increase --bloom\n", options.Bloom)
+	}
+	return stats, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resultsSink is an OutputSink recording the urls of results
+type resultsSink struct{ urls []string }
+
+func (r *resultsSink) Write(result Result) error {
+	r.urls = append(r.urls, result.url)
+	return nil
+}
+func (r *resultsSink) Close(Stats) error { return nil }
+
+func TestCrawl(t *testing.T) {
+
+	mux := http.NewServeMux()
+	page := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, body)
+		}
+	}
+	mux.HandleFunc("/", page(`<a href="/a">a</a> <a href="/tag/x">x</a>`))
+	mux.HandleFunc("/a", page(`hello <a href="/">home</a>`))
+	mux.HandleFunc("/tag/x", page(`hello`))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	csvFile := filepath.Join(t.TempDir(), "out.csv")
+	options := Options{
+		SearchTerms: []string{"hello"},
+		QuerySec:    1000,
+		IdleTimeout: 200 * time.Millisecond,
+		Budget:      []string{"/tag/=0"},
+		Output:      []string{"csv:" + csvFile},
+	}
+	options.Args.BaseURL = server.URL
+
+	var buf strings.Builder
+	diagnostics = &buf
+	defer func() { diagnostics = os.Stderr }()
+
+	extra := &resultsSink{}
+	stats, err := crawl(options, nil, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stats.Pages, 2; got != want {
+		t.Errorf("got %d want %d pages", got, want)
+	}
+	if got, want := len(extra.urls), 2; got != want {
+		t.Errorf("extra sink got %d want %d results", got, want)
+	}
+	contents, err := os.ReadFile(csvFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(contents), server.URL+"/a") {
+		t.Errorf("csv output missing /a:\n%s", contents)
+	}
+	if !strings.Contains(buf.String(), "budget /tag/=0 used up: 1 urls skipped") {
+		t.Errorf("budget not reported:\n%s", buf.String())
+	}
+
+	options.Budget = []string{"/tag/"}
+	if _, err := crawl(options, nil); !errors.Is(err, ErrBudgetFormat) {
+		t.Errorf("got error %v want %v", err, ErrBudgetFormat)
+	}
+}
+
+func TestCrawlDelay(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nCrawl-delay: 0.05\n")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `hello <a href="/a">a</a>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	options := Options{
+		SearchTerms: []string{"hello"},
+		QuerySec:    1000,
+		IdleTimeout: 200 * time.Millisecond,
+		Output:      []string{"csv:" + filepath.Join(t.TempDir(), "out.csv")},
+	}
+	options.Args.BaseURL = server.URL
+
+	var buf strings.Builder
+	diagnostics = &buf
+	defer func() { diagnostics = os.Stderr }()
+
+	for _, ignore := range []bool{false, true} {
+		buf.Reset()
+		options.IgnoreDelay = ignore
+		stats, err := crawl(options, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := stats.Pages, 2; got != want {
+			t.Errorf("got %d want %d pages", got, want)
+		}
+		reported := strings.Contains(buf.String(), "robots.txt crawl-delay of 50ms: requesting at most 20 pages per second")
+		if reported == ignore {
+			t.Errorf("ignore %t: crawl delay reported %t:\n%s", ignore, reported, buf.String())
+		}
+	}
+}
+
+func TestCrawlRobots(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private/\n")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `hello <a href="/a">a</a> <a href="/private/b">b</a>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	options := Options{
+		SearchTerms: []string{"hello"},
+		QuerySec:    1000,
+		IdleTimeout: 200 * time.Millisecond,
+		Output:      []string{"csv:" + filepath.Join(t.TempDir(), "out.csv")},
+	}
+	options.Args.BaseURL = server.URL
+
+	var buf strings.Builder
+	diagnostics = &buf
+	defer func() { diagnostics = os.Stderr }()
+
+	for _, ignore := range []bool{false, true} {
+		buf.Reset()
+		options.NoRobots = ignore
+		stats, err := crawl(options, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 2
+		if ignore {
+			want = 3
+		}
+		if got := stats.Pages; got != want {
+			t.Errorf("ignore %t: got %d want %d pages", ignore, got, want)
+		}
+		report := "urls fetched which robots.txt disallows: 1\n  " + server.URL + "/private/b\n"
+		if got := strings.Contains(buf.String(), report); got != ignore {
+			t.Errorf("ignore %t: compliance reported %t:\n%s", ignore, got, buf.String())
+		}
+	}
+}
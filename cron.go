@@ -0,0 +1,148 @@
+// cron.go parses cron-style schedules, used to run crawls at regular
+// times in serve mode.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCronFormat reports a schedule which is not a valid cron
+// expression
+var ErrCronFormat = errors.New("schedule should be a cron expression of five fields (minute hour day-of-month month day-of-week), for example \"0 2 * * *\", or one of @hourly, @daily, @weekly or @monthly")
+
+// cronMacros are the supported shorthand schedules
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// cronSchedule is a parsed cron expression, with each field recorded
+// as a bit set of the values it matches
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool // the day fields were *
+}
+
+// parseCron parses a standard five field cron expression. Each field
+// may be *, a value, a range a-b or a list of these separated by
+// commas, and * or a range may be followed by /step. Days of the week
+// are 0-7, where both 0 and 7 are Sunday.
+func parseCron(spec string) (cronSchedule, error) {
+	var c cronSchedule
+	if macro, ok := cronMacros[strings.TrimSpace(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return c, fmt.Errorf("schedule %q: %w", spec, ErrCronFormat)
+	}
+	for i, f := range []struct {
+		bits        *uint64
+		first, last int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	} {
+		bits, err := parseCronField(fields[i], f.first, f.last)
+		if err != nil {
+			return c, fmt.Errorf("schedule %q field %d: %w", spec, i+1, err)
+		}
+		*f.bits = bits
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1 // 7 is also Sunday
+	}
+	c.domStar, c.dowStar = strings.HasPrefix(fields[2], "*"), strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// parseCronField parses a single cron field with values from first to
+// last
+func parseCronField(field string, first, last int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step < 1 {
+				return 0, ErrCronFormat
+			}
+		}
+		lo, hi := first, last
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			loStr, hiStr, _ := strings.Cut(rng, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(loStr)
+			hi, err2 = strconv.Atoi(hiStr)
+			if err1 != nil || err2 != nil {
+				return 0, ErrCronFormat
+			}
+		default:
+			if hasStep {
+				return 0, ErrCronFormat // a step needs * or a range
+			}
+			v, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, ErrCronFormat
+			}
+			lo, hi = v, v
+		}
+		if lo < first || hi > last || lo > hi {
+			return 0, ErrCronFormat
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// matchesDay reports whether the schedule runs on the day of t. As in
+// cron, if both day fields are restricted a day matching either runs.
+func (c cronSchedule) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.domStar || c.dowStar:
+		return dom && dow
+	default:
+		return dom || dow
+	}
+}
+
+// next returns the first time after t at which the schedule runs, or
+// the zero time if there is none within five years
+func (c cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+
+	tests := []struct {
+		spec  string
+		isErr bool
+	}{
+		{spec: "* * * * *"},
+		{spec: "0 2 * * *"},
+		{spec: "*/15 9-17 * * 1-5"},
+		{spec: "0,30 0 1,15 */3 7"},
+		{spec: "@daily"},
+		{spec: "@weekly"},
+		{spec: "", isErr: true},
+		{spec: "0 2 * *", isErr: true},
+		{spec: "60 * * * *", isErr: true},
+		{spec: "* 24 * * *", isErr: true},
+		{spec: "* * 0 * *", isErr: true},
+		{spec: "* * * 13 *", isErr: true},
+		{spec: "* * * * 8", isErr: true},
+		{spec: "5-1 * * * *", isErr: true},
+		{spec: "*/0 * * * *", isErr: true},
+		{spec: "5/2 * * * *", isErr: true},
+		{spec: "a * * * *", isErr: true},
+		{spec: "@yearly", isErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			_, err := parseCron(tt.spec)
+			if err != nil {
+				if !tt.isErr {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if !errors.Is(err, ErrCronFormat) {
+					t.Errorf("got error %v want %v", err, ErrCronFormat)
+				}
+				return
+			}
+			if tt.isErr {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+
+	// Friday 15 March 2024
+	from := time.Date(2024, 3, 15, 10, 7, 30, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", at(3, 15, 10, 8)},
+		{"0 2 * * *", at(3, 16, 2, 0)},
+		{"*/15 * * * *", at(3, 15, 10, 15)},
+		{"0 9-17 * * 1-5", at(3, 15, 11, 0)},
+		{"0 9 * * 1-5", at(3, 18, 9, 0)}, // the next weekday
+		{"30 6 * * 0", at(3, 17, 6, 30)}, // sunday
+		{"30 6 * * 7", at(3, 17, 6, 30)}, // also sunday
+		{"0 0 1 * *", at(4, 1, 0, 0)},    // monthly
+		{"0 0 31 * *", at(3, 31, 0, 0)},  // months with 31 days
+		{"0 0 1 1 *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 20 * 1", at(3, 18, 0, 0)}, // day of month or week
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}}, // never
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			c, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.next(from); !got.Equal(tt.want) {
+				t.Errorf("%s next got %s want %s", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+// dashboard.go serves the serve mode web dashboard, which is embedded
+// in the binary so that webchk remains a single file to deploy.
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// dashboardHandler serves the dashboard's static assets
+func dashboardHandler() http.Handler {
+	static, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		panic(err) // the embedded directory is always present
+	}
+	return http.FileServer(http.FS(static))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboardHandler(t *testing.T) {
+
+	ts := httptest.NewServer(newServer("", Options{}, nil).http.Handler)
+	defer ts.Close()
+
+	tests := []struct {
+		path        string
+		contentType string
+		contains    string
+	}{
+		{"/", "text/html", `<script src="dashboard.js">`},
+		{"/dashboard.js", "javascript", `new EventSource(withKey("events"))`},
+		{"/dashboard.css", "text/css", "#progress"},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(ts.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s status %d", tt.path, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, tt.contentType) {
+			t.Errorf("%s content type %s want %s", tt.path, ct, tt.contentType)
+		}
+		if !strings.Contains(string(body), tt.contains) {
+			t.Errorf("%s does not contain %s", tt.path, tt.contains)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// dial.go makes the connections of a crawl, with a limit on the time
+// taken to connect and a choice of whether ipv6 is used, so that
+// crawls from networks with broken ipv6 or slow servers can be tuned.
+// Where a host has both ipv6 and ipv4 addresses they are raced as
+// described in RFC 8305 (Happy Eyeballs).
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// FALLBACKDELAY is how long a connection to the preferred addresses of
+// a host is given before the other address family is also tried
+const FALLBACKDELAY time.Duration = 300 * time.Millisecond
+
+// connector dials the connections of a crawl, looking up hosts in
+// cache, if set
+type connector struct {
+	dialer   *net.Dialer
+	ipv4Only bool
+	cache    *dnsCache // optional
+}
+
+// newConnector makes a connector taking at most timeout to connect to
+// each address, if more than 0, and only connecting over ipv4 if
+// ipv4Only is set
+func newConnector(timeout time.Duration, ipv4Only bool, cache *dnsCache) *connector {
+	return &connector{
+		dialer:   &net.Dialer{Timeout: max(timeout, 0), FallbackDelay: FALLBACKDELAY},
+		ipv4Only: ipv4Only,
+		cache:    cache,
+	}
+}
+
+// DialContext is a DialContextFunc connecting to addr
+func (c *connector) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if c.ipv4Only && network == "tcp" {
+		network = "tcp4"
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if c.cache == nil || err != nil || net.ParseIP(host) != nil {
+		return c.dialer.DialContext(ctx, network, addr)
+	}
+	addrs, err := c.cache.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	primaries, fallbacks := partitionAddrs(addrs, c.ipv4Only)
+	if len(primaries) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address", Name: host, IsNotFound: true}
+	}
+	return c.dialParallel(ctx, network, port, primaries, fallbacks)
+}
+
+// partitionAddrs splits addrs into those of the family of the first,
+// which is preferred, and those of the other family. With ipv4Only
+// only the ipv4 addresses are returned, as the primaries.
+func partitionAddrs(addrs []net.IPAddr, ipv4Only bool) (primaries, fallbacks []net.IPAddr) {
+	if ipv4Only {
+		for _, a := range addrs {
+			if a.IP.To4() != nil {
+				primaries = append(primaries, a)
+			}
+		}
+		return primaries, nil
+	}
+	for _, a := range addrs {
+		if len(primaries) == 0 || (a.IP.To4() != nil) == (primaries[0].IP.To4() != nil) {
+			primaries = append(primaries, a)
+		} else {
+			fallbacks = append(fallbacks, a)
+		}
+	}
+	return primaries, fallbacks
+}
+
+// dialSerial dials each of addrs in turn, returning the first
+// connection made
+func (c *connector) dialSerial(ctx context.Context, network, port string, addrs []net.IPAddr) (net.Conn, error) {
+	errs := []error{}
+	for _, a := range addrs {
+		conn, err := c.dialer.DialContext(ctx, network, net.JoinHostPort(a.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// dialParallel dials the primary addresses, and the fallback addresses
+// too if no connection has been made after FALLBACKDELAY or the
+// primaries fail, returning the first connection made
+func (c *connector) dialParallel(ctx context.Context, network, port string, primaries, fallbacks []net.IPAddr) (net.Conn, error) {
+	if len(fallbacks) == 0 {
+		return c.dialSerial(ctx, network, port, primaries)
+	}
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan dialResult, 2) // never blocking the dials
+	dial := func(addrs []net.IPAddr) {
+		conn, err := c.dialSerial(ctx, network, port, addrs)
+		results <- dialResult{conn, err}
+	}
+	go dial(primaries)
+	fallback := time.NewTimer(c.dialer.FallbackDelay)
+	defer fallback.Stop()
+
+	started, errs := 1, []error{}
+	for {
+		select {
+		case <-fallback.C:
+			if started == 1 {
+				started++
+				go dial(fallbacks)
+			}
+		case r := <-results:
+			if r.err == nil {
+				if started-len(errs) == 2 { // close the loser, if it connects
+					go func() {
+						if loser := <-results; loser.conn != nil {
+							loser.conn.Close()
+						}
+					}()
+				}
+				return r.conn, nil
+			}
+			errs = append(errs, r.err)
+			if len(errs) == started {
+				if started == 2 {
+					return nil, errors.Join(errs...)
+				}
+				started++ // the primaries failed: try the fallbacks now
+				go dial(fallbacks)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/goleak"
+)
+
+func TestPartitionAddrs(t *testing.T) {
+
+	addrs := func(ips ...string) []net.IPAddr {
+		a := []net.IPAddr{}
+		for _, ip := range ips {
+			a = append(a, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+		return a
+	}
+	tests := []struct {
+		addrs     []net.IPAddr
+		ipv4Only  bool
+		primaries []net.IPAddr
+		fallbacks []net.IPAddr
+	}{
+		{addrs("2001:db8::1", "192.0.2.1", "2001:db8::2"), false, addrs("2001:db8::1", "2001:db8::2"), addrs("192.0.2.1")},
+		{addrs("192.0.2.1", "2001:db8::1"), false, addrs("192.0.2.1"), addrs("2001:db8::1")},
+		{addrs("192.0.2.1", "192.0.2.2"), false, addrs("192.0.2.1", "192.0.2.2"), nil},
+		{addrs("2001:db8::1", "192.0.2.1", "2001:db8::2"), true, addrs("192.0.2.1"), nil},
+		{addrs("2001:db8::1"), true, nil, nil},
+	}
+	for i, tt := range tests {
+		primaries, fallbacks := partitionAddrs(tt.addrs, tt.ipv4Only)
+		if diff := cmp.Diff(tt.primaries, primaries); diff != "" {
+			t.Errorf("%d: primaries mismatch (-want +got):\n%s", i, diff)
+		}
+		if diff := cmp.Diff(tt.fallbacks, fallbacks); diff != "" {
+			t.Errorf("%d: fallbacks mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestConnectorDialContext(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFakeDNSServer(t)
+	c := newConnector(time.Second, false, testDNSCache(f, 0))
+	for _, addr := range []string{"site.test:" + port, server.Listener.Addr().String()} {
+		conn, err := c.DialContext(context.Background(), "tcp", addr)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", addr, err)
+		}
+		conn.Close()
+	}
+	if f.count("site.test.") == 0 {
+		t.Error("site.test not looked up")
+	}
+
+	var dnsErr *net.DNSError
+	if _, err := c.DialContext(context.Background(), "tcp", "missing.test:"+port); !errors.As(err, &dnsErr) {
+		t.Errorf("got error %v want a dns error", err)
+	}
+
+	// without a cache hosts are dialled by the dialer
+	c = newConnector(time.Second, true, nil)
+	conn, err := c.DialContext(context.Background(), "tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := conn.RemoteAddr().Network(), "tcp"; got != want {
+		t.Errorf("got network %s want %s", got, want)
+	}
+	conn.Close()
+}
+
+func TestConnectorFallback(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ipv4 := net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+	// 192.0.2.1 is a documentation address which does not answer
+	blackhole := net.IPAddr{IP: net.ParseIP("192.0.2.1")}
+	refused := net.IPAddr{IP: net.ParseIP("::1")} // nothing listens on the port over ipv6
+
+	c := newConnector(2*time.Second, false, nil)
+	c.dialer.FallbackDelay = 20 * time.Millisecond
+
+	for _, tt := range []struct {
+		name                 string
+		primaries, fallbacks []net.IPAddr
+	}{
+		{"primary refused", []net.IPAddr{refused}, []net.IPAddr{ipv4}},
+		{"primary slow", []net.IPAddr{blackhole}, []net.IPAddr{ipv4}},
+		{"primary connects", []net.IPAddr{ipv4}, []net.IPAddr{refused}},
+	} {
+		start := time.Now()
+		conn, err := c.dialParallel(context.Background(), "tcp", port, tt.primaries, tt.fallbacks)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		conn.Close()
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: took %s", tt.name, elapsed)
+		}
+	}
+
+	_, err = c.dialParallel(context.Background(), "tcp", port, []net.IPAddr{refused}, []net.IPAddr{refused})
+	if err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,182 @@
+// diff.go makes unified diffs of the visible text of pages, so that the
+// changes to a page found with --changes can be seen line by line.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DIFFCONTEXT is the number of unchanged lines around each change in a
+// unified diff
+const DIFFCONTEXT = 3
+
+// DIFFMAXCELLS bounds the lines compared in a diff, as the product of
+// the numbers of lines of each version after any lines common to their
+// starts and ends, beyond which the lines are shown replaced in full
+const DIFFMAXCELLS = 4_000_000
+
+// visibleLines returns the visible text of an html page as lines, one
+// for the text of each element with its whitespace collapsed, leaving
+// out elements without text
+func visibleLines(body []byte) []string {
+	lines := []string{}
+	for _, t := range visibleTextRuns(body) {
+		if line := strings.Join(strings.Fields(t), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// diffOp is an operation of an edit script: an unchanged line (' '), a
+// deleted line ('-') or an inserted line ('+')
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns an edit script turning a into b, with the fewest
+// changes unless the lines are too many to compare
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(ma)*len(mb) > DIFFMAXCELLS {
+		for _, l := range ma {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range mb {
+			ops = append(ops, diffOp{'+', l})
+		}
+	} else {
+		ops = append(ops, lcsDiff(ma, mb)...)
+	}
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// lcsDiff returns an edit script turning a into b from their longest
+// common subsequence of lines
+func lcsDiff(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	ops := []diffOp{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff returns the unified diff of the lines a, named from, and
+// the lines b, named to, or "" if they are the same
+func unifiedDiff(from, to string, a, b []string) string {
+	ops := diffLines(a, b)
+	var d strings.Builder
+	// line numbers of the next op in a and b
+	ai, bi := 1, 1
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start, ai, bi = start+1, ai+1, bi+1
+		}
+		if start == len(ops) {
+			break
+		}
+		// extend the hunk while changes are within twice the context
+		end, unchanged := start, 0
+		for i := start; i < len(ops) && unchanged <= 2*DIFFCONTEXT; i++ {
+			if ops[i].kind == ' ' {
+				unchanged++
+			} else {
+				end, unchanged = i+1, 0
+			}
+		}
+		lead := min(DIFFCONTEXT, start)
+		trail := min(DIFFCONTEXT, len(ops)-end)
+		hunk := ops[start-lead : end+trail]
+		aStart, bStart := ai-lead, bi-lead
+		aCount, bCount := 0, 0
+		for _, op := range hunk {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		if d.Len() == 0 {
+			fmt.Fprintf(&d, "--- %s\n+++ %s\n", from, to)
+		}
+		fmt.Fprintf(&d, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, op := range hunk {
+			fmt.Fprintf(&d, "%c%s\n", op.kind, op.line)
+		}
+		// advance past the changes to the trailing context
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				ai++
+			}
+			if op.kind != '-' {
+				bi++
+			}
+		}
+		start = end
+	}
+	return d.String()
+}
+
+// hunkRange prints the start and count of the lines of a hunk, where an
+// empty range starts at the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVisibleLines(t *testing.T) {
+	body := `<html><head><title>Home</title><style>p {}</style></head>
+<body><h1>Welcome</h1>
+<p>Hello
+   there</p><script>x = 1</script><p> </p></body></html>`
+	if diff := cmp.Diff([]string{"Home", "Welcome", "Hello there"}, visibleLines([]byte(body))); diff != "" {
+		t.Errorf("lines mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+
+	lines := func(s string) []string { return strings.Fields(s) }
+
+	tests := []struct {
+		name string
+		a, b []string
+		want string
+	}{
+		{
+			name: "same",
+			a:    lines("a b c"),
+			b:    lines("a b c"),
+			want: "",
+		},
+		{
+			name: "changed",
+			a:    lines("a b c d e f g h i"),
+			b:    lines("a b c d E f g h i"),
+			want: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n",
+		},
+		{
+			name: "added and removed",
+			a:    lines("a b"),
+			b:    lines("b c"),
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-a\n b\n+c\n",
+		},
+		{
+			name: "from empty",
+			a:    []string{},
+			b:    lines("a"),
+			want: "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			name: "two hunks",
+			a:    lines("1 2 3 4 5 6 7 8 9 10 11 12"),
+			b:    lines("x 2 3 4 5 6 7 8 9 10 11 y"),
+			want: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n" +
+				"@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n",
+		},
+		{
+			name: "close changes in one hunk",
+			a:    lines("1 2 3 4 5 6 7 8"),
+			b:    lines("x 2 3 4 5 6 7 y"),
+			want: "--- old\n+++ new\n@@ -1,8 +1,8 @@\n-1\n+x\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, unifiedDiff("old", "new", tt.a, tt.b)); diff != "" {
+				t.Errorf("diff mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiffLinesTooMany(t *testing.T) {
+	a := make([]string, 2001)
+	b := make([]string, 2001)
+	for i := range a {
+		a[i], b[i] = "a", "b"
+	}
+	a[0], b[0] = "same", "same"
+	ops := diffLines(a, b)
+	if got, want := len(ops), 1+2000+2000; got != want {
+		t.Fatalf("got %d want %d ops", got, want)
+	}
+	if got, want := [3]byte{ops[0].kind, ops[1].kind, ops[len(ops)-1].kind}, [3]byte{' ', '-', '+'}; got != want {
+		t.Errorf("got kinds %q want %q", got, want)
+	}
+}
@@ -0,0 +1,273 @@
+// dispatch_options.go provides the functional options used to
+// configure a dispatch with NewDispatch.
+
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// DispatchOption is a functional option for configuring a dispatch
+type DispatchOption func(*dispatch)
+
+// URLFilter reports whether a url found during a crawl should be
+// followed. URLFilters are consulted in order after the built-in
+// checks that a url is within the base url, has not been seen before
+// and is not an image.
+type URLFilter interface {
+	Follow(url string) bool
+}
+
+// VisitedSet is a URLFilter recording the urls seen during a crawl.
+// Follow reports whether a url has not been seen before and records
+// it, while Seen only reports whether it has been seen. A VisitedSet
+// must be safe for concurrent use.
+type VisitedSet interface {
+	URLFilter
+	Seen(url string) bool
+}
+
+// URLFilterFunc adapts a function to the URLFilter interface
+type URLFilterFunc func(url string) bool
+
+// Follow calls f(url)
+func (f URLFilterFunc) Follow(url string) bool {
+	return f(url)
+}
+
+// URLRewriter rewrites a url found during a crawl before it is checked
+// by the URLFilters and queued for processing. Rewrite is called by
+// the workers and must be safe for concurrent use.
+type URLRewriter interface {
+	Rewrite(url string) string
+}
+
+// URLRewriterFunc adapts a function to the URLRewriter interface
+type URLRewriterFunc func(url string) string
+
+// Rewrite calls f(url)
+func (f URLRewriterFunc) Rewrite(url string) string {
+	return f(url)
+}
+
+// WithWorkers sets the number of worker goroutines
+func WithWorkers(workers int) DispatchOption {
+	return func(d *dispatch) {
+		d.workers = workers
+	}
+}
+
+// WithBufferSize sets the size of the buffer of links waiting to be
+// processed
+func WithBufferSize(linkBufferSize int) DispatchOption {
+	return func(d *dispatch) {
+		d.linkBufferSize = linkBufferSize
+	}
+}
+
+// WithBufferGrace sets how long links found wait for space in a full
+// link buffer, holding up the workers finding them, before they are
+// dropped. The wait starts again whenever a link is queued.
+func WithBufferGrace(grace time.Duration) DispatchOption {
+	return func(d *dispatch) {
+		d.bufferGrace = grace
+	}
+}
+
+// WithResultsBufferSize sets the size of the buffer of results waiting
+// to be consumed. While it is full, the workers wait to send their
+// results rather than fetching more pages.
+func WithResultsBufferSize(resultsBufferSize int) DispatchOption {
+	return func(d *dispatch) {
+		d.resultsBufferSize = resultsBufferSize
+	}
+}
+
+// WithRate sets the number of http requests per second across all
+// workers
+func WithRate(httpRateSec int) DispatchOption {
+	return func(d *dispatch) {
+		d.httpRateSec = httpRateSec
+	}
+}
+
+// WithCrawlDelay sets the delay between http requests asked for by the
+// site, such as by the Crawl-delay directive of its robots.txt file,
+// which slows the rate set by WithRate if it allows fewer requests per
+// second. The idle timeout is extended by the delay.
+func WithCrawlDelay(delay time.Duration) DispatchOption {
+	return func(d *dispatch) {
+		d.crawlDelay = delay
+	}
+}
+
+// WithSearchTerms sets the terms to search for in each page
+func WithSearchTerms(searchTerms ...string) DispatchOption {
+	return func(d *dispatch) {
+		d.searchTerms = searchTerms
+	}
+}
+
+// WithDispatcherTimeout sets how long the dispatcher waits for a
+// result before stopping
+func WithDispatcherTimeout(timeout time.Duration) DispatchOption {
+	return func(d *dispatch) {
+		d.dispatcherTimeout = timeout
+	}
+}
+
+// WithTimeout sets the overall timeout. A timeout of 0 or less means
+// no timeout.
+func WithTimeout(timeout time.Duration) DispatchOption {
+	return func(d *dispatch) {
+		d.ctxTimeout = timeout
+	}
+}
+
+// WithClient sets the getClient used for http requests
+func WithClient(client *getClient) DispatchOption {
+	return func(d *dispatch) {
+		d.client = client
+	}
+}
+
+// WithFilters adds URLFilters which must all allow a url for it to be
+// followed
+func WithFilters(filters ...URLFilter) DispatchOption {
+	return func(d *dispatch) {
+		d.filters = append(d.filters, filters...)
+	}
+}
+
+// WithVisitedSet sets the VisitedSet recording the urls seen during the
+// crawl, in place of the default exact set
+func WithVisitedSet(visited VisitedSet) DispatchOption {
+	return func(d *dispatch) {
+		d.visited = visited
+	}
+}
+
+// WithSkipSuffixes sets the url suffixes which are not followed, in
+// place of the default image suffixes
+func WithSkipSuffixes(suffixes ...string) DispatchOption {
+	return func(d *dispatch) {
+		d.skipSuffixes = suffixes
+	}
+}
+
+// WithSchemes sets the url schemes which are followed, in place of the
+// default http and https. Schemes are compared in lowercase.
+func WithSchemes(schemes ...string) DispatchOption {
+	return func(d *dispatch) {
+		d.schemes = schemes
+	}
+}
+
+// WithRewriters adds URLRewriters which are applied in order to each
+// url found
+func WithRewriters(rewriters ...URLRewriter) DispatchOption {
+	return func(d *dispatch) {
+		d.rewriters = append(d.rewriters, rewriters...)
+	}
+}
+
+// WithHeartbeat sets the interval at which a single line progress
+// report is written to diagnostics. An interval of 0 or less means no
+// reports.
+func WithHeartbeat(interval time.Duration) DispatchOption {
+	return func(d *dispatch) {
+		d.heartbeat = interval
+	}
+}
+
+// WithWindow only makes requests within the daily window of times w,
+// pausing outside it. The Dispatcher does not time out while paused.
+func WithWindow(w *timeWindow) DispatchOption {
+	return func(d *dispatch) {
+		d.window = w
+	}
+}
+
+// WithVerbose reports the links which are not followed, and why, to v
+func WithVerbose(v *verboseLog) DispatchOption {
+	return func(d *dispatch) {
+		d.verbose = v
+	}
+}
+
+// WithJournal records the links queued and the urls fetched in j
+func WithJournal(j *journal) DispatchOption {
+	return func(d *dispatch) {
+		d.journal = j
+	}
+}
+
+// WithResume resumes a crawl from the frontier reconstructed from its
+// journal, starting with its pending links instead of the base url and
+// not following the links queued before
+func WithResume(fr frontier) DispatchOption {
+	return func(d *dispatch) {
+		d.resume = &fr
+	}
+}
+
+// WithSeeds starts the Dispatcher from the given links as well as the
+// base url, such as the urls listed in the sitemaps of a site. Seeds
+// are filtered like other links and are not used when resuming a crawl.
+func WithSeeds(seeds ...refLink) DispatchOption {
+	return func(d *dispatch) {
+		d.seeds = seeds
+	}
+}
+
+// WithNoFollow stops the links found on pages being followed, so that
+// only the base url and any seeds are fetched.
+func WithNoFollow() DispatchOption {
+	return func(d *dispatch) {
+		d.noFollow = true
+	}
+}
+
+// WithAcceptLanguages fetches each page once for each of languages,
+// sent as its Accept-Language header, reporting a result for each
+// language. By default each page is fetched once.
+func WithAcceptLanguages(languages ...string) DispatchOption {
+	return func(d *dispatch) {
+		d.acceptLanguages = languages
+	}
+}
+
+// WithMaxPages stops the Dispatcher after maxPages results have been
+// produced. Values less than 1 mean there is no limit.
+func WithMaxPages(maxPages int) DispatchOption {
+	return func(d *dispatch) {
+		d.maxPages = maxPages
+	}
+}
+
+// WithHostErrorBudget stops urls being fetched from a host after
+// limit hard errors, such as connection failures, timeouts or 5xx
+// statuses. Values less than 1 mean there is no limit.
+func WithHostErrorBudget(limit int) DispatchOption {
+	return func(d *dispatch) {
+		d.hostErrors = newHostBudget(limit)
+	}
+}
+
+// WithDiagnostics writes the messages of the dispatch, such as its
+// heartbeat and the reasons it terminates, to w in place of the
+// package diagnostics writer. w must be safe for concurrent use.
+func WithDiagnostics(w io.Writer) DispatchOption {
+	return func(d *dispatch) {
+		d.diagnostics = w
+	}
+}
+
+// WithScope sets the scope of the urls followed, by default those on
+// the host of the base url.
+func WithScope(scope *urlScope) DispatchOption {
+	return func(d *dispatch) {
+		d.scope = scope
+	}
+}
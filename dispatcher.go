@@ -12,7 +12,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"runtime/debug"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -28,10 +32,17 @@ func (err linkError) Error() string {
 	return string(err)
 }
 
+// ErrPanic reports a url whose processing panicked
+var ErrPanic = errors.New("panic processing the page")
+
 const (
 	// Sentinel error for non html pages
 	NonHTMLPageType = linkError("NonHTMLPageType")
 	StatusNotOk     = linkError("StatusNotOk")
+	// Sentinel error for binary content served as html
+	MislabelledPage = linkError("MislabelledPage")
+	// Sentinel error for pages redirected off the site
+	ExternalRedirect = linkError("ExternalRedirect")
 )
 
 // Defaults
@@ -41,6 +52,12 @@ const (
 	GOWORKERS = 8
 	// LINKBUFFERSIZE is the size of the link buffer during processing
 	LINKBUFFERSIZE = 2500
+	// BUFFERGRACE is how long links wait for space in a full link
+	// buffer before they are dropped
+	BUFFERGRACE time.Duration = 10 * time.Second
+	// RESULTSBUFFERSIZE is the size of the buffer of results waiting to
+	// be consumed
+	RESULTSBUFFERSIZE = 100
 	// HTTPWORKERS is the number of concurrent web queries to run; this
 	// doesn't make sense to make much less than GOWORKERS
 	HTTPWORKERS = 8
@@ -54,46 +71,120 @@ const (
 	DISPATCHERTIMEOUT time.Duration = 1800 * time.Millisecond
 )
 
+// Termination reasons record why a Dispatcher stopped processing
+const (
+	TerminationIdle            = "idle timeout"
+	TerminationDeadline        = "deadline exceeded"
+	TerminationTooManyRequests = "too many requests"
+	TerminationWorkersDone     = "workers finished"
+	TerminationPageLimit       = "page limit reached"
+)
+
+// diagnostics is the io.Writer for Dispatcher messages, which are kept
+// separate from results output
+var diagnostics io.Writer = os.Stderr
+
+// urlSchemesToFollow are the schemes of the urls followed by default
+var urlSchemesToFollow = []string{"http", "https"}
+
+// parseSchemes parses url schemes given as one or more comma separated
+// lists, such as "http,https", into lowercase schemes without a trailing
+// colon
+func parseSchemes(specs []string) []string {
+	schemes := []string{}
+	for _, spec := range specs {
+		for _, s := range strings.Split(spec, ",") {
+			if s = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(s), ":")); s != "" {
+				schemes = append(schemes, s)
+			}
+		}
+	}
+	return schemes
+}
+
 // urlSuffixesToSkip are urls with extensions that should not be
 // followed.
 var urlSuffixesToSkip = []string{".png", ".jpg", ".jpeg", ".heic", ".svg"}
 
 var (
 	// ErrDispatchTimeoutTooSmall is an error message when the
-	// DISPATCHERTIMEOUT is set too small
-	ErrDispatchTimeoutTooSmall = errors.New(`
-	dispatcher timeout should not be smaller than the httptimeout as the
-	dispatcher will stop processing before the web calls have been
-	terminated.
-	`)
+	// dispatcher (idle) timeout is set too small
+	ErrDispatchTimeoutTooSmall = errors.New("dispatcher timeout should not be smaller than the http timeout " +
+		"as the dispatcher will stop processing before the web calls have been terminated")
 )
 
 // followURLs is a closure which returns true if a url has not been seen
-// before and the provided url matches the baseURL and does not match
-// one of the provided URLSuffixes. followURLs should only used in a
-// fully contained manner (by a single func) and therefore does not need
-// to be protected by a synchronisation primitive such as sync.Map.
-func followURLs(baseURL string) func(u string) bool {
-	uniqueURLs := map[string]bool{}
-	uniqueURLs[baseURL] = true
+// before in visited and the provided url has one of the provided
+// schemes, is within the scope and does not match one of the provided
+// skip suffixes. Hosts are compared in their punycode form. Urls which
+// are followed are added to visited, which is seeded with the base url
+// of the scope. As visited is safe for concurrent use, so is the
+// closure.
+func followURLs(scope *urlScope, visited VisitedSet, skip, schemes []string) func(u string) bool {
+	skipReason := urlSkipReason(scope, visited, skip, schemes)
 	return func(u string) bool {
+		return skipReason(u) == ""
+	}
+}
+
+// urlSkipReason returns a closure, like that of followURLs, returning
+// the reason a url is not followed, or "" if it is followed
+func urlSkipReason(scope *urlScope, visited VisitedSet, skip, schemes []string) func(u string) string {
+	visited.Follow(scope.base)
+	linkSkip := linkSkipReason(scope, skip, schemes)
+	return func(u string) string {
+		if reason := linkSkip(u); reason != "" {
+			return reason
+		}
+		if !visited.Follow(visitedURL(u)) {
+			return SkipSeen
+		}
+		return ""
+	}
+}
+
+// visitedURL returns the url u as it is recorded in the visited set,
+// without a trailing slash and normalised by normaliseURL
+func visitedURL(u string) string {
+	return normaliseURL(strings.TrimSuffix(u, "/"))
+}
+
+// linkSkipReason returns a closure returning the reason a url is not
+// followed because of its scheme, scope or suffix, or "", without
+// consulting or recording the urls seen. The closure is safe for
+// concurrent use, so that workers can discard links before sending
+// them to the dispatcher.
+func linkSkipReason(scope *urlScope, skip, schemes []string) func(u string) string {
+	return func(u string) string {
 		u = strings.TrimSuffix(u, "/") // shouldn't be necessary
-		if !strings.Contains(u, baseURL) {
-			return false
+		u = normaliseURL(u)
+		scheme, _, ok := strings.Cut(u, ":")
+		if !ok || !slices.Contains(schemes, strings.ToLower(scheme)) {
+			return SkipScheme // such as javascript:, mailto:, tel: or data: urls
 		}
-		if _, ok := uniqueURLs[u]; ok {
-			return false
+		if !scope.contains(u) {
+			return SkipExternal
 		}
-		for _, skip := range urlSuffixesToSkip {
-			if strings.HasSuffix(u, skip) {
-				return false
+		for _, suffix := range skip {
+			if strings.HasSuffix(u, suffix) {
+				return SkipSuffix + " " + suffix
 			}
 		}
-		uniqueURLs[u] = true
-		return true
+		return ""
 	}
 }
 
+// refLink is a link waiting to be processed, with the url of the page it
+// was found on, its depth from the base url, for the pages of a
+// paginated listing after the first, its page number and the anchor
+// linking to it
+type refLink struct {
+	url, referrer string
+	depth         int
+	page          int
+	anchor        linkAnchor
+}
+
 // dispatch encapsulates the components needed to make recursive web
 // calls: the base url, search terms, decorated http.Client and timeout
 // for the calls.
@@ -101,43 +192,92 @@ type dispatch struct {
 	baseURL           string
 	workers           int
 	linkBufferSize    int
+	bufferGrace       time.Duration // the wait for space in the link buffer
+	resultsBufferSize int           // results waiting for the consumer
 	httpRateSec       int
+	crawlDelay        time.Duration // asked for by the site, if any
+	scope             *urlScope     // the urls followed
 	searchTerms       []string
 	dispatcherTimeout time.Duration // processing timeout
 	ctxTimeout        time.Duration // program timeout
 	client            *getClient
+	filters           []URLFilter   // additional url filters
+	rewriters         []URLRewriter // rewrites applied to links before filtering
+	skipSuffixes      []string      // url suffixes not followed
+	schemes           []string      // url schemes followed
+	heartbeat         time.Duration // progress reporting interval
+	maxPages          int           // stop after this many results, if set
+	visited           VisitedSet    // urls seen during processing
+	maintenance       maintenance   // pause for maintenance windows
+	window            *timeWindow   // optional times requests are made
+	amp               ampPages      // canonical pages of AMP pages queued
+	journal           *journal      // optional frontier journal
+	resume            *frontier     // optional frontier to resume from
+	seeds             []refLink     // further links to start from
+	noFollow          bool          // do not follow the links of pages
+	acceptLanguages   []string      // optional languages each page is fetched in
+	hostErrors        *hostBudget   // optional limit on the hard errors of each host
+	verbose           *verboseLog   // optional reports of links not followed
+	fetches           *busyWorkers  // what each worker is fetching
+	diagnostics       io.Writer     // for messages, by default diagnostics
+	stats             Stats         // statistics collected during processing
 }
 
-// NewDispatch returns a pointer to a dispatch struct after
-// initialisation.
-func NewDispatch(
-	baseURL string,
-	workers int,
-	linkBufferSize int,
-	httpRateSec int,
-	searchTerms []string,
-	dispatcherTimeout time.Duration,
-	timeout time.Duration,
-	client *getClient,
-) *dispatch {
-	if workers < 1 {
-		workers = GOWORKERS
+// NewDispatch returns a pointer to a dispatch struct for baseURL after
+// initialisation with the provided DispatchOptions. Options which are
+// not provided, or are provided with values less than 1, take their
+// default values. By default there is no overall timeout.
+//
+// Each dispatch has its own client, rate limiter, visited set, filters
+// and Stats, so several may crawl concurrently in one process, as in
+// serve mode. Only what is passed to more than one dispatch, such as a
+// getClient, VisitedSet or URLFilter, is shared, and a getClient should
+// not be shared as it records the state of its crawl. Messages from
+// concurrent dispatches may be kept apart with WithDiagnostics.
+func NewDispatch(baseURL string, options ...DispatchOption) *dispatch {
+	d := dispatch{
+		baseURL:           normaliseURL(baseURL),
+		searchTerms:       []string{},
+		dispatcherTimeout: DISPATCHERTIMEOUT,
+		filters:           []URLFilter{},
+		rewriters:         []URLRewriter{},
+		skipSuffixes:      slices.Clone(urlSuffixesToSkip),
+		schemes:           slices.Clone(urlSchemesToFollow),
 	}
-	if linkBufferSize < 1 {
-		linkBufferSize = LINKBUFFERSIZE
+	for _, o := range options {
+		o(&d)
 	}
-	if httpRateSec < 1 {
-		httpRateSec = HTTPRATESEC
+	if d.workers < 1 {
+		d.workers = GOWORKERS
 	}
-	d := dispatch{
-		baseURL:           baseURL,
-		workers:           workers,
-		linkBufferSize:    linkBufferSize,
-		httpRateSec:       httpRateSec,
-		searchTerms:       searchTerms,
-		dispatcherTimeout: dispatcherTimeout,
-		ctxTimeout:        timeout,
-		client:            client,
+	if d.linkBufferSize < 1 {
+		d.linkBufferSize = LINKBUFFERSIZE
+	}
+	if d.bufferGrace <= 0 {
+		d.bufferGrace = BUFFERGRACE
+	}
+	if d.resultsBufferSize < 1 {
+		d.resultsBufferSize = RESULTSBUFFERSIZE
+	}
+	if d.httpRateSec < 1 {
+		d.httpRateSec = HTTPRATESEC
+	}
+	if d.dispatcherTimeout <= 0 {
+		d.dispatcherTimeout = DISPATCHERTIMEOUT
+	}
+	// wait for results for at least the delay between requests
+	d.dispatcherTimeout += d.crawlDelay
+	if d.client == nil {
+		d.client = NewGetClient(HTTPWORKERS, HTTPTIMEOUT)
+	}
+	if d.visited == nil {
+		d.visited = newVisitedSet()
+	}
+	if d.diagnostics == nil {
+		d.diagnostics = diagnostics
+	}
+	if d.scope == nil {
+		d.scope = hostScope(d.baseURL)
 	}
 	return &d
 }
@@ -145,30 +285,29 @@ func NewDispatch(
 // Dispatcher is a function for launching worker goroutines to process
 // getURL functions to produce Results. Since the initial page(s)
 // produce more links than can be easily processed, a buffered channel
-// is used to store urls waiting to be processed. If the channel becomes
-// full the program will start to shut down.
+// is used to store urls waiting to be processed. While the channel is
+// full the links found wait for space, holding up the workers finding
+// them, and are dropped if none is made for the buffer grace period, so
+// the crawl continues without them. Results are buffered for
+// the consumer; while the buffer is full the workers wait rather than
+// fetching, and the time waiting does not count towards the idle
+// timeout, so a slow consumer throttles the crawl instead of ending it.
 func (d *dispatch) Dispatcher() <-chan Result {
 
-	if d.ctxTimeout > 0 && d.ctxTimeout < d.client.client.Timeout {
-		fmt.Println(ErrDispatchTimeoutTooSmall)
-	}
-
-	type refLink struct {
-		url, referrer string
-	}
-
+	linkSkip := linkSkipReason(d.scope, d.skipSuffixes, d.schemes)
 	concurrentURLgetter := func(ctx context.Context, inputURLs <-chan refLink) (
 		<-chan Result, <-chan []refLink,
 	) {
 		results := make(chan Result)
-		outputLinks := make(chan []refLink)
+		outputLinks := make(chan []refLink) // a batch for each page with links
 
 		// use the x/time/rate token bucket rate limiter
-		rateLimit := rate.NewLimiter(rate.Limit(d.httpRateSec), 1)
+		rateLimit := rate.NewLimiter(d.rate(), 1)
 
 		var wg sync.WaitGroup
 		wg.Add(d.workers)
-		for range d.workers {
+		for i := range d.workers {
+			id := i + 1 // numbered from 1 in reports
 			go func() {
 				defer wg.Done()
 				for {
@@ -176,23 +315,118 @@ func (d *dispatch) Dispatcher() <-chan Result {
 					case <-ctx.Done():
 						return
 					case rl := <-inputURLs:
-						err := rateLimit.Wait(ctx)
-						if err != nil {
-							return // ctx timeout
+						// urls queued before their host used up its
+						// error budget are not fetched
+						if !d.hostErrors.allowed(rl.url) {
+							d.verbose.printf(VerboseLinks, "not fetching %s (from %s): %s", rl.url, rl.referrer, SkipHostErrors)
+							continue
 						}
-						result, links := d.client.getURL(rl.url, rl.referrer, d.searchTerms)
-						// done checks for each send of the results from
-						// getURLer are needed as getURLer may take some
-						// time. The guards are to stop sends causing
-						// goroutine leaks.
-						select {
-						case <-ctx.Done():
-							return
-						case results <- result:
+						// the page is fetched once for each language
+						// variant, the links of all the variants being
+						// followed
+						var refLinks []refLink
+						var sent map[string]bool       // links of the page, sent once
+						redirects := map[string]bool{} // whether each redirect is reported here
+						for _, language := range d.variants() {
+							var result Result
+							var links []string
+							var rateWait time.Duration
+							// fetch the url again after any maintenance
+							// window the site reports
+							for attempt := 1; ; attempt++ {
+								if err := d.window.wait(ctx, d.diagnostics); err != nil {
+									return // ctx timeout
+								}
+								if err := d.maintenance.wait(ctx, rl.url); err != nil {
+									return // ctx timeout
+								}
+								waitStart := time.Now()
+								err := rateLimit.Wait(ctx)
+								if err != nil {
+									return // ctx timeout
+								}
+								start := time.Now()
+								rateWait += start.Sub(waitStart)
+								result, links = d.fetch(id, rl, language, start)
+								result.depth, result.elapsed, result.page = rl.depth, time.Since(start), rl.page
+								result.rateWait = rateWait
+								result.anchor, result.worker = rl.anchor, id
+								d.verbose.printf(VerboseRequests, "worker %d fetched %s in %s", id, rl.url, result.elapsed.Round(time.Millisecond))
+								if result.retryAfter <= 0 || attempt == MAINTENANCERETRIES {
+									break
+								}
+								if d.maintenance.pause(rl.url, result.retryAfter) {
+									fmt.Fprintf(d.diagnostics, "service unavailable, pausing requests to %s for %s\n", urlHost(rl.url), result.retryAfter)
+								}
+							}
+							// a page redirected to a url which has been
+							// seen is reported with that url, so only the
+							// redirect is reported here; otherwise the
+							// redirected url is reported here and not
+							// fetched again
+							if result.redirect != "" && result.err != ExternalRedirect {
+								redirect := visitedURL(result.redirect)
+								followed, ok := redirects[redirect]
+								if !ok {
+									followed = d.visited.Follow(redirect)
+									redirects[redirect] = followed
+								}
+								if !followed {
+									result.matches, links = []SearchMatch{}, nil
+								}
+							}
+							result.violations = append(result.violations, d.amp.check(result)...)
+							// done checks for each send of the results
+							// from getURLer are needed as getURLer may
+							// take some time. The guards are to stop sends
+							// causing goroutine leaks.
+							select {
+							case <-ctx.Done():
+								return
+							case results <- result:
+							}
+							// rewrite the links and discard repeats, those
+							// already seen and those which are not followed
+							// whatever the urls seen, cutting the links sent
+							// to the dispatcher, which makes the final check
+							if d.noFollow {
+								links = nil
+							}
+							if sent == nil { // sized for the links of the first variant
+								refLinks = make([]refLink, 0, len(links))
+								sent = make(map[string]bool, len(links))
+							}
+							for _, l := range links {
+								isAMP := result.amp != "" && l == result.amp
+								for _, rw := range d.rewriters {
+									l = rw.Rewrite(l)
+								}
+								if len(d.rewriters) > 0 {
+									l = normaliseURL(l)
+								}
+								if sent[l] {
+									continue
+								}
+								sent[l] = true
+								if d.visited.Seen(l) {
+									continue
+								}
+								if reason := linkSkip(l); reason != "" {
+									d.verbose.printf(VerboseLinks, "not following %s (from %s): %s", l, result.url, reason)
+									continue
+								}
+								if isAMP {
+									d.amp.add(l, result) // checked when it is fetched
+								}
+								page := 0
+								if slices.Contains(result.next, l) {
+									page = max(rl.page, 1) + 1
+								}
+								refLinks = append(refLinks, refLink{l, result.url, rl.depth + 1, page, result.anchors[l]})
+							}
 						}
-						refLinks := []refLink{}
-						for _, l := range links {
-							refLinks = append(refLinks, refLink{l, result.url})
+						if len(refLinks) == 0 {
+							continue
 						}
 						select {
 						case <-ctx.Done():
@@ -211,8 +445,17 @@ func (d *dispatch) Dispatcher() <-chan Result {
 		return results, outputLinks
 	}
 
-	links := make(chan refLink, d.linkBufferSize)
-	resultsOutput := make(chan Result)
+	bufferSize := d.linkBufferSize + len(d.seeds)
+	if d.resume != nil {
+		bufferSize += len(d.resume.pending)
+	}
+	links := make(chan refLink, bufferSize)
+	resultsOutput := make(chan Result, d.resultsBufferSize)
+	d.stats = newStats()
+	d.stats.Scope = d.scope.String()
+	d.stats.WorkerPages = make([]int, d.workers)
+	d.fetches = newBusyWorkers(d.workers)
+	termination := ""
 
 	var ctx context.Context
 	var cancel context.CancelFunc
@@ -225,8 +468,56 @@ func (d *dispatch) Dispatcher() <-chan Result {
 
 	results, linksFound := concurrentURLgetter(ctx, links)
 
-	follow := followURLs(d.baseURL)
-	links <- refLink{url: d.baseURL, referrer: "/"} // start links with baseurl
+	skipReason := urlSkipReason(d.scope, d.visited, d.skipSuffixes, d.schemes)
+	follow := func(l refLink) bool {
+		reason := skipReason(l.url)
+		if reason == "" && !d.hostErrors.allowed(l.url) {
+			reason = SkipHostErrors
+		}
+		if reason == "" && !slices.ContainsFunc(d.filters, func(f URLFilter) bool { return !f.Follow(l.url) }) {
+			return true
+		}
+		if reason == "" {
+			reason = SkipFilter
+		}
+		if reason != SkipSeen {
+			d.verbose.printf(VerboseLinks, "not following %s (from %s): %s", l.url, l.referrer, reason)
+		}
+		return false
+	}
+	switch {
+	case d.resume != nil:
+		// resume with the pending links, not following those queued
+		// before
+		for _, u := range d.resume.queued {
+			d.visited.Follow(u)
+		}
+		for _, l := range d.resume.pending {
+			links <- l
+			d.stats.discover(l.depth)
+		}
+	default:
+		base := refLink{url: d.baseURL, referrer: "/"} // start links with baseurl
+		links <- base
+		d.stats.discover(0)
+		if d.journal != nil {
+			d.journal.add(base)
+		}
+		for _, s := range d.seeds {
+			if !follow(s) {
+				continue
+			}
+			links <- s
+			d.stats.discover(s.depth)
+			if d.journal != nil {
+				d.journal.add(s)
+			}
+		}
+		if d.journal != nil {
+			d.journal.flush()
+		}
+	}
+	d.stats.PeakQueueDepth = len(links) // the high-water mark of the queue
 
 	// define timeout and timeout reset function
 	timeout := time.NewTimer(d.dispatcherTimeout)
@@ -237,6 +528,61 @@ func (d *dispatch) Dispatcher() <-chan Result {
 		timeout.Reset(d.dispatcherTimeout)
 	}
 
+	// an optional heartbeat reports progress at an interval
+	var heartbeat <-chan time.Time
+	stopHeartbeat := func() {}
+	if d.heartbeat > 0 {
+		ticker := time.NewTicker(d.heartbeat)
+		heartbeat, stopHeartbeat = ticker.C, ticker.Stop
+	}
+
+	// links found by the workers wait for space in the links buffer,
+	// and are dropped if none is made for the buffer grace period
+	var pending []refLink
+	grace := time.NewTimer(d.bufferGrace)
+	if !grace.Stop() {
+		<-grace.C
+	}
+	waiting := false // for the grace period
+	stopGrace := func() {
+		if waiting && !grace.Stop() {
+			<-grace.C
+		}
+		waiting = false
+	}
+	queued := func(l refLink) {
+		if d.journal != nil {
+			d.journal.add(l)
+		}
+		d.stats.discover(l.depth)
+		d.stats.PeakQueueDepth = max(d.stats.PeakQueueDepth, len(links))
+	}
+	// enqueue queues the pending links while there is space, restarting
+	// the grace period if they made progress
+	enqueue := func(progress bool) {
+	fill:
+		for len(pending) > 0 {
+			select {
+			case links <- pending[0]:
+				queued(pending[0])
+				pending = pending[1:]
+				progress = true
+			default:
+				break fill
+			}
+		}
+		if d.journal != nil {
+			d.journal.flush()
+		}
+		if len(pending) == 0 || progress {
+			stopGrace()
+		}
+		if len(pending) > 0 && !waiting {
+			grace.Reset(d.bufferGrace)
+			waiting = true
+		}
+	}
+
 	// this func is the main coordinator of Dispatcher, putting incoming
 	// links from concurrentURLgetter onto the links buffered channel if
 	// they have not already been seen by follow() and sending results
@@ -244,43 +590,145 @@ func (d *dispatch) Dispatcher() <-chan Result {
 	go func() {
 		defer close(resultsOutput)
 		defer close(links)
+		defer stopHeartbeat()
+		defer grace.Stop()
 		defer func() {
 			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-				fmt.Printf("deadline of %s exceeded. quitting...\n", d.ctxTimeout)
+				termination = TerminationDeadline
+				fmt.Fprintf(d.diagnostics, "deadline of %s exceeded. quitting...\n", d.ctxTimeout)
 			}
+			d.stats.finish(termination)
 			cancel()
 		}()
 		for {
+			// while links are waiting for space in the buffer no more
+			// are received from the workers, holding them up
+			found, blocked, next := linksFound, (chan refLink)(nil), refLink{}
+			if len(pending) > 0 {
+				found, blocked, next = nil, links, pending[0]
+			}
 			select {
-			case hereLinks, ok := <-linksFound:
+			case hereLinks, ok := <-found:
 				if !ok {
+					termination = TerminationWorkersDone
 					return
 				}
+				// the batch is no longer used by the worker, and no
+				// links are pending, so it is filtered in place
+				pending = hereLinks[:0]
 				for _, l := range hereLinks {
-					if !follow(l.url) {
-						continue
-					}
-					select {
-					case links <- l:
-					default:
-						fmt.Println("no space left on buffer")
-						return
+					if follow(l) {
+						pending = append(pending, l)
 					}
 				}
+				enqueue(false)
+			case blocked <- next:
+				queued(next)
+				pending = pending[1:]
+				enqueue(true)
+			case <-grace.C:
+				waiting = false
+				fmt.Fprintf(d.diagnostics, "no space left on buffer for %s: dropping %d links\n", d.bufferGrace, len(pending))
+				d.stats.Dropped += len(pending)
+				pending = nil
 			case r, ok := <-results:
 				if !ok {
+					termination = TerminationWorkersDone
 					return
 				}
 				toResetter() // reset timeout
 				if r.status == http.StatusTooManyRequests {
-					fmt.Println("too many requests error. quitting...")
+					termination = TerminationTooManyRequests
+					fmt.Fprintln(d.diagnostics, "too many requests error. quitting...")
 					return
 				}
-				resultsOutput <- r
+				d.stats.add(r)
+				if host, usedUp := d.hostErrors.add(r); usedUp {
+					fmt.Fprintf(d.diagnostics, "host %s has had %d errors: not fetching further urls from it\n", host, d.hostErrors.limit)
+				}
+				if d.journal != nil {
+					d.journal.done(r.url)
+					d.journal.flush()
+				}
+				select {
+				case resultsOutput <- r:
+				default:
+					// wait for the consumer, holding up the workers
+					select {
+					case resultsOutput <- r:
+					case <-ctx.Done():
+						return
+					}
+					toResetter() // not idle while waiting
+				}
+				if d.maxPages > 0 && d.stats.Pages >= d.maxPages {
+					termination = TerminationPageLimit
+					return
+				}
+			case <-heartbeat:
+				fmt.Fprintf(d.diagnostics, "heartbeat: %d pages processed, %d links queued, %s elapsed, %s\n",
+					d.stats.Pages, len(links), time.Since(d.stats.Start).Round(time.Second), d.fetches.report(time.Now()))
 			case <-timeout.C:
+				if wait := max(d.maintenance.longest(), d.window.remaining()); wait > 0 {
+					timeout.Reset(wait + d.dispatcherTimeout) // idle during the pause
+					continue
+				}
+				if len(pending) > 0 {
+					timeout.Reset(d.dispatcherTimeout) // waiting for space in the buffer
+					continue
+				}
+				termination = TerminationIdle
 				return
 			}
 		}
 	}()
 	return resultsOutput
 }
+
+// variants returns the languages each page is fetched in, or a single
+// empty language if pages are fetched once without an Accept-Language
+// header of their own
+func (d *dispatch) variants() []string {
+	if len(d.acceptLanguages) == 0 {
+		return []string{""}
+	}
+	return d.acceptLanguages
+}
+
+// fetch fetches the url of rl with the client for worker id, starting
+// at start, asking for language if set. A panic while fetching or
+// processing the page, such as from a pathological page, is reported
+// and recovered from, giving an error result for the url so that the
+// crawl continues.
+func (d *dispatch) fetch(id int, rl refLink, language string, start time.Time) (result Result, links []string) {
+	d.fetches.start(id, rl.url, start)
+	defer d.fetches.done(id)
+	defer func() {
+		if p := recover(); p != nil {
+			fmt.Fprintf(d.diagnostics, "worker %d recovered from a panic processing %s: %v\n%s", id, rl.url, p, debug.Stack())
+			result = Result{url: rl.url, referrer: rl.referrer, language: language, matches: []SearchMatch{}, err: fmt.Errorf("%w: %v", ErrPanic, p)}
+			links = nil
+		}
+	}()
+	if language != "" {
+		return d.client.getVariant(rl.url, rl.referrer, language, d.searchTerms)
+	}
+	return d.client.getURL(rl.url, rl.referrer, d.searchTerms)
+}
+
+// rate returns the rate of http requests per second across all
+// workers: the rate set, or the rate allowed by the crawl delay if that
+// is slower
+func (d *dispatch) rate() rate.Limit {
+	limit := rate.Limit(d.httpRateSec)
+	if d.crawlDelay > 0 {
+		limit = min(limit, rate.Every(d.crawlDelay))
+	}
+	return limit
+}
+
+// Stats reports the statistics collected by the Dispatcher. It is only
+// valid after the channel returned by Dispatcher is closed.
+func (d *dispatch) Stats() Stats {
+	return d.stats
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"go.uber.org/goleak"
+	"golang.org/x/time/rate"
 )
 
 func TestLinkError(t *testing.T) {
@@ -34,10 +41,15 @@ func TestFollowURLs(t *testing.T) {
 		{"http://x.com/1.svg", false},  // svg
 		{"http://x.com/1.png", false},  // png
 		{"http://x.com/unique", true},  // unique
+		{"HTTP://x.com/upper", true},   // schemes are case insensitive
+		{"javascript:alert('http://x.com/js')", false},
+		{"mailto:info@x.com?cc=http://x.com/mail", false},
+		{"data:text/html,http://x.com/data", false},
+		{"tel:+44123", false},
 	}
 
 	// init
-	f := followURLs("http://x.com")
+	f := followURLs(hostScope("http://x.com"), newVisitedSet(), urlSuffixesToSkip, urlSchemesToFollow)
 
 	for i, tt := range tests {
 		t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
@@ -48,6 +60,116 @@ func TestFollowURLs(t *testing.T) {
 	}
 }
 
+func TestURLSkipReason(t *testing.T) {
+	f := urlSkipReason(hostScope("http://x.com"), newVisitedSet(), urlSuffixesToSkip, urlSchemesToFollow)
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://x.com/a", ""},
+		{"http://x.com/a", SkipSeen},
+		{"http://y.com/b", SkipExternal},
+		{"mailto:info@x.com", SkipScheme},
+		{"http://x.com/c.png", SkipSuffix + " .png"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
+			if got := f(tt.url); got != tt.want {
+				t.Errorf("%s got %q want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkSkipReason(t *testing.T) {
+	f := linkSkipReason(hostScope("http://x.com"), urlSuffixesToSkip, urlSchemesToFollow)
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://x.com/a", ""},
+		{"http://x.com/a", ""}, // not recorded as seen
+		{"http://y.com/b", SkipExternal},
+		{"mailto:info@x.com", SkipScheme},
+		{"http://x.com/c.png", SkipSuffix + " .png"},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
+			if got := f(tt.url); got != tt.want {
+				t.Errorf("%s got %q want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcherWorkerLinkFilter(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		links := []string{}
+		if url == "https://example.com" {
+			for range 100 {
+				links = append(links, "https://example.com/a", "https://example.org/b", "mailto:info@example.com")
+			}
+		}
+		return Result{url: url, referrer: referrer, status: 200, matches: []SearchMatch{}}, links
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	var buf bytes.Buffer
+	d := NewDispatch("https://example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+		WithVerbose(newVerboseLog(&buf, VerboseLinks)),
+	)
+	got := []string{}
+	for r := range d.Dispatcher() {
+		got = append(got, r.url)
+	}
+	slices.Sort(got)
+	want := []string{"https://example.com", "https://example.com/a"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+	// the repeated links are only reported once by the worker
+	for _, l := range []string{"https://example.org/b", "mailto:info@example.com"} {
+		if n := strings.Count(buf.String(), "not following "+l); n != 1 {
+			t.Errorf("%s reported %d times:\n%s", l, n, buf.String())
+		}
+	}
+}
+
+func TestFollowURLsSchemes(t *testing.T) {
+	f := followURLs(hostScope("x.com"), newVisitedSet(), nil, parseSchemes([]string{"HTTPS:, ftp"}))
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://x.com/a", true},
+		{"ftp://x.com/b", true},
+		{"http://x.com/c", false},
+		{"mailto:info@x.com", false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
+			if got, want := f(tt.url), tt.ok; got != want {
+				t.Errorf("%s got %t want %t", tt.url, got, want)
+			}
+		})
+	}
+}
+
+func TestParseSchemes(t *testing.T) {
+	got := parseSchemes([]string{"http, HTTPS:", "", "ftp"})
+	if diff := cmp.Diff([]string{"http", "https", "ftp"}, got); diff != "" {
+		t.Errorf("parseSchemes mismatch (-want +got):\n%s", diff)
+	}
+}
+
 // linkMaker is a generalised way of making links
 type linkMaker func() []string
 
@@ -131,13 +253,13 @@ func TestNewDispatch(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			d := NewDispatch(
 				tt.baseURL,
-				tt.workers,
-				tt.linkBufferSize,
-				tt.httpRateSec,
-				tt.searchTerms,
-				tt.dispatcherTimeout,
-				tt.timeout,
-				tt.client,
+				WithWorkers(tt.workers),
+				WithBufferSize(tt.linkBufferSize),
+				WithRate(tt.httpRateSec),
+				WithSearchTerms(tt.searchTerms...),
+				WithDispatcherTimeout(tt.dispatcherTimeout),
+				WithTimeout(tt.timeout),
+				WithClient(tt.client),
 			)
 			if got, want := d.workers, tt.wantWorkers; got != want {
 				t.Errorf("workers got %v != want %v", got, want)
@@ -160,6 +282,92 @@ func TestNewDispatch(t *testing.T) {
 			// tt.client not of interest
 		})
 	}
+
+	t.Run("unset_defaults", func(t *testing.T) {
+		d := NewDispatch("https://example.com")
+		if got, want := d.dispatcherTimeout, DISPATCHERTIMEOUT; got != want {
+			t.Errorf("dispatcherTimeout got %v != want %v", got, want)
+		}
+		if got, want := d.ctxTimeout, time.Duration(0); got != want {
+			t.Errorf("global timeout got %v != want %v", got, want)
+		}
+		if d.client == nil {
+			t.Error("default client not set")
+		}
+		if got, want := len(d.searchTerms), 0; got != want {
+			t.Errorf("searchterms got %d want %d", got, want)
+		}
+	})
+
+	t.Run("crawl_delay", func(t *testing.T) {
+		for _, tt := range []struct {
+			rateSec    int
+			crawlDelay time.Duration
+			want       rate.Limit
+		}{
+			{10, 0, 10},
+			{10, 2 * time.Second, 0.5},       // slower than the rate
+			{2, 100 * time.Millisecond, 2},   // faster than the rate
+			{10, 100 * time.Millisecond, 10}, // the same as the rate
+			{10, 250 * time.Millisecond, 4},  // fractional
+		} {
+			d := NewDispatch("https://example.com", WithRate(tt.rateSec), WithCrawlDelay(tt.crawlDelay))
+			if got := d.rate(); got != tt.want {
+				t.Errorf("rate %d crawl delay %s: got %v want %v", tt.rateSec, tt.crawlDelay, got, tt.want)
+			}
+			if got, want := d.dispatcherTimeout, DISPATCHERTIMEOUT+tt.crawlDelay; got != want {
+				t.Errorf("dispatcherTimeout got %v want %v", got, want)
+			}
+		}
+	})
+	t.Run("isolated", func(t *testing.T) {
+		var buf bytes.Buffer
+		d1 := NewDispatch("https://example.com", WithDiagnostics(&buf))
+		d2 := NewDispatch("https://example.org")
+		if d1.diagnostics != &buf || d2.diagnostics != diagnostics {
+			t.Error("diagnostics writers not set")
+		}
+		// the defaults are not shared between dispatches
+		d1.skipSuffixes[0], d1.schemes[0] = ".gif", "ftp"
+		if d2.skipSuffixes[0] != urlSuffixesToSkip[0] || d2.schemes[0] != urlSchemesToFollow[0] || urlSchemesToFollow[0] != "http" {
+			t.Errorf("defaults shared: %v %v", d2.skipSuffixes, d2.schemes)
+		}
+		if d1.client == d2.client || d1.visited == d2.visited {
+			t.Error("client or visited set shared")
+		}
+	})
+}
+
+func TestDispatcherFilters(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	links := prefixer("a", "b", "skip/c", "skip/d")
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		return Result{url: url, status: 200, matches: []SearchMatch{}}, links()
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	noSkip := URLFilterFunc(func(u string) bool {
+		return !strings.Contains(u, "/skip/")
+	})
+	d := NewDispatch("https://example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+		WithFilters(noSkip),
+	)
+	urls := []string{}
+	for r := range d.Dispatcher() {
+		urls = append(urls, r.url)
+	}
+	slices.Sort(urls)
+	want := []string{"https://example.com", "https://example.com/a", "https://example.com/b"}
+	if diff := cmp.Diff(want, urls); diff != "" {
+		t.Errorf("urls mismatch (-want +got):\n%s", diff)
+	}
 }
 
 func TestDispatcher(t *testing.T) {
@@ -195,7 +403,8 @@ func TestDispatcher(t *testing.T) {
 		links          linkMaker
 		resultChk      resultChecker
 		resultNo       int
-		dispatchMS     int // set the dispatcher timeout if not thistest.dispatchMS
+		dispatchMS     int    // set the dispatcher timeout if not thistest.dispatchMS
+		termination    string // termination reason, if checked
 	}{
 		{
 			workers:        1,
@@ -203,14 +412,16 @@ func TestDispatcher(t *testing.T) {
 			links:          prefixer([]string{"1", "2"}...),
 			resultChk:      eq, // equality checker
 			resultNo:       3,  // there will be 3 results
+			termination:    TerminationIdle,
 		},
 		{ // 1
-			// fails with not enough room in the buffer
+			// waits for room in the buffer
 			workers:        1,
 			linkbuffersize: 1,
 			links:          prefixer([]string{"1", "2"}...),
-			resultChk:      gt,
-			resultNo:       0,
+			resultChk:      eq,
+			resultNo:       3,
+			termination:    TerminationIdle,
 		},
 		{ // 2
 			// should proceed fine
@@ -257,8 +468,8 @@ func TestDispatcher(t *testing.T) {
 			resultNo:       7,
 		},
 		{ // 8
-			// fails with not enough room in the buffer after about
-			// 26/27 items
+			// the buffer fills after about 26/27 items, holding up the
+			// workers until the deadline
 			workers:        20,
 			linkbuffersize: 40,
 			links:          prefixerRandom(3), // keep generating new links
@@ -283,13 +494,12 @@ func TestDispatcher(t *testing.T) {
 			gc.getURL = getURLer
 
 			d := NewDispatch("https://example.com",
-				tt.workers,
-				tt.linkbuffersize,
-				httpRateSec,
-				[]string{},
-				timeout,
-				invocationTimeout,
-				gc,
+				WithWorkers(tt.workers),
+				WithBufferSize(tt.linkbuffersize),
+				WithRate(httpRateSec),
+				WithDispatcherTimeout(timeout),
+				WithTimeout(invocationTimeout),
+				WithClient(gc),
 			)
 			resultNo := 0
 			for range d.Dispatcher() {
@@ -298,6 +508,19 @@ func TestDispatcher(t *testing.T) {
 			if got, want := resultNo, tt.resultNo; !tt.resultChk(resultNo, tt.resultNo) {
 				t.Errorf("got %d want %d results", got, want)
 			}
+			stats := d.Stats()
+			if got, want := stats.Pages, resultNo; got != want {
+				t.Errorf("stats pages got %d want %d", got, want)
+			}
+			if stats.PeakQueueDepth > tt.linkbuffersize {
+				t.Errorf("peak queue depth %d exceeds buffer size %d", stats.PeakQueueDepth, tt.linkbuffersize)
+			}
+			if tt.termination == "" {
+				return
+			}
+			if got, want := stats.Termination, tt.termination; got != want {
+				t.Errorf("termination got %q want %q", got, want)
+			}
 		})
 	}
 }
@@ -384,13 +607,12 @@ func TestRateLimit(t *testing.T) {
 			gc.getURL = getURLer
 
 			d := NewDispatch("https://example.com",
-				tt.workers,
-				linkBufferSize,
-				tt.rateSec,
-				[]string{},
-				dispatcherTimeout,
-				time.Millisecond*time.Duration(tt.invokeTimeoutMS),
-				gc,
+				WithWorkers(tt.workers),
+				WithBufferSize(linkBufferSize),
+				WithRate(tt.rateSec),
+				WithDispatcherTimeout(dispatcherTimeout),
+				WithTimeout(time.Millisecond*time.Duration(tt.invokeTimeoutMS)),
+				WithClient(gc),
 			)
 			resultNo := 0
 			for range d.Dispatcher() {
@@ -404,3 +626,559 @@ func TestRateLimit(t *testing.T) {
 		})
 	}
 }
+
+func TestDispatcherHeartbeat(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	var buf bytes.Buffer
+	diagnostics = &buf
+	defer func() { diagnostics = os.Stderr }()
+
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		time.Sleep(10 * time.Millisecond)
+		return Result{url: url, status: 200, matches: []SearchMatch{}}, prefixerRandom(1)()
+	}
+	gc := NewGetClient(1, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	d := NewDispatch("https://example.com",
+		WithWorkers(1),
+		WithRate(100000),
+		WithTimeout(100*time.Millisecond),
+		WithClient(gc),
+		WithHeartbeat(20*time.Millisecond),
+	)
+	for range d.Dispatcher() {
+	}
+	if got := strings.Count(buf.String(), "heartbeat: "); got < 2 {
+		t.Errorf("got %d heartbeats want at least 2:\n%s", got, buf.String())
+	}
+}
+
+func TestDispatcherMaxPages(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	site := map[string][]string{
+		"https://example.com":   prefixer("a", "b")(),
+		"https://example.com/a": prefixer("a/1", "a/2")(),
+		"https://example.com/b": prefixer("b/1", "a")(),
+	}
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		return Result{url: url, status: 200, matches: []SearchMatch{}}, site[url]
+	}
+	gc := NewGetClient(1, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	// a single worker processes urls in the order they are queued
+	d := NewDispatch("https://example.com",
+		WithWorkers(1),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+		WithMaxPages(3),
+	)
+	depths := []int{}
+	for r := range d.Dispatcher() {
+		depths = append(depths, r.depth)
+	}
+	if diff := cmp.Diff([]int{0, 1, 1}, depths); diff != "" {
+		t.Errorf("depths mismatch (-want +got):\n%s", diff)
+	}
+	stats := d.Stats()
+	if got, want := stats.Termination, TerminationPageLimit; got != want {
+		t.Errorf("termination got %s want %s", got, want)
+	}
+	if diff := cmp.Diff([]int{1, 2, 2}, stats.Discovered); diff != "" {
+		t.Errorf("discovered mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDispatcherSlowConsumer(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	site := map[string][]string{
+		"https://example.com":   prefixer("a", "b", "c")(),
+		"https://example.com/a": prefixer("a/1", "a/2")(),
+	}
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		return Result{url: url, status: 200, matches: []SearchMatch{}}, site[url]
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	// the consumer takes longer over each result than the idle timeout
+	d := NewDispatch("https://example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithResultsBufferSize(1),
+		WithClient(gc),
+	)
+	got := 0
+	for range d.Dispatcher() {
+		time.Sleep(80 * time.Millisecond)
+		got++
+	}
+	if want := 6; got != want {
+		t.Errorf("got %d want %d results", got, want)
+	}
+	if got, want := d.Stats().Termination, TerminationIdle; got != want {
+		t.Errorf("termination got %s want %s", got, want)
+	}
+}
+
+func TestDispatcherRewriters(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		links := []string{}
+		if url == "https://staging.example.com" {
+			links = []string{"https://www.example.com/a", "https://www.example.com/b"}
+		}
+		return Result{url: url, status: 200, matches: []SearchMatch{}}, links
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	toStaging := URLRewriterFunc(func(u string) string {
+		return strings.Replace(u, "https://www.", "https://staging.", 1)
+	})
+	d := NewDispatch("https://staging.example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+		WithRewriters(toStaging),
+	)
+	urls := []string{}
+	for r := range d.Dispatcher() {
+		urls = append(urls, r.url)
+	}
+	slices.Sort(urls)
+	want := []string{"https://staging.example.com", "https://staging.example.com/a", "https://staging.example.com/b"}
+	if diff := cmp.Diff(want, urls); diff != "" {
+		t.Errorf("urls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDispatcherRedirects(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	tests := []struct {
+		baseLinks []string
+		redirect  string
+		wantURLs  []string
+	}{
+		{
+			// the new page is also linked, so whichever of the two is
+			// fetched second is only reported as a redirect
+			baseLinks: []string{"https://example.com/new", "https://example.com/old"},
+			redirect:  "https://example.com/new",
+			wantURLs:  []string{"https://example.com", "https://example.com/new", "https://example.com/old"},
+		},
+		{
+			// the new page is only reached by the redirect, so is
+			// reported with the old page and not fetched again
+			baseLinks: []string{"https://example.com/old"},
+			redirect:  "https://example.com/new",
+			wantURLs:  []string{"https://example.com", "https://example.com/old"},
+		},
+		{
+			// the redirect is recorded as the link to the new page is,
+			// once normalised
+			baseLinks: []string{"https://example.com/new", "https://example.com/old"},
+			redirect:  "https://EXAMPLE.com/n%65w/",
+			wantURLs:  []string{"https://example.com", "https://example.com/new", "https://example.com/old"},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+				r := Result{url: url, status: 200, matches: []SearchMatch{{1, "hi", 0}}}
+				switch url {
+				case "https://example.com":
+					return r, tt.baseLinks
+				case "https://example.com/old":
+					r.redirect = tt.redirect
+				}
+				return r, []string{"https://example.com/new"}
+			}
+			gc := NewGetClient(2, 20*time.Millisecond)
+			gc.getURL = getURLer
+			d := NewDispatch("https://example.com",
+				WithWorkers(2),
+				WithRate(100000),
+				WithDispatcherTimeout(50*time.Millisecond),
+				WithClient(gc),
+			)
+			urls := []string{}
+			matched := 0 // pages with matches other than the base url
+			for r := range d.Dispatcher() {
+				urls = append(urls, r.url)
+				if r.url != "https://example.com" && len(r.matches) > 0 {
+					matched++
+				}
+			}
+			slices.Sort(urls)
+			if diff := cmp.Diff(tt.wantURLs, urls); diff != "" {
+				t.Errorf("urls mismatch (-want +got):\n%s", diff)
+			}
+			if got, want := matched, 1; got != want {
+				t.Errorf("got %d want %d pages with matches", got, want)
+			}
+		})
+	}
+}
+
+func TestDispatcherSeeds(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		return Result{url: url, referrer: referrer, status: 200, matches: []SearchMatch{}}, []string{}
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	d := NewDispatch("https://example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+		WithSeeds(
+			refLink{url: "https://example.com/a", referrer: "sitemap", depth: 1},
+			refLink{url: "https://example.com", referrer: "sitemap", depth: 1},   // the base url
+			refLink{url: "https://example.org/b", referrer: "sitemap", depth: 1}, // another site
+		),
+	)
+	got := []string{}
+	for r := range d.Dispatcher() {
+		got = append(got, r.url+" "+r.referrer)
+	}
+	slices.Sort(got)
+	want := []string{"https://example.com /", "https://example.com/a sitemap"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDispatcherAcceptLanguages(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	getVariant := func(url, referrer, language string, searchTerms []string) (Result, []string) {
+		links := []string{"https://example.com/about"}
+		if language == "de" {
+			links = append(links, "https://example.com/impressum")
+		}
+		return Result{url: url, referrer: referrer, language: language, status: 200, matches: []SearchMatch{}}, links
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getVariant = getVariant
+
+	d := NewDispatch("https://example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+		WithAcceptLanguages("en", "de"),
+	)
+	got := []string{}
+	for r := range d.Dispatcher() {
+		got = append(got, r.url+" "+r.language)
+	}
+	slices.Sort(got)
+	want := []string{
+		"https://example.com de",
+		"https://example.com en",
+		"https://example.com/about de",
+		"https://example.com/about en",
+		"https://example.com/impressum de",
+		"https://example.com/impressum en",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDispatcherBufferGrace(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		if url != "https://example.com" {
+			time.Sleep(50 * time.Millisecond)
+			return Result{url: url, status: 200, matches: []SearchMatch{}}, []string{}
+		}
+		return Result{url: url, status: 200, matches: []SearchMatch{}},
+			[]string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+	}
+	gc := NewGetClient(1, 100*time.Millisecond)
+	gc.getURL = getURLer
+
+	var buf lockedBuffer
+	d := NewDispatch("https://example.com",
+		WithWorkers(1),
+		WithBufferSize(1),
+		WithBufferGrace(10*time.Millisecond),
+		WithRate(100000),
+		WithDispatcherTimeout(100*time.Millisecond),
+		WithClient(gc),
+		WithDiagnostics(&buf),
+	)
+	got := []string{}
+	for r := range d.Dispatcher() {
+		got = append(got, r.url)
+	}
+	// a is queued, b as soon as the worker takes a, and c is dropped
+	// while the worker fetches a
+	want := []string{"https://example.com", "https://example.com/a", "https://example.com/b"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+	stats := d.Stats()
+	if got, want := stats.Dropped, 1; got != want {
+		t.Errorf("got %d want %d links dropped", got, want)
+	}
+	if got, want := stats.Termination, TerminationIdle; got != want {
+		t.Errorf("termination got %q want %q", got, want)
+	}
+	if got, want := buf.String(), "no space left on buffer for 10ms: dropping 1 links\n"; got != want {
+		t.Errorf("got diagnostics %q want %q", got, want)
+	}
+}
+
+func TestDispatcherNoFollow(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		return Result{url: url, referrer: referrer, status: 200, matches: []SearchMatch{}},
+			[]string{"https://example.com/linked"}
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	d := NewDispatch("https://example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+		WithNoFollow(),
+		WithSeeds(refLink{url: "https://example.com/a", referrer: "sitemap", depth: 1}),
+	)
+	got := []string{}
+	for r := range d.Dispatcher() {
+		got = append(got, r.url)
+	}
+	slices.Sort(got)
+	want := []string{"https://example.com", "https://example.com/a"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDispatcherPanic(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	var buf bytes.Buffer
+	diagnostics = &buf
+	defer func() { diagnostics = os.Stderr }()
+
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		if url == "https://example.com/bad" {
+			var m map[string]int
+			m["pathological"]++ // panics
+		}
+		return Result{url: url, status: 200, matches: []SearchMatch{}}, prefixer("bad", "good")()
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	d := NewDispatch("https://example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+	)
+	got := map[string]bool{}
+	for r := range d.Dispatcher() {
+		got[r.url] = errors.Is(r.err, ErrPanic)
+	}
+	want := map[string]bool{"https://example.com": false, "https://example.com/bad": true, "https://example.com/good": false}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := d.Stats().ErrorKinds["panic"], 1; got != want {
+		t.Errorf("got %d want %d panic errors", got, want)
+	}
+	if !strings.Contains(buf.String(), "recovered from a panic processing https://example.com/bad: assignment to entry in nil map") {
+		t.Errorf("panic not reported:\n%s", buf.String())
+	}
+}
+
+func TestDispatcherHostErrorBudget(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	var buf bytes.Buffer
+	diagnostics = &buf
+	defer func() { diagnostics = os.Stderr }()
+
+	// the pages of a subdomain fail
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		r := Result{url: url, referrer: referrer, status: 200, matches: []SearchMatch{}}
+		if strings.HasPrefix(url, "https://bad.example.com") {
+			r.status, r.err = http.StatusBadGateway, StatusNotOk
+			return r, nil
+		}
+		if url != "https://example.com" {
+			return r, nil
+		}
+		links := []string{}
+		for i := range 10 {
+			links = append(links, fmt.Sprintf("https://bad.example.com/%d", i), fmt.Sprintf("https://example.com/%d", i))
+		}
+		return r, links
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getURL = getURLer
+	scope, err := newURLScope(SCOPEDOMAIN, "https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDispatch("https://example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+		WithHostErrorBudget(3),
+		WithScope(scope),
+	)
+	failed, fetched := 0, 0
+	for r := range d.Dispatcher() {
+		if r.err != nil {
+			failed++
+		} else {
+			fetched++
+		}
+	}
+	// workers may fetch urls of the host while its last errors are
+	// being counted
+	if failed < 3 || failed > 3+2 {
+		t.Errorf("got %d failed pages want 3 to 5", failed)
+	}
+	if got, want := fetched, 11; got != want {
+		t.Errorf("got %d want %d pages fetched", got, want)
+	}
+	if !strings.Contains(buf.String(), "host bad.example.com has had 3 errors: not fetching further urls from it") {
+		t.Errorf("budget not reported:\n%s", buf.String())
+	}
+	buf.Reset()
+	d.hostErrors.report(&buf)
+	want := fmt.Sprintf("host bad.example.com error budget of 3 used up: %d urls not fetched\n", 10-failed)
+	if got := buf.String(); got != want {
+		t.Errorf("got report %q want %q", got, want)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *lockedBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+func TestDispatcherConcurrent(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	// sites of different sizes crawled at the same time share nothing:
+	// each reports only its own pages, stats and messages
+	sites := []struct {
+		baseURL string
+		pages   int
+	}{
+		{"https://a.example.com", 5},
+		{"https://b.example.com", 9},
+		{"https://c.example.com", 1},
+	}
+	type crawlResult struct {
+		urls        []string
+		stats       Stats
+		diagnostics string
+	}
+	crawls := make([]crawlResult, len(sites))
+
+	var wg sync.WaitGroup
+	for i, site := range sites {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+				links := []string{}
+				if url == site.baseURL {
+					for p := 1; p < site.pages; p++ {
+						links = append(links, fmt.Sprintf("%s/%d", site.baseURL, p))
+					}
+					links = append(links, "https://elsewhere.example.com/")
+				}
+				return Result{url: url, status: 200, matches: []SearchMatch{}}, links
+			}
+			gc := NewGetClient(2, 20*time.Millisecond)
+			gc.getURL = getURLer
+			var buf lockedBuffer
+			d := NewDispatch(site.baseURL,
+				WithWorkers(2),
+				WithRate(100000),
+				WithDispatcherTimeout(50*time.Millisecond),
+				WithClient(gc),
+				WithHeartbeat(10*time.Millisecond),
+				WithDiagnostics(&buf),
+			)
+			for r := range d.Dispatcher() {
+				crawls[i].urls = append(crawls[i].urls, r.url)
+			}
+			crawls[i].stats = d.Stats()
+			crawls[i].diagnostics = buf.String()
+		}()
+	}
+	wg.Wait()
+
+	for i, site := range sites {
+		c := crawls[i]
+		if got, want := len(c.urls), site.pages; got != want {
+			t.Errorf("%s got %d want %d results", site.baseURL, got, want)
+		}
+		for _, u := range c.urls {
+			if !strings.HasPrefix(u, site.baseURL) {
+				t.Errorf("%s got result for %s", site.baseURL, u)
+			}
+		}
+		if got, want := c.stats.Pages, site.pages; got != want {
+			t.Errorf("%s got %d want %d pages in stats", site.baseURL, got, want)
+		}
+		if !strings.Contains(c.diagnostics, fmt.Sprintf("heartbeat: %d pages processed", site.pages)) {
+			t.Errorf("%s heartbeat not reported with its own pages:\n%s", site.baseURL, c.diagnostics)
+		}
+	}
+}
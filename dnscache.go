@@ -0,0 +1,176 @@
+// dnscache.go provides an in-process cache of dns lookups, so that a
+// crawl making many requests a second to the same hosts does not look
+// each host up again for every connection. Lookups are kept for the ttl
+// of their records, which the go resolver does not report, so the ttls
+// are read from the dns responses as they are received.
+
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSCACHEDEFAULTTTL is how long a lookup is cached when the ttl of its
+// records is not known, such as for hosts in /etc/hosts
+const DNSCACHEDEFAULTTTL time.Duration = time.Minute
+
+// dnsLookup is a cached or in-flight lookup of a host
+type dnsLookup struct {
+	done    chan struct{} // closed when the lookup is complete
+	addrs   []net.IPAddr
+	err     error
+	expires time.Time
+}
+
+// dnsCache caches the addresses of hosts, which are kept for the ttl
+// of their dns records or, if set, for ttl. Concurrent lookups of the
+// same host are made once. Failed lookups are not cached. A dnsCache is
+// safe for concurrent use.
+type dnsCache struct {
+	ttl      time.Duration // overriding the record ttls, if more than 0
+	resolver *net.Resolver
+	dialer   *net.Dialer
+	now      func() time.Time
+	mu       sync.Mutex
+	lookups  map[string]*dnsLookup
+	ttls     map[string]time.Duration // the least record ttl seen, by name
+}
+
+// newDNSCache makes a dnsCache, keeping lookups for the ttl of their
+// records, or for ttl if it is more than 0
+func newDNSCache(ttl time.Duration) *dnsCache {
+	c := &dnsCache{
+		ttl:     ttl,
+		dialer:  &net.Dialer{},
+		now:     time.Now,
+		lookups: map[string]*dnsLookup{},
+		ttls:    map[string]time.Duration{},
+	}
+	c.resolver = &net.Resolver{PreferGo: true, Dial: c.dialDNS}
+	return c
+}
+
+// dialDNS dials a dns server for the resolver, recording the ttls of
+// the records in the responses received over udp
+func (c *dnsCache) dialDNS(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := c.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if udp, ok := conn.(*net.UDPConn); ok {
+		return &ttlConn{UDPConn: udp, cache: c}, nil
+	}
+	return conn, nil
+}
+
+// ttlConn is a connection to a dns server over udp, on which each read
+// is a whole dns message. It is a net.PacketConn, which the resolver
+// needs to send messages as datagrams.
+type ttlConn struct {
+	*net.UDPConn
+	cache *dnsCache
+}
+
+// Read reads a dns message, recording the ttls of its answers
+func (t *ttlConn) Read(b []byte) (int, error) {
+	n, err := t.UDPConn.Read(b)
+	if n > 0 {
+		t.cache.recordTTLs(b[:n])
+	}
+	return n, err
+}
+
+// recordTTLs records the least ttl of the answers of a dns response by
+// the name asked about. Messages which cannot be parsed are ignored.
+func (c *dnsCache) recordTTLs(msg []byte) {
+	var p dnsmessage.Parser
+	if _, err := p.Start(msg); err != nil {
+		return
+	}
+	question, err := p.Question()
+	if err != nil {
+		return
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return
+	}
+	answers, err := p.AllAnswers()
+	if err != nil || len(answers) == 0 {
+		return
+	}
+	least := time.Duration(answers[0].Header.TTL) * time.Second
+	for _, a := range answers[1:] {
+		least = min(least, time.Duration(a.Header.TTL)*time.Second)
+	}
+	name := dnsName(question.Name.String())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ttl, ok := c.ttls[name]; !ok || least < ttl {
+		c.ttls[name] = least
+	}
+}
+
+// dnsName returns host as a name is recorded, in lowercase and without
+// a trailing dot
+func dnsName(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// lookup returns the addresses of host, from the cache if they have not
+// expired
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	name := dnsName(host)
+	c.mu.Lock()
+	l, ok := c.lookups[name]
+	if ok {
+		select {
+		case <-l.done:
+			if c.now().After(l.expires) {
+				ok = false
+			}
+		default: // in flight
+		}
+	}
+	if !ok {
+		l = &dnsLookup{done: make(chan struct{})}
+		c.lookups[name] = l
+		delete(c.ttls, name)
+		c.mu.Unlock()
+		c.resolve(ctx, name, l)
+		return l.addrs, l.err
+	}
+	c.mu.Unlock()
+	select {
+	case <-l.done:
+		return l.addrs, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// resolve looks up name for l, setting when it expires
+func (c *dnsCache) resolve(ctx context.Context, name string, l *dnsLookup) {
+	defer close(l.done)
+	l.addrs, l.err = c.resolver.LookupIPAddr(ctx, name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l.err != nil {
+		delete(c.lookups, name) // looked up again next time
+		return
+	}
+	ttl, ok := c.ttls[name]
+	switch {
+	case c.ttl > 0:
+		ttl = c.ttl
+	case !ok:
+		ttl = DNSCACHEDEFAULTTTL
+	}
+	l.expires = c.now().Add(ttl)
+	delete(c.ttls, name)
+}
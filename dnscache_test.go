@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNSServer answers A queries for names ending in site.test. with
+// 127.0.0.1 and a ttl of 300 seconds, and other queries with no
+// answers, counting the queries for each name
+type fakeDNSServer struct {
+	conn    net.PacketConn
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+func newFakeDNSServer(t *testing.T) *fakeDNSServer {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeDNSServer{conn: conn, queries: map[string]int{}}
+	go f.serve()
+	t.Cleanup(func() { conn.Close() })
+	return f
+}
+
+func (f *fakeDNSServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var p dnsmessage.Parser
+		header, err := p.Start(buf[:n])
+		if err != nil {
+			continue
+		}
+		q, err := p.Question()
+		if err != nil {
+			continue
+		}
+		f.mu.Lock()
+		f.queries[q.Name.String()]++
+		f.mu.Unlock()
+
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true})
+		if q.Name.String() == "missing.test." {
+			b = dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RCode: dnsmessage.RCodeNameError})
+		}
+		b.StartQuestions()
+		b.Question(q)
+		b.StartAnswers()
+		if q.Type == dnsmessage.TypeA && q.Name.String() == "site.test." {
+			b.AResource(
+				dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 300},
+				dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+			)
+		}
+		msg, err := b.Finish()
+		if err != nil {
+			continue
+		}
+		f.conn.WriteTo(msg, addr)
+	}
+}
+
+// count returns the number of queries for name
+func (f *fakeDNSServer) count(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queries[name]
+}
+
+// testDNSCache makes a dnsCache with ttl using the fake dns server
+func testDNSCache(f *fakeDNSServer, ttl time.Duration) *dnsCache {
+	c := newDNSCache(ttl)
+	c.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return c.dialDNS(ctx, "udp", f.conn.LocalAddr().String())
+		},
+	}
+	return c
+}
+
+func TestDNSCacheLookup(t *testing.T) {
+
+	f := newFakeDNSServer(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := testDNSCache(f, 0)
+	c.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs, err := c.lookup(ctx, "SITE.test")
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+				return
+			}
+			if len(addrs) != 1 || addrs[0].String() != "127.0.0.1" {
+				t.Errorf("unexpected addresses %v", addrs)
+			}
+		}()
+	}
+	wg.Wait()
+	queries := f.count("site.test.")
+	if queries == 0 || queries > 2 { // one each for A and AAAA
+		t.Errorf("got %d queries want 1 or 2", queries)
+	}
+	// the ttl of the record is used
+	if _, ok := c.lookups["site.test"]; !ok {
+		t.Fatal("lookup not cached")
+	}
+	if got, want := c.lookups["site.test"].expires, now.Add(300*time.Second); !got.Equal(want) {
+		t.Errorf("expires got %s want %s", got, want)
+	}
+
+	// the lookup is made again once it expires
+	now = now.Add(301 * time.Second)
+	if _, err := c.lookup(ctx, "site.test"); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.count("site.test."); got <= queries {
+		t.Errorf("got %d queries after expiry want more than %d", got, queries)
+	}
+
+	// failed lookups are not cached
+	if _, err := c.lookup(ctx, "missing.test"); err == nil {
+		t.Error("expected error")
+	}
+	if _, ok := c.lookups["missing.test"]; ok {
+		t.Error("failed lookup cached")
+	}
+}
+
+func TestDNSCacheTTLOverride(t *testing.T) {
+
+	f := newFakeDNSServer(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := testDNSCache(f, 10*time.Second)
+	c.now = func() time.Time { return now }
+
+	if _, err := c.lookup(context.Background(), "site.test"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.lookups["site.test"].expires, now.Add(10*time.Second); !got.Equal(want) {
+		t.Errorf("expires got %s want %s", got, want)
+	}
+}
+
+func TestDNSCacheRecordTTLs(t *testing.T) {
+
+	name := dnsmessage.MustNewName("Example.COM.")
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET})
+	b.StartAnswers()
+	for _, ttl := range []uint32{600, 60, 3600} {
+		b.AResource(
+			dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: ttl},
+			dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newDNSCache(0)
+	c.recordTTLs([]byte("not a dns message"))
+	c.recordTTLs(msg)
+	if got, want := c.ttls["example.com"], time.Minute; got != want {
+		t.Errorf("got ttl %s want %s", got, want)
+	}
+	if got, want := len(c.ttls), 1; got != want {
+		t.Errorf("got %d want %d ttls", got, want)
+	}
+}
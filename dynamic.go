@@ -0,0 +1,141 @@
+// dynamic.go detects pages with dynamic content, whose visible text is
+// different each time they are fetched, such as pages showing the time,
+// a rotating banner or a session token. A sample of the pages of a
+// crawl is fetched twice more once it has finished, with cache-busting
+// query parameters so that neither the site's caches nor a response
+// cache answer, and the pages whose text differs between the fetches
+// are reported, since they make noise in the reports of --changes.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DYNAMICPARAM is the query parameter added to the urls of the pages
+// sampled to bust caches
+const DYNAMICPARAM = "webchk"
+
+// dynamicAudit is an OutputSink keeping a random sample of the html
+// pages found, before writing their results to its OutputSink
+type dynamicAudit struct {
+	sink   OutputSink
+	size   int      // of the sample
+	seen   int      // html pages seen
+	sample []string // the urls sampled
+}
+
+// newDynamicAudit makes a dynamicAudit sampling size pages for sink
+func newDynamicAudit(sink OutputSink, size int) *dynamicAudit {
+	return &dynamicAudit{sink: sink, size: size}
+}
+
+// Write adds the url of the result to the sample if it is an html page,
+// keeping each page equally likely to be sampled, and writes the result
+func (a *dynamicAudit) Write(r Result) error {
+	if r.err == nil && strings.Contains(r.contentType, "text/html") {
+		a.seen++
+		switch {
+		case len(a.sample) < a.size:
+			a.sample = append(a.sample, r.url)
+		default:
+			if i := rand.IntN(a.seen); i < a.size {
+				a.sample[i] = r.url
+			}
+		}
+	}
+	return a.sink.Write(r)
+}
+
+// Close closes the sink
+func (a *dynamicAudit) Close(stats Stats) error {
+	return a.sink.Close(stats)
+}
+
+// dynamicPage is a page of the sample whose content differs between
+// fetches, or which could not be fetched
+type dynamicPage struct {
+	url string
+	err error
+}
+
+// check fetches each page of the sample twice with the getClient,
+// returning those whose visible text differs or which could not be
+// fetched, sorted by url
+func (a *dynamicAudit) check(g *getClient) []dynamicPage {
+	pages := []dynamicPage{}
+	for _, u := range a.sample {
+		checksums := [2]string{}
+		var err error
+		for i := range checksums {
+			if checksums[i], err = g.pageChecksum(cacheBustingURL(u)); err != nil {
+				break
+			}
+		}
+		switch {
+		case err != nil:
+			pages = append(pages, dynamicPage{u, err})
+		case checksums[0] != checksums[1]:
+			pages = append(pages, dynamicPage{u, nil})
+		}
+	}
+	slices.SortFunc(pages, func(a, b dynamicPage) int { return strings.Compare(a.url, b.url) })
+	return pages
+}
+
+// report checks the sample with the getClient, writing the pages with
+// dynamic content, and those which could not be checked, to w
+func (a *dynamicAudit) report(w io.Writer, g *getClient) {
+	if len(a.sample) == 0 {
+		fmt.Fprintln(w, "dynamic content: no pages were sampled")
+		return
+	}
+	pages := a.check(g)
+	dynamic := 0
+	for _, p := range pages {
+		if p.err == nil {
+			dynamic++
+		}
+	}
+	fmt.Fprintf(w, "\n== dynamic content ==\npages sampled: %d, with content differing between fetches: %d\n", len(a.sample), dynamic)
+	for _, p := range pages {
+		if p.err != nil {
+			fmt.Fprintf(w, "  %s : not checked: %v\n", p.url, p.err)
+			continue
+		}
+		fmt.Fprintf(w, "  %s\n", p.url)
+	}
+}
+
+// cacheBustingURL returns rawURL with a DYNAMICPARAM query parameter
+// with a random value, or rawURL if it cannot be parsed
+func cacheBustingURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	q.Set(DYNAMICPARAM, strconv.FormatUint(rand.Uint64(), 36))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// pageChecksum fetches the page at url with the getClient, returning the
+// contentChecksum of its visible text
+func (g *getClient) pageChecksum(url string) (string, error) {
+	body, status, err := g.fetch(url)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("status %d", status)
+	}
+	return contentChecksum(body), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDynamicAuditSample(t *testing.T) {
+
+	sink := &resultsSink{}
+	a := newDynamicAudit(sink, 2)
+	for i := range 10 {
+		r := Result{url: fmt.Sprintf("https://example.com/%d", i), contentType: "text/html"}
+		if i == 0 {
+			r.contentType = "image/png"
+		}
+		if i == 1 {
+			r.err = StatusNotOk
+		}
+		if err := a.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := len(sink.urls), 10; got != want {
+		t.Errorf("got %d want %d results written", got, want)
+	}
+	if got, want := a.seen, 8; got != want {
+		t.Errorf("got %d want %d html pages seen", got, want)
+	}
+	if got, want := len(a.sample), 2; got != want {
+		t.Fatalf("got %d want %d pages sampled", got, want)
+	}
+	for _, u := range a.sample {
+		if u == "https://example.com/0" || u == "https://example.com/1" {
+			t.Errorf("%s should not be sampled", u)
+		}
+	}
+}
+
+func TestCacheBustingURL(t *testing.T) {
+
+	first := cacheBustingURL("https://example.com/a?q=1")
+	second := cacheBustingURL("https://example.com/a?q=1")
+	if first == second {
+		t.Errorf("urls should differ: %s", first)
+	}
+	u, err := url.Parse(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("q"); got != "1" {
+		t.Errorf("got q %q want 1", got)
+	}
+	if u.Query().Get(DYNAMICPARAM) == "" {
+		t.Errorf("%s has no %s parameter", first, DYNAMICPARAM)
+	}
+}
+
+func TestDynamicAuditReport(t *testing.T) {
+
+	var visits atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/static", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body>unchanging</body></html>`)
+	})
+	mux.HandleFunc("/clock", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body>visit %d</body></html>`, visits.Add(1))
+	})
+	mux.HandleFunc("/markup", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body data-nonce="%d">unchanging</body></html>`, visits.Add(1))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	a := newDynamicAudit(&resultsSink{}, 10)
+	for _, path := range []string{"/static", "/clock", "/markup", "/missing"} {
+		if err := a.Write(Result{url: server.URL + path, contentType: "text/html"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	a.report(&buf, NewGetClient(1, time.Second))
+	want := fmt.Sprintf(`
+== dynamic content ==
+pages sampled: 4, with content differing between fetches: 1
+  %[1]s/clock
+  %[1]s/missing : not checked: status 404
+`, server.URL)
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("report mismatch (-want +got):\n%s", diff)
+	}
+
+	buf.Reset()
+	newDynamicAudit(&resultsSink{}, 10).report(&buf, NewGetClient(1, time.Second))
+	if got := buf.String(); !strings.Contains(got, "no pages were sampled") {
+		t.Errorf("unexpected report %q", got)
+	}
+}
@@ -0,0 +1,128 @@
+// email.go provides an OutputSink emailing a report of a run over SMTP
+// when the run finishes, for teams who receive audits by email.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTPPASSWORDENV is the environment variable holding the SMTP
+// password, which is not given as an option to keep it out of process
+// listings and the json output
+const SMTPPASSWORDENV = "WEBCHK_SMTP_PASSWORD"
+
+// emailSink is an OutputSink collecting results as csv, which is sent
+// as an attachment to an email summarising the run when closed
+type emailSink struct {
+	options Options
+	csv     *csvSink
+	buf     bytes.Buffer
+	matched int // results with matches
+	send    func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// newEmailSink makes a new emailSink for the email options in options
+func newEmailSink(options Options) (*emailSink, error) {
+	e := &emailSink{options: options, send: smtp.SendMail}
+	var err error
+	e.csv, err = newCSVSink(closingWriter{Writer: &e.buf})
+	return e, err
+}
+
+// Write records a result
+func (e *emailSink) Write(r Result) error {
+	if len(r.matches) > 0 {
+		e.matched++
+	}
+	return e.csv.Write(r)
+}
+
+// Close sends the email
+func (e *emailSink) Close(stats Stats) error {
+	if err := e.csv.Close(stats); err != nil {
+		return err
+	}
+	msg, err := e.message(stats)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if e.options.SMTPUser != "" {
+		host, _, _ := net.SplitHostPort(e.options.SMTP)
+		auth = smtp.PlainAuth("", e.options.SMTPUser, os.Getenv(SMTPPASSWORDENV), host)
+	}
+	if err := e.send(e.options.SMTP, auth, e.options.SMTPFrom, e.options.EmailTo, msg); err != nil {
+		return fmt.Errorf("could not send email report: %w", err)
+	}
+	return nil
+}
+
+// message makes the email, with a plain text summary of the run and the
+// results attached as csv
+func (e *emailSink) message(stats Stats) ([]byte, error) {
+	var msg bytes.Buffer
+	mw := multipart.NewWriter(&msg)
+
+	subject := fmt.Sprintf("webchk report for %s: %d pages, %d broken, %d errors",
+		e.options.Args.BaseURL, stats.Pages, stats.Broken, stats.Errors)
+	fmt.Fprintf(&msg, "From: %s\r\n", e.options.SMTPFrom)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.options.EmailTo, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	body, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(body, "webchk report for %s\r\n\r\n", e.options.Args.BaseURL)
+	for _, line := range []struct {
+		name  string
+		value any
+	}{
+		{"start", stats.Start.Format(time.RFC1123)},
+		{"duration", stats.Duration.Round(time.Second)},
+		{"termination", stats.Termination},
+		{"pages", stats.Pages},
+		{"pages with matches", e.matched},
+		{"errors", stats.Errors},
+		{"broken", stats.Broken},
+		{"violations", stats.Violations},
+	} {
+		fmt.Fprintf(body, "%-19s %v\r\n", line.name+":", line.value)
+	}
+	fmt.Fprintf(body, "\r\nThe results are attached as csv.\r\n")
+
+	attachment, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/csv; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {`attachment; filename="webchk.csv"`},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(e.buf.Bytes())
+	for len(encoded) > 76 {
+		fmt.Fprintf(attachment, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(attachment, "%s\r\n", encoded)
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEmailSink(t *testing.T) {
+
+	options := Options{
+		EmailTo:  []string{"a@example.com", "b@example.com"},
+		SMTP:     "mail.example.com:587",
+		SMTPFrom: "webchk@example.com",
+		SMTPUser: "webchk",
+	}
+	options.Args.BaseURL = "https://example.com"
+	t.Setenv(SMTPPASSWORDENV, "secret")
+
+	sink, err := newEmailSink(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var gotMsg []byte
+	var gotAuth smtp.Auth
+	sink.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotAuth, gotFrom, gotTo, gotMsg = addr, a, from, to, msg
+		return nil
+	}
+	stats := Stats{Pages: 3, Errors: 1, Broken: 1, Start: time.Now(), Termination: TerminationIdle}
+	if _, err := drain(testResults(), sink, fakeStatser(stats)); err != nil {
+		t.Fatal(err)
+	}
+	if gotAddr != "mail.example.com:587" || gotFrom != "webchk@example.com" || gotAuth == nil {
+		t.Errorf("unexpected send %s %s %v", gotAddr, gotFrom, gotAuth)
+	}
+	if diff := cmp.Diff(options.EmailTo, gotTo); diff != "" {
+		t.Errorf("to mismatch (-want +got):\n%s", diff)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(gotMsg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "webchk report for https://example.com: 3 pages, 1 broken, 1 errors"; subject != want {
+		t.Errorf("subject got %q want %q", subject, want)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("content type %s error %v", mediaType, err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+
+	body, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := io.ReadAll(body)
+	for _, want := range []string{"pages with matches: 1", "broken:             1", "termination:        idle timeout"} {
+		if !strings.Contains(string(text), want) {
+			t.Errorf("body does not contain %q:\n%s", want, text)
+		}
+	}
+
+	attachment, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := attachment.FileName(), "webchk.csv"; got != want {
+		t.Errorf("attachment name got %s want %s", got, want)
+	}
+	records, err := csv.NewReader(base64.NewDecoder(base64.StdEncoding, attachment)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(records), 4; got != want {
+		t.Errorf("got %d want %d csv records", got, want)
+	} else if got, want := records[2][0], "https://example.com/gone"; got != want {
+		t.Errorf("got url %s want %s", got, want)
+	}
+}
+
+func TestEmailSinkError(t *testing.T) {
+
+	sendErr := errors.New("connection refused")
+	sink, err := newEmailSink(Options{EmailTo: []string{"a@example.com"}, SMTP: "localhost:25", SMTPFrom: "w@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		if a != nil {
+			t.Error("unexpected auth without a user")
+		}
+		return sendErr
+	}
+	if _, err := drain(testResults(), sink, fakeStatser{Pages: 3}); !errors.Is(err, sendErr) {
+		t.Errorf("got error %v want %v", err, sendErr)
+	}
+}
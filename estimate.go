@@ -0,0 +1,141 @@
+// estimate.go projects the size, duration and bandwidth of a full crawl
+// from a small sample crawl, so that the cost of a crawl can be judged
+// before it is run.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// projection is the projected size of a full crawl
+type projection struct {
+	pages     int
+	bytes     int64
+	duration  time.Duration
+	converges bool // false if pages is only a lower bound
+}
+
+// project projects a full crawl from the unique urls discovered and the
+// pages processed at each depth from the base url during a sample
+// crawl. The ratio of new urls found at the next depth to the pages
+// processed at the deepest depth reached is assumed to hold for the
+// rest of the crawl, which converges only if the ratio is less than 1.
+// The duration is limited by the slower of the rate limit and the
+// workers' throughput at the average response time.
+func project(discovered, processed []int, avgSize int64, avgElapsed time.Duration, workers, querySec int) projection {
+	p := projection{converges: true}
+	for _, n := range discovered {
+		p.pages += n
+	}
+	deepest := -1
+	for d, n := range processed {
+		if n > 0 {
+			deepest = d
+		}
+	}
+	if deepest >= 0 {
+		next := 0
+		if deepest+1 < len(discovered) {
+			next = discovered[deepest+1]
+		}
+		ratio := float64(next) / float64(processed[deepest])
+		remaining := float64(discovered[deepest]-processed[deepest]) * ratio
+		p.pages += int(remaining)
+		switch {
+		case ratio >= 1:
+			p.converges = false
+		case ratio > 0:
+			p.pages += int((float64(next) + remaining) * ratio / (1 - ratio))
+		}
+	}
+	p.bytes = int64(p.pages) * avgSize
+
+	rate := float64(querySec)
+	if avgElapsed > 0 {
+		rate = min(rate, float64(workers)/avgElapsed.Seconds())
+	}
+	if rate > 0 {
+		p.duration = time.Duration(float64(p.pages) / rate * float64(time.Second)).Round(time.Second)
+	}
+	return p
+}
+
+// formatBytes formats a number of bytes in decimal units
+func formatBytes(b int64) string {
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "kMGTPE"[exp])
+}
+
+// estimateSink is an OutputSink measuring the results of a sample
+// crawl, which prints a projection of a full crawl when closed
+type estimateSink struct {
+	w         closingWriter
+	options   Options
+	processed []int         // pages processed by depth
+	elapsed   time.Duration // total response time
+}
+
+// newEstimateSink makes a new estimateSink writing to w
+func newEstimateSink(w closingWriter, options Options) *estimateSink {
+	return &estimateSink{w: w, options: options}
+}
+
+// Write records a result
+func (e *estimateSink) Write(r Result) error {
+	for len(e.processed) <= r.depth {
+		e.processed = append(e.processed, 0)
+	}
+	e.processed[r.depth]++
+	e.elapsed += r.elapsed
+	return nil
+}
+
+// Close prints the sample measurements and the projection
+func (e *estimateSink) Close(stats Stats) error {
+	if stats.Pages == 0 {
+		_, err := fmt.Fprintln(e.w, "no pages were processed, so no estimate can be made")
+		return errors.Join(err, e.w.close())
+	}
+	avgSize := stats.Bytes / int64(stats.Pages)
+	avgElapsed := e.elapsed / time.Duration(stats.Pages)
+	discovered := 0
+	for _, n := range stats.Discovered {
+		discovered += n
+	}
+	p := project(stats.Discovered, e.processed, avgSize, avgElapsed, e.options.Workers, e.options.QuerySec)
+
+	pages := fmt.Sprintf("%d", p.pages)
+	if !p.converges {
+		pages = fmt.Sprintf("at least %d (the sample is still finding more new links than pages; try a larger --estimate)", p.pages)
+	}
+	_, err := fmt.Fprintf(e.w, `
+Estimate from a sample of %d pages of %s (depths 0-%d):
+  average page size:     %s
+  average response time: %s
+  link fan-out:          %.1f new links per page
+Projected full crawl:
+  pages:     %s
+  duration:  %s
+  bandwidth: %s
+`,
+		stats.Pages, e.options.Args.BaseURL, len(e.processed)-1,
+		formatBytes(avgSize),
+		avgElapsed.Round(time.Millisecond),
+		float64(discovered-1)/float64(stats.Pages),
+		pages,
+		p.duration,
+		formatBytes(p.bytes),
+	)
+	return errors.Join(err, e.w.close())
+}
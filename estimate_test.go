@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProject(t *testing.T) {
+
+	tests := []struct {
+		discovered []int
+		processed  []int
+		avgSize    int64
+		avgElapsed time.Duration
+		workers    int
+		querySec   int
+		want       projection
+	}{
+		{ // no sample
+			querySec: 10,
+			want:     projection{converges: true},
+		},
+		{ // a single page with no links
+			discovered: []int{1},
+			processed:  []int{1},
+			avgSize:    1000,
+			querySec:   10,
+			want:       projection{pages: 1, bytes: 1000, converges: true},
+		},
+		{ // depth 1 complete, each page finding 0.5 new links
+			discovered: []int{1, 4, 2},
+			processed:  []int{1, 4},
+			avgSize:    1000,
+			querySec:   10,
+			want:       projection{pages: 9, bytes: 9000, duration: time.Second, converges: true},
+		},
+		{ // limited by the workers at the response time
+			discovered: []int{1, 4, 3},
+			processed:  []int{1, 4},
+			avgSize:    10,
+			avgElapsed: time.Second,
+			workers:    2,
+			querySec:   10,
+			want:       projection{pages: 17, bytes: 170, duration: 9 * time.Second, converges: true},
+		},
+		{ // depth 1 partly processed, each page finding 1 new link
+			discovered: []int{1, 4, 2},
+			processed:  []int{1, 2},
+			querySec:   10,
+			want:       projection{pages: 9, duration: time.Second},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			got := project(tt.discovered, tt.processed, tt.avgSize, tt.avgElapsed, tt.workers, tt.querySec)
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(projection{})); diff != "" {
+				t.Errorf("projection mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+
+	tests := []struct {
+		b    int64
+		want string
+	}{
+		{0, "0 B"},
+		{999, "999 B"},
+		{1500, "1.5 kB"},
+		{2_500_000, "2.5 MB"},
+		{3_000_000_000, "3.0 GB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.b); got != tt.want {
+			t.Errorf("formatBytes(%d) got %s want %s", tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateSink(t *testing.T) {
+
+	r := make(chan Result, 5)
+	r <- Result{url: "https://example.com", depth: 0, size: 2000, elapsed: 100 * time.Millisecond}
+	for _, p := range []string{"a", "b", "c", "d"} {
+		r <- Result{url: "https://example.com/" + p, depth: 1, size: 2000, elapsed: 300 * time.Millisecond}
+	}
+	close(r)
+
+	var buf bytes.Buffer
+	options := Options{Workers: 8, QuerySec: 10}
+	options.Args.BaseURL = "https://example.com"
+	sink := newEstimateSink(closingWriter{Writer: &buf}, options)
+	stats := Stats{Pages: 5, Bytes: 10000, Discovered: []int{1, 4, 2}}
+	if _, err := drain(r, sink, fakeStatser(stats)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	want := `
+Estimate from a sample of 5 pages of https://example.com (depths 0-1):
+  average page size:     2.0 kB
+  average response time: 260ms
+  link fan-out:          1.2 new links per page
+Projected full crawl:
+  pages:     9
+  duration:  1s
+  bandwidth: 18.0 kB
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("output mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,125 @@
+// exec.go runs a user supplied command for each page with search term
+// matches, allowing ad-hoc integrations with other tools.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// EXECTIMEOUT is the longest an exec hook command may run
+const EXECTIMEOUT time.Duration = 30 * time.Second
+
+// ErrEmptyExecCommand reports an exec hook without a command
+var ErrEmptyExecCommand = errors.New("exec command is empty")
+
+// ErrUnterminatedQuote reports an exec command with an unbalanced quote
+var ErrUnterminatedQuote = errors.New("exec command has an unterminated quote")
+
+// execHook runs a command for each matching page. The command is split
+// into arguments by splitCommand and is not run by a shell; any "{}" in
+// the arguments is replaced with the url of the page. If no argument
+// contains "{}" the url is appended as the last argument.
+type execHook struct {
+	args    []string
+	timeout time.Duration
+	output  io.Writer // command stdout and stderr
+}
+
+// newExecHook makes a new execHook from a command string
+func newExecHook(command string, output io.Writer) (*execHook, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, ErrEmptyExecCommand
+	}
+	if !strings.Contains(command, "{}") {
+		args = append(args, "{}")
+	}
+	return &execHook{args: args, timeout: EXECTIMEOUT, output: output}, nil
+}
+
+// splitCommand splits a command into arguments on whitespace, keeping
+// text between single or double quotes together. A backslash escapes
+// the following character outside single quotes. No other shell
+// processing is done.
+func splitCommand(command string) ([]string, error) {
+	args := []string{}
+	var arg strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+	for _, c := range command {
+		switch {
+		case escaped:
+			arg.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return args, ErrUnterminatedQuote
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// run runs the command for url
+func (e *execHook) run(url string) error {
+	args := make([]string, len(e.args))
+	for i, a := range e.args {
+		args[i] = strings.ReplaceAll(a, "{}", url)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = e.output, e.output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("exec %s error: %w", url, err)
+	}
+	return nil
+}
+
+// pipe passes results through unchanged, running the command for each
+// result with search term matches. Command errors are reported to the
+// hook's output.
+func (e *execHook) pipe(results <-chan Result) <-chan Result {
+	piped := make(chan Result)
+	go func() {
+		defer close(piped)
+		for r := range results {
+			if r.err == nil && len(r.matches) > 0 {
+				if err := e.run(r.url); err != nil {
+					fmt.Fprintln(e.output, err)
+				}
+			}
+			piped <- r
+		}
+	}()
+	return piped
+}
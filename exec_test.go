@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewExecHook(t *testing.T) {
+
+	tests := []struct {
+		command string
+		args    []string
+		err     error
+	}{
+		{
+			command: "",
+			err:     ErrEmptyExecCommand,
+		},
+		{
+			command: "   ",
+			err:     ErrEmptyExecCommand,
+		},
+		{
+			command: "echo {}",
+			args:    []string{"echo", "{}"},
+		},
+		{
+			command: "notify --url={} --urgent",
+			args:    []string{"notify", "--url={}", "--urgent"},
+		},
+		{
+			command: `notify-send "webchk match" {}`,
+			args:    []string{"notify-send", "webchk match", "{}"},
+		},
+		{
+			command: `sh -c 'echo "$0" >> log' {}`,
+			args:    []string{"sh", "-c", `echo "$0" >> log`, "{}"},
+		},
+		{
+			command: `a\ b ""`,
+			args:    []string{"a b", "", "{}"},
+		},
+		{
+			command: `echo "unterminated {}`,
+			err:     ErrUnterminatedQuote,
+		},
+		{
+			command: "echo", // url appended
+			args:    []string{"echo", "{}"},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			e, err := newExecHook(tt.command, &bytes.Buffer{})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.args, e.args); diff != "" {
+				t.Errorf("args mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecHookPipe(t *testing.T) {
+
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "exec.log")
+	script := filepath.Join(dir, "hook.sh")
+	if err := os.WriteFile(script, []byte(`echo "$1" >> `+logFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	command := fmt.Sprintf("/bin/sh '%s' {}", script)
+	var buf bytes.Buffer
+	e, err := newExecHook(command, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan Result, 4)
+	results <- Result{url: "https://example.com/1", matches: []SearchMatch{{1, "hi", 0}}}
+	results <- Result{url: "https://example.com/2", matches: []SearchMatch{}}
+	results <- Result{url: "https://example.com/3", matches: []SearchMatch{{1, "hi", 0}}, err: errors.New("x")}
+	results <- Result{url: "https://example.com/4", matches: []SearchMatch{{9, "there", 0}}}
+	close(results)
+
+	n := 0
+	for range e.pipe(results) {
+		n++
+	}
+	if got, want := n, 4; got != want {
+		t.Errorf("got %d want %d results", got, want)
+	}
+	log, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "https://example.com/1\nhttps://example.com/4\n"
+	if diff := cmp.Diff(want, string(log)); diff != "" {
+		t.Errorf("exec log mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecHookRunError(t *testing.T) {
+
+	var buf bytes.Buffer
+	e, err := newExecHook("/nonexistent/command {}", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.run("https://example.com"); err == nil {
+		t.Error("expected error")
+	}
+
+	if _, err := os.Stat("/bin/sleep"); err != nil {
+		t.Skip("no /bin/sleep")
+	}
+	e, err = newExecHook("/bin/sleep 5 {}", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.timeout = 20 * time.Millisecond
+	err = e.run("https://example.com")
+	if err == nil || !strings.Contains(err.Error(), "https://example.com") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
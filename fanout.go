@@ -0,0 +1,126 @@
+// fanout.go writes results to several outputs at once, each output
+// target in its own goroutine, so that a slow output, such as a
+// webhook, does not hold up the others, and an output which fails is
+// reported on its own without stopping the crawl or the other outputs.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// FANOUTBUFFERSIZE is the number of results buffered for each output
+// target; when it is full, writes wait for the output
+const FANOUTBUFFERSIZE = 100
+
+// fanoutOutput is an OutputSink written to by a fanoutSink, and the
+// failures writing to it
+type fanoutOutput struct {
+	name     string
+	sink     OutputSink
+	failures int
+	err      error // the first write error
+}
+
+// fanoutLane writes the results it receives to its outputs in turn
+type fanoutLane struct {
+	outputs []*fanoutOutput
+	results chan Result
+}
+
+// fanoutSink is an OutputSink writing results to its outputs
+// concurrently. Outputs writing to the same target, such as stdout,
+// share a lane so that their writes are not interleaved.
+type fanoutSink struct {
+	lanes   []*fanoutLane
+	outputs []*fanoutOutput
+	wg      sync.WaitGroup
+}
+
+// outputLane returns the key of the lane of an output specification:
+// its target, so that outputs to stdout share a lane
+func outputLane(spec string) string {
+	kind, target, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "text", "json", "csv", "gob":
+		if target == "" || target == "-" {
+			return "-"
+		}
+		return target
+	}
+	return spec
+}
+
+// newFanoutSink makes a fanoutSink for the sinks made from the output
+// specifications specs, in the same order
+func newFanoutSink(specs []string, sinks []OutputSink) *fanoutSink {
+	f := &fanoutSink{}
+	lanes := map[string]*fanoutLane{}
+	for i, s := range sinks {
+		o := &fanoutOutput{name: specs[i], sink: s}
+		f.outputs = append(f.outputs, o)
+		key := outputLane(specs[i])
+		lane, ok := lanes[key]
+		if !ok {
+			lane = &fanoutLane{results: make(chan Result, FANOUTBUFFERSIZE)}
+			lanes[key] = lane
+			f.lanes = append(f.lanes, lane)
+		}
+		lane.outputs = append(lane.outputs, o)
+	}
+	f.wg.Add(len(f.lanes))
+	for _, lane := range f.lanes {
+		go func() {
+			defer f.wg.Done()
+			for r := range lane.results {
+				for _, o := range lane.outputs {
+					o.write(r)
+				}
+			}
+		}()
+	}
+	return f
+}
+
+// write writes a result to the output, reporting its first failure
+func (o *fanoutOutput) write(r Result) {
+	err := o.sink.Write(r)
+	if err == nil {
+		return
+	}
+	o.failures++
+	if o.err == nil {
+		o.err = err
+		fmt.Fprintf(diagnostics, "output %s failed, continuing with the other outputs: %v\n", o.name, err)
+	}
+}
+
+// Write sends the result to each lane, waiting while a lane is full
+func (f *fanoutSink) Write(r Result) error {
+	for _, lane := range f.lanes {
+		lane.results <- r
+	}
+	return nil
+}
+
+// Close waits for the outputs to write the results sent to them and
+// closes them, returning the failures of each
+func (f *fanoutSink) Close(stats Stats) error {
+	for _, lane := range f.lanes {
+		close(lane.results)
+	}
+	f.wg.Wait()
+	var errs []error
+	for _, o := range f.outputs {
+		if o.err != nil {
+			errs = append(errs, fmt.Errorf("output %s: %d results could not be written: %w", o.name, o.failures, o.err))
+		}
+		if err := o.sink.Close(stats); err != nil {
+			errs = append(errs, fmt.Errorf("output %s: %w", o.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingSink is an OutputSink failing to write results whose url
+// contains fail
+type failingSink struct {
+	resultsSink
+	fail string
+}
+
+func (f *failingSink) Write(r Result) error {
+	if strings.Contains(r.url, f.fail) {
+		return errors.New("write failed")
+	}
+	return f.resultsSink.Write(r)
+}
+
+// blockingSink is an OutputSink whose writes wait until it is released
+type blockingSink struct {
+	resultsSink
+	release chan struct{}
+}
+
+func (b *blockingSink) Write(r Result) error {
+	<-b.release
+	return b.resultsSink.Write(r)
+}
+
+// notifyingSink is an OutputSink sending the url of each result written
+type notifyingSink struct {
+	resultsSink
+	written chan string
+}
+
+func (n *notifyingSink) Write(r Result) error {
+	n.written <- r.url
+	return n.resultsSink.Write(r)
+}
+
+func TestOutputLane(t *testing.T) {
+	for _, tt := range []struct{ spec, want string }{
+		{"text", "-"},
+		{"json:-", "-"},
+		{"csv:out.csv", "out.csv"},
+		{"gob", "-"},
+		{"gob:results.gob", "results.gob"},
+		{"sqlite:webchk.db", "sqlite:webchk.db"},
+		{"webhook:https://example.com/hook", "webhook:https://example.com/hook"},
+	} {
+		if got := outputLane(tt.spec); got != tt.want {
+			t.Errorf("%s: got %s want %s", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestFanoutSink(t *testing.T) {
+
+	var buf strings.Builder
+	diagnostics = &buf
+	defer func() { diagnostics = os.Stderr }()
+
+	written := make(chan string, 3)
+	good, bad := &notifyingSink{written: written}, &failingSink{fail: "gone"}
+	slow := &blockingSink{release: make(chan struct{})}
+	f := newFanoutSink(
+		[]string{"text", "webhook:https://example.com/hook", "sqlite:webchk.db"},
+		[]OutputSink{good, bad, slow},
+	)
+	if got, want := len(f.lanes), 3; got != want {
+		t.Fatalf("got %d want %d lanes", got, want)
+	}
+
+	// the other outputs are written while the slow one waits
+	results := testResults()
+	for r := range results {
+		if err := f.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 3 {
+		select {
+		case <-written:
+		case <-time.After(time.Second):
+			t.Fatal("an output waited for the slow output")
+		}
+	}
+	close(slow.release)
+
+	err := f.Close(Stats{})
+	if err == nil || !strings.Contains(err.Error(), "output webhook:https://example.com/hook: 1 results could not be written: write failed") {
+		t.Errorf("unexpected error %v", err)
+	}
+	for name, s := range map[string]*resultsSink{"good": &good.resultsSink, "bad": &bad.resultsSink, "slow": &slow.resultsSink} {
+		want := 3
+		if name == "bad" {
+			want = 2
+		}
+		if got := len(s.urls); got != want {
+			t.Errorf("%s: got %d want %d results", name, got, want)
+		}
+	}
+	if got := strings.Count(buf.String(), "output webhook:https://example.com/hook failed"); got != 1 {
+		t.Errorf("failure reported %d times:\n%s", got, buf.String())
+	}
+}
+
+func TestFanoutSinkSharedLane(t *testing.T) {
+
+	text, json := &resultsSink{}, &resultsSink{}
+	f := newFanoutSink([]string{"text", "json:-"}, []OutputSink{text, json})
+	if got, want := len(f.lanes), 1; got != want {
+		t.Fatalf("got %d want %d lanes", got, want)
+	}
+	for r := range testResults() {
+		f.Write(r)
+	}
+	if err := f.Close(Stats{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(text.urls) != 3 || len(json.urls) != 3 {
+		t.Errorf("got %d and %d results want 3 each", len(text.urls), len(json.urls))
+	}
+}
@@ -0,0 +1,74 @@
+// feed.go extracts the links from RSS and Atom feeds, so that content
+// which is reached mainly through a site's feeds is crawled too.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// feedType reports whether contentType is that of an RSS or Atom feed
+func feedType(contentType string) bool {
+	return strings.Contains(contentType, "rss+xml") || strings.Contains(contentType, "atom+xml")
+}
+
+// parseFeed extracts the links from an RSS (0.9x, 1.0 or 2.0) or Atom
+// feed, resolved against its url, sorted without duplicates. Links are
+// taken from the text of RSS link elements and the href of Atom link
+// elements with no rel or a rel of alternate. parseFeed reports false
+// if body is not a feed.
+func parseFeed(body []byte, url *url.URL) ([]string, bool) {
+	links := []string{}
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	isFeed := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break // io.EOF or a malformed feed, keeping the links found
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !isFeed {
+			switch start.Name.Local {
+			case "rss", "feed", "RDF":
+				isFeed = true
+				continue
+			default:
+				return links, false // not a feed
+			}
+		}
+		if start.Name.Local != "link" {
+			continue
+		}
+		var link struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+			Text string `xml:",chardata"`
+		}
+		if err := decoder.DecodeElement(&link, &start); err != nil {
+			continue
+		}
+		ref := strings.TrimSpace(link.Text)
+		if link.Href != "" {
+			if link.Rel != "" && link.Rel != "alternate" {
+				continue
+			}
+			ref = link.Href
+		}
+		if ref == "" {
+			continue
+		}
+		if l, ok := resolveLink(url, ref); ok {
+			links = append(links, l)
+		}
+	}
+	slices.Sort(links)
+	return slices.Compact(links), isFeed
+}
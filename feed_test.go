@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseFeed(t *testing.T) {
+
+	feedURL, err := url.Parse("https://e.com/blog/feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		body   string
+		links  []string
+		isFeed bool
+	}{
+		{
+			name: "rss",
+			body: `<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel>
+<title>Blog</title><link>https://e.com/blog/</link>
+<atom:link href="https://e.com/blog/feed" rel="self" type="application/rss+xml"/>
+<item><title>One</title><link>https://e.com/blog/one?utm=rss</link></item>
+<item><title>Two</title><link> /blog/two </link></item>
+</channel></rss>`,
+			links:  []string{"https://e.com/blog", "https://e.com/blog/one", "https://e.com/blog/two"},
+			isFeed: true,
+		},
+		{
+			name: "atom",
+			body: `<feed xmlns="http://www.w3.org/2005/Atom">
+<link href="https://e.com/blog/feed" rel="self"/>
+<link href="https://e.com/blog"/>
+<entry><link href="one" rel="alternate"/><link href="one/comments" rel="replies"/></entry>
+</feed>`,
+			links:  []string{"https://e.com/blog", "https://e.com/blog/one"},
+			isFeed: true,
+		},
+		{
+			name: "rdf",
+			body: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+<item><link>https://e.com/blog/one</link></item></rdf:RDF>`,
+			links:  []string{"https://e.com/blog/one"},
+			isFeed: true,
+		},
+		{
+			name:   "truncated",
+			body:   `<rss><channel><item><link>https://e.com/blog/one</link></item><item><li`,
+			links:  []string{"https://e.com/blog/one"},
+			isFeed: true,
+		},
+		{
+			name:   "sitemap",
+			body:   `<urlset><url><loc>https://e.com/</loc></url></urlset>`,
+			links:  []string{},
+			isFeed: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, isFeed := parseFeed([]byte(tt.body), feedURL)
+			if isFeed != tt.isFeed {
+				t.Errorf("is feed got %t want %t", isFeed, tt.isFeed)
+			}
+			if diff := cmp.Diff(tt.links, links); diff != "" {
+				t.Errorf("links mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParsePageFeedLinks(t *testing.T) {
+
+	body := []byte(`<html><head>
+<link rel="alternate" type="application/rss+xml" href="/feed.rss">
+<link rel="alternate" type="application/atom+xml" href="/feed.atom">
+<link rel="stylesheet" href="/site.css">
+</head><body><a href="/about">about</a></body></html>`)
+	pageURL, err := url.Parse("https://e.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := parsePage(body, pageURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := page.links
+	want := []string{"https://e.com/about", "https://e.com/feed.atom", "https://e.com/feed.rss"}
+	if diff := cmp.Diff(want, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetURLFeed(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprint(w, `<rss><channel><item><link>/post</link></item></channel></rss>`)
+		default:
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<urlset/>`)
+		}
+	}))
+	defer server.Close()
+
+	g := NewGetClient(1, time.Second)
+	r, links := g.getURL(server.URL+"/feed", "/", nil)
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if diff := cmp.Diff([]string{server.URL + "/post"}, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+	r, links = g.getURL(server.URL+"/sitemap.xml", "/", nil)
+	if r.err != NonHTMLPageType || len(links) != 0 {
+		t.Errorf("not a feed got error %v links %v", r.err, links)
+	}
+}
@@ -0,0 +1,88 @@
+// fixture.go provides http.RoundTrippers recording the responses of a
+// crawl in a fixtures directory and replaying them, so that regression
+// suites for search and filter configurations can be run without
+// fetching from the live site. Responses are stored by url, and language
+// if fetched with an Accept-Language header, in the format of the
+// response cache.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+)
+
+// ErrNotRecorded reports a request replayed from fixtures in which no
+// response was recorded for its url
+var ErrNotRecorded = errors.New("no response recorded")
+
+// fixtureKey returns the key a response to req is stored by
+func fixtureKey(req *http.Request) string {
+	if req.Method == http.MethodGet {
+		return cacheKey(req) // as for the response cache
+	}
+	return req.Method + " " + cacheKey(req)
+}
+
+// recordingTransport is an http.RoundTripper storing every response
+// from transport, whatever its status, in a Cache
+type recordingTransport struct {
+	transport http.RoundTripper
+	fixtures  Cache
+}
+
+// newRecordingTransport makes a recordingTransport recording the
+// responses of transport, or http.DefaultTransport if transport is nil
+func newRecordingTransport(transport http.RoundTripper, fixtures Cache) *recordingTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &recordingTransport{transport: transport, fixtures: fixtures}
+}
+
+// RoundTrip meets the http.RoundTripper interface. The body of each
+// response is read in full to store it and replaced.
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("could not record response: %w", err)
+	}
+	t.fixtures.Set(fixtureKey(req), b)
+	return resp, nil
+}
+
+// replayTransport is an http.RoundTripper serving the responses stored
+// in a Cache by a recordingTransport, without making any requests
+type replayTransport struct {
+	fixtures Cache
+}
+
+// newReplayTransport makes a replayTransport for fixtures
+func newReplayTransport(fixtures Cache) *replayTransport {
+	return &replayTransport{fixtures: fixtures}
+}
+
+// RoundTrip meets the http.RoundTripper interface
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	b, ok := t.fixtures.Get(fixtureKey(req))
+	if !ok {
+		return nil, fmt.Errorf("%w for %s", ErrNotRecorded, req.URL)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+	if err != nil {
+		return nil, fmt.Errorf("could not replay response for %s: %w", req.URL, err)
+	}
+	return resp, nil
+}
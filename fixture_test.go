@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+		case "/missing":
+			http.NotFound(w, r)
+		case "/lang":
+			fmt.Fprintf(w, "language %s", r.Header.Get("Accept-Language"))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<p>hello</p>")
+		}
+	}))
+
+	fixtures, err := newDiskCache(filepath.Join(t.TempDir(), "fixtures"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(client *http.Client, path string) (int, string, error) {
+		path, language, _ := strings.Cut(path, " ")
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			return 0, "", err
+		}
+		if language != "" {
+			req.Header.Set("Accept-Language", language)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), err
+	}
+
+	recorder := &http.Client{Transport: newRecordingTransport(nil, fixtures)}
+	for _, path := range []string{"/old", "/missing", "/lang de", "/lang en"} {
+		if _, _, err := get(recorder, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := requests, 5; got != want {
+		t.Fatalf("got %d want %d requests recorded", got, want)
+	}
+	server.Close() // replaying should not need the site
+
+	replayer := &http.Client{Transport: newReplayTransport(fixtures)}
+	tests := []struct {
+		path   string
+		status int
+		body   string
+		err    error
+	}{
+		{"/old", http.StatusOK, "<p>hello</p>", nil}, // following the recorded redirect
+		{"/missing", http.StatusNotFound, "404 page not found\n", nil},
+		{"/lang de", http.StatusOK, "language de", nil},
+		{"/lang en", http.StatusOK, "language en", nil},
+		{"/lang fr", 0, "", ErrNotRecorded},
+		{"/new", 0, "", ErrNotRecorded},
+	}
+	for _, tt := range tests {
+		status, body, err := get(replayer, tt.path)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got error %v want %v", tt.path, err, tt.err)
+			continue
+		}
+		if status != tt.status || body != tt.body {
+			t.Errorf("%s: got %d %q want %d %q", tt.path, status, body, tt.status, tt.body)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// fold.go matches search terms loosely, ignoring accents and other
+// diacritics and the style of quotes and apostrophes, since content
+// teams rarely know whether the CMS wrote resume or résumé, or don't
+// or don’t. Matches are reported under the search term as given.
+
+package main
+
+import (
+	"bytes"
+	"slices"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldQuotes maps typographic quotes and apostrophes to their ascii
+// forms
+var foldQuotes = map[rune]rune{
+	'‘': '\'', '’': '\'', '‚': '\'', '‛': '\'', '′': '\'',
+	'“': '"', '”': '"', '„': '"', '‟': '"', '″': '"',
+}
+
+// foldLetters maps letters with strokes, which do not decompose into a
+// letter and a combining mark, to the letter
+var foldLetters = map[rune]rune{
+	'ø': 'o', 'ł': 'l', 'đ': 'd', 'ħ': 'h', 'ı': 'i',
+}
+
+// foldText returns s in lowercase without diacritics and with ascii
+// quotes, and the offset in s of the rune each byte of the folded text
+// came from
+func foldText(s []byte) ([]byte, []int) {
+	folded, offsets := make([]byte, 0, len(s)), make([]int, 0, len(s))
+	add := func(r rune, offset int) {
+		n := len(folded)
+		folded = utf8.AppendRune(folded, r)
+		for range len(folded) - n {
+			offsets = append(offsets, offset)
+		}
+	}
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRune(s[i:])
+		switch {
+		case r < utf8.RuneSelf:
+			add(unicode.ToLower(r), i)
+		case foldQuotes[r] != 0:
+			add(foldQuotes[r], i)
+		default:
+			for _, d := range norm.NFD.String(string(r)) {
+				if unicode.Is(unicode.Mn, d) {
+					continue // a combining mark
+				}
+				d = unicode.ToLower(d)
+				if l, ok := foldLetters[d]; ok {
+					d = l
+				}
+				add(d, i)
+			}
+		}
+		i += size
+	}
+	return folded, offsets
+}
+
+// foldMatches adds to the matches of the lines of body those of
+// searchTerms found once the terms and lines are folded by foldText,
+// keeping one match for each term on a line, as parsePage does. The
+// matches are returned in order of line and search term. With first,
+// for --first-match, lines are only folded until the first line with a
+// match, whether found by parsePage or folded.
+func foldMatches(body []byte, searchTerms []string, matches []SearchMatch, first bool) []SearchMatch {
+	if len(searchTerms) == 0 {
+		return matches
+	}
+	terms := make([][]byte, len(searchTerms))
+	for i, st := range searchTerms {
+		terms[i], _ = foldText([]byte(st))
+	}
+	matched := map[SearchMatch]bool{}
+	lastLine := -1 // the last line folded, for first
+	for _, m := range matches {
+		matched[SearchMatch{line: m.line, match: m.match}] = true
+		if first && (lastLine < 0 || m.line < lastLine) {
+			lastLine = m.line
+		}
+	}
+	start := 0
+	for i := 1; start <= len(body) && (lastLine < 0 || i <= lastLine); i++ {
+		line := body[start:]
+		if end := bytes.IndexByte(line, '\n'); end >= 0 {
+			line = line[:end]
+		}
+		folded, offsets := foldText(line)
+		for t, term := range terms {
+			key := SearchMatch{line: i, match: searchTerms[t]}
+			if matched[key] || len(term) == 0 {
+				continue
+			}
+			if j := bytes.Index(folded, term); j >= 0 {
+				matches = append(matches, SearchMatch{i, searchTerms[t], start + offsets[j]})
+				matched[key] = true
+				if first {
+					lastLine = i
+				}
+			}
+		}
+		start += len(line) + 1
+	}
+	order := map[string]int{}
+	for i, st := range searchTerms {
+		order[st] = i
+	}
+	slices.SortStableFunc(matches, func(a, b SearchMatch) int {
+		if a.line != b.line {
+			return a.line - b.line
+		}
+		return order[a.match] - order[b.match]
+	})
+	return matches
+}
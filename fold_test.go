@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFoldText(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Résumé", "resume"},
+		{"Ångström", "angstrom"},
+		{"naïve Café", "naive cafe"},
+		{"Don’t „quote“", `don't "quote"`},
+		{"Łódź, København", "lodz, kobenhavn"},
+		{"plain ascii", "plain ascii"},
+	}
+	for _, tt := range tests {
+		got, offsets := foldText([]byte(tt.in))
+		if string(got) != tt.want {
+			t.Errorf("%q got %q want %q", tt.in, got, tt.want)
+		}
+		if len(offsets) != len(got) {
+			t.Errorf("%q got %d offsets for %d bytes", tt.in, len(offsets), len(got))
+		}
+	}
+
+	// offsets are those of the runes in the original text
+	_, offsets := foldText([]byte("aé’b"))
+	if diff := cmp.Diff([]int{0, 1, 3, 6}, offsets); diff != "" {
+		t.Errorf("offsets mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFoldMatches(t *testing.T) {
+
+	body := []byte("<p>Send your résumé</p>\n<p>we don’t mind</p>\n<p>resume and don't</p>")
+	terms := []string{"don't", "resume"}
+	// parsePage finds the exact matches on the last line
+	matches := []SearchMatch{{3, "don't", 63}, {3, "resume", 52}}
+
+	got := foldMatches(body, terms, matches, false)
+	want := []SearchMatch{
+		{1, "resume", 13},
+		{2, "don't", 32},
+		{3, "don't", 63},
+		{3, "resume", 52},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(SearchMatch{})); diff != "" {
+		t.Errorf("matches mismatch (-want +got):\n%s", diff)
+	}
+
+	// with first, lines are folded only until the first line matched
+	for _, tt := range []struct {
+		name    string
+		terms   []string
+		matches []SearchMatch
+		want    []SearchMatch
+	}{
+		{"before exact", terms, []SearchMatch{{3, "resume", 52}}, []SearchMatch{{1, "resume", 13}, {3, "resume", 52}}},
+		{"folded only", []string{"don't"}, []SearchMatch{}, []SearchMatch{{2, "don't", 32}}},
+		{"exact first", []string{"send"}, []SearchMatch{{1, "send", 3}}, []SearchMatch{{1, "send", 3}}},
+	} {
+		got := foldMatches(body, tt.terms, tt.matches, true)
+		if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(SearchMatch{})); diff != "" {
+			t.Errorf("first %s: matches mismatch (-want +got):\n%s", tt.name, diff)
+		}
+	}
+
+	// accented terms match unaccented text
+	got = foldMatches([]byte("RESUME"), []string{"Résumé"}, []SearchMatch{}, false)
+	if diff := cmp.Diff([]SearchMatch{{1, "Résumé", 0}}, got, cmp.AllowUnexported(SearchMatch{})); diff != "" {
+		t.Errorf("matches mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetFold(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>\n<p>Our café’s menu</p>\n</body></html>")
+	}))
+	defer server.Close()
+
+	for _, fold := range []bool{false, true} {
+		g := NewGetClient(1, time.Second)
+		g.fold = fold
+		r, _ := g.get(server.URL, "", []string{"cafe's"})
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if got, want := len(r.matches), map[bool]int{false: 0, true: 1}[fold]; got != want {
+			t.Errorf("fold %t got %d want %d matches", fold, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// gob.go streams results as they are found in the gob encoding, for
+// piping to a downstream Go tool which can decode them without the
+// ambiguities and overhead of parsing text or json.
+
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+)
+
+// gobHeader begins a gob stream, describing the run
+type gobHeader struct {
+	SchemaVersion int
+	Version       string
+	BaseURL       string
+	Tags          map[string]string
+}
+
+// gobRecord is a record of a gob stream. The stream is a gob record
+// with a Header, followed by a record with a Result for each result as
+// it is found, and ends with a record with the Stats of the run, its
+// jsonEnvelope without results.
+type gobRecord struct {
+	Header *gobHeader
+	Result *jsonResult
+	Stats  *jsonEnvelope
+}
+
+// gobSink is an OutputSink streaming results as gobRecords. gob
+// messages are length prefixed, and the types of the records are only
+// sent once.
+type gobSink struct {
+	w       closingWriter
+	encoder *gob.Encoder
+	options Options
+}
+
+// newGobSink makes a new gobSink writing the header of the stream to w
+func newGobSink(w closingWriter, options Options) (*gobSink, error) {
+	g := &gobSink{w: w, encoder: gob.NewEncoder(w), options: options}
+	header := gobHeader{
+		SchemaVersion: SCHEMAVERSION,
+		Version:       version,
+		BaseURL:       options.Args.BaseURL,
+		Tags:          options.tags(),
+	}
+	if err := g.encoder.Encode(gobRecord{Header: &header}); err != nil {
+		return nil, errors.Join(err, w.close())
+	}
+	return g, nil
+}
+
+// Write writes a record of the result
+func (g *gobSink) Write(r Result) error {
+	j := newJSONResult(r)
+	return g.encoder.Encode(gobRecord{Result: &j})
+}
+
+// Close writes the record of the Stats of the run
+func (g *gobSink) Close(stats Stats) error {
+	envelope := newJSONEnvelope(g.options, stats, nil)
+	err := g.encoder.Encode(gobRecord{Stats: &envelope})
+	return errors.Join(err, g.w.close())
+}
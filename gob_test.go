@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestGobSink(t *testing.T) {
+
+	var buf bytes.Buffer
+	options := Options{}
+	options.Args.BaseURL = "https://example.com"
+	sink, err := newGobSink(closingWriter{Writer: &buf}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := drain(testResults(), sink, fakeStatser{Pages: 3, Termination: TerminationIdle}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	records := []gobRecord{}
+	decoder := gob.NewDecoder(&buf)
+	for {
+		var r gobRecord
+		err := decoder.Decode(&r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not decode record %d: %v", len(records), err)
+		}
+		records = append(records, r)
+	}
+	if got, want := len(records), 5; got != want {
+		t.Fatalf("got %d want %d records", got, want)
+	}
+	if h := records[0].Header; h == nil || h.SchemaVersion != SCHEMAVERSION || h.BaseURL != "https://example.com" {
+		t.Errorf("unexpected header %+v", h)
+	}
+	for i, r := range records[1:4] {
+		if r.Result == nil {
+			t.Fatalf("record %d has no result", i+1)
+		}
+	}
+	if got, want := records[2].Result.Status, 404; got != want {
+		t.Errorf("status got %d want %d", got, want)
+	}
+	if got, want := len(records[1].Result.Matches), 2; got != want {
+		t.Errorf("got %d want %d matches", got, want)
+	}
+	if got, want := records[3].Result.Error, "timeout"; got != want {
+		t.Errorf("error got %q want %q", got, want)
+	}
+	s := records[4].Stats
+	if s == nil || s.Pages != 3 || s.Termination != TerminationIdle {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
@@ -0,0 +1,119 @@
+// group.go groups the results of a crawl for the text output by status
+// code, directory, search term or, for broken links, referring page, so
+// that a large report can be reviewed group by group rather than in the
+// order pages were fetched.
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// The ways results can be grouped
+const (
+	GROUPSTATUS = "status"
+	GROUPDIR    = "dir"
+	GROUPTERM   = "term"
+	GROUPREF    = "referrer"
+)
+
+// groupKey is the heading of a group of results. Groups are printed in
+// order of rank then heading, so that groups such as errors come last.
+type groupKey struct {
+	rank    int
+	heading string
+}
+
+// groupKeys returns the groups a result belongs to. A result belongs to
+// the group of each term it matches.
+func groupKeys(by string, r Result) []groupKey {
+	switch by {
+	case GROUPDIR:
+		u, err := url.Parse(r.url)
+		if err != nil || u.Host == "" {
+			return []groupKey{{1, "other"}}
+		}
+		dir := path.Dir(strings.TrimSuffix(u.Path, "/"))
+		if dir == "." {
+			dir = "/"
+		}
+		u.Path = strings.TrimSuffix(dir, "/") + "/"
+		u.RawQuery, u.Fragment = "", ""
+		return []groupKey{{0, u.String()}}
+	case GROUPTERM:
+		keys := []groupKey{}
+		for _, m := range r.matches {
+			k := groupKey{0, fmt.Sprintf("term %q", m.match)}
+			if !slices.Contains(keys, k) {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			keys = append(keys, groupKey{1, "no matches"})
+		}
+		return keys
+	case GROUPREF:
+		if r.err == nil || r.err == NonHTMLPageType {
+			return []groupKey{{1, "other pages"}}
+		}
+		return []groupKey{{0, r.referrer}}
+	}
+	if r.err != nil && r.err != StatusNotOk && r.err != NonHTMLPageType {
+		return []groupKey{{1, "errors"}}
+	}
+	return []groupKey{{0, fmt.Sprintf("status %d", r.status)}}
+}
+
+// resultGroups buffers results by group
+type resultGroups struct {
+	by     string
+	groups map[groupKey][]Result
+}
+
+// newResultGroups makes a new resultGroups grouping results by status,
+// dir, term or referrer
+func newResultGroups(by string) *resultGroups {
+	return &resultGroups{by: by, groups: map[groupKey][]Result{}}
+}
+
+// add adds a result to each of its groups
+func (g *resultGroups) add(r Result) {
+	for _, k := range groupKeys(g.by, r) {
+		g.groups[k] = append(g.groups[k], r)
+	}
+}
+
+// groupHeading returns the heading printed for a group of n results,
+// which for a referring page counts its broken links
+func groupHeading(by string, k groupKey, n int) string {
+	if by != GROUPREF || k.rank != 0 {
+		return k.heading
+	}
+	if n == 1 {
+		return k.heading + " contains 1 broken link"
+	}
+	return fmt.Sprintf("%s contains %d broken links", k.heading, n)
+}
+
+// each calls fn for each group in order with its results sorted by url
+func (g *resultGroups) each(fn func(heading string, results []Result)) {
+	keys := []groupKey{}
+	for k := range g.groups {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b groupKey) int {
+		return cmp.Or(cmp.Compare(a.rank, b.rank), cmp.Compare(a.heading, b.heading))
+	})
+	for _, k := range keys {
+		results := g.groups[k]
+		slices.SortStableFunc(results, func(a, b Result) int {
+			return cmp.Compare(a.url, b.url)
+		})
+		fn(groupHeading(g.by, k, len(results)), results)
+	}
+}
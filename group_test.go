@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGroupKeys(t *testing.T) {
+
+	tests := []struct {
+		by     string
+		result Result
+		want   []groupKey
+	}{
+		{
+			by:     GROUPSTATUS,
+			result: Result{url: "https://example.com/a", status: 200},
+			want:   []groupKey{{0, "status 200"}},
+		},
+		{
+			by:     GROUPSTATUS,
+			result: Result{url: "https://example.com/a", status: 404, err: StatusNotOk},
+			want:   []groupKey{{0, "status 404"}},
+		},
+		{
+			by:     GROUPSTATUS,
+			result: Result{url: "https://example.com/a", err: errors.New("timeout")},
+			want:   []groupKey{{1, "errors"}},
+		},
+		{
+			by:     GROUPDIR,
+			result: Result{url: "https://example.com/docs/a"},
+			want:   []groupKey{{0, "https://example.com/docs/"}},
+		},
+		{
+			by:     GROUPDIR,
+			result: Result{url: "https://example.com/docs/a/"},
+			want:   []groupKey{{0, "https://example.com/docs/"}},
+		},
+		{
+			by:     GROUPDIR,
+			result: Result{url: "https://example.com/docs"},
+			want:   []groupKey{{0, "https://example.com/"}},
+		},
+		{
+			by:     GROUPDIR,
+			result: Result{url: "https://example.com"},
+			want:   []groupKey{{0, "https://example.com/"}},
+		},
+		{
+			by:     GROUPDIR,
+			result: Result{url: "https://example.com/list?page=2"},
+			want:   []groupKey{{0, "https://example.com/"}},
+		},
+		{
+			by:     GROUPTERM,
+			result: Result{url: "https://example.com", matches: []SearchMatch{{1, "hi", 0}, {2, "there", 0}, {5, "hi", 0}}},
+			want:   []groupKey{{0, `term "hi"`}, {0, `term "there"`}},
+		},
+		{
+			by:     GROUPTERM,
+			result: Result{url: "https://example.com"},
+			want:   []groupKey{{1, "no matches"}},
+		},
+		{
+			by:     GROUPREF,
+			result: Result{url: "https://example.com/gone", referrer: "https://example.com/a", status: 404, err: StatusNotOk},
+			want:   []groupKey{{0, "https://example.com/a"}},
+		},
+		{
+			by:     GROUPREF,
+			result: Result{url: "https://example.com/slow", referrer: "https://example.com/a", err: errors.New("timeout")},
+			want:   []groupKey{{0, "https://example.com/a"}},
+		},
+		{
+			by:     GROUPREF,
+			result: Result{url: "https://example.com/ok", referrer: "https://example.com/a", status: 200},
+			want:   []groupKey{{1, "other pages"}},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			got := groupKeys(tt.by, tt.result)
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(groupKey{})); diff != "" {
+				t.Errorf("keys mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTextSinkGroups(t *testing.T) {
+
+	results := func() <-chan Result {
+		r := make(chan Result, 6)
+		r <- Result{url: "https://example.com/docs/b", status: 200, matches: []SearchMatch{{1, "hi", 0}}}
+		r <- Result{url: "https://example.com/gone", referrer: "/", status: 404, err: StatusNotOk}
+		r <- Result{url: "https://example.com/slow", referrer: "https://example.com/docs/a", err: errors.New("timeout")}
+		r <- Result{url: "https://example.com/docs/a", status: 200, matches: []SearchMatch{{3, "there", 0}}}
+		r <- Result{url: "https://example.com/docs/c", status: 200} // nothing to print
+		r <- Result{url: "https://example.com/old", referrer: "/", status: 410, err: StatusNotOk}
+		close(r)
+		return r
+	}
+
+	tests := []struct {
+		by   string
+		want string
+	}{
+		{
+			by: GROUPSTATUS,
+			want: `
+== status 200 ==
+https://example.com/docs/a
+> line:   3 match: there
+https://example.com/docs/b
+> line:   1 match: hi
+
+== status 404 ==
+https://example.com/gone
+- status 404 (from /)
+
+== status 410 ==
+https://example.com/old
+- status 410 (from /)
+
+== errors ==
+https://example.com/slow : error timeout
+`,
+		},
+		{
+			by: GROUPTERM,
+			want: `
+== term "hi" ==
+https://example.com/docs/b
+> line:   1 match: hi
+
+== term "there" ==
+https://example.com/docs/a
+> line:   3 match: there
+
+== no matches ==
+https://example.com/gone
+- status 404 (from /)
+https://example.com/old
+- status 410 (from /)
+https://example.com/slow : error timeout
+`,
+		},
+		{
+			by: GROUPREF,
+			want: `
+== / contains 2 broken links ==
+https://example.com/gone
+- status 404 (from /)
+https://example.com/old
+- status 410 (from /)
+
+== https://example.com/docs/a contains 1 broken link ==
+https://example.com/slow : error timeout
+
+== other pages ==
+https://example.com/docs/a
+> line:   3 match: there
+https://example.com/docs/b
+> line:   1 match: hi
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			var buf bytes.Buffer
+			options := Options{GroupBy: tt.by}
+			options.Args.BaseURL = "https://example.com"
+			sink := newTextSink(closingWriter{Writer: &buf}, options)
+			if _, err := drain(results(), sink, fakeStatser{Pages: 6}); err != nil {
+				t.Fatal(err)
+			}
+			want := "\nCommencing search of https://example.com:\n" + tt.want + "processed 6 pages\n"
+			if diff := cmp.Diff(want, buf.String()); diff != "" {
+				t.Errorf("output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
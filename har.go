@@ -0,0 +1,425 @@
+// har.go records the http traffic of a crawl in the HTTP Archive (HAR)
+// 1.2 format, for analysis in browser devtools or HAR viewers. Headers,
+// timings and sizes are recorded for each request and response, with the
+// bodies of requests which have them, such as seed requests, and
+// optionally the response bodies.
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// HARVERSION is the version of the HAR format written
+const HARVERSION = "1.2"
+
+// harLog is the document written to a HAR file
+type harLog struct {
+	Log struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+// harCreator names the program making a HAR file
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// harEntry is a request and its response
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"` // milliseconds
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Error           string      `json:"_error,omitempty"` // a request without a response
+	started         time.Time
+}
+
+// harRequest is a request of a harEntry
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harPair    `json:"cookies"`
+	Headers     []harPair    `json:"headers"`
+	QueryString []harPair    `json:"queryString"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+}
+
+// harPostData is the body of a request, such as the form posted for a
+// seed, with its parameters if it is a form
+type harPostData struct {
+	MimeType string    `json:"mimeType"`
+	Params   []harPair `json:"params"`
+	Text     string    `json:"text"`
+}
+
+// harResponse is a response of a harEntry
+type harResponse struct {
+	Status      int        `json:"status"`
+	StatusText  string     `json:"statusText"`
+	HTTPVersion string     `json:"httpVersion"`
+	Cookies     []harPair  `json:"cookies"`
+	Headers     []harPair  `json:"headers"`
+	Content     harContent `json:"content"`
+	RedirectURL string     `json:"redirectURL"`
+	HeadersSize int        `json:"headersSize"`
+	BodySize    int        `json:"bodySize"`
+}
+
+// harContent describes the body of a response, with its text if bodies
+// are recorded
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// harPair is a header, cookie or query string parameter
+type harPair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harTimings are the phases of a request in milliseconds, with -1 for
+// phases which did not apply, such as connecting on a reused
+// connection. As the format requires, connect includes ssl.
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// harRecorder is an http.RoundTripper recording the requests made with
+// transport and their responses as HAR entries. An entry is complete
+// once its response body has been read or closed.
+type harRecorder struct {
+	transport http.RoundTripper
+	bodies    bool // record the response bodies
+	now       func() time.Time
+	mu        sync.Mutex
+	entries   []harEntry
+}
+
+// newHARRecorder makes a harRecorder for transport, or
+// http.DefaultTransport if transport is nil
+func newHARRecorder(transport http.RoundTripper, bodies bool) *harRecorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &harRecorder{transport: transport, bodies: bodies, now: time.Now}
+}
+
+// harTrace records the times of the phases of a request
+type harTrace struct {
+	mu                     sync.Mutex
+	start                  time.Time
+	dnsStart, dnsDone      time.Time
+	connectStart, connDone time.Time
+	tlsStart, tlsDone      time.Time
+	gotConn, wrote, first  time.Time
+	remoteAddr             string
+}
+
+// clientTrace returns the httptrace.ClientTrace recording the times
+// into t, using now as the clock
+func (t *harTrace) clientTrace(now func() time.Time) *httptrace.ClientTrace {
+	at := func(field *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if field.IsZero() {
+			*field = now()
+		}
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { at(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { at(&t.dnsDone) },
+		ConnectStart:      func(_, _ string) { at(&t.connectStart) },
+		ConnectDone:       func(_, _ string, _ error) { at(&t.connDone) },
+		TLSHandshakeStart: func() { at(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { at(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			at(&t.gotConn)
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				t.remoteAddr = host
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { at(&t.wrote) },
+		GotFirstResponseByte: func() { at(&t.first) },
+	}
+}
+
+// timings returns the harTimings of a request completed at end
+func (t *harTrace) timings(end time.Time) harTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ms := func(from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() {
+			return -1
+		}
+		return float64(to.Sub(from).Microseconds()) / 1000
+	}
+	connected := t.connDone
+	if !t.tlsDone.IsZero() {
+		connected = t.tlsDone
+	}
+	h := harTimings{
+		DNS:     ms(t.dnsStart, t.dnsDone),
+		Connect: ms(t.connectStart, connected),
+		SSL:     ms(t.tlsStart, t.tlsDone),
+		Send:    ms(t.gotConn, t.wrote),
+		Wait:    ms(t.wrote, t.first),
+		Receive: ms(t.first, end),
+	}
+	h.Blocked = max(ms(t.start, t.gotConn)-max(h.DNS, 0)-max(h.Connect, 0), 0)
+	if t.gotConn.IsZero() {
+		h.Blocked = -1
+	}
+	return h
+}
+
+// total returns the total time of the timings, which excludes ssl as it
+// is included in connect
+func (h harTimings) total() float64 {
+	total := 0.0
+	for _, ms := range []float64{h.Blocked, h.DNS, h.Connect, h.Send, h.Wait, h.Receive} {
+		total += max(ms, 0)
+	}
+	return total
+}
+
+// RoundTrip meets the http.RoundTripper interface
+func (h *harRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &harTrace{start: h.now()}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace(h.now)))
+	entry := harEntry{started: trace.start, Request: newHARRequest(req)}
+
+	resp, err := h.transport.RoundTrip(req)
+	if err != nil {
+		entry.Error = err.Error()
+		entry.Response = harResponse{Cookies: []harPair{}, Headers: []harPair{}, HeadersSize: -1, BodySize: -1}
+		h.add(entry, trace)
+		return nil, err
+	}
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     harCookies(resp.Cookies()),
+		Headers:     harHeaders(resp.Header),
+		Content:     harContent{MimeType: resp.Header.Get("Content-Type")},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+	}
+	body := &harBody{ReadCloser: resp.Body}
+	if h.bodies {
+		body.buf = &bytes.Buffer{}
+	}
+	body.done = func() {
+		entry.Response.BodySize = body.n
+		entry.Response.Content.Size = body.n
+		if body.buf != nil {
+			entry.Response.Content.Text, entry.Response.Content.Encoding = harText(body.buf.Bytes())
+		}
+		h.add(entry, trace)
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// add completes entry with its timings and records it
+func (h *harRecorder) add(entry harEntry, trace *harTrace) {
+	entry.Timings = trace.timings(h.now())
+	entry.Time = entry.Timings.total()
+	entry.StartedDateTime = entry.started.Format("2006-01-02T15:04:05.000Z07:00")
+	trace.mu.Lock()
+	entry.ServerIPAddress = trace.remoteAddr
+	trace.mu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, entry)
+}
+
+// write writes the entries recorded, in the order the requests were
+// started, to a HAR file
+func (h *harRecorder) write(filename string) error {
+	h.mu.Lock()
+	entries := append([]harEntry{}, h.entries...)
+	h.mu.Unlock()
+	slices.SortStableFunc(entries, func(a, b harEntry) int {
+		return a.started.Compare(b.started)
+	})
+
+	doc := harLog{}
+	doc.Log.Version = HARVERSION
+	doc.Log.Creator = harCreator{Name: "webchk", Version: version}
+	doc.Log.Entries = entries
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("could not create har file: %w", err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write har file: %w", err)
+	}
+	return f.Close()
+}
+
+// newHARRequest describes req. The body of a request with one, such as
+// a seed request, is read from a copy made by its GetBody, leaving req
+// to be sent; a body which cannot be copied is recorded as of unknown
+// size.
+func newHARRequest(req *http.Request) harRequest {
+	headers := harHeaders(req.Header)
+	if req.Host != "" {
+		headers = append([]harPair{{"Host", req.Host}}, headers...)
+	}
+	query := []harPair{}
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			query = append(query, harPair{name, v})
+		}
+	}
+	slices.SortStableFunc(query, func(a, b harPair) int { return cmp.Compare(a.Name, b.Name) })
+	r := harRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: req.Proto,
+		Cookies:     harCookies(req.Cookies()),
+		Headers:     headers,
+		QueryString: query,
+		HeadersSize: -1,
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return r
+	}
+	r.BodySize = -1
+	if req.GetBody == nil {
+		return r
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return r
+	}
+	defer body.Close()
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return r
+	}
+	r.BodySize = len(b)
+	r.PostData = newHARPostData(req.Header.Get("Content-Type"), b)
+	return r
+}
+
+// newHARPostData describes a request body of the content type
+// mimeType, with its parameters, sorted by name, if it is a form
+func newHARPostData(mimeType string, body []byte) *harPostData {
+	data := &harPostData{MimeType: mimeType, Params: []harPair{}, Text: string(body)}
+	if media, _, _ := mime.ParseMediaType(mimeType); media != "application/x-www-form-urlencoded" {
+		return data
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return data
+	}
+	for name, vs := range values {
+		for _, v := range vs {
+			data.Params = append(data.Params, harPair{name, v})
+		}
+	}
+	slices.SortStableFunc(data.Params, func(a, b harPair) int { return cmp.Compare(a.Name, b.Name) })
+	return data
+}
+
+// harHeaders returns headers sorted by name
+func harHeaders(header http.Header) []harPair {
+	pairs := []harPair{}
+	for name, values := range header {
+		for _, v := range values {
+			pairs = append(pairs, harPair{name, v})
+		}
+	}
+	slices.SortStableFunc(pairs, func(a, b harPair) int { return cmp.Compare(a.Name, b.Name) })
+	return pairs
+}
+
+// harCookies returns the names and values of cookies
+func harCookies(cookies []*http.Cookie) []harPair {
+	pairs := []harPair{}
+	for _, c := range cookies {
+		pairs = append(pairs, harPair{c.Name, c.Value})
+	}
+	return pairs
+}
+
+// harText returns a body as text, base64 encoded unless it is utf-8
+func harText(body []byte) (text, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// harBody counts, and optionally keeps, the bytes read from a response
+// body, calling done once when it is read to the end or closed
+type harBody struct {
+	io.ReadCloser
+	n    int
+	buf  *bytes.Buffer
+	done func()
+	once sync.Once
+}
+
+// Read reads from the body
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += n
+	if b.buf != nil {
+		b.buf.Write(p[:n])
+	}
+	if err == io.EOF {
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+// Close closes the body
+func (b *harBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
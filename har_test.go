@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHARRecorder(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0xff, 0xfe})
+		default:
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<p>hello</p>")
+		}
+	}))
+	defer server.Close()
+
+	for _, bodies := range []bool{false, true} {
+		t.Run(fmt.Sprintf("bodies %t", bodies), func(t *testing.T) {
+			har := newHARRecorder(nil, bodies)
+			client := &http.Client{Transport: har}
+			for _, path := range []string{"/old?a=1", "/binary"} {
+				resp, err := client.Get(server.URL + path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			client.Timeout = 100 * time.Millisecond
+			if _, err := client.Get("http://127.0.0.1:1/refused"); err == nil {
+				t.Fatal("expected connection error")
+			}
+
+			filename := filepath.Join(t.TempDir(), "crawl.har")
+			if err := har.write(filename); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc harLog
+			if err := json.Unmarshal(b, &doc); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := doc.Log.Version, HARVERSION; got != want {
+				t.Errorf("version got %s want %s", got, want)
+			}
+
+			type summary struct {
+				URL, Redirect, MimeType, Text, Encoding string
+				Status, Size                            int
+				Query, Cookies                          []harPair
+				Error                                   bool
+			}
+			got := []summary{}
+			for _, e := range doc.Log.Entries {
+				got = append(got, summary{
+					URL:      e.Request.URL,
+					Redirect: e.Response.RedirectURL,
+					MimeType: e.Response.Content.MimeType,
+					Text:     e.Response.Content.Text,
+					Encoding: e.Response.Content.Encoding,
+					Status:   e.Response.Status,
+					Size:     e.Response.Content.Size,
+					Query:    e.Request.QueryString,
+					Cookies:  e.Response.Cookies,
+					Error:    e.Error != "",
+				})
+				if e.Error == "" && (e.Timings.Wait < 0 || e.Time < e.Timings.Wait) {
+					t.Errorf("%s: unexpected timings %+v total %g", e.Request.URL, e.Timings, e.Time)
+				}
+			}
+			text := func(s string) string {
+				if bodies {
+					return s
+				}
+				return ""
+			}
+			want := []summary{
+				{URL: server.URL + "/old?a=1", Redirect: "/new", MimeType: "text/html; charset=utf-8", Status: 301, Size: 39,
+					Text: text(`<a href="/new">Moved Permanently</a>.` + "\n\n"), Query: []harPair{{"a", "1"}}, Cookies: []harPair{}},
+				{URL: server.URL + "/new", MimeType: "text/html", Status: 200, Size: 12,
+					Text: text("<p>hello</p>"), Query: []harPair{}, Cookies: []harPair{{"session", "abc"}}},
+				{URL: server.URL + "/binary", MimeType: "application/octet-stream", Status: 200, Size: 2,
+					Text: text("//4="), Encoding: text("base64"), Query: []harPair{}, Cookies: []harPair{}},
+				{URL: "http://127.0.0.1:1/refused", Query: []harPair{}, Cookies: []harPair{}, Error: true},
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("entries mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHARSeedRequest(t *testing.T) {
+
+	var posted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		posted = string(b)
+		fmt.Fprint(w, "<p>results</p>")
+	}))
+	defer server.Close()
+
+	seeds := seedRequests{
+		server.URL + "/search": {Method: http.MethodPost, Body: "q=shoes&page=2&q=boots"},
+		server.URL + "/api":    {Method: http.MethodPut, Body: `{"q":"shoes"}`, Headers: map[string]string{"Content-Type": "application/json"}},
+	}
+	tests := []struct {
+		url      string
+		bodySize int
+		postData *harPostData
+	}{
+		{server.URL + "/page", 0, nil},
+		{server.URL + "/search", 22, &harPostData{
+			MimeType: "application/x-www-form-urlencoded",
+			Params:   []harPair{{"page", "2"}, {"q", "shoes"}, {"q", "boots"}},
+			Text:     "q=shoes&page=2&q=boots",
+		}},
+		{server.URL + "/api", 13, &harPostData{MimeType: "application/json", Params: []harPair{}, Text: `{"q":"shoes"}`}},
+	}
+	har := newHARRecorder(nil, false)
+	client := &http.Client{Transport: har}
+	for _, tt := range tests {
+		req, err := seeds.newRequest(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if tt.postData != nil && posted != tt.postData.Text {
+			t.Errorf("%s: server got body %q want %q", tt.url, posted, tt.postData.Text)
+		}
+	}
+	if got, want := len(har.entries), len(tests); got != want {
+		t.Fatalf("got %d want %d entries", got, want)
+	}
+	for i, e := range har.entries {
+		if got, want := e.Request.BodySize, tests[i].bodySize; got != want {
+			t.Errorf("%s: body size got %d want %d", e.Request.URL, got, want)
+		}
+		if diff := cmp.Diff(tests[i].postData, e.Request.PostData); diff != "" {
+			t.Errorf("%s: post data mismatch (-want +got):\n%s", e.Request.URL, diff)
+		}
+	}
+}
+
+func TestHARTimings(t *testing.T) {
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ms := func(n int) time.Time { return start.Add(time.Duration(n) * time.Millisecond) }
+	tests := []struct {
+		name  string
+		trace *harTrace
+		want  harTimings
+	}{
+		{
+			name: "new connection",
+			trace: &harTrace{start: start, dnsStart: ms(1), dnsDone: ms(3), connectStart: ms(3), connDone: ms(5),
+				tlsStart: ms(5), tlsDone: ms(9), gotConn: ms(10), wrote: ms(11), first: ms(20)},
+			want: harTimings{Blocked: 2, DNS: 2, Connect: 6, SSL: 4, Send: 1, Wait: 9, Receive: 5},
+		},
+		{
+			name:  "reused connection",
+			trace: &harTrace{start: start, gotConn: ms(2), wrote: ms(3), first: ms(10)},
+			want:  harTimings{Blocked: 2, DNS: -1, Connect: -1, SSL: -1, Send: 1, Wait: 7, Receive: 15},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.trace.timings(ms(25))
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("timings mismatch (-want +got):\n%s", diff)
+			}
+			if got, want := got.total(), 25.0; got != want {
+				t.Errorf("total got %g want %g", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// highlight.go colours each search term distinctly in the text output
+// when it is written to a terminal.
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// termColours are the ansi colours given to the search terms in turn
+var termColours = []string{
+	"\x1b[31m", // red
+	"\x1b[32m", // green
+	"\x1b[33m", // yellow
+	"\x1b[34m", // blue
+	"\x1b[35m", // magenta
+	"\x1b[36m", // cyan
+}
+
+// colourReset ends an ansi colour
+const colourReset = "\x1b[0m"
+
+// highlighter colours the search terms, each in the colour of its
+// position in the search terms
+type highlighter map[string]string
+
+// newHighlighter makes a highlighter for searchTerms
+func newHighlighter(searchTerms []string) highlighter {
+	h := highlighter{}
+	for i, st := range searchTerms {
+		h[st] = termColours[i%len(termColours)]
+	}
+	return h
+}
+
+// paint returns term in its colour, or unchanged if it has none
+func (h highlighter) paint(term string) string {
+	colour, ok := h[term]
+	if !ok {
+		return term
+	}
+	return colour + term + colourReset
+}
+
+// isColourTerminal reports whether w is a terminal which may be
+// coloured, which it may not be if NO_COLOR is set
+func isColourTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
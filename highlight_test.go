@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestHighlighter(t *testing.T) {
+
+	terms := []string{"a", "b", "c", "d", "e", "f", "g"}
+	h := newHighlighter(terms)
+	tests := []struct {
+		term string
+		want string
+	}{
+		{"a", "\x1b[31ma\x1b[0m"},
+		{"b", "\x1b[32mb\x1b[0m"},
+		{"g", "\x1b[31mg\x1b[0m"}, // colours are reused
+		{"z", "z"},
+	}
+	for _, tt := range tests {
+		if got := h.paint(tt.term); got != tt.want {
+			t.Errorf("%s got %q want %q", tt.term, got, tt.want)
+		}
+	}
+
+	var none highlighter // not a terminal
+	if got := none.paint("a"); got != "a" {
+		t.Errorf("got %q want %q", got, "a")
+	}
+}
+
+func TestIsColourTerminal(t *testing.T) {
+
+	if isColourTerminal(&bytes.Buffer{}) {
+		t.Error("buffer reported as a terminal")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if isColourTerminal(w) {
+		t.Error("pipe reported as a terminal")
+	}
+}
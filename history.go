@@ -0,0 +1,310 @@
+// history.go reads the runs recorded by the sqlite OutputSink, listing
+// the runs of a site, fetching the results of a run and reporting how
+// the counts of broken pages and matches change from run to run.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRunNotFound reports a run which is not in the database
+var ErrRunNotFound = errors.New("run not found")
+
+// runSummary summarises a run recorded in the database. Trends are the
+// change in the broken pages and matches since the previous run of the
+// same site.
+type runSummary struct {
+	ID            int64     `json:"id"`
+	BaseURL       string    `json:"baseurl"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	Termination   string    `json:"termination"`
+	Pages         int       `json:"pages"`
+	Errors        int       `json:"errors"`
+	Broken        int       `json:"broken"`
+	Violations    int       `json:"violations"`
+	Matches       int       `json:"matches"`
+	BrokenChange  int       `json:"broken_change"`
+	MatchesChange int       `json:"matches_change"`
+}
+
+// history reads runs from a sqlite database written by the sqlite
+// OutputSink
+type history struct {
+	db *sql.DB
+}
+
+// openHistory opens the sqlite database at filename
+func openHistory(filename string) (*history, error) {
+	db, err := sql.Open("sqlite", "file:"+filename+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("could not open history: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not open history: %w", err)
+	}
+	return &history{db: db}, nil
+}
+
+// close closes the database
+func (h *history) close() error {
+	return h.db.Close()
+}
+
+// runs lists the runs of baseURL, or of all sites if baseURL is empty,
+// oldest first
+func (h *history) runs(baseURL string) ([]runSummary, error) {
+	rows, err := h.db.Query(`
+		SELECT runs.id, baseurl, start, COALESCE(end, ''), COALESCE(termination, ''),
+			COALESCE(pages, 0), COALESCE(errors, 0), COALESCE(broken, 0), COALESCE(violations, 0),
+			(SELECT COUNT(*) FROM matches JOIN results ON results.id = matches.result_id
+				WHERE results.run_id = runs.id)
+		FROM runs
+		WHERE ? = '' OR baseurl = ?
+		ORDER BY start, runs.id`, baseURL, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []runSummary{}
+	previous := map[string]runSummary{} // by base url
+	for rows.Next() {
+		var r runSummary
+		var start, end string
+		if err := rows.Scan(&r.ID, &r.BaseURL, &start, &end, &r.Termination,
+			&r.Pages, &r.Errors, &r.Broken, &r.Violations, &r.Matches); err != nil {
+			return nil, fmt.Errorf("history query error: %w", err)
+		}
+		r.Start, _ = time.Parse(time.RFC3339Nano, start)
+		r.End, _ = time.Parse(time.RFC3339Nano, end) // zero if the run did not finish
+		if p, ok := previous[r.BaseURL]; ok {
+			r.BrokenChange, r.MatchesChange = r.Broken-p.Broken, r.Matches-p.Matches
+		}
+		previous[r.BaseURL] = r
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// results returns the results of run id selected by the query
+func (h *history) results(id int64, q resultQuery) (storedResults, error) {
+	var n int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM runs WHERE id = ?", id).Scan(&n); err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("run %d: %w", id, ErrRunNotFound)
+	}
+
+	// databases made by earlier versions, which are opened read only,
+	// may not record the size and content type of results
+	detail := "0, ''"
+	if ok, err := hasColumn(h.db, "results", "content_type"); err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	} else if ok {
+		detail = "COALESCE(size, 0), COALESCE(content_type, '')"
+	}
+	where, args := q.where(id)
+	selected := "SELECT id FROM results WHERE " + where + " ORDER BY id" + q.page()
+	rows, err := h.db.Query(`
+		SELECT id, url, COALESCE(referrer, ''), COALESCE(status, 0), COALESCE(error, ''), `+detail+`
+		FROM results WHERE id IN (`+selected+`) ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	}
+	defer rows.Close()
+	results := storedResults{}
+	index := map[int64]int{} // result id to index in results
+	for rows.Next() {
+		var resultID int64
+		r := jsonResult{Matches: []jsonMatch{}, Violations: []jsonViolation{}}
+		if err := rows.Scan(&resultID, &r.URL, &r.Referrer, &r.Status, &r.Error, &r.Size, &r.ContentType); err != nil {
+			return nil, fmt.Errorf("history query error: %w", err)
+		}
+		index[resultID] = len(results)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	}
+
+	offset := "0"
+	if ok, err := hasColumn(h.db, "matches", "byte_offset"); err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	} else if ok {
+		offset = "COALESCE(byte_offset, 0)"
+	}
+	matches, err := h.db.Query(`
+		SELECT result_id, line, term, `+offset+` FROM matches
+		WHERE result_id IN (`+selected+`) ORDER BY rowid`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	}
+	defer matches.Close()
+	for matches.Next() {
+		var resultID int64
+		var m jsonMatch
+		if err := matches.Scan(&resultID, &m.Line, &m.Match, &m.Offset); err != nil {
+			return nil, fmt.Errorf("history query error: %w", err)
+		}
+		r := &results[index[resultID]]
+		r.Matches = append(r.Matches, m)
+	}
+	if err := matches.Err(); err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	}
+
+	violations, err := h.db.Query(`
+		SELECT result_id, kind, message FROM violations
+		WHERE result_id IN (`+selected+`) ORDER BY rowid`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("history query error: %w", err)
+	}
+	defer violations.Close()
+	for violations.Next() {
+		var resultID int64
+		var v jsonViolation
+		if err := violations.Scan(&resultID, &v.Kind, &v.Message); err != nil {
+			return nil, fmt.Errorf("history query error: %w", err)
+		}
+		r := &results[index[resultID]]
+		r.Violations = append(r.Violations, v)
+	}
+	return results, violations.Err()
+}
+
+// writeRuns writes a table of runs and their trends to w
+func writeRuns(w io.Writer, runs []runSummary) error {
+	if len(runs) == 0 {
+		_, err := fmt.Fprintln(w, "no runs recorded")
+		return err
+	}
+	change := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return fmt.Sprintf("(%+d)", n)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%5s  %-19s  %6s  %6s  %6s %-6s  %10s  %7s %-6s  %s\n",
+		"run", "start", "pages", "errors", "broken", "", "violations", "matches", "", "termination")
+	for _, r := range runs {
+		fmt.Fprintf(&b, "%5d  %-19s  %6d  %6d  %6d %-6s  %10d  %7d %-6s  %s\n",
+			r.ID, r.Start.Local().Format(time.DateTime), r.Pages, r.Errors,
+			r.Broken, change(r.BrokenChange), r.Violations,
+			r.Matches, change(r.MatchesChange), r.Termination,
+		)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// historyHandler serves the history of runs in the sqlite database at
+// filename as json. The database is opened for each request as it may
+// not exist until the first run has been recorded.
+func historyHandler(filename string, query func(h *history, r *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h, err := openHistory(filename)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer h.close()
+		v, err := query(h, r)
+		switch {
+		case errors.Is(err, ErrRunNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, ErrSiteForbidden):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case errors.Is(err, ErrResultQuery):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if results, ok := v.(storedResults); ok && r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			if err := results.writeCSV(w); err != nil {
+				fmt.Fprintln(diagnostics, err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			fmt.Fprintln(diagnostics, err)
+		}
+	}
+}
+
+// historyRuns lists the runs, optionally for the site given by the
+// baseurl query parameter, of the sites the api key of the request may
+// see
+func historyRuns(h *history, r *http.Request) (any, error) {
+	runs, err := h.runs(r.URL.Query().Get("baseurl"))
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(runs, func(run runSummary) bool {
+		return !allowsSite(r, run.BaseURL)
+	}), nil
+}
+
+// historyResults returns the results of the run given by the id path
+// parameter, selected by the query parameters
+func historyResults(h *history, r *http.Request) (any, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("run %q: %w", r.PathValue("id"), ErrRunNotFound)
+	}
+	if err := allowsRun(h, r, id); err != nil {
+		return nil, err
+	}
+	q, err := parseResultQuery(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	return h.results(id, q)
+}
+
+// showHistory writes the runs of the base url in the history database
+// given in options to w or, if a run is given, its results selected by
+// the results query of options as json or csv
+func showHistory(w io.Writer, options Options) error {
+	h, err := openHistory(options.History)
+	if err != nil {
+		return err
+	}
+	defer h.close()
+	if options.Run != 0 {
+		results, err := h.results(options.Run, options.resultQuery())
+		if err != nil {
+			return err
+		}
+		if options.RunCSV {
+			return results.writeCSV(w)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+	runs, err := h.runs(options.Args.BaseURL)
+	if err != nil {
+		return err
+	}
+	return writeRuns(w, runs)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// historyDB makes a database with two runs of example.com and one of
+// example.org
+func historyDB(t *testing.T) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "webchk.db")
+	start := time.Date(2024, 4, 1, 2, 0, 0, 0, time.UTC)
+	for i, site := range []string{"https://example.com", "https://example.org", "https://example.com"} {
+		options := Options{}
+		options.Args.BaseURL = site
+		sink, err := newSQLiteSink(filename, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := testResults()
+		if i == 2 {
+			<-results // the second run of example.com finds fewer matches
+		}
+		runStart := start.AddDate(0, 0, i)
+		if _, err := drain(results, sink, fakeStatser{
+			Pages:       3,
+			Broken:      i,
+			Start:       runStart,
+			End:         runStart.Add(time.Minute),
+			Termination: TerminationIdle,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filename
+}
+
+func TestHistory(t *testing.T) {
+
+	h, err := openHistory(historyDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+
+	runs, err := h.runs("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type summary struct{ id, broken, brokenChange, matches, matchesChange int }
+	got := []summary{}
+	for _, r := range runs {
+		got = append(got, summary{int(r.ID), r.Broken, r.BrokenChange, r.Matches, r.MatchesChange})
+	}
+	want := []summary{{1, 0, 0, 2, 0}, {3, 2, 2, 0, -2}}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(summary{})); diff != "" {
+		t.Errorf("runs mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := runs[1].End, time.Date(2024, 4, 3, 2, 1, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("end got %s want %s", got, want)
+	}
+
+	all, err := h.runs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(all), 3; got != want {
+		t.Errorf("got %d want %d runs", got, want)
+	}
+
+	results, err := h.results(1, resultQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]jsonMatch{{3, "hi", 0}, {10, "there", 0}}, results[0].Matches); diff != "" {
+		t.Errorf("matches mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]jsonViolation{{"status", "status 404 want 200 (/)"}}, results[1].Violations); diff != "" {
+		t.Errorf("violations mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := results[2].Error, "timeout"; got != want {
+		t.Errorf("error got %s want %s", got, want)
+	}
+	if got, want := [2]any{results[0].Size, results[0].ContentType}, [2]any{2048, "text/html"}; got != want {
+		t.Errorf("size and content type got %v want %v", got, want)
+	}
+	if _, err := h.results(99, resultQuery{}); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("got error %v want %v", err, ErrRunNotFound)
+	}
+}
+
+func TestShowHistory(t *testing.T) {
+
+	options := Options{History: historyDB(t)}
+	options.Args.BaseURL = "https://example.com"
+
+	var buf bytes.Buffer
+	if err := showHistory(&buf, options); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if got, want := len(lines), 3; got != want {
+		t.Fatalf("got %d want %d lines:\n%s", got, want, buf.String())
+	}
+	for _, want := range []string{"2 (+2)", "0 (-2)", "idle timeout"} {
+		if !strings.Contains(lines[2], want) {
+			t.Errorf("line %q does not contain %q", lines[2], want)
+		}
+	}
+
+	buf.Reset()
+	options.Run = 3
+	if err := showHistory(&buf, options); err != nil {
+		t.Fatal(err)
+	}
+	var results []jsonResult
+	if err := json.Unmarshal(buf.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(results), 2; got != want {
+		t.Errorf("got %d want %d results", got, want)
+	}
+
+	options.History = filepath.Join(t.TempDir(), "missing.db")
+	if err := showHistory(&buf, options); err == nil {
+		t.Error("expected error for missing database")
+	}
+}
+
+func TestHistoryEndpoints(t *testing.T) {
+
+	filename := historyDB(t)
+	ts := httptest.NewServer(newServer("", Options{Output: []string{"sqlite:" + filename}}, nil).http.Handler)
+	defer ts.Close()
+
+	tests := []struct {
+		path   string
+		status int
+		count  int
+	}{
+		{"/history/runs", http.StatusOK, 3},
+		{"/history/runs?baseurl=https://example.org", http.StatusOK, 1},
+		{"/history/runs/1", http.StatusOK, 3},
+		{"/history/runs/1?status=404", http.StatusOK, 1},
+		{"/history/runs/1?limit=1&offset=1", http.StatusOK, 1},
+		{"/history/runs/1?limit=x", http.StatusBadRequest, 0},
+		{"/history/runs/99", http.StatusNotFound, 0},
+		{"/history/runs/x", http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(ts.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var items []json.RawMessage
+		if tt.status == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+				t.Errorf("%s decode error %v", tt.path, err)
+			}
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s status got %d want %d", tt.path, resp.StatusCode, tt.status)
+		}
+		if len(items) != tt.count {
+			t.Errorf("%s got %d want %d items", tt.path, len(items), tt.count)
+		}
+	}
+
+	// results may be exported as csv
+	resp, err := http.Get(ts.URL + "/history/runs/1?format=csv&term=hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.Header.Get("Content-Type"), "text/csv"; got != want {
+		t.Errorf("content type got %s want %s", got, want)
+	}
+	if got, want := len(records), 2; got != want {
+		t.Errorf("got %d want %d csv records", got, want)
+	}
+
+	// without a sqlite output there is no history
+	ts2 := httptest.NewServer(newServer("", Options{}, nil).http.Handler)
+	defer ts2.Close()
+	resp, err = http.Get(ts2.URL + "/history/runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status got %d want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,129 @@
+// historyquery.go queries the results of a run recorded by the sqlite
+// OutputSink, filtering them by status, search term and url and paging
+// through them, so that the results of large runs can be explored
+// without loading them all. Results may be exported as csv.
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrResultQuery reports a query of the results of a run which cannot
+// be parsed
+var ErrResultQuery = errors.New("invalid results query")
+
+// resultQuery selects the results of a run. Zero values select all the
+// results.
+type resultQuery struct {
+	status int    // only results with this status
+	term   string // only results matching this search term
+	url    string // only results with urls matching this glob pattern
+	limit  int    // at most this many results
+	offset int    // skipping this many results first
+}
+
+// where returns the sql condition selecting the results of run id
+// matching the query, and its arguments
+func (q resultQuery) where(id int64) (string, []any) {
+	conditions, args := []string{"run_id = ?"}, []any{id}
+	if q.status != 0 {
+		conditions, args = append(conditions, "status = ?"), append(args, q.status)
+	}
+	if q.term != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM matches WHERE matches.result_id = results.id AND matches.term = ?)")
+		args = append(args, q.term)
+	}
+	if q.url != "" {
+		conditions, args = append(conditions, "url GLOB ?"), append(args, q.url)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// page returns the sql clause limiting the results to the page of the
+// query
+func (q resultQuery) page() string {
+	if q.limit <= 0 && q.offset <= 0 {
+		return ""
+	}
+	limit := q.limit
+	if limit <= 0 {
+		limit = -1 // no limit
+	}
+	return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, max(q.offset, 0))
+}
+
+// parseResultQuery parses a results query from the status, term, url,
+// limit and offset query parameters of a request
+func parseResultQuery(values url.Values) (resultQuery, error) {
+	q := resultQuery{term: values.Get("term"), url: values.Get("url")}
+	for _, p := range []struct {
+		name string
+		n    *int
+	}{
+		{"status", &q.status},
+		{"limit", &q.limit},
+		{"offset", &q.offset},
+	} {
+		v := values.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return resultQuery{}, fmt.Errorf("%s %q: %w", p.name, v, ErrResultQuery)
+		}
+		*p.n = n
+	}
+	return q, nil
+}
+
+// resultQuery returns the query of the results of --run given in
+// options
+func (o Options) resultQuery() resultQuery {
+	return resultQuery{
+		status: o.RunStatus,
+		term:   o.RunTerm,
+		url:    o.RunURL,
+		limit:  o.RunLimit,
+		offset: o.RunOffset,
+	}
+}
+
+// storedResults are results read back from the database
+type storedResults []jsonResult
+
+// writeCSV writes the results as csv, with the columns of the csv
+// output which are recorded in the database
+func (s storedResults) writeCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"url", "referrer", "status", "error", "matches", "violations", "size", "content_type"})
+	for _, r := range s {
+		matches := make([]string, len(r.Matches))
+		for i, m := range r.Matches {
+			matches[i] = fmt.Sprintf("%d:%s", m.Line, m.Match)
+		}
+		violations := make([]string, len(r.Violations))
+		for i, v := range r.Violations {
+			violations[i] = v.Message
+		}
+		c.Write([]string{
+			r.URL,
+			r.Referrer,
+			strconv.Itoa(r.Status),
+			r.Error,
+			strings.Join(matches, "; "),
+			strings.Join(violations, "; "),
+			strconv.Itoa(r.Size),
+			r.ContentType,
+		})
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHistoryResultQuery(t *testing.T) {
+
+	h, err := openHistory(historyDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.close()
+
+	tests := []struct {
+		name  string
+		query resultQuery
+		want  []string
+	}{
+		{"all", resultQuery{}, []string{"https://example.com", "https://example.com/gone", "https://example.com/slow"}},
+		{"status", resultQuery{status: 404}, []string{"https://example.com/gone"}},
+		{"term", resultQuery{term: "there"}, []string{"https://example.com"}},
+		{"no term", resultQuery{term: "missing"}, []string{}},
+		{"url", resultQuery{url: "*/s*"}, []string{"https://example.com/slow"}},
+		{"limit", resultQuery{limit: 2}, []string{"https://example.com", "https://example.com/gone"}},
+		{"offset", resultQuery{limit: 2, offset: 2}, []string{"https://example.com/slow"}},
+		{"offset only", resultQuery{offset: 1}, []string{"https://example.com/gone", "https://example.com/slow"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := h.results(1, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, r := range results {
+				got = append(got, r.URL)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("results mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// the matches and violations of the results selected are read
+	results, err := h.results(1, resultQuery{offset: 1, limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(results[0].Matches); got != 0 {
+		t.Errorf("got %d matches want 0", got)
+	}
+	if diff := cmp.Diff([]jsonViolation{{"status", "status 404 want 200 (/)"}}, results[0].Violations); diff != "" {
+		t.Errorf("violations mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseResultQuery(t *testing.T) {
+
+	values, _ := url.ParseQuery("status=404&term=hi&url=*/news/*&limit=50&offset=100")
+	got, err := parseResultQuery(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := resultQuery{status: 404, term: "hi", url: "*/news/*", limit: 50, offset: 100}
+	if got != want {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+	for _, query := range []string{"status=x", "limit=-1"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := parseResultQuery(values); !errors.Is(err, ErrResultQuery) {
+			t.Errorf("%s got error %v want %v", query, err, ErrResultQuery)
+		}
+	}
+}
+
+func TestStoredResultsCSV(t *testing.T) {
+
+	results := storedResults{
+		{URL: "https://example.com", Referrer: "/", Status: 200, Size: 2048, ContentType: "text/html",
+			Matches: []jsonMatch{{3, "hi", 0}, {10, "there", 0}}},
+		{URL: "https://example.com/gone", Status: 404, Error: "StatusNotOk",
+			Violations: []jsonViolation{{"status", "status 404 want 200 (/)"}}},
+	}
+	var buf bytes.Buffer
+	if err := results.writeCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"url", "referrer", "status", "error", "matches", "violations", "size", "content_type"},
+		{"https://example.com", "/", "200", "", "3:hi; 10:there", "", "2048", "text/html"},
+		{"https://example.com/gone", "", "404", "StatusNotOk", "", "status 404 want 200 (/)", "0", ""},
+	}
+	if diff := cmp.Diff(want, records); diff != "" {
+		t.Errorf("csv mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,105 @@
+// hostbudget.go stops urls being fetched from a host after a number of
+// hard errors, so that a misconfigured host, such as a subdomain which
+// does not resolve, does not produce thousands of identical errors.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// hostBudget counts the hard errors of each host, and the urls not
+// fetched from hosts whose error budget is used up. A nil hostBudget
+// has no limit. It is safe for concurrent use, as the workers check it
+// before fetching urls already queued.
+type hostBudget struct {
+	limit   int
+	mu      sync.Mutex
+	errors  map[string]int
+	skipped map[string]int
+}
+
+// newHostBudget makes a hostBudget allowing limit hard errors from each
+// host, or nil, for no limit, if limit is less than 1
+func newHostBudget(limit int) *hostBudget {
+	if limit < 1 {
+		return nil
+	}
+	return &hostBudget{limit: limit, errors: map[string]int{}, skipped: map[string]int{}}
+}
+
+// hardError reports whether a result is an error of its host rather
+// than of the page, such as a dns, connection or tls failure, a timeout
+// or a 5xx status
+func hardError(r Result) bool {
+	switch errorKind(r) {
+	case "dns", "connection", "timeout":
+		return true
+	}
+	return r.err == StatusNotOk && r.status >= http.StatusInternalServerError
+}
+
+// urlHost returns the host of u in lowercase, or "" if u cannot be
+// parsed
+func urlHost(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Host)
+}
+
+// add counts the result if it is a hard error, reporting the host of
+// the result if this used up its error budget
+func (b *hostBudget) add(r Result) (host string, usedUp bool) {
+	if b == nil || !hardError(r) {
+		return "", false
+	}
+	host = urlHost(r.url)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errors[host]++
+	return host, b.errors[host] == b.limit
+}
+
+// allowed reports whether u may be fetched, as its host has not used
+// up its error budget, counting it as skipped if not
+func (b *hostBudget) allowed(u string) bool {
+	if b == nil {
+		return true
+	}
+	host := urlHost(u)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.errors[host] < b.limit {
+		return true
+	}
+	b.skipped[host]++
+	return false
+}
+
+// report writes a line to w for each host whose error budget was used
+// up, with the number of urls not fetched as a result
+func (b *hostBudget) report(w io.Writer) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hosts := []string{}
+	for h, n := range b.errors {
+		if n >= b.limit {
+			hosts = append(hosts, h)
+		}
+	}
+	slices.Sort(hosts)
+	for _, h := range hosts {
+		fmt.Fprintf(w, "host %s error budget of %d used up: %d urls not fetched\n", h, b.limit, b.skipped[h])
+	}
+}
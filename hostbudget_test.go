@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHardError(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		r    Result
+		want bool
+	}{
+		{"ok", Result{status: 200}, false},
+		{"not found", Result{status: 404, err: StatusNotOk}, false},
+		{"bad gateway", Result{status: 502, err: StatusNotOk}, true},
+		{"non html", Result{status: 200, err: NonHTMLPageType}, false},
+		{"timeout", Result{err: context.DeadlineExceeded}, true},
+		{"dns", Result{err: &url.Error{Op: "Get", URL: "https://x", Err: &net.DNSError{Err: "no such host"}}}, true},
+		{"connection", Result{err: &url.Error{Op: "Get", URL: "https://x", Err: errors.New("connection refused")}}, true},
+		{"processing", Result{status: 200, err: errors.New("links error")}, false},
+	} {
+		if got := hardError(tt.r); got != tt.want {
+			t.Errorf("%s: got %t want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHostBudget(t *testing.T) {
+
+	var none *hostBudget
+	if b := newHostBudget(0); b != none {
+		t.Fatal("expected no budget for a limit of 0")
+	}
+	if !none.allowed("https://example.com") {
+		t.Error("no budget should allow every url")
+	}
+	if _, usedUp := none.add(Result{status: 502, err: StatusNotOk}); usedUp {
+		t.Error("no budget should never be used up")
+	}
+
+	b := newHostBudget(2)
+	bad := Result{url: "https://Bad.example.com/a", status: http.StatusServiceUnavailable, err: StatusNotOk}
+	if _, usedUp := b.add(bad); usedUp {
+		t.Error("budget used up after 1 error")
+	}
+	b.add(Result{url: "https://bad.example.com/b", status: 404, err: StatusNotOk}) // not counted
+	if host, usedUp := b.add(bad); !usedUp || host != "bad.example.com" {
+		t.Errorf("got %s %t want bad.example.com used up", host, usedUp)
+	}
+	if _, usedUp := b.add(bad); usedUp {
+		t.Error("used up reported more than once")
+	}
+	for _, tt := range []struct {
+		url  string
+		want bool
+	}{
+		{"https://bad.example.com/c", false},
+		{"https://BAD.example.com/d", false},
+		{"https://example.com/c", true},
+	} {
+		if got := b.allowed(tt.url); got != tt.want {
+			t.Errorf("%s: got %t want %t", tt.url, got, tt.want)
+		}
+	}
+	var report strings.Builder
+	b.report(&report)
+	if got, want := report.String(), "host bad.example.com error budget of 2 used up: 2 urls not fetched\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
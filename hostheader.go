@@ -0,0 +1,75 @@
+// hostheader.go sends the Host header given with --host-header, and
+// presents it for TLS SNI, in the requests to the host of the base url,
+// so that a name-based virtual host can be checked at the address of its
+// load balancer or server before it goes live. Requests to other hosts,
+// such as those of external links and assets, are sent as usual.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// withHostHeader sets the getClient to send hostHeader as the Host
+// header of requests to the host of baseURL, and to present it during
+// their TLS handshakes. An empty hostHeader leaves requests as they are.
+func (g *getClient) withHostHeader(hostHeader, baseURL string) {
+	u, err := url.Parse(baseURL)
+	if hostHeader == "" || err != nil || u.Hostname() == "" {
+		return
+	}
+	g.hostHeader, g.baseHost = hostHeader, u.Hostname()
+	if t, ok := g.client.Transport.(*http.Transport); ok {
+		t.DialTLSContext = hostHeaderTLSDialer(t, g.baseHost, hostHeader)
+	}
+}
+
+// setHost sets the Host header of req to the hostHeader of the getClient
+// if req is to the host of the base url
+func (g *getClient) setHost(req *http.Request) {
+	if g.hostHeader != "" && strings.EqualFold(req.URL.Hostname(), g.baseHost) {
+		req.Host = g.hostHeader
+	}
+}
+
+// hostHeaderTLSDialer returns a function making the TLS connections of
+// transport t, presenting hostHeader as the server name to host and the
+// host dialled to any other. Connections are made with the DialContext
+// of t, if set, when dialled, so that it may be set after this.
+func hostHeaderTLSDialer(t *http.Transport, host, hostHeader string) DialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dial := t.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		serverName, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(serverName, host) {
+			serverName = hostHeader
+		}
+		config := &tls.Config{}
+		if t.TLSClientConfig != nil {
+			config = t.TLSClientConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = serverName
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetURLHostHeader(t *testing.T) {
+
+	var gotHost, gotServerName string
+	server := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			gotHost, gotServerName = r.Host, r.TLS.ServerName
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintln(w, "hello world")
+		},
+	))
+	defer server.Close()
+
+	// the server is also reached by the name localhost, as another host
+	baseURL := server.URL
+	otherURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	otherHost := strings.TrimPrefix(otherURL, "https://")
+
+	tests := []struct {
+		name           string
+		hostHeader     string
+		url            string
+		wantHost       string
+		wantServerName string
+	}{
+		{"no_override", "", baseURL, server.Listener.Addr().String(), ""},
+		{"override", "www.example.com", baseURL, "www.example.com", "www.example.com"},
+		{"override_path", "www.example.com", baseURL + "/about", "www.example.com", "www.example.com"},
+		{"other_host", "www.example.com", otherURL, otherHost, "localhost"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGetClient(1, time.Second, WithTransportFunc(func(t *http.Transport) {
+				t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			}))
+			g.withHostHeader(tt.hostHeader, baseURL)
+			gotHost, gotServerName = "", ""
+			result, _ := g.get(tt.url, "/referrer", []string{})
+			if result.err != nil {
+				t.Fatalf("unexpected error %v", result.err)
+			}
+			if got, want := gotHost, tt.wantHost; got != want {
+				t.Errorf("host header got %s want %s", got, want)
+			}
+			if got, want := gotServerName, tt.wantServerName; got != want {
+				t.Errorf("sni got %s want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// idn.go normalises internationalised domain names to their lowercase
+// punycode form, so that urls written with münchen.example and with
+// xn--mnchen-3ya.example are treated as being on the same host.
+
+package main
+
+import (
+	"net"
+	"net/url"
+
+	"golang.org/x/net/idna"
+)
+
+// normaliseHost rewrites the host of u, keeping any port, in its
+// lowercase ASCII (punycode) form. Hosts which are ip addresses or are
+// not valid domain names are left as they are.
+func normaliseHost(u *url.URL) {
+	host := u.Hostname()
+	if host == "" || net.ParseIP(host) != nil {
+		return
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil || ascii == host {
+		return
+	}
+	if port := u.Port(); port != "" {
+		ascii = net.JoinHostPort(ascii, port)
+	}
+	u.Host = ascii
+}
+
+// normaliseURL returns rawURL with its host normalised by normaliseHost
+// and its percent-encoding by normalisePercent, or rawURL itself if it
+// cannot be parsed or has no host
+func normaliseURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	host, path, query := u.Host, u.EscapedPath(), u.RawQuery
+	normaliseHost(u)
+	normalisePercent(u)
+	if u.Host == host && u.EscapedPath() == path && u.RawQuery == query {
+		return rawURL
+	}
+	return u.String()
+}
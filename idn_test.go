@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNormaliseURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"https://münchen.example/a", "https://xn--mnchen-3ya.example/a"},
+		{"https://MÜNCHEN.example:8080/a", "https://xn--mnchen-3ya.example:8080/a"},
+		{"https://xn--mnchen-3ya.example/a", "https://xn--mnchen-3ya.example/a"},
+		{"https://XN--MNCHEN-3YA.example/a", "https://xn--mnchen-3ya.example/a"},
+		{"https://www.example.com/ü", "https://www.example.com/ü"},
+		{"http://127.0.0.1:8000/a", "http://127.0.0.1:8000/a"},
+		{"http://[::1]:8000/a", "http://[::1]:8000/a"},
+		{"mailto:info@münchen.example", "mailto:info@münchen.example"},
+		{"x.com", "x.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := normaliseURL(tt.in); got != tt.want {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveLinkIDN(t *testing.T) {
+	base, _ := url.Parse("https://xn--mnchen-3ya.example/")
+	for _, link := range []string{"https://münchen.example/b", "https://m%C3%BCnchen.example/b", "/b"} {
+		got, ok := resolveLink(base, link)
+		if !ok || got != "https://xn--mnchen-3ya.example/b" {
+			t.Errorf("%s: got %q %t", link, got, ok)
+		}
+	}
+}
+
+func TestFollowURLsIDN(t *testing.T) {
+	f := followURLs(hostScope("https://münchen.example"), newVisitedSet(), nil, urlSchemesToFollow)
+	if !f("https://xn--mnchen-3ya.example/a") {
+		t.Error("punycode url of unicode base url not followed")
+	}
+	if f("https://münchen.example/a") {
+		t.Error("unicode form of followed punycode url followed again")
+	}
+	if f("https://xn--mnchen-3ya.example") {
+		t.Error("punycode form of base url followed")
+	}
+}
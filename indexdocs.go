@@ -0,0 +1,63 @@
+// indexdocs.go treats links to the index document of a directory, such
+// as /dir/index.html, as links to the directory, so that /dir, /dir/ and
+// /dir/index.html are fetched and reported once, as /dir.
+
+package main
+
+import (
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// INDEXDOCUMENTSNONE turns off the equivalence of index documents and
+// their directories
+const INDEXDOCUMENTSNONE = "none"
+
+// indexDocumentsDefault are the names of the index documents treated
+// as their directory by default
+var indexDocumentsDefault = []string{"index.html", "index.htm"}
+
+// indexDocuments is a URLRewriter rewriting urls whose path ends in one
+// of its names to their directory, without a trailing slash. It is safe
+// for concurrent use.
+type indexDocuments []string
+
+// parseIndexDocuments parses index document names given as one or more
+// comma separated lists, such as "index.html,index.php", returning the
+// default names if none are given and none if the names are
+// INDEXDOCUMENTSNONE
+func parseIndexDocuments(specs []string) indexDocuments {
+	if len(specs) == 0 {
+		return indexDocumentsDefault
+	}
+	names := indexDocuments{}
+	for _, spec := range specs {
+		for _, n := range strings.Split(spec, ",") {
+			if n = strings.TrimSpace(n); n != "" && n != INDEXDOCUMENTSNONE {
+				names = append(names, n)
+			}
+		}
+	}
+	return names
+}
+
+// Rewrite rewrites u to its directory if its path ends in an index
+// document, keeping any query string
+func (ix indexDocuments) Rewrite(u string) string {
+	if len(ix) == 0 {
+		return u
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	dir, name := path.Split(parsed.Path)
+	if dir == "" || !slices.Contains(ix, name) {
+		return u
+	}
+	parsed.Path = strings.TrimSuffix(dir, "/")
+	parsed.RawPath = ""
+	return parsed.String()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseIndexDocuments(t *testing.T) {
+	for _, tt := range []struct {
+		specs []string
+		want  indexDocuments
+	}{
+		{nil, indexDocuments{"index.html", "index.htm"}},
+		{[]string{"index.php, default.aspx", "index.html"}, indexDocuments{"index.php", "default.aspx", "index.html"}},
+		{[]string{"none"}, indexDocuments{}},
+	} {
+		if diff := cmp.Diff(tt.want, parseIndexDocuments(tt.specs)); diff != "" {
+			t.Errorf("%v: mismatch (-want +got):\n%s", tt.specs, diff)
+		}
+	}
+}
+
+func TestIndexDocumentsRewrite(t *testing.T) {
+	ix := indexDocuments{"index.html", "index.php"}
+	for _, tt := range []struct{ url, want string }{
+		{"https://example.com/dir/index.html", "https://example.com/dir"},
+		{"https://example.com/index.html", "https://example.com"},
+		{"https://example.com/a/b/index.php?page=2", "https://example.com/a/b?page=2"},
+		{"https://example.com/dir", "https://example.com/dir"},
+		{"https://example.com/dir/myindex.html", "https://example.com/dir/myindex.html"},
+		{"https://example.com/dir/index.htm", "https://example.com/dir/index.htm"},
+		{"https://example.com/dir/INDEX.HTML", "https://example.com/dir/INDEX.HTML"},
+		{"mailto:index.html", "mailto:index.html"},
+	} {
+		if got := ix.Rewrite(tt.url); got != tt.want {
+			t.Errorf("%s: got %s want %s", tt.url, got, tt.want)
+		}
+	}
+	if got, u := (indexDocuments{}).Rewrite("https://example.com/index.html"), "https://example.com/index.html"; got != u {
+		t.Errorf("got %s want %s unchanged", got, u)
+	}
+}
+
+func TestCrawlIndexDocuments(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `hello <a href="/dir">a</a> <a href="/dir/">b</a> <a href="/dir/index.html">c</a>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var buf strings.Builder
+	diagnostics = &buf
+	defer func() { diagnostics = os.Stderr }()
+
+	for _, tt := range []struct {
+		indexDocs []string
+		pages     int
+	}{
+		{nil, 2},              // the base url and /dir
+		{[]string{"none"}, 3}, // and /dir/index.html
+	} {
+		outFile := filepath.Join(t.TempDir(), "out.csv")
+		options := Options{
+			SearchTerms: []string{"hello"},
+			QuerySec:    1000,
+			IdleTimeout: 200 * time.Millisecond,
+			IndexDocs:   tt.indexDocs,
+			Output:      []string{"csv:" + outFile},
+		}
+		options.Args.BaseURL = server.URL
+		stats, err := crawl(options, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := stats.Pages; got != tt.pages {
+			out, _ := os.ReadFile(outFile)
+			t.Errorf("%v: got %d want %d pages:\n%s", tt.indexDocs, got, tt.pages, out)
+		}
+	}
+}
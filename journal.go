@@ -0,0 +1,140 @@
+// journal.go records the frontier of a crawl, the urls queued and the
+// urls completed, in an append-only journal so that a crawl which is
+// interrupted or crashes can be resumed, fetching only the urls which
+// were still pending.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Journal operations
+const (
+	journalAdd  = "add"  // a url was queued
+	journalDone = "done" // a url was fetched
+)
+
+// journalEntry is a line of the journal
+type journalEntry struct {
+	Op       string `json:"op"`
+	URL      string `json:"url"`
+	Referrer string `json:"referrer,omitempty"`
+	Depth    int    `json:"depth,omitempty"`
+	Page     int    `json:"page,omitempty"`
+	Text     string `json:"text,omitempty"`    // of the anchor linking to the url
+	Element  string `json:"element,omitempty"` // enclosing the anchor
+}
+
+// journal appends entries to a journal file. It is only written by the
+// Dispatcher's coordinating goroutine, which flushes it after handling
+// each batch of links or result. Write errors are kept and reported by
+// close.
+type journal struct {
+	f   *os.File
+	w   *bufio.Writer
+	err error
+}
+
+// openJournal opens filename for appending, creating it if necessary
+func openJournal(filename string) (*journal, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open journal: %w", err)
+	}
+	return &journal{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// write appends an entry
+func (j *journal) write(e journalEntry) {
+	if j.err != nil {
+		return
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		j.err = err
+		return
+	}
+	b = append(b, '\n')
+	_, j.err = j.w.Write(b)
+}
+
+// add records that a link was queued
+func (j *journal) add(l refLink) {
+	j.write(journalEntry{Op: journalAdd, URL: l.url, Referrer: l.referrer, Depth: l.depth, Page: l.page, Text: l.anchor.text, Element: l.anchor.element})
+}
+
+// done records that a url was fetched
+func (j *journal) done(url string) {
+	j.write(journalEntry{Op: journalDone, URL: url})
+}
+
+// flush writes the buffered entries to the file
+func (j *journal) flush() {
+	if j.err == nil {
+		j.err = j.w.Flush()
+	}
+}
+
+// close flushes and closes the journal, returning the first error
+// encountered writing it
+func (j *journal) close() error {
+	j.flush()
+	err := errors.Join(j.err, j.f.Close())
+	if err != nil {
+		return fmt.Errorf("journal error: %w", err)
+	}
+	return nil
+}
+
+// frontier is the state of a crawl reconstructed from its journal: the
+// urls queued, in order, and which of them were still pending
+type frontier struct {
+	queued  []string
+	pending []refLink
+}
+
+// readJournal reconstructs the frontier of the crawl recorded in
+// filename. Lines which cannot be read, such as a partial last line
+// written during a crash, are skipped.
+func readJournal(filename string) (frontier, error) {
+	var fr frontier
+	f, err := os.Open(filename)
+	if err != nil {
+		return fr, fmt.Errorf("could not open journal: %w", err)
+	}
+	defer f.Close()
+
+	added := map[string]refLink{}
+	completed := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20) // allow for very long urls
+	for scanner.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		switch e.Op {
+		case journalAdd:
+			if _, ok := added[e.URL]; !ok {
+				fr.queued = append(fr.queued, e.URL)
+			}
+			added[e.URL] = refLink{e.URL, e.Referrer, e.Depth, e.Page, linkAnchor{e.Text, e.Element}}
+		case journalDone:
+			completed[e.URL] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fr, fmt.Errorf("could not read journal: %w", err)
+	}
+	for _, u := range fr.queued {
+		if !completed[u] {
+			fr.pending = append(fr.pending, added[u])
+		}
+	}
+	return fr, nil
+}
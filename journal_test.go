@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/goleak"
+)
+
+func TestJournal(t *testing.T) {
+
+	filename := filepath.Join(t.TempDir(), "webchk.journal")
+	j, err := openJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.add(refLink{"https://example.com", "/", 0, 0, linkAnchor{}})
+	j.add(refLink{"https://example.com/a", "https://example.com", 1, 0, linkAnchor{"About", "nav"}})
+	j.add(refLink{"https://example.com/b", "https://example.com", 1, 0, linkAnchor{}})
+	j.done("https://example.com")
+	j.add(refLink{"https://example.com/c", "https://example.com/a", 2, 0, linkAnchor{}})
+	j.done("https://example.com/b")
+	if err := j.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash part way through writing a line
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"op":"done","url":"https://exa`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fr, err := readJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantQueued := []string{"https://example.com", "https://example.com/a", "https://example.com/b", "https://example.com/c"}
+	if diff := cmp.Diff(wantQueued, fr.queued); diff != "" {
+		t.Errorf("queued mismatch (-want +got):\n%s", diff)
+	}
+	wantPending := []refLink{
+		{"https://example.com/a", "https://example.com", 1, 0, linkAnchor{"About", "nav"}},
+		{"https://example.com/c", "https://example.com/a", 2, 0, linkAnchor{}},
+	}
+	if diff := cmp.Diff(wantPending, fr.pending, cmp.AllowUnexported(refLink{}, linkAnchor{})); diff != "" {
+		t.Errorf("pending mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := readJournal(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for missing journal")
+	}
+}
+
+func TestDispatcherJournalResume(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	site := map[string][]string{
+		"https://example.com":   {"https://example.com/a", "https://example.com/b"},
+		"https://example.com/a": {"https://example.com/c"},
+		"https://example.com/c": {"https://example.com/a", "https://example.com/d"},
+	}
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		return Result{url: url, referrer: referrer, status: 200, matches: []SearchMatch{}}, site[url]
+	}
+	crawl := func(options ...DispatchOption) []string {
+		gc := NewGetClient(2, 20*time.Millisecond)
+		gc.getURL = getURLer
+		d := NewDispatch("https://example.com", append([]DispatchOption{
+			WithWorkers(2),
+			WithRate(100000),
+			WithDispatcherTimeout(50 * time.Millisecond),
+			WithClient(gc),
+		}, options...)...)
+		urls := []string{}
+		for r := range d.Dispatcher() {
+			urls = append(urls, r.url)
+		}
+		slices.Sort(urls)
+		return urls
+	}
+
+	// a crawl interrupted after fetching the base url and /b
+	filename := filepath.Join(t.TempDir(), "webchk.journal")
+	j, err := openJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.add(refLink{"https://example.com", "/", 0, 0, linkAnchor{}})
+	j.done("https://example.com")
+	j.add(refLink{"https://example.com/a", "https://example.com", 1, 0, linkAnchor{}})
+	j.add(refLink{"https://example.com/b", "https://example.com", 1, 0, linkAnchor{}})
+	j.done("https://example.com/b")
+	if err := j.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fr, err := readJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err = openJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := crawl(WithResume(fr), WithJournal(j))
+	if err := j.close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://example.com/a", "https://example.com/c", "https://example.com/d"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("resumed urls mismatch (-want +got):\n%s", diff)
+	}
+
+	// the journal now records the crawl as complete
+	fr, err = readJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fr.pending) != 0 || len(fr.queued) != 5 {
+		t.Errorf("got %d pending of %d queued, want 0 of 5", len(fr.pending), len(fr.queued))
+	}
+}
@@ -0,0 +1,234 @@
+// jsonlinks.go discovers links in json responses, for sites whose
+// navigation is delivered by api endpoints rather than in html. Links
+// are either all the url-like strings in a response or the strings
+// selected by JSONPath expressions.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrJSONPathFormat reports a JSONPath expression which cannot be
+// parsed
+var ErrJSONPathFormat = errors.New("invalid JSONPath; use expressions such as $.items[*].url or $..href")
+
+// jsonStep is a step of a JSONPath expression, selecting the named
+// member, the index or, if wildcard, all members or elements of the
+// current values, or their descendants if recursive
+type jsonStep struct {
+	name      string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool
+}
+
+// jsonPath is a parsed JSONPath expression
+type jsonPath []jsonStep
+
+// parseJSONPath parses the subset of JSONPath made up of $ followed by
+// .name, ['name'], [n], [*], .* and ..name steps
+func parseJSONPath(expr string) (jsonPath, error) {
+	fail := func() (jsonPath, error) {
+		return nil, fmt.Errorf("%q: %w", expr, ErrJSONPathFormat)
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSpace(expr), "$")
+	if !ok {
+		return fail()
+	}
+	path := jsonPath{}
+	for rest != "" {
+		var step jsonStep
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break // as a bracketed step below
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			step.name, rest = rest[:end], rest[end:]
+			if step.name == "" {
+				return fail()
+			}
+			step.wildcard = step.name == "*"
+			path = append(path, step)
+			continue
+		}
+		if !strings.HasPrefix(rest, "[") {
+			return fail()
+		}
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return fail()
+		}
+		inner := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+		switch {
+		case inner == "*":
+			step.wildcard = true
+		case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+			step.name = inner[1 : len(inner)-1]
+		default:
+			n, err := strconv.Atoi(inner)
+			if err != nil {
+				return fail()
+			}
+			step.index, step.isIndex = n, true
+		}
+		path = append(path, step)
+	}
+	return path, nil
+}
+
+// children returns the members or elements of v selected by step
+func (step jsonStep) children(v any) []any {
+	selected := []any{}
+	switch v := v.(type) {
+	case map[string]any:
+		if step.wildcard {
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			slices.Sort(keys) // for a stable order
+			for _, k := range keys {
+				selected = append(selected, v[k])
+			}
+		} else if c, ok := v[step.name]; ok && !step.isIndex {
+			selected = append(selected, c)
+		}
+	case []any:
+		switch {
+		case step.wildcard:
+			selected = append(selected, v...)
+		case step.isIndex:
+			i := step.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				selected = append(selected, v[i])
+			}
+		}
+	}
+	return selected
+}
+
+// descendants returns v and all the values nested within it
+func descendants(v any) []any {
+	all := []any{v}
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			all = append(all, descendants(v[k])...)
+		}
+	case []any:
+		for _, c := range v {
+			all = append(all, descendants(c)...)
+		}
+	}
+	return all
+}
+
+// selectValues returns the values in doc selected by the path
+func (p jsonPath) selectValues(doc any) []any {
+	current := []any{doc}
+	for _, step := range p {
+		next := []any{}
+		for _, v := range current {
+			candidates := []any{v}
+			if step.recursive {
+				candidates = descendants(v)
+			}
+			for _, c := range candidates {
+				next = append(next, step.children(c)...)
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// parseJSONPaths parses the JSONPath expressions given as options
+func parseJSONPaths(exprs []string) ([]jsonPath, error) {
+	paths := []jsonPath{}
+	for _, expr := range exprs {
+		p, err := parseJSONPath(expr)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// jsonType reports whether contentType is that of a json document
+func jsonType(contentType string) bool {
+	return strings.Contains(contentType, "application/json") || strings.Contains(contentType, "+json")
+}
+
+// jsonLinker returns a function extracting the links from a json
+// document, resolved against its url and sorted without duplicates.
+// With no paths the links are all the strings which look like urls,
+// being absolute http or https urls or absolute paths, otherwise they
+// are the strings selected by the paths.
+func jsonLinker(paths []jsonPath) func(body []byte, url *url.URL) ([]string, error) {
+	return func(body []byte, url *url.URL) ([]string, error) {
+		links := []string{}
+		var doc any
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return links, fmt.Errorf("could not parse json: %w", err)
+		}
+		var refs []any
+		if len(paths) == 0 {
+			for _, v := range descendants(doc) {
+				if s, ok := v.(string); ok && urlLike(s) {
+					refs = append(refs, s)
+				}
+			}
+		}
+		for _, p := range paths {
+			refs = append(refs, p.selectValues(doc)...)
+		}
+		for _, ref := range refs {
+			s, ok := ref.(string)
+			if !ok || strings.TrimSpace(s) == "" {
+				continue
+			}
+			if link, ok := resolveLink(url, strings.TrimSpace(s)); ok {
+				links = append(links, link)
+			}
+		}
+		slices.Sort(links)
+		return slices.Compact(links), nil
+	}
+}
+
+// urlLike reports whether s looks like a url: an absolute http or https
+// url or an absolute path, without spaces
+func urlLike(s string) bool {
+	if strings.ContainsAny(s, " \t\n") {
+		return false
+	}
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://") ||
+		(strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//") && len(s) > 1)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseJSONPath(t *testing.T) {
+
+	tests := []struct {
+		expr  string
+		path  jsonPath
+		isErr bool
+	}{
+		{expr: "$", path: jsonPath{}},
+		{expr: "$.items[*].url", path: jsonPath{{name: "items"}, {wildcard: true}, {name: "url"}}},
+		{expr: "$['nav'][0]", path: jsonPath{{name: "nav"}, {index: 0, isIndex: true}}},
+		{expr: `$..href`, path: jsonPath{{name: "href", recursive: true}}},
+		{expr: `$..["href"]`, path: jsonPath{{name: "href", recursive: true}}},
+		{expr: "$.*", path: jsonPath{{name: "*", wildcard: true}}},
+		{expr: "items", isErr: true},
+		{expr: "$.", isErr: true},
+		{expr: "$[x]", isErr: true},
+		{expr: "$[0", isErr: true},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			path, err := parseJSONPath(tt.expr)
+			if tt.isErr {
+				if !errors.Is(err, ErrJSONPathFormat) {
+					t.Errorf("%s got error %v want %v", tt.expr, err, ErrJSONPathFormat)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.path, path, cmp.AllowUnexported(jsonStep{})); diff != "" {
+				t.Errorf("%s mismatch (-want +got):\n%s", tt.expr, diff)
+			}
+		})
+	}
+}
+
+func TestJSONLinker(t *testing.T) {
+
+	body := []byte(`{
+		"nav": [{"title": "Home", "href": "/"}, {"title": "About", "href": "/about/"}],
+		"items": [
+			{"url": "https://e.com/items/1", "image": "/img/1.png"},
+			{"url": "items/2", "note": "see /not a url"}
+		],
+		"next": "https://e.com/api/items?page=2",
+		"count": 2
+	}`)
+	apiURL, err := url.Parse("https://e.com/api/items")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		exprs []string
+		links []string
+	}{
+		{
+			exprs: nil, // all url-like strings, except a bare /
+			links: []string{
+				"https://e.com/about", "https://e.com/api/items",
+				"https://e.com/img/1.png", "https://e.com/items/1",
+			},
+		},
+		{
+			exprs: []string{"$.items[*].url"},
+			links: []string{"https://e.com/api/items/2", "https://e.com/items/1"},
+		},
+		{
+			exprs: []string{"$..href", "$.next"},
+			links: []string{"https://e.com", "https://e.com/about", "https://e.com/api/items"},
+		},
+		{
+			exprs: []string{"$.nav[-1].href", "$.count"},
+			links: []string{"https://e.com/about"},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			paths, err := parseJSONPaths(tt.exprs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			links, err := jsonLinker(paths)(body, apiURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.links, links); diff != "" {
+				t.Errorf("links mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := jsonLinker(nil)([]byte(`{"broken`), apiURL); err == nil {
+		t.Error("expected error for invalid json")
+	}
+}
+
+func TestGetURLJSONLinks(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, `{"pages": ["/a", "/b"]}`)
+	}))
+	defer server.Close()
+
+	g := NewGetClient(1, time.Second)
+	r, _ := g.getURL(server.URL+"/api/nav", "/", nil)
+	if r.err != NonHTMLPageType {
+		t.Errorf("without json links got error %v", r.err)
+	}
+
+	g.withJSONLinks(nil)
+	r, links := g.getURL(server.URL+"/api/nav", "/", nil)
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if diff := cmp.Diff([]string{server.URL + "/a", server.URL + "/b"}, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,73 @@
+// lang.go restricts search term matching to pages in selected
+// languages, as declared by the lang attribute of the html element or
+// the Content-Language header, reducing noise on multilingual sites.
+// Pages may also be fetched once in each of several languages, to audit
+// the content a site negotiates for each.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// languages are the language tags of the pages to search, in lowercase.
+// No languages means pages in any language are searched.
+type languages []string
+
+// parseLanguages parses language options, each of which may be a comma
+// separated list of tags such as en,de
+func parseLanguages(specs []string) languages {
+	l := languages{}
+	for _, spec := range specs {
+		for _, tag := range strings.Split(spec, ",") {
+			if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+				l = append(l, tag)
+			}
+		}
+	}
+	return l
+}
+
+// acceptLanguages returns the languages pages are fetched in from
+// specs, each an Accept-Language header value such as de or
+// "de-CH, de;q=0.9", without blanks or repeats
+func acceptLanguages(specs []string) []string {
+	l := []string{}
+	for _, spec := range specs {
+		if spec = strings.TrimSpace(spec); spec != "" && !slices.Contains(l, spec) {
+			l = append(l, spec)
+		}
+	}
+	return l
+}
+
+// languageLabel labels a result with the language the page was
+// fetched in, if any
+func languageLabel(r Result) string {
+	if r.language == "" {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", r.language)
+}
+
+// match reports whether a page declaring the given languages, as a
+// lang attribute or comma separated Content-Language header, should be
+// searched. A selected tag matches the same tag or a more specific one,
+// so en matches en-GB. Pages which do not declare a language are
+// searched as their language is unknown.
+func (l languages) match(declared string) bool {
+	if len(l) == 0 || strings.TrimSpace(declared) == "" {
+		return true
+	}
+	for _, tag := range strings.Split(declared, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		for _, want := range l {
+			if tag == want || strings.HasPrefix(tag, want+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseLanguages(t *testing.T) {
+
+	got := parseLanguages([]string{"en, DE", "fr-CA", ""})
+	if diff := cmp.Diff(languages{"en", "de", "fr-ca"}, got); diff != "" {
+		t.Errorf("languages mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAcceptLanguages(t *testing.T) {
+
+	got := acceptLanguages([]string{"de", " fr-CA, fr;q=0.9 ", "", "de"})
+	if diff := cmp.Diff([]string{"de", "fr-CA, fr;q=0.9"}, got); diff != "" {
+		t.Errorf("accept languages mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLanguagesMatch(t *testing.T) {
+
+	tests := []struct {
+		languages languages
+		declared  string
+		want      bool
+	}{
+		{languages{}, "fr", true}, // no filter
+		{languages{"en", "de"}, "", true},
+		{languages{"en", "de"}, "en", true},
+		{languages{"en", "de"}, "EN-gb", true},
+		{languages{"en", "de"}, "fr", false},
+		{languages{"en", "de"}, "fr, de-AT", true},
+		{languages{"en"}, "eng", false},
+		{languages{"fr-ca"}, "fr", false},
+		{languages{"fr-ca"}, "fr-CA", true},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			if got := tt.languages.match(tt.declared); got != tt.want {
+				t.Errorf("%v %q got %t want %t", tt.languages, tt.declared, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePageLang(t *testing.T) {
+
+	page, err := parsePage([]byte(`<!doctype html><html lang="de-AT"><body>hallo</body></html>`), &url.URL{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := page.lang, "de-AT"; got != want {
+		t.Errorf("lang got %q want %q", got, want)
+	}
+}
+
+func TestGetURLLanguages(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/de":
+			fmt.Fprint(w, `<html lang="de"><body>welcome</body></html>`)
+		case "/fr":
+			w.Header().Set("Content-Language", "fr")
+			fmt.Fprint(w, `<html><body>welcome</body></html>`)
+		default:
+			fmt.Fprint(w, `<html><body>welcome</body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	g := NewGetClient(1, time.Second)
+	g.languages = parseLanguages([]string{"en,de"})
+	tests := []struct {
+		path    string
+		matches int
+	}{
+		{"/de", 1},
+		{"/fr", 0},
+		{"/unknown", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r, _ := g.getURL(server.URL+tt.path, "/", []string{"welcome"})
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			if got := len(r.matches); got != tt.matches {
+				t.Errorf("got %d want %d matches", got, tt.matches)
+			}
+		})
+	}
+}
+
+func TestGetLanguage(t *testing.T) {
+
+	greetings := map[string]string{"de": "willkommen", "fr": "bienvenue"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		greeting, ok := greetings[r.Header.Get("Accept-Language")]
+		if !ok {
+			greeting = "welcome"
+		}
+		fmt.Fprintf(w, `<html><body>%s</body></html>`, greeting)
+	}))
+	defer server.Close()
+
+	g := NewGetClient(1, time.Second)
+	tests := []struct {
+		language string
+		label    string
+		matches  int
+	}{
+		{"", "", 0},
+		{"de", " [de]", 1},
+		{"fr", " [fr]", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			r, _ := g.getVariant(server.URL, "/", tt.language, []string{"willkommen"})
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			if got := len(r.matches); got != tt.matches {
+				t.Errorf("got %d want %d matches", got, tt.matches)
+			}
+			if got := languageLabel(r); got != tt.label {
+				t.Errorf("got label %q want %q", got, tt.label)
+			}
+		})
+	}
+}
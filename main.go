@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"time"
 
 	flags "github.com/jessevdk/go-flags"
@@ -16,31 +18,127 @@ const Usage = `-s "searchterm" [-s "searchterm"]... <baseurl>
 Look for one or more case-insensitive search terms (typically
 constrained between double quotes) in a website starting at <baseurl>.
 
-The timeout should be specified as a go time.ParseDuration string, for
-example "1m30s". For no timeout, use a negative duration or "0s".
+The timeouts should be specified as go time.ParseDuration strings, for
+example "1m30s". The overall timeout (-t) is the longest the program
+will run; for no overall timeout, use a negative duration or "0s". The
+idle timeout stops the program if no results are received for that
+duration, which normally signals the crawl is complete.
 
-The program will exit early if the link buffer becomes full, if it
-encounters a "too many requests" 429 error or if it times out.
+The program will exit early if it encounters a "too many requests" 429
+error or if it times out. If the link buffer becomes full, the links
+which find no space in it are dropped and counted, and the summary
+suggests a larger buffer size to set with -z.
 
 Application Arguments:
 
  `
 
+// version is the webchk version, set at build time with
+// -ldflags "-X main.version=v1.2.3"
+var version = "development"
+
 // errorForOSExit signals that an os.Exit(1) is required
 var errorForOSExit = errors.New("osexit")
 
 // Options are the command line options
 type Options struct {
-	SearchTerms []string      `short:"s" long:"searchterm" required:"true" description:"search terms, can be specified more than once"`
-	Verbose     bool          `short:"v" long:"verbose" description:"set verbose output"`
-	QuerySec    int           `short:"q" long:"querysec" description:"queries per second" default:"10"`
-	Timeout     time.Duration `short:"t" long:"timeout" description:"program timeout" default:"2m"`
-	BufferSize  int           `short:"z" long:"buffersize" description:"size of links buffer" default:"2500"`
-	Workers     int           `short:"w" long:"workers" description:"number of goroutine workers" default:"8"`
-	HTTPWorkers int           `short:"x" long:"httpworkers" description:"number of http workers" default:"8"`
+	SearchTerms []string      `short:"s" long:"searchterm" description:"search terms, can be specified more than once, and required unless --changes or --history is given" json:"searchterms"`
+	Verbose     verbosity     `short:"v" long:"verbose" description:"set verbose output; -v prints every page, -vv also reports the links not followed and why, and redirects, to stderr, and -vvv also the timing and headers of each request" json:"verbose"`
+	QuerySec    int           `short:"q" long:"querysec" description:"queries per second" default:"10" json:"querysec"`
+	IgnoreDelay bool          `long:"ignore-crawl-delay" description:"do not slow requests to the Crawl-delay of the robots.txt file of the site, such as for sites you own" json:"ignore_crawl_delay"`
+	NoRobots    bool          `long:"ignore-robots" description:"also fetch the urls the robots.txt file of the site disallows, such as for sites you own, reporting them in a robots.txt compliance section" json:"ignore_robots"`
+	Timeout     time.Duration `short:"t" long:"timeout" description:"overall program timeout" default:"2m" json:"timeout"`
+	StartAt     string        `long:"start-at" description:"wait until this time of day, for example 02:00, to start the crawl" json:"start_at"`
+	Window      string        `long:"only-between" description:"only make requests between these times of day, for example 01:00-05:00, pausing the crawl outside them" json:"only_between"`
+	IdleTimeout time.Duration `long:"idle-timeout" description:"stop if no results are received for this duration" default:"1.8s" json:"idle_timeout"`
+	BufferSize  int           `short:"z" long:"buffersize" description:"size of links buffer" default:"2500" json:"buffersize"`
+	BufferGrace time.Duration `long:"buffer-grace" description:"while the links buffer is full, hold up the workers finding links for up to this long waiting for space before dropping the links" default:"10s" json:"buffer_grace"`
+	ResultsSize int           `long:"results-buffer" description:"size of the buffer of results waiting to be written to the outputs; while it is full, fetching pauses for slow outputs such as sqlite" default:"100" json:"results_buffer"`
+	Workers     int           `short:"w" long:"workers" description:"number of goroutine workers" default:"8" json:"workers"`
+	HTTPWorkers int           `short:"x" long:"httpworkers" description:"number of http workers" default:"8" json:"httpworkers"`
+	PAC         string        `long:"pac" description:"connect through the proxy chosen for each url by this proxy auto-config (PAC) file, given as a url or file name; a file which cannot be run stops webchk before the crawl" json:"pac"`
+	UnixSocket  string        `long:"unix-socket" description:"connect to the http server listening on this unix socket for every request, while the Host header and paths are taken from the urls" json:"unix_socket"`
+	ConnTimeout time.Duration `long:"connect-timeout" description:"give up connecting to an address of a host after this duration; 0 for no limit other than the http timeout" json:"connect_timeout"`
+	IPv4Only    bool          `long:"ipv4-only" description:"only connect over ipv4, for networks with broken ipv6" json:"ipv4_only"`
+	DNSCacheTTL time.Duration `long:"dns-cache-ttl" description:"cache dns lookups for this long in place of the ttl of their records; a negative duration, such as --dns-cache-ttl=-1s, turns the cache off" json:"dns_cache_ttl"`
+	NTLMUser    string        `long:"ntlm-user" description:"log in to sites using Windows integrated (NTLM or Negotiate) authentication as this user, given as DOMAIN\\user; the password is read from $WEBCHK_NTLM_PASSWORD" json:"ntlm_user"`
+	Profile     string        `long:"profile" description:"send the request headers of a browser, chrome or firefox, or of a bot identifying itself as webchk, with every request" json:"profile"`
+	HostHeader  string        `long:"host-header" description:"send this Host header (and TLS SNI) in requests to the host of the base url" json:"host_header"`
+	Assertions  string        `long:"assertions" description:"yaml file of per-url assertions; the run fails on any violation" json:"assertions"`
+	MaxErrors   int           `long:"max-errors" description:"fail if more than this number of pages cannot be retrieved (-1 for no limit)" default:"-1" json:"max_errors"`
+	MaxBroken   int           `long:"max-broken" description:"fail if more than this number of pages have a non-200 status (-1 for no limit)" default:"-1" json:"max_broken"`
+	Redirects   int           `long:"max-redirects" description:"report urls redirected more than this number of times, or in a loop, as redirect errors" default:"10" json:"max_redirects"`
+	Webhook     string        `long:"webhook" description:"url to post a json alert to when a maximum is exceeded" json:"webhook"`
+	JSON        bool          `long:"json" description:"write results as a json document with run metadata; shorthand for --output json" json:"json"`
+	Heartbeat   time.Duration `long:"heartbeat" description:"print a progress line to stderr at this interval, for example 30s (default: off)" json:"heartbeat"`
+	IndexDocs   []string      `long:"index-docs" description:"treat links to these index documents, for example index.html,index.php, as links to their directory, so that /dir, /dir/ and /dir/index.html are fetched once (default: index.html,index.htm); none to treat them as separate pages" json:"index_docs"`
+	Rewrite     []string      `long:"rewrite" description:"rewrite links found before they are followed with a sed-style rule such as 's#^https://www.example.com#https://staging.example.com#'; can be specified more than once" json:"rewrite"`
+	Scope       string        `long:"scope" description:"the urls followed: host for those on the host of the base url, domain for those on its registered domain and subdomains, prefix for those under the path of the base url, or regex:PATTERN for those matching a regular expression" default:"host" json:"scope"`
+	IncludeFile string        `long:"include-file" description:"file of url patterns, one per line; only links matching a pattern are followed" json:"include_file"`
+	ExcludeFile string        `long:"exclude-file" description:"file of url patterns, one per line; links matching a pattern are not followed" json:"exclude_file"`
+	Schemes     []string      `long:"schemes" description:"only follow links with these url schemes, for example http,https (default: http,https); links such as javascript:, mailto:, tel: and data: are never followed by default" json:"schemes"`
+	Budget      []string      `long:"budget" description:"limit the pages fetched under a path prefix, as prefix=n, for example /blog/=200; can be specified more than once" json:"budget"`
+	HostErrors  int           `long:"host-error-budget" description:"stop fetching from a host after this many hard errors, such as dns or connection failures, timeouts or 5xx statuses; 0 for no limit" json:"host_error_budget"`
+	Journal     string        `long:"journal" description:"append the urls queued and fetched to this file, so that an interrupted crawl can be resumed with --resume" json:"journal"`
+	Resume      bool          `long:"resume" description:"resume the crawl recorded in --journal, fetching only the urls which were still pending" json:"resume"`
+	AcceptLang  []string      `long:"accept-language" description:"fetch each page once with each of these Accept-Language headers, reporting the results of each language; may be repeated" json:"accept_language"`
+	Lang        []string      `long:"lang" description:"only search pages in these languages, given by the html lang attribute or Content-Language header, for example en,de; pages which do not declare a language are searched" json:"lang"`
+	PageMatches int           `long:"max-matches-per-page" description:"report at most this many matches for each page" json:"max_matches_per_page"`
+	TermMatches int           `long:"max-matches-per-term" description:"report at most this many matches of each search term over the crawl" json:"max_matches_per_term"`
+	Fold        bool          `long:"fold" description:"also match search terms ignoring accents and other diacritics and the style of quotes and apostrophes, so that resume matches résumé and don't matches don’t" json:"fold"`
+	FirstMatch  bool          `long:"first-match" description:"stop matching the search terms against each page at its first match, reporting only that match, for faster audits which only need to know which pages match" json:"first_match"`
+	Boilerplate float64       `long:"boilerplate" description:"do not match lines of html repeated on at least this fraction of the pages, such as navigation and footers, for example 0.5" json:"boilerplate"`
+	Charset     string        `long:"assume-charset" description:"decode pages from this charset, such as windows-1252 or shift_jis, whatever charset the site declares, before searching them" json:"assume_charset"`
+	Spellcheck  string        `long:"spellcheck" description:"report the words of the visible text of each page not in the dictionary of this language, for example en_GB" json:"spellcheck"`
+	Dictionary  []string      `long:"dictionary" description:"with --spellcheck, file of further words, one per line, such as product names; can be specified more than once" json:"dictionary"`
+	Readability bool          `long:"readability" description:"record the word count and readability scores of the visible text of each page in the json output" json:"readability"`
+	NoIndex     string        `long:"noindex" description:"leave pages marked noindex, by a robots meta element or X-Robots-Tag header, out of the reports (hide) or print them after the other pages (separate)" json:"noindex"`
+	AMP         bool          `long:"amp" description:"also crawl the AMP versions of pages, given by link elements with rel=\"amphtml\", reporting those without the search terms found on the page as violations" json:"amp"`
+	Sitemaps    bool          `long:"sitemaps" description:"also crawl the urls listed in the sitemaps given by the Sitemap directives of the robots.txt file of the site" json:"sitemaps"`
+	SitemapOnly bool          `long:"sitemap-only" description:"only check the base url and the urls listed in the sitemaps given by the robots.txt file of the site, without following links, for a fast audit of the pages the site lists" json:"sitemap_only"`
+	Seeds       string        `long:"seeds" description:"yaml file of further urls to start the crawl from, each optionally requested with its own method, body and headers, such as POST search endpoints returning listings" json:"seeds"`
+	Assets      bool          `long:"assets" description:"also check stylesheets, scripts and the images, fonts and other assets they refer to" json:"assets"`
+	JSONLinks   bool          `long:"json-links" description:"also follow the urls in json responses, such as those of api endpoints delivering navigation" json:"json_links"`
+	JSONPath    []string      `long:"json-path" description:"with --json-links, only follow the strings selected by this JSONPath expression, for example '$.items[*].url'; can be specified more than once" json:"json_path"`
+	HAR         string        `long:"har" description:"record the requests and responses of the crawl, with their headers, timings and sizes, in this HTTP Archive (HAR) file" json:"har"`
+	HARBodies   bool          `long:"har-bodies" description:"with --har, also record the response bodies" json:"har_bodies"`
+	Cache       string        `long:"cache" description:"cache responses in this directory, honouring Cache-Control, so that repeated crawls reuse fresh responses and revalidate stale ones" json:"cache"`
+	Record      string        `long:"record" description:"record every response of the crawl in this fixtures directory, for replaying with --replay" json:"record"`
+	Replay      string        `long:"replay" description:"serve the responses recorded with --record in this fixtures directory instead of fetching from the site, reporting urls not recorded as errors" json:"replay"`
+	Bloom       int           `long:"bloom" description:"record visited urls in a bloom filter sized for this many urls, bounding memory on very large sites at the cost of skipping about 1 in 1000 new urls" json:"bloom"`
+	Sort        bool          `long:"sort" description:"write the results sorted by url once the crawl is complete, so that the reports of different runs can be compared" json:"sort"`
+	GroupBy     string        `long:"group-by" description:"print the text output once the crawl is complete, grouped by status, dir (directory), term (search term) or referrer (the page containing each broken link)" json:"group_by"`
+	Top         int           `long:"top" description:"end the text summary with lists of this many of the slowest and largest pages, the pages with most matches and the hosts with most errors, for example 10" json:"top"`
+	Estimate    int           `long:"estimate" description:"crawl a sample of this many pages and print a projection of a full crawl instead of the results" json:"estimate"`
+	Serve       string        `long:"serve" description:"serve a live dashboard and stream of results at this address, for example :8080, until interrupted" json:"serve"`
+	EventWindow int           `long:"replay-window" description:"in serve mode, retain this many of the latest events for clients reconnecting to /events with a resumption token; 0 retains them all" default:"10000" json:"replay_window"`
+	Schedule    string        `long:"schedule" description:"in serve mode, crawl the base url again on this cron schedule, for example '0 2 * * *'" json:"schedule"`
+	Sites       string        `long:"sites" description:"in serve mode, yaml file of further sites to crawl on their own cron schedules" json:"sites"`
+	APIKeys     string        `long:"api-keys" description:"in serve mode, yaml file of api keys needed for the events, reports and history, each optionally restricted to some sites and a rate of requests" json:"api_keys"`
+	Changes     bool          `long:"changes" description:"record a checksum of the visible text of each page with the sqlite output and report the pages changed, added or removed since the previous run of the base url" json:"changes"`
+	Dynamic     int           `long:"dynamic-sample" description:"after the crawl, fetch this many of the pages found, chosen at random, twice more with cache-busting query parameters and report those whose visible text differs between fetches" json:"dynamic_sample"`
+	Diff        string        `long:"diff" description:"with --changes, also record the visible text of each page and write a unified diff of the text of each changed page since the previous run to this file" json:"diff"`
+	History     string        `long:"history" description:"instead of crawling, list the runs of the base url recorded in this sqlite database, with the change in broken pages and matches from run to run" json:"history"`
+	Run         int64         `long:"run" description:"with --history, write the results of this run as json" json:"run"`
+	RunStatus   int           `long:"status" description:"with --run, only write the results with this http status" json:"status"`
+	RunTerm     string        `long:"term" description:"with --run, only write the results matching this search term" json:"term"`
+	RunURL      string        `long:"url" description:"with --run, only write the results with urls matching this pattern, in which * matches any characters" json:"url"`
+	RunLimit    int           `long:"limit" description:"with --run, write at most this many results" json:"limit"`
+	RunOffset   int           `long:"offset" description:"with --run, skip this many results first, for paging through them with --limit" json:"offset"`
+	RunCSV      bool          `long:"csv" description:"with --run, write the results as csv rather than json" json:"csv"`
+	EmailTo     []string      `long:"email-to" description:"email a report of the run with the results attached as csv to this address; can be specified more than once" json:"email_to"`
+	SMTP        string        `long:"smtp" description:"SMTP server host:port for emailing reports; a password for --smtp-user is read from $WEBCHK_SMTP_PASSWORD" json:"smtp"`
+	SMTPFrom    string        `long:"smtp-from" description:"sender address for emailed reports" json:"smtp_from"`
+	SMTPUser    string        `long:"smtp-user" description:"SMTP user name, if the server requires authentication" json:"smtp_user"`
+	Output      []string      `short:"o" long:"output" description:"output as kind[:target], where kind is text, json, csv, gob, sqlite, postgres, clickhouse or webhook; can be specified more than once (default: text)" json:"output"`
+	Tags        []string      `long:"tag" description:"tag the run and its results with key=value, such as env=staging, recorded by the json, gob, webhook and database outputs and the manifest; can be specified more than once" json:"tags"`
+	Manifest    string        `long:"manifest" description:"write a json manifest of the run, with the options, seeds, filters and versions used, the counts and termination reason and the files written, to this file" json:"manifest"`
+	Exec        string        `long:"exec" description:"command to run for each page with matches; {} is replaced by the url" json:"exec"`
+	Config      string        `long:"config" description:"yaml file of named presets of options, selected with --preset" json:"config"`
+	Preset      string        `long:"preset" description:"set the options not given on the command line from this named preset: polite, aggressive, seo-audit, link-check or one defined in --config" json:"preset"`
 	Args        struct {
-		BaseURL string `description:"base url to search"`
-	} `positional-args:"yes" required:"yes"`
+		BaseURL string `description:"base url to search" json:"baseurl"`
+	} `positional-args:"yes" required:"yes" json:"args"`
 }
 
 // getOptions gets the command line options
@@ -56,65 +154,127 @@ func getOptions() (Options, error) {
 		}
 		return options, errorForOSExit
 	}
+	// parse again with the arguments of a preset before those given, for
+	// the options not on the command line
+	if options.Preset != "" {
+		args, err := presetArgs(parser, options)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return options, errorForOSExit
+		}
+		options = Options{}
+		parser = flags.NewParser(&options, flags.Default)
+		parser.Usage = Usage
+		if _, err := parser.ParseArgs(append(args, os.Args[1:]...)); err != nil {
+			if !flags.WroteHelp(err) {
+				parser.WriteHelp(os.Stdout)
+			}
+			return options, errorForOSExit
+		}
+	}
+	// search terms are only optional when watching for changes, or when
+	// reporting the history of runs rather than crawling
+	if len(options.SearchTerms) == 0 && !options.Changes && options.History == "" {
+		fmt.Fprintln(os.Stderr, "the required flag `-s, --searchterm' was not specified")
+		parser.WriteHelp(os.Stdout)
+		return options, errorForOSExit
+	}
 	return options, nil
 }
 
 // output sets the io.Writer for output
 var output io.Writer = os.Stdout
 
-// printResults prints results from a Dispatcher Result chan
-func printResults(options Options, results <-chan Result) {
-
-	fmt.Fprintf(output, "\nCommencing search of %s:\n", options.Args.BaseURL)
-
-	pages := 0
-	for r := range results {
-		pages++
-		switch r.err {
-		case NonHTMLPageType:
-			continue
-		case StatusNotOk:
-			fmt.Fprintf(output, "%s\n- status %d (from %s)\n", r.url, r.status, r.referrer)
-			continue
-		default:
-			if r.err != nil {
-				fmt.Fprintf(output, "%s : error %v\n", r.url, r.err)
-				continue
-			}
+func main() {
+	options, err := getOptions()
+	if errors.Is(errorForOSExit, err) {
+		os.Exit(1)
+	}
+	if err := options.validate(HTTPTIMEOUT); err != nil {
+		fmt.Fprintf(diagnostics, "invalid options:\n%s\n", err)
+		os.Exit(1)
+	}
+	// report the history of runs from a sqlite output
+	if options.History != "" {
+		if err := showHistory(output, options); err != nil {
+			fmt.Fprintln(diagnostics, err)
+			os.Exit(1)
 		}
-		switch {
-		case options.Verbose && len(r.matches) == 0:
-			fmt.Fprintf(output, "%s\n", r.url)
-		case len(r.matches) > 0:
-			fmt.Fprintf(output, "%s\n", r.url)
-			for _, m := range r.matches {
-				fmt.Fprintf(output, "> %s\n", m)
+		os.Exit(0)
+	}
+	// in serve mode results are also streamed by the server, and
+	// further crawls may be scheduled
+	var srv *server
+	var sites []Site
+	var pool *transportPool // reusing connections between crawls
+	if options.Serve != "" {
+		sites, err = options.sites()
+		if err != nil {
+			fmt.Fprintln(diagnostics, err)
+			os.Exit(1)
+		}
+		var keys *keyring
+		if options.APIKeys != "" {
+			keys, err = loadAPIKeys(options.APIKeys)
+			if err != nil {
+				fmt.Fprintln(diagnostics, err)
+				os.Exit(1)
 			}
 		}
+		srv = newServer(options.Serve, options, keys)
+		pool = newTransportPool()
+		if err := srv.listen(); err != nil {
+			fmt.Fprintln(diagnostics, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(diagnostics, "serving dashboard at %s until interrupted\n", options.Serve)
 	}
-	fmt.Fprintln(output, "processed", pages, "pages")
-}
-
-func main() {
-	options, err := getOptions()
-	if errors.Is(errorForOSExit, err) {
+	if options.StartAt != "" {
+		start, _ := parseClockTime(options.StartAt) // validated
+		fmt.Fprintf(diagnostics, "waiting until %s to start the crawl\n", start)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err := waitUntil(ctx, start)
+		stop()
+		if err != nil {
+			os.Exit(1)
+		}
+	}
+	sinks := []OutputSink{}
+	if srv != nil {
+		sinks = append(sinks, srv.current())
+	}
+	stats, err := crawl(options, pool, sinks...)
+	if err != nil {
+		fmt.Fprintln(diagnostics, err)
 		os.Exit(1)
 	}
-	// make new httpClient
-	httpClient := NewGetClient(options.HTTPWorkers, HTTPTIMEOUT)
-	// initialise a dispatcher
-	d := NewDispatch(
-		options.Args.BaseURL,
-		options.Workers,
-		options.BufferSize,
-		options.QuerySec,
-		options.SearchTerms,
-		DISPATCHERTIMEOUT, // default
-		options.Timeout,
-		httpClient,
-	)
-	// receive channel from Dispatcher
-	results := d.Dispatcher()
-	// print results from channel
-	printResults(options, results)
+	if options.Estimate > 0 {
+		os.Exit(0)
+	}
+	exitCode := 0
+	if stats.Violations > 0 {
+		exitCode = 1
+	}
+	if alertOnThresholds(options, stats) {
+		exitCode = 1
+	}
+	if srv != nil {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		newScheduler(sites, func(site Site) {
+			siteOptions := site.options(options)
+			fmt.Fprintf(diagnostics, "starting scheduled crawl of %s\n", site.URL)
+			stats, err := crawl(siteOptions, pool, srv.newRun(siteOptions))
+			if err != nil {
+				fmt.Fprintln(diagnostics, err)
+				return
+			}
+			alertOnThresholds(siteOptions, stats)
+		}).start(ctx)
+		if err := srv.wait(ctx); err != nil {
+			fmt.Fprintln(diagnostics, err)
+		}
+		stop()
+		pool.close()
+	}
+	os.Exit(exitCode)
 }
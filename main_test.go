@@ -1,8 +1,6 @@
 package main
 
 import (
-	"bytes"
-	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -17,13 +15,14 @@ func TestGetOptions(t *testing.T) {
 	tests := []struct {
 		argString   string
 		SearchTerms []string
-		Verbose     bool
+		Verbose     int
 		BaseURL     string
 		BufferSize  int
 		QuerySec    int
 		Timeout     string // valid time.ParseDuration string needed
 		HTTPWorkers int
 		Workers     int
+		HostHeader  string
 		ok          bool
 	}{
 		{ // 0
@@ -37,21 +36,19 @@ func TestGetOptions(t *testing.T) {
 		{ // 2
 			argString:   `<prog> -s "hi" https://www.test.com`,
 			SearchTerms: []string{"hi"},
-			Verbose:     false,
 			BaseURL:     "https://www.test.com",
 			ok:          true,
 		},
 		{ // 3
 			argString:   `<prog> -s "hi" -s "there" https://www.test.com`,
 			SearchTerms: []string{"hi", "there"},
-			Verbose:     false,
 			BaseURL:     "https://www.test.com",
 			ok:          true,
 		},
 		{ // 4
 			argString:   `<prog> -v -s "hi" -s "there" https://www.test.com`,
 			SearchTerms: []string{"hi", "there"},
-			Verbose:     true,
+			Verbose:     1,
 			BaseURL:     "https://www.test.com",
 			ok:          true,
 		},
@@ -68,7 +65,7 @@ func TestGetOptions(t *testing.T) {
 		{ // 7
 			argString:   `<prog> -v -s "hi" -z 100 -s "there" https://www.test.com`,
 			SearchTerms: []string{"hi", "there"},
-			Verbose:     true,
+			Verbose:     1,
 			BaseURL:     "https://www.test.com",
 			ok:          true,
 			BufferSize:  100,
@@ -104,7 +101,7 @@ func TestGetOptions(t *testing.T) {
 		{ // 12
 			argString:   `<prog> -v -s "hi" -w 100 -s "there" https://www.test.com`,
 			SearchTerms: []string{"hi", "there"},
-			Verbose:     true,
+			Verbose:     1,
 			BaseURL:     "https://www.test.com",
 			ok:          true,
 			Workers:     100,
@@ -112,7 +109,7 @@ func TestGetOptions(t *testing.T) {
 		{ // 13
 			argString:   `<prog> -v -s "hi" -x 100 -s "there" https://www.test.com`,
 			SearchTerms: []string{"hi", "there"},
-			Verbose:     true,
+			Verbose:     1,
 			BaseURL:     "https://www.test.com",
 			ok:          true,
 			HTTPWorkers: 100,
@@ -120,7 +117,7 @@ func TestGetOptions(t *testing.T) {
 		{ // 14
 			argString:   `<prog> -v -t 1h20m10s -q 19 -s "hi" -z 5 -w 6 -x 7 -s "there" https://www.test.com`,
 			SearchTerms: []string{"hi", "there"},
-			Verbose:     true,
+			Verbose:     1,
 			BaseURL:     "https://www.test.com",
 			ok:          true,
 			BufferSize:  5,
@@ -129,6 +126,46 @@ func TestGetOptions(t *testing.T) {
 			QuerySec:    19,
 			Timeout:     "1h20m10s",
 		},
+		{ // 15
+			argString:   `<prog> --host-header www.example.com -s "hi" https://10.0.0.1`,
+			SearchTerms: []string{"hi"},
+			BaseURL:     "https://10.0.0.1",
+			ok:          true,
+			HostHeader:  "www.example.com",
+		},
+		{ // 16
+			argString:   `<prog> -vv -s "hi" https://www.test.com`,
+			SearchTerms: []string{"hi"},
+			Verbose:     VerboseLinks,
+			BaseURL:     "https://www.test.com",
+			ok:          true,
+		},
+		{ // 17
+			argString:   `<prog> -vvv -s "hi" https://www.test.com`,
+			SearchTerms: []string{"hi"},
+			Verbose:     VerboseRequests,
+			BaseURL:     "https://www.test.com",
+			ok:          true,
+		},
+		{ // 18
+			argString:   `<prog> -v -s "hi" --verbose https://www.test.com`,
+			SearchTerms: []string{"hi"},
+			Verbose:     VerboseLinks,
+			BaseURL:     "https://www.test.com",
+			ok:          true,
+		},
+		{ // 19
+			// search terms are optional when watching for changes
+			argString: `<prog> --changes -o sqlite:webchk.db https://www.test.com`,
+			BaseURL:   "https://www.test.com",
+			ok:        true,
+		},
+		{ // 20
+			// and when reporting the history of runs
+			argString: `<prog> --history webchk.db --run 12 --status 404 --csv https://www.test.com`,
+			BaseURL:   "https://www.test.com",
+			ok:        true,
+		},
 	}
 	for i, tt := range tests {
 		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
@@ -173,8 +210,8 @@ func TestGetOptions(t *testing.T) {
 			if diff := cmp.Diff(options.SearchTerms, tt.SearchTerms); diff != "" {
 				t.Errorf("searchterms mismatch (-want +got):\n%s", diff)
 			}
-			if got, want := options.Verbose, tt.Verbose; got != want {
-				t.Errorf("verbose mismatch want %t got %t", got, want)
+			if got, want := options.Verbose.level(), tt.Verbose; got != want {
+				t.Errorf("verbose mismatch want %d got %d", got, want)
 			}
 			if got, want := options.BufferSize, tt.BufferSize; got != want {
 				t.Errorf("link buffersize mismatch want %d got %d", got, want)
@@ -191,6 +228,9 @@ func TestGetOptions(t *testing.T) {
 			if got, want := options.Timeout, timeout; got != want {
 				t.Errorf("timeout mismatch want %v got %v", got, want)
 			}
+			if got, want := options.HostHeader, tt.HostHeader; got != want {
+				t.Errorf("host header mismatch want %s got %s", got, want)
+			}
 			if got, want := options.Args.BaseURL, tt.BaseURL; got != want {
 				t.Errorf("baseurl mismatch want %s got %s", got, want)
 			}
@@ -198,62 +238,77 @@ func TestGetOptions(t *testing.T) {
 	}
 }
 
-func TestPrintResults(t *testing.T) {
+func TestGetOptionsIdleTimeout(t *testing.T) {
 
-	resulter := func() <-chan Result {
-		r := make(chan Result, 5)
-		r <- Result{
-			url:     "http://example.com/nomatches",
-			status:  200,
-			matches: []SearchMatch{},
-		}
-		r <- Result{
-			err: NonHTMLPageType,
-		}
-		r <- Result{
-			referrer: "/referrer",
-			url:      "http://example.com/403",
-			status:   403,
-			err:      StatusNotOk,
-		}
-		r <- Result{
-			url:    "http://example.com/unknown",
-			status: 200,
-			err:    errors.New("unknown error"),
-		}
-		r <- Result{
-			url:     "http://example.com/matches",
-			status:  200,
-			matches: []SearchMatch{{2, "hi"}, {99, "there"}},
-		}
-		close(r)
-		return r
+	tests := []struct {
+		argString   string
+		timeout     time.Duration
+		idleTimeout time.Duration
+	}{
+		{
+			argString:   `<prog> -s "hi" https://www.test.com`,
+			timeout:     2 * time.Minute, // defaults
+			idleTimeout: DISPATCHERTIMEOUT,
+		},
+		{
+			argString:   `<prog> -t 1h --idle-timeout 30s -s "hi" https://www.test.com`,
+			timeout:     time.Hour,
+			idleTimeout: 30 * time.Second,
+		},
 	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			os.Args = strings.Fields(tt.argString)
+			options, err := getOptions()
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got, want := options.Timeout, tt.timeout; got != want {
+				t.Errorf("timeout got %v want %v", got, want)
+			}
+			if got, want := options.IdleTimeout, tt.idleTimeout; got != want {
+				t.Errorf("idle timeout got %v want %v", got, want)
+			}
+		})
+	}
+}
 
-	// redirect stdout
-	var buf bytes.Buffer
-	output = &buf
-
-	options := Options{Verbose: true}
-	options.Args.BaseURL = "https://example.com"
-	printResults(options, resulter())
-
-	// put back
-	output = os.Stdout
+func TestGetOptionsThresholds(t *testing.T) {
 
-	want := `
-Commencing search of https://example.com:
-http://example.com/nomatches
-http://example.com/403
-- status 403 (from /referrer)
-http://example.com/unknown : error unknown error
-http://example.com/matches
-> line:   2 match: hi
-> line:  99 match: there
-processed 5 pages
-`
-	got := buf.String()
-	if diff := cmp.Diff(got, want); diff != "" {
-		t.Errorf("output mismatch (-want +got):\n%s", diff)
+	tests := []struct {
+		argString string
+		maxErrors int
+		maxBroken int
+		webhook   string
+	}{
+		{
+			argString: `<prog> -s "hi" https://www.test.com`,
+			maxErrors: -1, // defaults
+			maxBroken: -1,
+		},
+		{
+			argString: `<prog> --max-errors 3 --max-broken 0 --webhook https://hooks.test.com/x -s "hi" https://www.test.com`,
+			maxErrors: 3,
+			maxBroken: 0,
+			webhook:   "https://hooks.test.com/x",
+		},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			os.Args = strings.Fields(tt.argString)
+			options, err := getOptions()
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got, want := options.MaxErrors, tt.maxErrors; got != want {
+				t.Errorf("max errors got %d want %d", got, want)
+			}
+			if got, want := options.MaxBroken, tt.maxBroken; got != want {
+				t.Errorf("max broken got %d want %d", got, want)
+			}
+			if got, want := options.Webhook, tt.webhook; got != want {
+				t.Errorf("webhook got %s want %s", got, want)
+			}
+		})
 	}
 }
@@ -0,0 +1,97 @@
+// maintenance.go pauses requests while a host is down for maintenance,
+// as signalled by a 503 Service Unavailable response with a Retry-After
+// header, rather than recording every page fetched during the window as
+// broken.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MAINTENANCERETRIES is the number of times a url is fetched while the
+// site reports it is down for maintenance before the 503 response is
+// recorded
+const MAINTENANCERETRIES = 3
+
+// maintenance records the time until which requests to each host are
+// paused, so that a host down for maintenance does not hold up requests
+// to the others. It is safe for concurrent use.
+type maintenance struct {
+	mu    sync.Mutex
+	until map[string]time.Time // by host, as given by urlHost
+}
+
+// pause pauses requests to the host of u for d, unless they are already
+// paused for longer, reporting whether the pause was extended
+func (m *maintenance) pause(u string, d time.Duration) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	host, until := urlHost(u), time.Now().Add(d)
+	if !until.After(m.until[host]) {
+		return false
+	}
+	if m.until == nil {
+		m.until = map[string]time.Time{}
+	}
+	m.until[host] = until
+	return true
+}
+
+// remaining returns how long requests to the host of u remain paused
+func (m *maintenance) remaining(u string) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return max(time.Until(m.until[urlHost(u)]), 0)
+}
+
+// longest returns how long requests to any host remain paused
+func (m *maintenance) longest() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var longest time.Duration
+	for _, until := range m.until {
+		longest = max(longest, time.Until(until))
+	}
+	return longest
+}
+
+// wait waits until requests to the host of u are no longer paused,
+// returning an error if the context is done first
+func (m *maintenance) wait(ctx context.Context, u string) error {
+	for {
+		d := m.remaining(u)
+		if d == 0 {
+			return nil
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C: // the pause may have been extended meanwhile
+		}
+	}
+}
+
+// parseRetryAfter parses a Retry-After header value, given either as a
+// number of seconds or as an http date, returning the time to wait from
+// now or 0 if the value is missing or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
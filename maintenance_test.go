@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/goleak"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{" 5 ", 5 * time.Second},
+		{"-5", 0},
+		{"Wed, 01 May 2024 12:00:30 GMT", 30 * time.Second},
+		{"Wed, 01 May 2024 11:00:00 GMT", 0}, // in the past
+		{"soon", 0},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("%q got %s want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+
+	const site, other = "https://example.com/a", "https://other.example.com/b"
+	var m maintenance
+	if got := m.remaining(site); got != 0 {
+		t.Errorf("unpaused remaining got %s", got)
+	}
+	if got := m.longest(); got != 0 {
+		t.Errorf("unpaused longest got %s", got)
+	}
+	if !m.pause(site, 50*time.Millisecond) {
+		t.Error("pause should be extended")
+	}
+	if m.pause("https://EXAMPLE.com/b", 10*time.Millisecond) {
+		t.Error("shorter pause of the host should not be extended")
+	}
+	if got := m.remaining(site); got <= 10*time.Millisecond {
+		t.Errorf("remaining got %s", got)
+	}
+	if got := m.longest(); got <= 10*time.Millisecond {
+		t.Errorf("longest got %s", got)
+	}
+	// other hosts are not paused
+	if got := m.remaining(other); got != 0 {
+		t.Errorf("other host remaining got %s", got)
+	}
+	start := time.Now()
+	if err := m.wait(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("other host waited %s", elapsed)
+	}
+	if err := m.wait(context.Background(), site); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("waited only %s", elapsed)
+	}
+
+	m.pause(site, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.wait(ctx, site); err == nil {
+		t.Error("expected context error")
+	}
+}
+
+func TestGetURLRetryAfter(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	g := NewGetClient(1, time.Second)
+	r, _ := g.getURL(server.URL, "/", nil)
+	if r.status != http.StatusServiceUnavailable || r.retryAfter != 7*time.Second {
+		t.Errorf("got status %d retry after %s", r.status, r.retryAfter)
+	}
+}
+
+func TestDispatcherMaintenance(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	// the site is down for maintenance for the first few requests, for
+	// longer than the idle timeout
+	var mu sync.Mutex
+	unavailable := MAINTENANCERETRIES - 1
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if unavailable > 0 {
+			unavailable--
+			return Result{url: url, status: 503, err: StatusNotOk, retryAfter: 40 * time.Millisecond}, nil
+		}
+		links := []string{"https://example.com/a", "https://example.com/b"}
+		return Result{url: url, status: 200, matches: []SearchMatch{}}, links
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	d := NewDispatch("https://example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(30*time.Millisecond),
+		WithClient(gc),
+	)
+	got := []string{}
+	for r := range d.Dispatcher() {
+		got = append(got, fmt.Sprintf("%s %d", r.url, r.status))
+	}
+	slices.Sort(got)
+	want := []string{"https://example.com 200", "https://example.com/a 200", "https://example.com/b 200"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := d.Stats().Termination, TerminationIdle; got != want {
+		t.Errorf("termination got %q want %q", got, want)
+	}
+}
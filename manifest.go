@@ -0,0 +1,158 @@
+// manifest.go writes a machine-readable manifest of a run, recording
+// the options, seeds, filters and versions used together with the
+// counts, termination reason and output files of the run, so that
+// audits are reproducible and self-describing.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// manifestVersions are the versions of the software making a run
+type manifestVersions struct {
+	Webchk        string `json:"webchk"`
+	Go            string `json:"go"`
+	SchemaVersion int    `json:"schema_version"` // of the json output
+}
+
+// manifestFilters are the rules deciding which links were followed
+type manifestFilters struct {
+	Scope       string   `json:"scope"`
+	Schemes     []string `json:"schemes"`
+	SkipSuffix  []string `json:"skip_suffixes"`
+	IncludeFile string   `json:"include_file,omitempty"`
+	ExcludeFile string   `json:"exclude_file,omitempty"`
+	Budgets     []string `json:"budgets,omitempty"`
+	Rewrites    []string `json:"rewrites,omitempty"`
+	IndexDocs   []string `json:"index_documents,omitempty"`
+	Languages   []string `json:"languages,omitempty"`
+}
+
+// manifestCounts are the counts of a run
+type manifestCounts struct {
+	Pages      int            `json:"pages"`
+	Bytes      int64          `json:"bytes"`
+	Errors     int            `json:"errors"`
+	Broken     int            `json:"broken"`
+	Violations int            `json:"violations"`
+	ErrorKinds map[string]int `json:"error_kinds"`
+	Discovered []int          `json:"discovered_by_depth"`
+	PeakQueue  int            `json:"peak_queue_depth"`
+}
+
+// manifestOutput is a file written by a run
+type manifestOutput struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+}
+
+// runManifest describes a run
+type runManifest struct {
+	Versions    manifestVersions  `json:"versions"`
+	Options     Options           `json:"options"`
+	Seeds       []string          `json:"seeds"`
+	Filters     manifestFilters   `json:"filters"`
+	Start       time.Time         `json:"start"`
+	End         time.Time         `json:"end"`
+	Duration    string            `json:"duration"`
+	Termination string            `json:"termination"`
+	Counts      manifestCounts    `json:"counts"`
+	Outputs     []manifestOutput  `json:"outputs"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// newRunManifest makes the manifest of a run with options, with their
+// secrets redacted, starting from seeds, which ended with stats
+func newRunManifest(options Options, seeds []string, stats Stats) runManifest {
+	options = options.redacted()
+	m := runManifest{
+		Versions:    manifestVersions{version, runtime.Version(), SCHEMAVERSION},
+		Options:     options,
+		Seeds:       seeds,
+		Start:       stats.Start,
+		End:         stats.End,
+		Duration:    stats.Duration.String(),
+		Termination: stats.Termination,
+		Counts: manifestCounts{
+			Pages:      stats.Pages,
+			Bytes:      stats.Bytes,
+			Errors:     stats.Errors,
+			Broken:     stats.Broken,
+			Violations: stats.Violations,
+			ErrorKinds: stats.ErrorKinds,
+			Discovered: stats.Discovered,
+			PeakQueue:  stats.PeakQueueDepth,
+		},
+		Filters: manifestFilters{
+			Scope:       stats.Scope,
+			Schemes:     urlSchemesToFollow,
+			SkipSuffix:  urlSuffixesToSkip,
+			IncludeFile: options.IncludeFile,
+			ExcludeFile: options.ExcludeFile,
+			Budgets:     options.Budget,
+			Rewrites:    options.Rewrite,
+			IndexDocs:   parseIndexDocuments(options.IndexDocs),
+			Languages:   parseLanguages(options.Lang),
+		},
+		Outputs: options.outputFiles(),
+		Tags:    options.tags(),
+	}
+	if len(options.Schemes) > 0 {
+		m.Filters.Schemes = parseSchemes(options.Schemes)
+	}
+	if options.Assets {
+		m.Filters.SkipSuffix = []string{}
+	}
+	return m
+}
+
+// outputFiles returns the files written by a run with the options,
+// which should be redacted, with stdout given as "-"
+func (o Options) outputFiles() []manifestOutput {
+	outputs := []manifestOutput{}
+	specs := o.Output
+	if o.JSON {
+		specs = append(specs, "json")
+	}
+	switch {
+	case o.Estimate > 0:
+		specs = []string{"estimate"} // in place of the usual outputs
+	case len(specs) == 0:
+		specs = []string{"text"}
+	}
+	for _, spec := range specs {
+		kind, target, _ := strings.Cut(spec, ":")
+		if target == "" && kind != "webhook" && kind != "sqlite" {
+			target = "-"
+		}
+		outputs = append(outputs, manifestOutput{kind, target})
+	}
+	for _, f := range []struct{ kind, target string }{
+		{"har", o.HAR},
+		{"journal", o.Journal},
+		{"cache", o.Cache},
+	} {
+		if f.target != "" {
+			outputs = append(outputs, manifestOutput{f.kind, f.target})
+		}
+	}
+	return outputs
+}
+
+// write writes the manifest as indented json to filename
+func (m runManifest) write(filename string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode manifest: %w", err)
+	}
+	if err := os.WriteFile(filename, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("could not write manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunManifest(t *testing.T) {
+
+	options := Options{
+		SearchTerms: []string{"hello"},
+		Output:      []string{"text", "csv:out.csv", "sqlite:webchk.db"},
+		JSON:        true,
+		HAR:         "crawl.har",
+		Schemes:     []string{"HTTP,https:"},
+		Budget:      []string{"/tag/=10"},
+		Tags:        []string{"env=staging", "team=web"},
+	}
+	options.Args.BaseURL = "https://example.com"
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	stats := Stats{
+		Pages:       3,
+		Broken:      1,
+		ErrorKinds:  map[string]int{"status 404": 1},
+		Discovered:  []int{1, 2},
+		Start:       start,
+		End:         start.Add(2 * time.Second),
+		Duration:    2 * time.Second,
+		Termination: TerminationIdle,
+	}
+	m := newRunManifest(options, []string{"https://example.com", "https://example.com/a"}, stats)
+
+	if got, want := m.Filters.Schemes, []string{"http", "https"}; !cmp.Equal(got, want) {
+		t.Errorf("got schemes %v want %v", got, want)
+	}
+	wantOutputs := []manifestOutput{
+		{"text", "-"}, {"csv", "out.csv"}, {"sqlite", "webchk.db"}, {"json", "-"}, {"har", "crawl.har"},
+	}
+	if diff := cmp.Diff(wantOutputs, m.Outputs); diff != "" {
+		t.Errorf("outputs differ (-want +got):\n%s", diff)
+	}
+
+	filename := filepath.Join(t.TempDir(), "manifest.json")
+	if err := m.write(filename); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got runManifest
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Termination != TerminationIdle || got.Counts.Pages != 3 || got.Counts.Broken != 1 {
+		t.Errorf("unexpected manifest counts %+v termination %q", got.Counts, got.Termination)
+	}
+	if got.Versions.Webchk != version || got.Versions.SchemaVersion != SCHEMAVERSION || got.Versions.Go == "" {
+		t.Errorf("unexpected versions %+v", got.Versions)
+	}
+	if diff := cmp.Diff(map[string]string{"env": "staging", "team": "web"}, got.Tags); diff != "" {
+		t.Errorf("tags differ (-want +got):\n%s", diff)
+	}
+	if got.Options.Args.BaseURL != options.Args.BaseURL || len(got.Seeds) != 2 {
+		t.Errorf("unexpected options or seeds %+v %v", got.Options.Args, got.Seeds)
+	}
+}
@@ -0,0 +1,46 @@
+// matchcaps.go caps the matches reported for each page and for each
+// search term over a crawl, so that a term which appears on every page,
+// such as in a footer, does not swamp the output.
+
+package main
+
+import "sync"
+
+// matchCaps caps the matches reported for each page and for each search
+// term over a crawl. A cap of 0 is no cap. matchCaps is safe for
+// concurrent use by the workers of a crawl.
+type matchCaps struct {
+	perPage int
+	perTerm int
+	mu      sync.Mutex
+	terms   map[string]int // matches reported by term
+}
+
+// newMatchCaps makes new matchCaps, or nil if neither cap is set
+func newMatchCaps(perPage, perTerm int) *matchCaps {
+	if perPage <= 0 && perTerm <= 0 {
+		return nil
+	}
+	return &matchCaps{perPage: perPage, perTerm: perTerm, terms: map[string]int{}}
+}
+
+// apply returns the matches of a page within the caps, reporting true if
+// any were dropped
+func (c *matchCaps) apply(matches []SearchMatch) ([]SearchMatch, bool) {
+	if c == nil {
+		return matches, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := []SearchMatch{}
+	truncated := false
+	for _, m := range matches {
+		if (c.perPage > 0 && len(kept) >= c.perPage) || (c.perTerm > 0 && c.terms[m.match] >= c.perTerm) {
+			truncated = true
+			continue
+		}
+		kept = append(kept, m)
+		c.terms[m.match]++
+	}
+	return kept, truncated
+}
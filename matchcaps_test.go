@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatchCaps(t *testing.T) {
+
+	page := []SearchMatch{{1, "hi", 0}, {2, "there", 10}, {3, "hi", 20}}
+
+	type pageResult struct {
+		lines     []int
+		truncated bool
+	}
+	tests := []struct {
+		perPage, perTerm int
+		want             []pageResult // for three pages in turn
+	}{
+		{
+			want: []pageResult{{[]int{1, 2, 3}, false}, {[]int{1, 2, 3}, false}, {[]int{1, 2, 3}, false}},
+		},
+		{
+			perPage: 2,
+			want:    []pageResult{{[]int{1, 2}, true}, {[]int{1, 2}, true}, {[]int{1, 2}, true}},
+		},
+		{
+			perTerm: 3,
+			want:    []pageResult{{[]int{1, 2, 3}, false}, {[]int{1, 2}, true}, {[]int{2}, true}},
+		},
+		{
+			perPage: 1,
+			perTerm: 1,
+			want:    []pageResult{{[]int{1}, true}, {[]int{2}, true}, {[]int{}, true}},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			caps := newMatchCaps(tt.perPage, tt.perTerm)
+			got := []pageResult{}
+			for range 3 {
+				matches, truncated := caps.apply(page)
+				lines := []int{}
+				for _, m := range matches {
+					lines = append(lines, m.line)
+				}
+				got = append(got, pageResult{lines, truncated})
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(pageResult{})); diff != "" {
+				t.Errorf("matches mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// noindex.go recognises pages marked noindex, by a robots meta element
+// or an X-Robots-Tag header, so that audits concerned only with the
+// pages search engines index can leave them out of the reports or
+// report them separately.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// The ways pages marked noindex can be reported, other than with the
+// other pages
+const (
+	NOINDEXHIDE     = "hide"     // leave out of the reports
+	NOINDEXSEPARATE = "separate" // report after the other pages
+)
+
+// noindexDirective reports whether the directives of a robots meta
+// element or X-Robots-Tag header value, such as "noindex, follow",
+// include noindex or none. Directives of a header value may be for a
+// named robot, such as "googlebot: noindex".
+func noindexDirective(content string) bool {
+	for _, d := range strings.Split(content, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if _, after, ok := strings.Cut(d, ":"); ok {
+			d = strings.TrimSpace(after)
+		}
+		if d == "noindex" || d == "none" {
+			return true
+		}
+	}
+	return false
+}
+
+// headerNoindex reports whether the X-Robots-Tag headers of a response
+// mark it noindex
+func headerNoindex(header http.Header) bool {
+	for _, v := range header.Values("X-Robots-Tag") {
+		if noindexDirective(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// noindexSink is an OutputSink leaving the results of pages marked
+// noindex out of its OutputSink
+type noindexSink struct {
+	sink OutputSink
+}
+
+// Write writes the result unless it is marked noindex
+func (n noindexSink) Write(r Result) error {
+	if r.noindex {
+		return nil
+	}
+	return n.sink.Write(r)
+}
+
+// Close closes the sink
+func (n noindexSink) Close(stats Stats) error {
+	return n.sink.Close(stats)
+}
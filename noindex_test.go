@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNoindexDirective(t *testing.T) {
+
+	for _, tt := range []struct {
+		content string
+		want    bool
+	}{
+		{"noindex", true},
+		{"NOINDEX, follow", true},
+		{"none", true},
+		{"googlebot: noindex", true},
+		{"index, follow", false},
+		{"nofollow", false},
+		{"", false},
+	} {
+		if got := noindexDirective(tt.content); got != tt.want {
+			t.Errorf("%q: got %t want %t", tt.content, got, tt.want)
+		}
+	}
+
+	header := http.Header{}
+	header.Add("X-Robots-Tag", "noarchive")
+	if headerNoindex(header) {
+		t.Error("noarchive header should not be noindex")
+	}
+	header.Add("X-Robots-Tag", "otherbot: noindex, nofollow")
+	if !headerNoindex(header) {
+		t.Error("second header should be noindex")
+	}
+}
+
+func TestParsePageNoindex(t *testing.T) {
+
+	u, _ := url.Parse("https://example.com/")
+	for _, tt := range []struct {
+		body string
+		want bool
+	}{
+		{`<head><meta name="robots" content="noindex, follow"></head>`, true},
+		{`<head><META NAME="Robots" CONTENT="none"/></head>`, true},
+		{`<head><meta name="robots" content="index"></head>`, false},
+		{`<head><meta name="description" content="noindex"></head>`, false},
+		{`<p>noindex</p>`, false},
+	} {
+		page, err := parsePage([]byte(tt.body), u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.noindex != tt.want {
+			t.Errorf("%s: got %t want %t", tt.body, page.noindex, tt.want)
+		}
+	}
+}
+
+func TestNoindexSinks(t *testing.T) {
+
+	results := []Result{
+		{url: "http://example.com/a", status: 200, matches: []SearchMatch{{1, "hi", 0}}},
+		{url: "http://example.com/b", status: 200, matches: []SearchMatch{{2, "hi", 0}}, noindex: true},
+		{url: "http://example.com/c", status: 200, matches: []SearchMatch{{3, "hi", 0}}},
+	}
+
+	hidden := &resultsSink{}
+	sink := noindexSink{hidden}
+	for _, r := range results {
+		sink.Write(r)
+	}
+	if diff := cmp.Diff([]string{"http://example.com/a", "http://example.com/c"}, hidden.urls); diff != "" {
+		t.Errorf("hidden results mismatch (-want +got):\n%s", diff)
+	}
+
+	var buf strings.Builder
+	text := newTextSink(closingWriter{Writer: &buf}, Options{NoIndex: NOINDEXSEPARATE})
+	for _, r := range results {
+		text.Write(r)
+	}
+	text.Close(Stats{Pages: 3})
+	want := `
+Commencing search of :
+http://example.com/a
+> line:   1 match: hi
+http://example.com/c
+> line:   3 match: hi
+
+== pages marked noindex ==
+http://example.com/b
+> line:   2 match: hi
+processed 3 pages
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("text output mismatch (-want +got):\n%s", diff)
+	}
+}
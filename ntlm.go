@@ -0,0 +1,281 @@
+// ntlm.go provides an http.RoundTripper authenticating with Windows
+// integrated authentication, so that intranet sites behind IIS can be
+// crawled. NTLMv2 is used for both the NTLM and Negotiate schemes, as
+// Windows servers accept NTLM tokens for Negotiate; Kerberos is not
+// supported.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// NTLMPASSWORDENV is the environment variable holding the password for
+// --ntlm-user, which is not given as an option to keep it out of
+// process listings
+const NTLMPASSWORDENV = "WEBCHK_NTLM_PASSWORD"
+
+// NTLMATTEMPTS is the most handshakes tried for a request. A handshake
+// fails if its messages are sent on different pooled connections.
+const NTLMATTEMPTS = 3
+
+// ErrNTLMChallenge reports a challenge message which cannot be parsed
+var ErrNTLMChallenge = errors.New("invalid NTLM challenge")
+
+// ntlmSignature starts each NTLM message
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// The NTLM negotiate flags requested
+const (
+	ntlmUnicode         = 0x00000001
+	ntlmOEM             = 0x00000002
+	ntlmRequestTarget   = 0x00000004
+	ntlmNTLM            = 0x00000200
+	ntlmAlwaysSign      = 0x00008000
+	ntlmExtendedSession = 0x00080000
+	ntlmTargetInfo      = 0x00800000
+	ntlm128             = 0x20000000
+	ntlm56              = 0x80000000
+	ntlmFlags           = ntlmUnicode | ntlmOEM | ntlmRequestTarget | ntlmNTLM | ntlmAlwaysSign | ntlmExtendedSession | ntlmTargetInfo | ntlm128 | ntlm56
+)
+
+// ntlmAvTimestamp is the target information entry holding the server
+// time
+const ntlmAvTimestamp = 7
+
+// ntlmCredentials are the credentials of a Windows user
+type ntlmCredentials struct {
+	domain, user, password string
+}
+
+// parseNTLMUser parses a user given as DOMAIN\user, or as user or
+// user@domain, with password
+func parseNTLMUser(user, password string) ntlmCredentials {
+	if domain, name, ok := strings.Cut(user, `\`); ok {
+		return ntlmCredentials{domain, name, password}
+	}
+	return ntlmCredentials{"", user, password}
+}
+
+// utf16LE encodes s as UTF-16 little endian, as NTLM strings are sent
+func utf16LE(s string) []byte {
+	b := []byte{}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+// hmacMD5 returns the HMAC-MD5 of the concatenated data with key
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// ntowfv2 returns the NTLMv2 hash of the credentials
+func (c ntlmCredentials) ntowfv2() []byte {
+	hash := md4.New()
+	hash.Write(utf16LE(c.password))
+	return hmacMD5(hash.Sum(nil), utf16LE(strings.ToUpper(c.user)+c.domain))
+}
+
+// ntlmNegotiate returns the first, negotiate, message of a handshake
+func ntlmNegotiate() []byte {
+	msg := append([]byte{}, ntlmSignature...)
+	msg = binary.LittleEndian.AppendUint32(msg, 1)
+	msg = binary.LittleEndian.AppendUint32(msg, ntlmFlags)
+	return append(msg, make([]byte, 16)...) // no domain or workstation
+}
+
+// ntlmChallenge is the second, challenge, message of a handshake
+type ntlmChallenge struct {
+	flags      uint32
+	challenge  []byte
+	targetInfo []byte
+}
+
+// parseNTLMChallenge parses a challenge message
+func parseNTLMChallenge(msg []byte) (ntlmChallenge, error) {
+	c := ntlmChallenge{}
+	if len(msg) < 48 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return c, ErrNTLMChallenge
+	}
+	c.flags = binary.LittleEndian.Uint32(msg[20:])
+	c.challenge = msg[24:32]
+	length, offset := int(binary.LittleEndian.Uint16(msg[40:])), int(binary.LittleEndian.Uint32(msg[44:]))
+	if offset+length > len(msg) {
+		return c, ErrNTLMChallenge
+	}
+	c.targetInfo = msg[offset : offset+length]
+	return c, nil
+}
+
+// timestamp returns the server time from the target information, if
+// given
+func (c ntlmChallenge) timestamp() ([]byte, bool) {
+	for info := c.targetInfo; len(info) >= 4; {
+		id, length := binary.LittleEndian.Uint16(info), int(binary.LittleEndian.Uint16(info[2:]))
+		if len(info) < 4+length {
+			break
+		}
+		if id == ntlmAvTimestamp && length == 8 {
+			return info[4:12], true
+		}
+		info = info[4+length:]
+	}
+	return nil, false
+}
+
+// fileTime returns t as a Windows FILETIME, the 100ns intervals since
+// 1601
+func fileTime(t time.Time) []byte {
+	const epochDelta = 116444736000000000 // from 1601 to 1970
+	return binary.LittleEndian.AppendUint64(nil, uint64(t.UnixNano()/100+epochDelta))
+}
+
+// ntlmAuthenticate returns the third, authenticate, message of a
+// handshake answering challenge, with the clientChallenge and, if the
+// server does not give one, timestamp of the client
+func ntlmAuthenticate(c ntlmCredentials, challenge ntlmChallenge, clientChallenge, timestamp []byte) []byte {
+	key := c.ntowfv2()
+	lmResponse := make([]byte, 24)
+	if serverTime, ok := challenge.timestamp(); ok {
+		timestamp = serverTime
+	} else {
+		lmResponse = append(hmacMD5(key, challenge.challenge, clientChallenge), clientChallenge...)
+	}
+	temp := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	temp = append(temp, timestamp...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, challenge.targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+	ntResponse := append(hmacMD5(key, challenge.challenge, temp), temp...)
+
+	fields := [][]byte{lmResponse, ntResponse, utf16LE(c.domain), utf16LE(c.user), {}, {}}
+	const headerSize = 64
+	msg := append([]byte{}, ntlmSignature...)
+	msg = binary.LittleEndian.AppendUint32(msg, 3)
+	payload := []byte{}
+	for _, f := range fields {
+		msg = binary.LittleEndian.AppendUint16(msg, uint16(len(f)))
+		msg = binary.LittleEndian.AppendUint16(msg, uint16(len(f)))
+		msg = binary.LittleEndian.AppendUint32(msg, uint32(headerSize+len(payload)))
+		payload = append(payload, f...)
+	}
+	msg = binary.LittleEndian.AppendUint32(msg, challenge.flags&ntlmFlags|ntlmUnicode)
+	return append(msg, payload...)
+}
+
+// ntlmTransport is an http.RoundTripper answering requests for NTLM or
+// Negotiate authentication from transport with a handshake for the
+// credentials. As servers authenticate connections rather than
+// requests, later requests on an authenticated connection need no
+// handshake.
+type ntlmTransport struct {
+	transport   http.RoundTripper
+	credentials ntlmCredentials
+	now         func() time.Time
+}
+
+// newNTLMTransport makes an ntlmTransport for transport, or
+// http.DefaultTransport if transport is nil
+func newNTLMTransport(transport http.RoundTripper, credentials ntlmCredentials) *ntlmTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &ntlmTransport{transport: transport, credentials: credentials, now: time.Now}
+}
+
+// ntlmScheme returns the NTLM or Negotiate scheme offered by a 401
+// response, preferring NTLM, or "" if neither is offered
+func ntlmScheme(resp *http.Response) string {
+	scheme := ""
+	for _, h := range resp.Header.Values("Www-Authenticate") {
+		switch name, _, _ := strings.Cut(h, " "); {
+		case strings.EqualFold(name, "NTLM"):
+			return "NTLM"
+		case strings.EqualFold(name, "Negotiate"):
+			scheme = "Negotiate"
+		}
+	}
+	return scheme
+}
+
+// ntlmToken returns the token of scheme in a response, if any
+func ntlmToken(resp *http.Response, scheme string) ([]byte, bool) {
+	for _, h := range resp.Header.Values("Www-Authenticate") {
+		name, token, _ := strings.Cut(h, " ")
+		if strings.EqualFold(name, scheme) && strings.TrimSpace(token) != "" {
+			b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+			return b, err == nil
+		}
+	}
+	return nil, false
+}
+
+// discard reads and closes a response body so that its connection can
+// be reused for the next message of a handshake
+func discard(resp *http.Response) {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// RoundTrip meets the http.RoundTripper interface
+func (t *ntlmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || req.Body != nil && req.Body != http.NoBody {
+		return resp, err // requests with bodies, which cannot be resent, are not authenticated
+	}
+	scheme := ntlmScheme(resp)
+	if scheme == "" {
+		return resp, nil
+	}
+	for attempt := 1; ; attempt++ {
+		discard(resp)
+		negotiate := req.Clone(req.Context())
+		negotiate.Header.Set("Authorization", scheme+" "+base64.StdEncoding.EncodeToString(ntlmNegotiate()))
+		resp, err = t.transport.RoundTrip(negotiate)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+		token, ok := ntlmToken(resp, scheme)
+		if !ok {
+			return resp, nil // the credentials are not accepted
+		}
+		challenge, err := parseNTLMChallenge(token)
+		if err != nil {
+			discard(resp)
+			return nil, err
+		}
+		discard(resp)
+
+		clientChallenge := make([]byte, 8)
+		if _, err := rand.Read(clientChallenge); err != nil {
+			return nil, err
+		}
+		msg := ntlmAuthenticate(t.credentials, challenge, clientChallenge, fileTime(t.now()))
+		authenticate := req.Clone(req.Context())
+		authenticate.Header.Set("Authorization", scheme+" "+base64.StdEncoding.EncodeToString(msg))
+		resp, err = t.transport.RoundTrip(authenticate)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || attempt == NTLMATTEMPTS {
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseNTLMUser(t *testing.T) {
+	tests := []struct {
+		user string
+		want ntlmCredentials
+	}{
+		{`CORP\jo`, ntlmCredentials{"CORP", "jo", "pw"}},
+		{"jo", ntlmCredentials{"", "jo", "pw"}},
+		{"jo@corp.example", ntlmCredentials{"", "jo@corp.example", "pw"}},
+	}
+	for _, tt := range tests {
+		if got := parseNTLMUser(tt.user, "pw"); got != tt.want {
+			t.Errorf("%s: got %+v want %+v", tt.user, got, tt.want)
+		}
+	}
+}
+
+// TestNTLMv2 checks the responses against the example of section 4.2.4
+// of the MS-NLMP specification
+func TestNTLMv2(t *testing.T) {
+
+	unhex := func(s string) []byte {
+		b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	c := ntlmCredentials{"Domain", "User", "Password"}
+	if got, want := hex.EncodeToString(c.ntowfv2()), "0c868a403bfd7a93a3001ef22ef02e3f"; got != want {
+		t.Errorf("ntowfv2 got %s want %s", got, want)
+	}
+
+	challenge := ntlmChallenge{
+		flags:      0xe28a8233,
+		challenge:  unhex("0123456789abcdef"),
+		targetInfo: unhex("02000c0044006f006d00610069006e0001000c0053006500720076006500720000000000"),
+	}
+	msg := ntlmAuthenticate(c, challenge, unhex("aaaaaaaaaaaaaaaa"), make([]byte, 8))
+	field := func(offset int) []byte {
+		length, start := binary.LittleEndian.Uint16(msg[offset:]), binary.LittleEndian.Uint32(msg[offset+4:])
+		return msg[start : start+uint32(length)]
+	}
+	if got, want := hex.EncodeToString(field(12)), "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa"; got != want {
+		t.Errorf("lmv2 response got %s want %s", got, want)
+	}
+	if got, want := hex.EncodeToString(field(20)[:16]), "68cd0ab851e51c96aabc927bebef6a1c"; got != want {
+		t.Errorf("nt proof got %s want %s", got, want)
+	}
+	if got, want := field(28), utf16LE("Domain"); !bytes.Equal(got, want) {
+		t.Errorf("domain got %x want %x", got, want)
+	}
+	if got, want := field(36), utf16LE("User"); !bytes.Equal(got, want) {
+		t.Errorf("user got %x want %x", got, want)
+	}
+
+	// a server timestamp replaces the lmv2 response with zeros
+	challenge.targetInfo = unhex("0700080000000000000000000000000000")
+	msg = ntlmAuthenticate(c, challenge, unhex("aaaaaaaaaaaaaaaa"), []byte("ignored!"))
+	if got := field(12); !bytes.Equal(got, make([]byte, 24)) {
+		t.Errorf("lmv2 response got %x want zeros", got)
+	}
+	if got := field(20)[24:32]; !bytes.Equal(got, make([]byte, 8)) {
+		t.Errorf("timestamp got %x want server time", got)
+	}
+}
+
+// ntlmServer emulates a server with integrated authentication, which
+// authenticates connections, as IIS does
+type ntlmServer struct {
+	scheme        string
+	credentials   ntlmCredentials
+	mu            sync.Mutex
+	authenticated map[string]bool // by remote address
+	handshakes    int
+}
+
+func (s *ntlmServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.authenticated[r.RemoteAddr] {
+		fmt.Fprint(w, "welcome")
+		return
+	}
+	name, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	msg, _ := base64.StdEncoding.DecodeString(token)
+	if name != s.scheme || len(msg) < 12 {
+		w.Header().Set("Www-Authenticate", s.scheme)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch binary.LittleEndian.Uint32(msg[8:]) {
+	case 1:
+		s.handshakes++
+		challenge := append([]byte{}, ntlmSignature...)
+		challenge = binary.LittleEndian.AppendUint32(challenge, 2)
+		challenge = append(challenge, 0, 0, 0, 0, 48, 0, 0, 0) // no target name
+		challenge = binary.LittleEndian.AppendUint32(challenge, ntlmFlags)
+		challenge = append(challenge, []byte("chalenge")...)
+		challenge = append(challenge, make([]byte, 8)...)
+		challenge = append(challenge, 4, 0, 4, 0, 48, 0, 0, 0)
+		challenge = append(challenge, 0, 0, 0, 0) // end of target info
+		w.Header().Set("Www-Authenticate", s.scheme+" "+base64.StdEncoding.EncodeToString(challenge))
+		w.WriteHeader(http.StatusUnauthorized)
+	case 3:
+		length, start := binary.LittleEndian.Uint16(msg[20:]), binary.LittleEndian.Uint32(msg[24:])
+		nt := msg[start : start+uint32(length)]
+		if !bytes.Equal(nt[:16], hmacMD5(s.credentials.ntowfv2(), []byte("chalenge"), nt[16:])) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.authenticated[r.RemoteAddr] = true
+		fmt.Fprint(w, "welcome")
+	}
+}
+
+func TestNTLMTransport(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		scheme   string
+		password string
+		status   int
+	}{
+		{"ntlm", "NTLM", "secret", http.StatusOK},
+		{"negotiate", "Negotiate", "secret", http.StatusOK},
+		{"wrong password", "NTLM", "guess", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &ntlmServer{scheme: tt.scheme, credentials: ntlmCredentials{"CORP", "jo", "secret"}, authenticated: map[string]bool{}}
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			client := &http.Client{Transport: newNTLMTransport(nil, parseNTLMUser(`CORP\jo`, tt.password))}
+			for range 3 {
+				resp, err := client.Get(server.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if got, want := resp.StatusCode, tt.status; got != want {
+					t.Fatalf("status got %d want %d", got, want)
+				}
+				if tt.status == http.StatusOK && string(body) != "welcome" {
+					t.Errorf("body got %q", body)
+				}
+			}
+			want := 1 // the connection stays authenticated
+			if tt.status != http.StatusOK {
+				want = 3 * NTLMATTEMPTS
+			}
+			if got := s.handshakes; got != want {
+				t.Errorf("handshakes got %d want %d", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// output.go writes results and their Stats as a versioned json document
+// for consumption by other tools.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+)
+
+// SCHEMAVERSION is the version of the json output schema. It should be
+// incremented whenever the structure of the json output changes in a
+// way that is not backwards compatible.
+const SCHEMAVERSION = 2
+
+// jsonMatch is the json representation of a SearchMatch
+type jsonMatch struct {
+	Line   int    `json:"line"`
+	Match  string `json:"match"`
+	Offset int    `json:"offset"` // byte offset in the page
+}
+
+// jsonViolation is the json representation of a Violation
+type jsonViolation struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// jsonReadability is the json representation of the readability of a
+// page, with its scores to one decimal place
+type jsonReadability struct {
+	Words       int     `json:"words"`
+	Sentences   int     `json:"sentences"`
+	ReadingEase float64 `json:"reading_ease"`
+	GradeLevel  float64 `json:"grade_level"`
+}
+
+// newJSONReadability makes a jsonReadability from a readability
+func newJSONReadability(r readability) *jsonReadability {
+	round := func(f float64) float64 { return math.Round(f*10) / 10 }
+	return &jsonReadability{r.words, r.sentences, round(r.readingEase()), round(r.gradeLevel())}
+}
+
+// jsonResult is the json representation of a Result
+type jsonResult struct {
+	URL         string           `json:"url"`
+	Referrer    string           `json:"referrer"`
+	Status      int              `json:"status"`
+	Matches     []jsonMatch      `json:"matches"`
+	Violations  []jsonViolation  `json:"violations"`
+	Error       string           `json:"error,omitempty"`
+	Page        int              `json:"page,omitempty"` // page of a paginated listing
+	Size        int              `json:"size"`           // bytes read
+	ContentType string           `json:"content_type,omitempty"`
+	Redirect    string           `json:"redirect,omitempty"`  // the url redirected to
+	Truncated   bool             `json:"truncated,omitempty"` // matches were capped
+	Misspelt    []string         `json:"misspellings,omitempty"`
+	Readability *jsonReadability `json:"readability,omitempty"`
+	LinkText    string           `json:"link_text,omitempty"`    // of the anchor linking to the url
+	LinkElement string           `json:"link_element,omitempty"` // enclosing the anchor
+	NoIndex     bool             `json:"noindex,omitempty"`
+	AMP         string           `json:"amp,omitempty"`      // the url of the AMP alternate
+	Worker      int              `json:"worker,omitempty"`   // the worker fetching the url
+	Language    string           `json:"language,omitempty"` // the Accept-Language sent
+}
+
+// newJSONResult converts a Result to a jsonResult
+func newJSONResult(r Result) jsonResult {
+	j := jsonResult{
+		URL:         r.url,
+		Referrer:    r.referrer,
+		Status:      r.status,
+		Matches:     []jsonMatch{},
+		Violations:  []jsonViolation{},
+		Page:        r.page,
+		Size:        r.size,
+		ContentType: r.contentType,
+		Redirect:    r.redirect,
+		Truncated:   r.truncated,
+		Misspelt:    r.misspellings,
+		LinkText:    r.anchor.text,
+		LinkElement: r.anchor.element,
+		NoIndex:     r.noindex,
+		AMP:         r.amp,
+		Worker:      r.worker,
+		Language:    r.language,
+	}
+	if r.readability != nil {
+		j.Readability = newJSONReadability(*r.readability)
+	}
+	for _, m := range r.matches {
+		j.Matches = append(j.Matches, jsonMatch{m.line, m.match, m.offset})
+	}
+	for _, v := range r.violations {
+		j.Violations = append(j.Violations, jsonViolation{v.Kind, v.Message})
+	}
+	if r.err != nil {
+		j.Error = r.err.Error()
+	}
+	return j
+}
+
+// jsonEnvelope wraps the results of a run with metadata describing the
+// run, so that downstream tools can reliably parse results across
+// webchk versions.
+type jsonEnvelope struct {
+	SchemaVersion int               `json:"schema_version"`
+	Version       string            `json:"webchk_version"`
+	Options       Options           `json:"options"`
+	Start         time.Time         `json:"start"`
+	End           time.Time         `json:"end"`
+	Termination   string            `json:"termination"`
+	Scope         string            `json:"scope"` // describing the urls followed
+	Duration      string            `json:"duration"`
+	Pages         int               `json:"pages"`
+	Bytes         int64             `json:"bytes"`
+	Errors        int               `json:"errors"`
+	Broken        int               `json:"broken"`
+	Violations    int               `json:"violations"`
+	ErrorKinds    map[string]int    `json:"error_kinds"`
+	PeakQueue     int               `json:"peak_queue_depth"`
+	Dropped       int               `json:"dropped_links"` // as the link buffer was full
+	WorkerPages   []int             `json:"worker_pages,omitempty"`
+	RateWait      string            `json:"rate_wait"`  // total time workers waited for the rate limiter
+	FetchTime     string            `json:"fetch_time"` // total time workers spent fetching
+	Tags          map[string]string `json:"tags,omitempty"`
+	Results       []jsonResult      `json:"results"`
+}
+
+// newJSONEnvelope makes a jsonEnvelope from the run options, with their
+// secrets redacted, stats and results.
+func newJSONEnvelope(options Options, stats Stats, results []jsonResult) jsonEnvelope {
+	return jsonEnvelope{
+		SchemaVersion: SCHEMAVERSION,
+		Version:       version,
+		Options:       options.redacted(),
+		Start:         stats.Start,
+		End:           stats.End,
+		Termination:   stats.Termination,
+		Scope:         stats.Scope,
+		Duration:      stats.Duration.String(),
+		Pages:         stats.Pages,
+		Bytes:         stats.Bytes,
+		Errors:        stats.Errors,
+		Broken:        stats.Broken,
+		Violations:    stats.Violations,
+		ErrorKinds:    stats.ErrorKinds,
+		PeakQueue:     stats.PeakQueueDepth,
+		Dropped:       stats.Dropped,
+		WorkerPages:   stats.WorkerPages,
+		RateWait:      stats.RateWait.String(),
+		FetchTime:     stats.FetchTime.String(),
+		Tags:          options.tags(),
+		Results:       results,
+	}
+}
+
+// jsonSink is an OutputSink collecting results and writing them in a
+// jsonEnvelope when closed.
+type jsonSink struct {
+	w       closingWriter
+	options Options
+	results []jsonResult
+}
+
+// newJSONSink makes a new jsonSink writing to w
+func newJSONSink(w closingWriter, options Options) *jsonSink {
+	return &jsonSink{w: w, options: options, results: []jsonResult{}}
+}
+
+// Write records a result
+func (j *jsonSink) Write(r Result) error {
+	j.results = append(j.results, newJSONResult(r))
+	return nil
+}
+
+// Close writes the jsonEnvelope
+func (j *jsonSink) Close(stats Stats) error {
+	encoder := json.NewEncoder(j.w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(newJSONEnvelope(j.options, stats, j.results))
+	return errors.Join(err, j.w.close())
+}
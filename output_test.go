@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJSONSink(t *testing.T) {
+
+	results := make(chan Result, 3)
+	results <- Result{
+		url:      "https://example.com",
+		referrer: "/",
+		status:   200,
+		matches:  []SearchMatch{{3, "hi", 0}},
+	}
+	results <- Result{
+		url:        "https://example.com/gone",
+		referrer:   "https://example.com",
+		status:     404,
+		err:        StatusNotOk,
+		violations: []Violation{{"status", "status 404 want 200 (/)"}},
+	}
+	results <- Result{
+		url:      "https://example.com/slow",
+		referrer: "https://example.com",
+		err:      errors.New("timeout"),
+	}
+	close(results)
+
+	options := Options{SearchTerms: []string{"hi"}, JSON: true, Tags: []string{"env=staging"}}
+	options.Args.BaseURL = "https://example.com"
+	start := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	stats := Stats{
+		Pages:          3,
+		Bytes:          2048,
+		Errors:         1,
+		Broken:         1,
+		Violations:     1,
+		ErrorKinds:     map[string]int{"status 404": 1, "timeout": 1},
+		PeakQueueDepth: 7,
+		Start:          start,
+		End:            start.Add(90 * time.Second),
+		Duration:       90 * time.Second,
+		Termination:    TerminationIdle,
+		Scope:          "host: https urls on example.com",
+	}
+
+	var buf bytes.Buffer
+	sink := newJSONSink(closingWriter{Writer: &buf}, options)
+	if _, err := drain(results, sink, fakeStatser(stats)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var envelope jsonEnvelope
+	if err := json.Unmarshal(buf.Bytes(), &envelope); err != nil {
+		t.Fatalf("could not decode json: %v", err)
+	}
+	if got, want := envelope.SchemaVersion, SCHEMAVERSION; got != want {
+		t.Errorf("schema version got %d want %d", got, want)
+	}
+	if got, want := envelope.Version, version; got != want {
+		t.Errorf("version got %s want %s", got, want)
+	}
+	if got, want := envelope.Termination, TerminationIdle; got != want {
+		t.Errorf("termination got %s want %s", got, want)
+	}
+	if got, want := envelope.Scope, stats.Scope; got != want {
+		t.Errorf("scope got %s want %s", got, want)
+	}
+	if !envelope.Start.Equal(start) || !envelope.End.Equal(stats.End) {
+		t.Errorf("unexpected start/end %v %v", envelope.Start, envelope.End)
+	}
+	if got, want := envelope.Duration, "1m30s"; got != want {
+		t.Errorf("duration got %s want %s", got, want)
+	}
+	if diff := cmp.Diff(stats.ErrorKinds, envelope.ErrorKinds); diff != "" {
+		t.Errorf("error kinds mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"env": "staging"}, envelope.Tags); diff != "" {
+		t.Errorf("tags mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(options, envelope.Options); diff != "" {
+		t.Errorf("options mismatch (-want +got):\n%s", diff)
+	}
+	wantCounts := []int{3, 2048, 1, 1, 1, 7}
+	gotCounts := []int{envelope.Pages, int(envelope.Bytes), envelope.Errors, envelope.Broken, envelope.Violations, envelope.PeakQueue}
+	if diff := cmp.Diff(wantCounts, gotCounts); diff != "" {
+		t.Errorf("counts mismatch (-want +got):\n%s", diff)
+	}
+	wantResults := []jsonResult{
+		{
+			URL:        "https://example.com",
+			Referrer:   "/",
+			Status:     200,
+			Matches:    []jsonMatch{{3, "hi", 0}},
+			Violations: []jsonViolation{},
+		},
+		{
+			URL:        "https://example.com/gone",
+			Referrer:   "https://example.com",
+			Status:     404,
+			Matches:    []jsonMatch{},
+			Violations: []jsonViolation{{"status", "status 404 want 200 (/)"}},
+			Error:      "StatusNotOk",
+		},
+		{
+			URL:        "https://example.com/slow",
+			Referrer:   "https://example.com",
+			Matches:    []jsonMatch{},
+			Violations: []jsonViolation{},
+			Error:      "timeout",
+		},
+	}
+	if diff := cmp.Diff(wantResults, envelope.Results); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,272 @@
+// pac.go selects the proxy for each request with a proxy auto-config
+// (PAC) file, as used in enterprise environments whose proxy rules
+// cannot be expressed as a single proxy. The FindProxyForURL function of
+// the file is run by an embedded JavaScript engine with the standard PAC
+// functions, the date and time functions of which are in pacscript.go.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// PACMAXBYTES is the largest PAC file read
+const PACMAXBYTES = 1 << 20
+
+var (
+	// ErrPACScript reports a PAC file which cannot be parsed or run
+	ErrPACScript = errors.New("proxy auto-config script failed")
+	// ErrPACResult reports a FindProxyForURL result naming no usable
+	// proxy
+	ErrPACResult = errors.New("proxy auto-config gave no usable proxy")
+)
+
+// PACTIMEOUT is the longest a PAC script may run to choose the proxy of
+// a request, or to run its top level statements
+const PACTIMEOUT = time.Second
+
+// pacProxy selects proxies with a PAC script
+type pacProxy struct {
+	program  *goja.Program
+	runtimes sync.Pool // of *goja.Runtime, as a runtime is not safe for concurrent use
+	lookup   func(host string) ([]net.IP, error)
+	now      func() time.Time
+	myIP     string
+	dns      sync.Map // host to []net.IP, or nil if unresolvable
+	shExp    sync.Map // shell expression to *regexp.Regexp
+}
+
+// loadPAC loads a PAC file from a url or file name
+func loadPAC(location string) (*pacProxy, error) {
+	var body []byte
+	if u, err := url.Parse(location); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		client := &http.Client{Timeout: HTTPTIMEOUT}
+		resp, err := client.Get(location)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch pac file: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("could not fetch pac file: status %d", resp.StatusCode)
+		}
+		body, err = io.ReadAll(io.LimitReader(resp.Body, PACMAXBYTES))
+		if err != nil {
+			return nil, fmt.Errorf("could not read pac file: %w", err)
+		}
+	} else {
+		body, err = os.ReadFile(location)
+		if err != nil {
+			return nil, fmt.Errorf("could not read pac file: %w", err)
+		}
+	}
+	p, err := newPACProxy(string(body), net.LookupIP)
+	if err != nil {
+		return nil, fmt.Errorf("pac file %s: %w", location, err)
+	}
+	return p, nil
+}
+
+// newPACProxy makes a pacProxy from the source of a PAC script,
+// resolving host names with lookup. The script is compiled and its top
+// level statements run once, so that a script which cannot be parsed or
+// has no FindProxyForURL function is reported before the crawl starts.
+func newPACProxy(src string, lookup func(host string) ([]net.IP, error)) (*pacProxy, error) {
+	program, err := goja.Compile("proxy.pac", src, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPACScript, err)
+	}
+	p := &pacProxy{program: program, lookup: lookup, now: time.Now, myIP: localIPv4()}
+	vm, err := p.runtime()
+	if err != nil {
+		return nil, err
+	}
+	p.runtimes.Put(vm)
+	return p, nil
+}
+
+// runtime returns a runtime from the pool, or a new one which has run
+// the top level statements of the script
+func (p *pacProxy) runtime() (*goja.Runtime, error) {
+	if vm, ok := p.runtimes.Get().(*goja.Runtime); ok {
+		return vm, nil
+	}
+	vm := goja.New()
+	for name, f := range p.pacFunctions() {
+		if err := vm.Set(name, f); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrPACScript, err)
+		}
+	}
+	timer := time.AfterFunc(PACTIMEOUT, func() { vm.Interrupt("timed out") })
+	defer timer.Stop()
+	if _, err := vm.RunProgram(p.program); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPACScript, err)
+	}
+	if _, ok := goja.AssertFunction(vm.Get("FindProxyForURL")); !ok {
+		return nil, fmt.Errorf("%w: no FindProxyForURL function", ErrPACScript)
+	}
+	return vm, nil
+}
+
+// proxy returns the proxy for a request, or nil to connect directly,
+// meeting the http.Transport Proxy signature. Only the first usable
+// proxy of those listed by FindProxyForURL is used. A script which
+// fails for the request, or runs for longer than PACTIMEOUT, is
+// reported as an error of the request.
+func (p *pacProxy) proxy(req *http.Request) (*url.URL, error) {
+	vm, err := p.runtime()
+	if err != nil {
+		return nil, err
+	}
+	findProxy, _ := goja.AssertFunction(vm.Get("FindProxyForURL"))
+	timer := time.AfterFunc(PACTIMEOUT, func() { vm.Interrupt("timed out") })
+	result, err := findProxy(goja.Undefined(), vm.ToValue(req.URL.String()), vm.ToValue(req.URL.Hostname()))
+	if !timer.Stop() {
+		vm.ClearInterrupt()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: FindProxyForURL(%q): %w", ErrPACScript, req.URL.String(), err)
+	}
+	p.runtimes.Put(vm)
+	return parsePACResult(result.String())
+}
+
+// parsePACResult parses a FindProxyForURL result such as
+// "PROXY proxy.example.com:8080; DIRECT", returning the first usable
+// proxy, or nil for DIRECT
+func parsePACResult(result string) (*url.URL, error) {
+	schemes := map[string]string{"PROXY": "http", "HTTP": "http", "HTTPS": "https", "SOCKS": "socks5", "SOCKS5": "socks5"}
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		switch {
+		case len(fields) == 1 && strings.ToUpper(fields[0]) == "DIRECT":
+			return nil, nil
+		case len(fields) == 2 && schemes[strings.ToUpper(fields[0])] != "":
+			return &url.URL{Scheme: schemes[strings.ToUpper(fields[0])], Host: fields[1]}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrPACResult, result)
+}
+
+// resolve looks up the addresses of host, remembering the result
+func (p *pacProxy) resolve(host string) []net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}
+	}
+	if ips, ok := p.dns.Load(host); ok {
+		return ips.([]net.IP)
+	}
+	ips, err := p.lookup(host)
+	if err != nil {
+		ips = nil
+	}
+	p.dns.Store(host, ips)
+	return ips
+}
+
+// resolveIPv4 returns the first IPv4 address of host, or nil
+func (p *pacProxy) resolveIPv4(host string) net.IP {
+	for _, ip := range p.resolve(host) {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4
+		}
+	}
+	return nil
+}
+
+// shExpMatch reports whether s matches a shell expression, in which *
+// matches any characters and ? a single character
+func (p *pacProxy) shExpMatch(s, shExp string) bool {
+	re, ok := p.shExp.Load(shExp)
+	if !ok {
+		re = regexp.MustCompile(globToRegexp(shExp))
+		p.shExp.Store(shExp, re)
+	}
+	return re.(*regexp.Regexp).MatchString(s)
+}
+
+// pacFunctions returns the PAC functions, apart from the date and time
+// functions in pacscript.go, for setting in a runtime
+func (p *pacProxy) pacFunctions() map[string]any {
+	return map[string]any{
+		"isPlainHostName": func(host string) bool {
+			return !strings.Contains(host, ".")
+		},
+		"dnsDomainIs": func(host, domain string) bool {
+			return strings.HasSuffix(strings.ToLower(host), strings.ToLower(domain))
+		},
+		"localHostOrDomainIs": func(host, hostDomain string) bool {
+			host, hostDomain = strings.ToLower(host), strings.ToLower(hostDomain)
+			return host == hostDomain || (!strings.Contains(host, ".") && strings.HasPrefix(hostDomain, host+"."))
+		},
+		"isResolvable": func(host string) bool {
+			return len(p.resolve(host)) > 0
+		},
+		"isInNet": func(host, pattern, mask string) bool {
+			ip, patternIP, maskIP := p.resolveIPv4(host), net.ParseIP(pattern).To4(), net.ParseIP(mask).To4()
+			if ip == nil || patternIP == nil || maskIP == nil {
+				return false
+			}
+			m := net.IPMask(maskIP)
+			return ip.Mask(m).Equal(patternIP.Mask(m))
+		},
+		"dnsResolve": func(host string) any {
+			if ip := p.resolveIPv4(host); ip != nil {
+				return ip.String()
+			}
+			return nil
+		},
+		"myIpAddress": func() string {
+			return p.myIP
+		},
+		"dnsDomainLevels": func(host string) int {
+			return strings.Count(host, ".")
+		},
+		"shExpMatch": func(s, shExp string) bool {
+			return p.shExpMatch(s, shExp)
+		},
+		"weekdayRange": func(args ...any) bool {
+			return weekdayRange(p.now(), args)
+		},
+		"dateRange": func(args ...any) bool {
+			return dateRange(p.now(), args)
+		},
+		"timeRange": func(args ...any) bool {
+			return timeRange(p.now(), args)
+		},
+		"alert": func(...any) {},
+	}
+}
+
+// localIPv4 returns the first IPv4 address of this host which is not a
+// loopback address, or 127.0.0.1
+func localIPv4() string {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && !n.IP.IsLoopback() && n.IP.To4() != nil {
+				return n.IP.String()
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+// withProxy sets the getClient to connect through the proxy returned
+// for each request by proxy
+func (g *getClient) withProxy(proxy func(*http.Request) (*url.URL, error)) {
+	if t, ok := g.client.Transport.(*http.Transport); ok {
+		t.Proxy = proxy
+	}
+}
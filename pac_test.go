@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testPAC is a PAC file of the kind used in enterprise environments
+const testPAC = `
+var corporate = "PROXY proxy.corp.example:8080; DIRECT";
+var bypass = ["intranet.example", "corp.example"];
+
+function isBypassed(host) {
+	for (var i = 0; i < bypass.length; i++) {
+		if (dnsDomainIs(host, "." + bypass[i])) return true;
+	}
+	return false;
+}
+
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isPlainHostName(host) || isBypassed(host) ||
+		localHostOrDomainIs(host, "wiki.corp.example"))
+		return "DIRECT";
+	var ip = dnsResolve(host);
+	if (ip && isInNet(ip, "10.0.0.0", "255.0.0.0"))
+		return "DIRECT";
+	if (/^[0-9.]+$/.test(host))
+		return "DIRECT";
+	if (url.substring(0, 4) == "ftp:" || url.indexOf("/downloads/") >= 0 || dnsDomainLevels(host) > 3)
+		return "SOCKS socks.corp.example:1080";
+	switch (host.split(".").pop()) {
+	case "test":
+		return "PROXY test-proxy.corp.example:3128";
+	}
+	// the backup proxy takes over out of hours
+	return weekdayRange("MON", "FRI") && timeRange(8, 18) ? corporate : "PROXY backup.corp.example:8080";
+}
+`
+
+func TestPACProxy(t *testing.T) {
+
+	lookup := func(host string) ([]net.IP, error) {
+		if host == "build.example.com" {
+			return []net.IP{net.ParseIP("10.1.2.3")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	p, err := newPACProxy(testPAC, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a Wednesday morning
+	p.now = func() time.Time { return time.Date(2025, time.May, 14, 9, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://intranet/", ""},
+		{"https://hr.intranet.example/", ""},
+		{"http://wiki/page", ""},
+		{"http://build.example.com/", ""},
+		{"http://192.0.2.1/", ""},
+		{"https://www.example.com/downloads/file.zip", "socks5://socks.corp.example:1080"},
+		{"ftp://files.example.com/", "socks5://socks.corp.example:1080"},
+		{"https://a.b.c.example.com/", "socks5://socks.corp.example:1080"},
+		{"https://app.example.test/", "http://test-proxy.corp.example:3128"},
+		{"https://WWW.Example.com/", "http://proxy.corp.example:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			got, err := p.proxy(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+				t.Errorf("got %v want %q", got, tt.want)
+			}
+		})
+	}
+
+	// out of hours
+	p.now = func() time.Time { return time.Date(2025, time.May, 17, 9, 0, 0, 0, time.Local) }
+	req, _ := http.NewRequest(http.MethodGet, "https://www.example.com/", nil)
+	got, err := p.proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.String(), "http://backup.corp.example:8080"; got != want {
+		t.Errorf("saturday got %s want %s", got, want)
+	}
+}
+
+func TestPACScriptErrors(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		src     string
+		loadErr bool // else the error is of the request
+	}{
+		{"syntax error", `function FindProxyForURL(url, host) { return "DIRECT" `, true},
+		{"no function", `var proxy = "DIRECT";`, true},
+		{"top level error", `undefinedFunction(); function FindProxyForURL(url, host) { return "DIRECT" }`, true},
+		{"top level loop", `for (;;) {} function FindProxyForURL(url, host) { return "DIRECT" }`, true},
+		{"throws", `function FindProxyForURL(url, host) { throw "no proxy" }`, false},
+		{"loops", `function FindProxyForURL(url, host) { while (true) {} }`, false},
+		{"unknown function", `function FindProxyForURL(url, host) { return isResolvableEx(host) }`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newPACProxy(tt.src, net.LookupIP)
+			if got, want := err != nil, tt.loadErr; got != want {
+				t.Fatalf("load error got %v, want error %t", err, want)
+			}
+			if err == nil {
+				req, _ := http.NewRequest(http.MethodGet, "https://www.example.com/", nil)
+				_, err = p.proxy(req)
+			}
+			if !errors.Is(err, ErrPACScript) {
+				t.Errorf("got %v want %v", err, ErrPACScript)
+			}
+		})
+	}
+}
+
+func TestParsePACResult(t *testing.T) {
+
+	tests := []struct {
+		result string
+		want   string
+		err    error
+	}{
+		{"DIRECT", "", nil},
+		{"PROXY p:8080; DIRECT", "http://p:8080", nil},
+		{" HTTPS p:443 ", "https://p:443", nil},
+		{"SOCKS4 s:1080; SOCKS5 s:1081", "socks5://s:1081", nil},
+		{"", "", ErrPACResult},
+		{"BOGUS", "", ErrPACResult},
+	}
+	for _, tt := range tests {
+		t.Run(tt.result, func(t *testing.T) {
+			got, err := parsePACResult(tt.result)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v want %v", err, tt.err)
+			}
+			if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+				t.Errorf("got %v want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPAC(t *testing.T) {
+
+	pac := `function FindProxyForURL(url, host) { return "PROXY p:80" }`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/proxy.pac" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, pac)
+	}))
+	defer server.Close()
+	filename := filepath.Join(t.TempDir(), "proxy.pac")
+	if err := os.WriteFile(filename, []byte(pac), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	noFunction := filepath.Join(t.TempDir(), "empty.pac")
+	if err := os.WriteFile(noFunction, []byte(`var x = 1;`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		location string
+		isErr    bool
+	}{
+		{server.URL + "/proxy.pac", false},
+		{filename, false},
+		{server.URL + "/missing.pac", true},
+		{filepath.Join(t.TempDir(), "missing.pac"), true},
+		{noFunction, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			_, err := loadPAC(tt.location)
+			if got, want := err != nil, tt.isErr; got != want {
+				t.Errorf("got error %v, want error %t", err, want)
+			}
+		})
+	}
+}
+
+func TestGetClientPAC(t *testing.T) {
+
+	// an http proxy receives requests with absolute urls
+	proxied := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<p>via proxy</p>")
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	p, err := newPACProxy(fmt.Sprintf(`function FindProxyForURL(url, host) { return "PROXY %s" }`, proxyURL.Host), net.LookupIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGetClient(1, 0)
+	g.withProxy(p.proxy)
+	r, _ := g.getURL("http://www.example.invalid/page", "", []string{"proxy"})
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if got, want := proxied, "http://www.example.invalid/page"; got != want {
+		t.Errorf("proxy got %s want %s", got, want)
+	}
+	if got, want := len(r.matches), 1; got != want {
+		t.Errorf("got %d want %d matches", got, want)
+	}
+}
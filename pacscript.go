@@ -0,0 +1,155 @@
+// pacscript.go provides the date and time functions of proxy
+// auto-config (PAC) files, weekdayRange, dateRange and timeRange, to the
+// JavaScript engine running them. Each takes the current time, and the
+// arguments given by the script, which end with "GMT" for the time in
+// UTC rather than local time. A range whose start is after its end wraps
+// around, so that weekdayRange("FRI", "MON") covers the weekend.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pacWeekdays and pacMonths are the names of the days and months in PAC
+// files
+var (
+	pacWeekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+	pacMonths   = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+)
+
+// pacTime returns now in UTC if the last argument is "GMT", and the
+// arguments without it
+func pacTime(now time.Time, args []any) (time.Time, []any) {
+	if n := len(args); n > 0 && strings.EqualFold(fmt.Sprint(args[n-1]), "GMT") {
+		return now.UTC(), args[:n-1]
+	}
+	return now, args
+}
+
+// pacNumber returns an argument as an integer, reporting whether it is
+// one
+func pacNumber(arg any) (int, bool) {
+	switch n := arg.(type) {
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), n == float64(int(n))
+	}
+	return 0, false
+}
+
+// inPACRange reports whether v is between start and end inclusively,
+// wrapping around if start is after end
+func inPACRange(v, start, end int) bool {
+	if start <= end {
+		return start <= v && v <= end
+	}
+	return v >= start || v <= end
+}
+
+// weekdayRange reports whether now is on the day, or between the days,
+// given as SUN to SAT
+func weekdayRange(now time.Time, args []any) bool {
+	now, args = pacTime(now, args)
+	if len(args) < 1 || len(args) > 2 {
+		return false
+	}
+	days := []int{}
+	for _, a := range args {
+		day := slices.Index(pacWeekdays, strings.ToUpper(fmt.Sprint(a)))
+		if day < 0 {
+			return false
+		}
+		days = append(days, day)
+	}
+	return inPACRange(int(now.Weekday()), days[0], days[len(days)-1])
+}
+
+// pacDate parses the parts of a date given to dateRange, returning the
+// kinds of the parts given, such as "md" for a month and day, and the
+// date as a comparable number of those parts
+func pacDate(parts []any) (string, int, bool) {
+	var kinds string
+	var year, month, day int
+	for _, part := range parts {
+		n, isNumber := pacNumber(part)
+		m := slices.Index(pacMonths, strings.ToUpper(fmt.Sprint(part)))
+		switch {
+		case isNumber && n >= 1 && n <= 31:
+			kinds, day = kinds+"d", n
+		case isNumber && n > 31:
+			kinds, year = kinds+"y", n
+		case m >= 0:
+			kinds, month = kinds+"m", m+1
+		default:
+			return "", 0, false
+		}
+	}
+	return kinds, year*10000 + month*100 + day, true
+}
+
+// dateRange reports whether now is on the date, or between the dates,
+// given as days of the month (1 to 31), months (JAN to DEC) and four
+// digit years, such as dateRange(1, "JAN", 31, "MAR") or
+// dateRange("DEC", 2024, "JAN", 2025). Only the parts of now given are
+// compared, so that dateRange("MAY") covers the month.
+func dateRange(now time.Time, args []any) bool {
+	now, args = pacTime(now, args)
+	if len(args) == 0 || len(args) > 6 || (len(args) > 1 && len(args)%2 != 0) {
+		return false
+	}
+	half := max(len(args)/2, 1)
+	kinds, start, ok := pacDate(args[:half])
+	if !ok {
+		return false
+	}
+	endKinds, end, ok := pacDate(args[len(args)-half:])
+	if !ok || endKinds != kinds {
+		return false
+	}
+	current := []any{}
+	for _, kind := range kinds {
+		switch kind {
+		case 'd':
+			current = append(current, int64(now.Day()))
+		case 'y':
+			current = append(current, int64(now.Year()))
+		case 'm':
+			current = append(current, pacMonths[now.Month()-1])
+		}
+	}
+	_, today, _ := pacDate(current)
+	return inPACRange(today, start, end)
+}
+
+// timeRange reports whether now is within the hour, or between the
+// times, given as hours, hours and minutes, or hours, minutes and
+// seconds, such as timeRange(9, 17) or timeRange(8, 30, 17, 0). The end
+// time is included, to the end of its hour or minute.
+func timeRange(now time.Time, args []any) bool {
+	now, args = pacTime(now, args)
+	numbers := []int{}
+	for _, a := range args {
+		n, ok := pacNumber(a)
+		if !ok {
+			return false
+		}
+		numbers = append(numbers, n)
+	}
+	seconds := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	switch len(numbers) {
+	case 1:
+		return now.Hour() == numbers[0]
+	case 2:
+		return inPACRange(seconds, numbers[0]*3600, numbers[1]*3600+3599)
+	case 4:
+		return inPACRange(seconds, numbers[0]*3600+numbers[1]*60, numbers[2]*3600+numbers[3]*60+59)
+	case 6:
+		return inPACRange(seconds, numbers[0]*3600+numbers[1]*60+numbers[2], numbers[3]*3600+numbers[4]*60+numbers[5])
+	}
+	return false
+}
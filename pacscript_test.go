@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPACDateTimeFunctions(t *testing.T) {
+
+	// a Wednesday afternoon, an hour behind UTC
+	zone := time.FixedZone("test", -3600)
+	now := time.Date(2025, time.May, 14, 14, 30, 15, 0, zone)
+
+	tests := []struct {
+		name string
+		f    func(time.Time, []any) bool
+		args []any
+		want bool
+	}{
+		{"weekday", weekdayRange, []any{"WED"}, true},
+		{"weekday other", weekdayRange, []any{"THU"}, false},
+		{"weekdays", weekdayRange, []any{"MON", "FRI"}, true},
+		{"weekend wraps", weekdayRange, []any{"SAT", "MON"}, false},
+		{"weekdays wrap", weekdayRange, []any{"FRI", "WED"}, true},
+		{"weekday gmt", weekdayRange, []any{"WED", "GMT"}, true},
+		{"weekday unknown", weekdayRange, []any{"XYZ"}, false},
+		{"weekday no args", weekdayRange, nil, false},
+
+		{"day", dateRange, []any{int64(14)}, true},
+		{"month", dateRange, []any{"MAY"}, true},
+		{"year", dateRange, []any{int64(2024)}, false},
+		{"days", dateRange, []any{int64(1), int64(15)}, true},
+		{"months", dateRange, []any{"JAN", "APR"}, false},
+		{"months wrap", dateRange, []any{"NOV", "JUN"}, true},
+		{"day month", dateRange, []any{int64(1), "MAY", int64(14), "MAY"}, true},
+		{"day month after", dateRange, []any{int64(15), "MAY", int64(31), "MAY"}, false},
+		{"month year", dateRange, []any{"DEC", int64(2024), "JAN", int64(2026)}, true},
+		{"full dates", dateRange, []any{int64(1), "JAN", int64(2025), int64(13), "MAY", int64(2025)}, false},
+		{"mixed parts", dateRange, []any{int64(1), "MAY"}, false},
+		{"date gmt", dateRange, []any{int64(14), "GMT"}, true},
+		{"date odd args", dateRange, []any{int64(1), "MAY", int64(14)}, false},
+
+		{"hour", timeRange, []any{int64(14)}, true},
+		{"hour gmt", timeRange, []any{int64(15), "GMT"}, true},
+		{"hours", timeRange, []any{int64(9), int64(14)}, true},
+		{"hours before", timeRange, []any{int64(9), int64(13)}, false},
+		{"hours wrap", timeRange, []any{int64(22), int64(6)}, false},
+		{"minutes", timeRange, []any{int64(14), int64(0), int64(14), int64(30)}, true},
+		{"minutes after", timeRange, []any{int64(14), int64(31), int64(17), int64(0)}, false},
+		{"seconds", timeRange, []any{int64(14), int64(30), int64(0), int64(14), int64(30), int64(10)}, false},
+		{"float hours", timeRange, []any{9.0, 17.0}, true},
+		{"bad args", timeRange, []any{int64(9), int64(0), int64(17)}, false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d_%s", i, tt.name), func(t *testing.T) {
+			if got := tt.f(now, tt.args); got != tt.want {
+				t.Errorf("%v got %t want %t", tt.args, got, tt.want)
+			}
+		})
+	}
+}
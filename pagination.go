@@ -0,0 +1,52 @@
+// pagination.go detects the links to the next page of paginated
+// listings, which are followed with their query strings, as pages such
+// as ?page=2 would otherwise be stripped to the first page and skipped.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// nextPageText matches the text or aria-label of links to the next page
+// of a listing, such as "Next", "Next page »" or "Older posts"
+var nextPageText = regexp.MustCompile(`(?i)^(next(\s+page)?|older(\s+(posts|entries))?)?\s*[»›→>]*$`)
+
+// isNextPageText reports whether the text of a link marks it as a link
+// to the next page
+func isNextPageText(text string) bool {
+	text = strings.TrimSpace(text)
+	return text != "" && nextPageText.MatchString(text)
+}
+
+// isNextRel reports whether a rel attribute includes next
+func isNextRel(rel string) bool {
+	return slices.Contains(strings.Fields(strings.ToLower(rel)), "next")
+}
+
+// pageLabel labels the results of the pages of a paginated listing
+// after the first with their page number
+func pageLabel(r Result) string {
+	if r.page == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (page %d)", r.page)
+}
+
+// resolvePageLink resolves the link to a page of a listing against the
+// url of the page it was found on, removing any fragment but keeping
+// the query, with its percent-encoding normalised, reporting false for
+// links which cannot be parsed
+func resolvePageLink(url *url.URL, link string) (string, bool) {
+	linkURL, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", false
+	}
+	normalisePercent(linkURL)
+	linkURL.Fragment = ""
+	return linkURL.String(), true
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/goleak"
+)
+
+func TestIsNextPageText(t *testing.T) {
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"Next", true},
+		{" next page ", true},
+		{"Next »", true},
+		{"›", true},
+		{"Older posts", true},
+		{"older entries →", true},
+		{"", false},
+		{"Nextcloud", false},
+		{"Read the next chapter", false},
+		{"Previous", false},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			if got := isNextPageText(tt.text); got != tt.want {
+				t.Errorf("%q got %t want %t", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePageNext(t *testing.T) {
+
+	pageURL, err := url.Parse("https://e.com/blog/?page=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		body string
+		next []string
+	}{
+		{
+			body: `<head><link rel="next" href="/blog/?page=2"></head>`,
+			next: []string{"https://e.com/blog/?page=2"},
+		},
+		{
+			body: `<a href="?page=2#top" rel="Next nofollow">2</a>`,
+			next: []string{"https://e.com/blog/?page=2"},
+		},
+		{
+			body: `<a href="/blog/?page=2"><span>Next</span> &raquo;</a>`,
+			next: []string{"https://e.com/blog/?page=2"},
+		},
+		{
+			body: `<a href="/blog/?page=2" aria-label="Next page"><svg/></a>`,
+			next: []string{"https://e.com/blog/?page=2"},
+		},
+		{
+			body: `<a href="/blog/?page=0">Previous</a><a href="/blog/next-steps">Next steps</a>`,
+			next: []string{},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			page, err := parsePage([]byte(tt.body), pageURL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.next, page.next); diff != "" {
+				t.Errorf("next mismatch (-want +got):\n%s", diff)
+			}
+			for _, n := range page.next {
+				if !slices.Contains(page.links, n) {
+					t.Errorf("next link %s not in links %v", n, page.links)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcherPagination(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	// a listing of three pages, whose page links would otherwise all be
+	// stripped to the listing url
+	getURLer := func(u, referrer string, searchTerms []string) (Result, []string) {
+		r := Result{url: u, status: 200, matches: []SearchMatch{}}
+		n := 1
+		if _, after, ok := strings.Cut(u, "?page="); ok {
+			fmt.Sscan(after, &n)
+		}
+		if n < 3 {
+			next := fmt.Sprintf("https://example.com/list?page=%d", n+1)
+			r.next = []string{next}
+			return r, []string{next, "https://example.com/list"}
+		}
+		return r, []string{"https://example.com/list"}
+	}
+	gc := NewGetClient(2, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	d := NewDispatch("https://example.com",
+		WithWorkers(2),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+	)
+	got := []string{}
+	for r := range d.Dispatcher() {
+		got = append(got, r.url+pageLabel(r))
+	}
+	slices.Sort(got)
+	want := []string{
+		"https://example.com",
+		"https://example.com/list",
+		"https://example.com/list?page=2 (page 2)",
+		"https://example.com/list?page=3 (page 3)",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,114 @@
+// patterns.go reads files of url patterns, such as lists of sections to
+// include in or exclude from a crawl maintained by content teams.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// urlPattern is a regular expression matched against a url, or only
+// against its path
+type urlPattern struct {
+	re     *regexp.Regexp
+	isPath bool
+}
+
+// urlPatterns is a list of patterns which urls are matched against
+type urlPatterns []urlPattern
+
+// loadURLPatterns loads urlPatterns from filename
+func loadURLPatterns(filename string) (urlPatterns, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open pattern file: %w", err)
+	}
+	defer f.Close()
+	patterns, err := parseURLPatterns(f)
+	if err != nil {
+		return nil, fmt.Errorf("pattern file %s: %w", filename, err)
+	}
+	return patterns, nil
+}
+
+// parseURLPatterns reads one pattern per line from r. Blank lines and
+// lines starting with # are ignored. Lines starting with "re:" are
+// regular expressions matched anywhere in the full url. Other lines are
+// globs matched against the whole url path, where * matches any run of
+// characters (including /) and ? matches a single character.
+func parseURLPatterns(r io.Reader) (urlPatterns, error) {
+	patterns := urlPatterns{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		expr, isRegexp := strings.CutPrefix(line, "re:")
+		if !isRegexp {
+			expr = globToRegexp(line)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		patterns = append(patterns, urlPattern{re: re, isPath: !isRegexp})
+	}
+	return patterns, scanner.Err()
+}
+
+// globToRegexp converts a glob to a regular expression matching a url
+// path
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// match reports whether u matches any of the patterns
+func (p urlPatterns) match(u string) bool {
+	path := u
+	if parsed, err := url.Parse(u); err == nil {
+		path = parsed.Path
+	}
+	for _, pattern := range p {
+		if pattern.isPath && pattern.re.MatchString(path) {
+			return true
+		}
+		if !pattern.isPath && pattern.re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludeFilter is a URLFilter following urls not matching patterns
+func excludeFilter(patterns urlPatterns) URLFilter {
+	return URLFilterFunc(func(u string) bool {
+		return !patterns.match(u)
+	})
+}
+
+// includeFilter is a URLFilter following only urls matching patterns
+func includeFilter(patterns urlPatterns) URLFilter {
+	return URLFilterFunc(patterns.match)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseURLPatterns(t *testing.T) {
+
+	file := `
+# tag and archive pages
+/tag/*
+/archive/????
+re:[?&]page=\d+$
+re:\.pdf$
+`
+	patterns, err := parseURLPatterns(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(patterns), 4; got != want {
+		t.Fatalf("got %d want %d patterns", got, want)
+	}
+
+	urls := []string{
+		"https://example.com/tag/go",
+		"https://example.com/tag/go/page/2",
+		"https://example.com/blog/tag/go", // globs match the whole path
+		"https://example.com/archive/2020",
+		"https://example.com/archive/2020/01",
+		"https://example.com/list?page=3",
+		"https://example.com/files/report.pdf",
+		"https://example.com/about",
+	}
+	got := []bool{}
+	for _, u := range urls {
+		got = append(got, patterns.match(u))
+	}
+	want := []bool{true, true, false, true, false, true, true, false}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("match mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := parseURLPatterns(strings.NewReader("/ok\nre:(\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected line 2 error, got %v", err)
+	}
+}
+
+func TestURLPatternFilters(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "patterns.txt")
+	if err := os.WriteFile(file, []byte("/blog/*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	patterns, err := loadURLPatterns(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	include, exclude := includeFilter(patterns), excludeFilter(patterns)
+	for _, tt := range []struct {
+		url     string
+		include bool
+	}{
+		{"https://example.com/blog/a", true},
+		{"https://example.com/about", false},
+	} {
+		if got := include.Follow(tt.url); got != tt.include {
+			t.Errorf("include %s got %t want %t", tt.url, got, tt.include)
+		}
+		if got := exclude.Follow(tt.url); got != !tt.include {
+			t.Errorf("exclude %s got %t want %t", tt.url, got, !tt.include)
+		}
+	}
+
+	if _, err := loadURLPatterns(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -0,0 +1,68 @@
+// percent.go normalises the percent-encoding of urls as described in
+// RFC 3986 section 6.2.2, so that urls written with %7Euser, %7euser
+// and ~user are treated as the same url.
+
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// isUnreserved reports whether c is an unreserved character of RFC
+// 3986, which is never percent-encoded in a normalised url
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// unhex returns the value of the hex digit c, or -1 if c is not one
+func unhex(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c - 'a' + 10)
+	case 'A' <= c && c <= 'F':
+		return int(c - 'A' + 10)
+	}
+	return -1
+}
+
+// normaliseEscapes returns s with the percent-encoded unreserved
+// characters decoded and the hex digits of the other percent-encodings
+// in uppercase. Percent signs not followed by two hex digits are left
+// as they are.
+func normaliseEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || unhex(s[i+1]) < 0 || unhex(s[i+2]) < 0 {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := byte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// normalisePercent normalises the percent-encoding of the path and
+// query of u with normaliseEscapes
+func normalisePercent(u *url.URL) {
+	if path := normaliseEscapes(u.EscapedPath()); path != u.EscapedPath() {
+		if p, err := url.PathUnescape(path); err == nil {
+			u.Path, u.RawPath = p, path
+		}
+	}
+	u.RawQuery = normaliseEscapes(u.RawQuery)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNormaliseEscapes(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"", ""},
+		{"/~user", "/~user"},
+		// unreserved characters are decoded (RFC 3986 section 2.3)
+		{"/%7Euser", "/~user"},
+		{"/%7euser", "/~user"},
+		{"/%41%62%63%2D%2e%5F%30", "/Abc-._0"},
+		// other percent-encodings have uppercase hex (section 6.2.2.1)
+		{"/a%2fb", "/a%2Fb"},
+		{"/caf%c3%a9", "/caf%C3%A9"},
+		{"/a%20b", "/a%20b"},
+		{"/%3a%40%21", "/%3A%40%21"},
+		{"q=a%3db&r=%7e", "q=a%3Db&r=~"},
+		// malformed percent signs are left as they are
+		{"/100%", "/100%"},
+		{"/%4", "/%4"},
+		{"/%zz%7E", "/%zz~"},
+	} {
+		if got := normaliseEscapes(tt.in); got != tt.want {
+			t.Errorf("%q: got %q want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormaliseURLPercent(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"http://example.com/%7Euser", "http://example.com/~user"},
+		{"http://example.com/~user", "http://example.com/~user"},
+		{"http://example.com/a%2fb/%7ec", "http://example.com/a%2Fb/~c"},
+		{"http://example.com/caf%c3%a9?q=%e2%82%ac", "http://example.com/caf%C3%A9?q=%E2%82%AC"},
+		{"http://example.com/café", "http://example.com/café"}, // unchanged, as already normal
+		{"http://münchen.example/%7Ea", "http://xn--mnchen-3ya.example/~a"},
+	} {
+		if got := normaliseURL(tt.in); got != tt.want {
+			t.Errorf("%s: got %s want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResolveLinkPercent(t *testing.T) {
+	base, _ := url.Parse("https://example.com/dir/")
+	for _, tt := range []struct {
+		link, want string
+		page       bool // resolved as the link to a page of a listing
+	}{
+		{"%7Euser/", "https://example.com/dir/~user", false},
+		{"/%7euser", "https://example.com/~user", false},
+		{"/a%2fb", "https://example.com/a%2Fb", false},
+		{"/list?page=%32&q=%c3%a9", "https://example.com/list?page=2&q=%C3%A9", true},
+	} {
+		resolve := resolveLink
+		if tt.page {
+			resolve = resolvePageLink
+		}
+		if got, ok := resolve(base, tt.link); !ok || got != tt.want {
+			t.Errorf("%s: got %s %t want %s", tt.link, got, ok, tt.want)
+		}
+	}
+}
+
+func TestFollowURLsPercent(t *testing.T) {
+	f := followURLs(hostScope("http://x.com"), newVisitedSet(), nil, urlSchemesToFollow)
+	for _, tt := range []struct {
+		url string
+		ok  bool
+	}{
+		{"http://x.com/~user", true},
+		{"http://x.com/%7Euser", false},
+		{"http://x.com/%7euser", false},
+		{"http://x.com/a%2fb", true},
+		{"http://x.com/a%2Fb", false},
+		{"http://x.com/a/b", true}, // an encoded slash is not a slash
+	} {
+		if got := f(tt.url); got != tt.ok {
+			t.Errorf("%s: got %t want %t", tt.url, got, tt.ok)
+		}
+	}
+}
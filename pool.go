@@ -0,0 +1,85 @@
+// pool.go keeps the http transports of crawls between runs in serve
+// mode, so that successive crawls of a site reuse its open connections
+// rather than making them again, which saves the dns lookups and tcp
+// and tls handshakes of each connection at the start of every run.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// POOLIDLETIMEOUT is how long the idle connections of a pooled
+// transport are kept open between crawls
+const POOLIDLETIMEOUT time.Duration = 5 * time.Minute
+
+// transportPool holds a transport for each site crawled, by the
+// settings which make its connections. It is safe for concurrent use.
+type transportPool struct {
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+// newTransportPool makes an empty transportPool
+func newTransportPool() *transportPool {
+	return &transportPool{transports: map[string]*http.Transport{}}
+}
+
+// transport returns the pooled transport for key, or adds t to the
+// pool for key if there is none, keeping its idle connections for
+// POOLIDLETIMEOUT. A nil transportPool always returns t.
+func (p *transportPool) transport(key string, t *http.Transport) *http.Transport {
+	if p == nil {
+		return t
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pooled, ok := p.transports[key]; ok {
+		return pooled
+	}
+	t.IdleConnTimeout = POOLIDLETIMEOUT
+	p.transports[key] = t
+	return t
+}
+
+// has reports whether the pool holds a transport for key. A nil
+// transportPool holds none.
+func (p *transportPool) has(key string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.transports[key]
+	return ok
+}
+
+// close closes the idle connections of the pooled transports
+func (p *transportPool) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.transports {
+		t.CloseIdleConnections()
+	}
+}
+
+// poolKey returns the key of the transport of a crawl with the
+// options: the scheme and host of the base url together with the
+// options deciding how its connections are made
+func (o Options) poolKey() string {
+	site := o.Args.BaseURL
+	if u, err := url.Parse(o.Args.BaseURL); err == nil {
+		site = strings.ToLower(u.Scheme + "://" + u.Host)
+	}
+	return fmt.Sprintf("%s %d %q %q %q %s %s %t",
+		site, o.HTTPWorkers, o.HostHeader, o.UnixSocket, o.PAC, o.DNSCacheTTL, o.ConnTimeout, o.IPv4Only,
+	)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransportPool(t *testing.T) {
+
+	var nilPool *transportPool
+	t1 := NewTransport(2)
+	if got := nilPool.transport("a", t1); got != t1 {
+		t.Error("nil pool did not return the transport")
+	}
+	nilPool.close()
+
+	pool := newTransportPool()
+	if got := pool.transport("a", t1); got != t1 {
+		t.Error("first transport not pooled")
+	}
+	if got, want := t1.IdleConnTimeout, POOLIDLETIMEOUT; got != want {
+		t.Errorf("idle timeout got %s want %s", got, want)
+	}
+	if got := pool.transport("a", NewTransport(2)); got != t1 {
+		t.Error("pooled transport not reused")
+	}
+	if got := pool.transport("b", NewTransport(2)); got == t1 {
+		t.Error("transport reused for another key")
+	}
+	pool.close()
+}
+
+func TestPoolKey(t *testing.T) {
+
+	key := func(baseURL string, modify func(o *Options)) string {
+		o := Options{HTTPWorkers: 8}
+		o.Args.BaseURL = baseURL
+		if modify != nil {
+			modify(&o)
+		}
+		return o.poolKey()
+	}
+	base := key("https://example.com", nil)
+	for _, same := range []string{key("https://EXAMPLE.com/blog/", nil), key("https://example.com?x=1", nil)} {
+		if same != base {
+			t.Errorf("got key %s want %s", same, base)
+		}
+	}
+	for i, different := range []string{
+		key("http://example.com", nil),
+		key("https://example.com:8443", nil),
+		key("https://blog.example.com", nil),
+		key("https://example.com", func(o *Options) { o.HTTPWorkers = 2 }),
+		key("https://example.com", func(o *Options) { o.HostHeader = "www.example.com" }),
+		key("https://example.com", func(o *Options) { o.UnixSocket = "/run/site.sock" }),
+		key("https://example.com", func(o *Options) { o.PAC = "proxy.pac" }),
+		key("https://example.com", func(o *Options) { o.DNSCacheTTL = time.Hour }),
+		key("https://example.com", func(o *Options) { o.ConnTimeout = time.Second }),
+		key("https://example.com", func(o *Options) { o.IPv4Only = true }),
+	} {
+		if different == base {
+			t.Errorf("%d: got the same key %s", i, base)
+		}
+	}
+}
+
+func TestCrawlReusesConnections(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `hello <a href="/a">a</a> <a href="/b">b</a>`)
+	})
+	server := httptest.NewUnstartedServer(mux)
+	var connections atomic.Int32
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	options := Options{
+		SearchTerms: []string{"hello"},
+		QuerySec:    1000,
+		HTTPWorkers: 1,
+		IdleTimeout: 100 * time.Millisecond,
+		Output:      []string{"csv:" + filepath.Join(t.TempDir(), "out.csv")},
+	}
+	options.Args.BaseURL = server.URL
+
+	var buf strings.Builder
+	diagnostics = &buf
+	defer func() { diagnostics = os.Stderr }()
+
+	pool := newTransportPool()
+	defer pool.close()
+	for run := range 3 {
+		stats, err := crawl(options, pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := stats.Pages, 3; got != want {
+			t.Errorf("run %d got %d want %d pages", run, got, want)
+		}
+	}
+	// robots.txt and the pages of every run are fetched over the
+	// connection made by the first
+	if got, want := connections.Load(), int32(1); got != want {
+		t.Errorf("got %d want %d connections", got, want)
+	}
+}
+
+func TestCrawlPooledPAC(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `hello <a href="/a">a</a> <a href="/b">b</a> <a href="/c">c</a>`)
+	}))
+	defer server.Close()
+	var pacFetches atomic.Int32
+	pacServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pacFetches.Add(1)
+		fmt.Fprint(w, `function FindProxyForURL(url, host) { return "DIRECT" }`)
+	}))
+	defer pacServer.Close()
+
+	options := Options{
+		SearchTerms: []string{"hello"},
+		QuerySec:    1000,
+		HTTPWorkers: 2,
+		IdleTimeout: 100 * time.Millisecond,
+		PAC:         pacServer.URL + "/proxy.pac",
+	}
+	options.Args.BaseURL = server.URL
+
+	var buf strings.Builder
+	diagnostics = &buf
+	defer func() { diagnostics = os.Stderr }()
+
+	pool := newTransportPool()
+	defer pool.close()
+	if _, err := crawl(options, pool); err != nil {
+		t.Fatal(err)
+	}
+	// crawls sharing the pooled transport run alongside each other, as
+	// in serve mode
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats, err := crawl(options, pool)
+			if err == nil && stats.Pages != 4 {
+				err = fmt.Errorf("got %d want 4 pages", stats.Pages)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if got, want := pacFetches.Load(), int32(1); got != want {
+		t.Errorf("got %d want %d fetches of the pac file", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+// postgres.go writes runs and results to a Postgres database for the
+// warehouse sink, using the pure go github.com/lib/pq driver.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresSchema is the Postgres schema, made if it does not exist
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS webchk_runs (
+	id          BIGINT PRIMARY KEY,
+	baseurl     TEXT NOT NULL,
+	start_time  TIMESTAMPTZ,
+	end_time    TIMESTAMPTZ,
+	termination TEXT,
+	pages       INTEGER,
+	errors      INTEGER,
+	broken      INTEGER,
+	violations  INTEGER,
+	bytes       BIGINT,
+	tags        JSONB
+);
+CREATE TABLE IF NOT EXISTS webchk_results (
+	run_id       BIGINT NOT NULL,
+	url          TEXT NOT NULL,
+	referrer     TEXT,
+	status       INTEGER,
+	error        TEXT,
+	error_kind   TEXT,
+	content_type TEXT,
+	size         INTEGER,
+	elapsed_ms   BIGINT,
+	depth        INTEGER,
+	worker       INTEGER,
+	matches      INTEGER,
+	terms        TEXT,
+	violations   INTEGER,
+	fetched_at   TIMESTAMPTZ,
+	tags         JSONB
+);
+CREATE INDEX IF NOT EXISTS webchk_results_run_id ON webchk_results(run_id);
+`
+
+// postgresResultColumns are the columns of webchk_results written
+var postgresResultColumns = []string{
+	"run_id", "url", "referrer", "status", "error", "error_kind", "content_type", "size",
+	"elapsed_ms", "depth", "worker", "matches", "terms", "violations", "fetched_at",
+	"tags",
+}
+
+// postgresWriter is a warehouseWriter writing to a Postgres database
+type postgresWriter struct {
+	db *sql.DB
+}
+
+// newPostgresSink connects to the Postgres database given by dsn, a url
+// such as postgres://webchk@db.example.com/analytics or key=value
+// settings, making the schema if it does not exist. A password may be
+// given by $PGPASSWORD rather than in the dsn.
+func newPostgresSink(dsn string, options Options) (*warehouseSink, error) {
+	db, err := openPostgres(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return newWarehouseSink("postgres", &postgresWriter{db: db}, options), nil
+}
+
+// openPostgres opens the database given by dsn and makes the schema
+func openPostgres(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("could not open postgres database: %w", err)
+	}
+	if _, err := db.Exec(postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create postgres schema: %w", err)
+	}
+	return db, nil
+}
+
+// postgresInsert returns an INSERT statement of rows rows of columns
+// into table, with numbered placeholders
+func postgresInsert(table string, columns []string, rows int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", table, strings.Join(columns, ", "))
+	n := 1
+	for i := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j := range columns {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", n)
+			n++
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// postgresTags returns tags as a jsonb value, or NULL if there are none
+func postgresTags(tags map[string]string) sql.NullString {
+	s := tagsJSON(tags)
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// writeResults writes results in a single statement
+func (p *postgresWriter) writeResults(results []warehouseResult) error {
+	args := make([]any, 0, len(results)*len(postgresResultColumns))
+	for _, r := range results {
+		args = append(args,
+			r.RunID, r.URL, r.Referrer, r.Status, r.Error, r.ErrorKind, r.ContentType, r.Size,
+			r.ElapsedMS, r.Depth, r.Worker, r.Matches, r.Terms, r.Violations, r.FetchedAt,
+			postgresTags(r.Tags),
+		)
+	}
+	_, err := p.db.Exec(postgresInsert("webchk_results", postgresResultColumns, len(results)), args...)
+	return err
+}
+
+// writeRun writes the run
+func (p *postgresWriter) writeRun(run warehouseRun) error {
+	_, err := p.db.Exec(
+		`INSERT INTO webchk_runs (id, baseurl, start_time, end_time, termination, pages, errors, broken, violations, bytes, tags)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		run.ID, run.BaseURL, run.Start, run.End, run.Termination,
+		run.Pages, run.Errors, run.Broken, run.Violations, run.Bytes, postgresTags(run.Tags),
+	)
+	return err
+}
+
+// close closes the database
+func (p *postgresWriter) close() error {
+	return p.db.Close()
+}
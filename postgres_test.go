@@ -0,0 +1,12 @@
+package main
+
+import "testing"
+
+func TestPostgresInsert(t *testing.T) {
+
+	got := postgresInsert("t", []string{"a", "b"}, 3)
+	want := "INSERT INTO t (a, b) VALUES ($1, $2), ($3, $4), ($5, $6)"
+	if got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,147 @@
+// preset.go provides named presets of options for common tasks, such as
+// a polite crawl of a fragile site or a link check, selected with
+// --preset. Presets are built in or defined in a yaml file given with
+// --config, and set only the options not given on the command line.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrUnknownPreset reports a preset which is neither built in nor
+	// defined in the config file
+	ErrUnknownPreset = errors.New("unknown preset")
+	// ErrPresetOption reports a preset setting an option which does not
+	// exist or cannot be preset
+	ErrPresetOption = errors.New("preset sets an unknown option")
+)
+
+// preset maps the long names of options to their values: a string,
+// number or bool, or a list for options which can be given more than
+// once
+type preset map[string]any
+
+// builtinPresets are the presets available without a config file
+var builtinPresets = map[string]preset{
+	"polite": {
+		"querysec":     2,
+		"workers":      2,
+		"httpworkers":  2,
+		"idle-timeout": "10s",
+		"timeout":      "30m",
+	},
+	"aggressive": {
+		"querysec":           100,
+		"workers":            32,
+		"httpworkers":        32,
+		"buffersize":         20000,
+		"ignore-crawl-delay": true,
+	},
+	"seo-audit": {
+		"sitemaps":    true,
+		"noindex":     "separate",
+		"readability": true,
+		"index-docs":  []any{"index.html", "index.php"},
+		"top":         10,
+	},
+	"link-check": {
+		"assets":   true,
+		"group-by": "referrer",
+		"sort":     true,
+	},
+}
+
+// presetFile is the layout of the config file
+type presetFile struct {
+	Presets map[string]preset `yaml:"presets"`
+}
+
+// loadPresets returns the built in presets and those in the config file
+// filename, if given, which replace built in presets of the same name
+func loadPresets(filename string) (map[string]preset, error) {
+	presets := maps.Clone(builtinPresets)
+	if filename == "" {
+		return presets, nil
+	}
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+	var file presetFile
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return nil, fmt.Errorf("could not parse config file: %w", err)
+	}
+	maps.Copy(presets, file.Presets)
+	return presets, nil
+}
+
+// args returns the preset as command line arguments for the parser,
+// leaving out the options already given on the command line, in order
+// of option name
+func (p preset) args(parser *flags.Parser) ([]string, error) {
+	args := []string{}
+	for _, name := range sortedNames(p) {
+		option := parser.FindOptionByLongName(name)
+		if option == nil || name == "preset" || name == "config" {
+			return nil, fmt.Errorf("%q: %w", name, ErrPresetOption)
+		}
+		if option.IsSet() && !option.IsSetDefault() {
+			continue // given on the command line
+		}
+		values, ok := p[name].([]any)
+		if !ok {
+			values = []any{p[name]}
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case bool:
+				if v {
+					args = append(args, "--"+name)
+				}
+			case string, int, float64:
+				args = append(args, fmt.Sprintf("--%s=%v", name, v))
+			default:
+				return nil, fmt.Errorf("%q value %v: %w", name, v, ErrPresetOption)
+			}
+		}
+	}
+	return args, nil
+}
+
+// presetArgs returns the arguments of the preset selected in options,
+// which have been parsed by the parser, for the options not given on
+// the command line
+func presetArgs(parser *flags.Parser, options Options) ([]string, error) {
+	presets, err := loadPresets(options.Config)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := presets[options.Preset]
+	if !ok {
+		return nil, fmt.Errorf("%q is not one of %v: %w", options.Preset, sortedNames(presets), ErrUnknownPreset)
+	}
+	args, err := p.args(parser)
+	if err != nil {
+		return nil, fmt.Errorf("preset %s: %w", options.Preset, err)
+	}
+	return args, nil
+}
+
+// sortedNames returns the keys of m in order
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
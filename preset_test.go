@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jessevdk/go-flags"
+)
+
+// writeConfig writes a config file, returning its name
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "webchk.yaml")
+	if err := os.WriteFile(filename, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadPresets(t *testing.T) {
+
+	presets, err := loadPresets("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sortedNames(presets), []string{"aggressive", "link-check", "polite", "seo-audit"}; !cmp.Equal(got, want) {
+		t.Errorf("got presets %v want %v", got, want)
+	}
+
+	presets, err = loadPresets(writeConfig(t, `
+presets:
+  polite:
+    querysec: 1
+  nightly:
+    output: [json:nightly.json, "sqlite:webchk.db"]
+    changes: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(presets), 5; got != want {
+		t.Errorf("got %d want %d presets", got, want)
+	}
+	if diff := cmp.Diff(preset{"querysec": 1}, presets["polite"]); diff != "" {
+		t.Errorf("polite mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := builtinPresets["nightly"]; ok {
+		t.Error("the built in presets should not be modified")
+	}
+
+	for _, contents := range []string{"presets: [1, 2]", "presets:\n  x: 1\n"} {
+		if _, err := loadPresets(writeConfig(t, contents)); err == nil {
+			t.Errorf("expected an error for %q", contents)
+		}
+	}
+	if _, err := loadPresets(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestPresetArgs(t *testing.T) {
+
+	var options Options
+	parser := flags.NewParser(&options, flags.Default)
+	if _, err := parser.ParseArgs([]string{"-s", "hi", "-w", "4", "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := preset{
+		"workers":    2, // given on the command line
+		"querysec":   5, // a default
+		"sort":       true,
+		"sitemaps":   false,
+		"index-docs": []any{"index.html", "index.php"},
+		"timeout":    "30m",
+	}.args(parser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"--index-docs=index.html", "--index-docs=index.php", "--querysec=5", "--sort", "--timeout=30m"}
+	if diff := cmp.Diff(want, args); diff != "" {
+		t.Errorf("args mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, p := range []preset{{"no-such-option": 1}, {"preset": "polite"}, {"tag": map[string]any{"a": 1}}} {
+		if _, err := p.args(parser); !errors.Is(err, ErrPresetOption) {
+			t.Errorf("%v got error %v want %v", p, err, ErrPresetOption)
+		}
+	}
+}
+
+func TestGetOptionsPreset(t *testing.T) {
+
+	config := writeConfig(t, "presets:\n  watch:\n    changes: true\n    output: [\"sqlite:webchk.db\"]\n")
+	tests := []struct {
+		name string
+		args []string
+		ok   bool
+		want func(o Options) bool
+	}{
+		{
+			name: "built in",
+			args: []string{"--preset", "polite", "-s", "hi", "https://example.com"},
+			ok:   true,
+			want: func(o Options) bool { return o.Workers == 2 && o.QuerySec == 2 && o.IdleTimeout == 10*time.Second },
+		},
+		{
+			name: "command line wins",
+			args: []string{"--preset", "polite", "-w", "1", "-s", "hi", "https://example.com"},
+			ok:   true,
+			want: func(o Options) bool { return o.Workers == 1 && o.HTTPWorkers == 2 },
+		},
+		{
+			name: "from config, making search terms optional",
+			args: []string{"--config", config, "--preset", "watch", "https://example.com"},
+			ok:   true,
+			want: func(o Options) bool { return o.Changes && cmp.Equal(o.Output, []string{"sqlite:webchk.db"}) },
+		},
+		{
+			name: "unknown",
+			args: []string{"--preset", "gentle", "-s", "hi", "https://example.com"},
+		},
+	}
+	args := os.Args
+	defer func() { os.Args = args }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = append([]string{"webchk"}, tt.args...)
+			options, err := getOptions()
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v want ok %t", err, tt.ok)
+			}
+			if tt.ok && !tt.want(options) {
+				t.Errorf("unexpected options %+v", options)
+			}
+		})
+	}
+
+	// every built in preset makes valid options
+	for _, name := range sortedNames(builtinPresets) {
+		os.Args = []string{"webchk", "--preset", name, "-s", "hi", "https://example.com"}
+		options, err := getOptions()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := options.validate(HTTPTIMEOUT); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// profile.go sends the request headers of a browser, or of an honest
+// bot, with every request, since some firewalls serve different content
+// to requests which are obviously from a bot and audits need to see
+// what users see.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// The request header profiles
+const (
+	PROFILECHROME  = "chrome"
+	PROFILEFIREFOX = "firefox"
+	PROFILEBOT     = "bot"
+)
+
+// headerProfiles are the headers sent by each profile, as sent by the
+// browser when a page is opened from the address bar
+var headerProfiles = map[string]map[string]string{
+	PROFILECHROME: {
+		"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+		"Accept-Language":           "en-US,en;q=0.9",
+		"Sec-Ch-Ua":                 `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`,
+		"Sec-Ch-Ua-Mobile":          "?0",
+		"Sec-Ch-Ua-Platform":        `"Windows"`,
+		"Sec-Fetch-Dest":            "document",
+		"Sec-Fetch-Mode":            "navigate",
+		"Sec-Fetch-Site":            "none",
+		"Sec-Fetch-User":            "?1",
+		"Upgrade-Insecure-Requests": "1",
+	},
+	PROFILEFIREFOX: {
+		"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"Accept-Language":           "en-US,en;q=0.5",
+		"Sec-Fetch-Dest":            "document",
+		"Sec-Fetch-Mode":            "navigate",
+		"Sec-Fetch-Site":            "none",
+		"Sec-Fetch-User":            "?1",
+		"Upgrade-Insecure-Requests": "1",
+	},
+	PROFILEBOT: {
+		"User-Agent": fmt.Sprintf("%s/%s (+https://github.com/rorycl/webchk)", ROBOTSAGENT, version),
+		"Accept":     "text/html,application/xhtml+xml,*/*;q=0.8",
+	},
+}
+
+// profileTransport is an http.RoundTripper adding the headers of a
+// profile to each request, apart from those already set
+type profileTransport struct {
+	transport http.RoundTripper
+	headers   map[string]string
+}
+
+// newProfileTransport makes a profileTransport for transport, or
+// http.DefaultTransport if transport is nil, sending the headers of
+// profile, which has been validated
+func newProfileTransport(transport http.RoundTripper, profile string) *profileTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &profileTransport{transport: transport, headers: headerProfiles[profile]}
+}
+
+// RoundTrip meets the http.RoundTripper interface
+func (t *profileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context()) // a RoundTripper should not modify the request
+	for k, v := range t.headers {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, v)
+		}
+	}
+	return t.transport.RoundTrip(req)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProfileTransport(t *testing.T) {
+
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	for _, profile := range []string{PROFILECHROME, PROFILEFIREFOX, PROFILEBOT} {
+		client := &http.Client{Transport: newProfileTransport(nil, profile)}
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Language", "de")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		for k, v := range headerProfiles[profile] {
+			if k == "Accept-Language" {
+				continue
+			}
+			if got := received.Get(k); got != v {
+				t.Errorf("%s: header %s got %q want %q", profile, k, got, v)
+			}
+		}
+		// headers already set are kept, and the request is unchanged
+		if got, want := received.Get("Accept-Language"), "de"; got != want {
+			t.Errorf("%s: Accept-Language got %q want %q", profile, got, want)
+		}
+		if got := req.Header.Get("User-Agent"); got != "" {
+			t.Errorf("%s: request modified with User-Agent %q", profile, got)
+		}
+	}
+
+	if got := received.Get("User-Agent"); !strings.HasPrefix(got, ROBOTSAGENT+"/") {
+		t.Errorf("bot User-Agent %q does not name %s", got, ROBOTSAGENT)
+	}
+	if got := received.Get("Sec-Fetch-Mode"); got != "" {
+		t.Errorf("bot sent Sec-Fetch-Mode %q", got)
+	}
+}
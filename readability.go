@@ -0,0 +1,70 @@
+// readability.go measures the word count and the Flesch readability
+// scores of the visible text of pages, for content inventories. The
+// syllable counts are estimated for English text.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sentenceEnd matches the punctuation ending a sentence
+var sentenceEnd = regexp.MustCompile(`[.!?]+(\s|$)`)
+
+// vowelGroups matches the groups of vowels in a word, each taken to be
+// a syllable
+var vowelGroups = regexp.MustCompile(`[aeiouy]+`)
+
+// readability holds the counts from which readability scores are
+// calculated
+type readability struct {
+	words     int
+	sentences int
+	syllables int
+}
+
+// measureReadability counts the words, sentences and syllables of text.
+// Text with words but without sentence punctuation, such as a list, is
+// counted as one sentence.
+func measureReadability(text string) readability {
+	r := readability{}
+	for _, word := range wordPattern.FindAllString(text, -1) {
+		r.words++
+		r.syllables += syllables(word)
+	}
+	r.sentences = len(sentenceEnd.FindAllStringIndex(text, -1))
+	if r.sentences == 0 && r.words > 0 {
+		r.sentences = 1
+	}
+	return r
+}
+
+// syllables estimates the syllables of an English word as its groups of
+// vowels, not counting a silent final "e", with at least one syllable
+func syllables(word string) int {
+	word = strings.ToLower(word)
+	n := len(vowelGroups.FindAllStringIndex(word, -1))
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") && n > 1 {
+		n--
+	}
+	return max(n, 1)
+}
+
+// readingEase returns the Flesch reading ease score, from about 100 for
+// very easy text to 0 or less for very difficult text
+func (r readability) readingEase() float64 {
+	if r.words == 0 {
+		return 0
+	}
+	return 206.835 - 1.015*float64(r.words)/float64(r.sentences) - 84.6*float64(r.syllables)/float64(r.words)
+}
+
+// gradeLevel returns the Flesch-Kincaid grade level, the years of
+// schooling needed to understand the text
+func (r readability) gradeLevel() float64 {
+	if r.words == 0 {
+		return 0
+	}
+	return 0.39*float64(r.words)/float64(r.sentences) + 11.8*float64(r.syllables)/float64(r.words) - 15.59
+}
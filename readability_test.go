@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSyllables(t *testing.T) {
+
+	tests := []struct {
+		word string
+		want int
+	}{
+		{"cat", 1},
+		{"make", 1},
+		{"table", 2},
+		{"the", 1},
+		{"readability", 5},
+		{"Beautiful", 3},
+		{"rhythm", 1},
+		{"hmm", 1},
+	}
+	for _, tt := range tests {
+		if got := syllables(tt.word); got != tt.want {
+			t.Errorf("%s got %d want %d", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestReadability(t *testing.T) {
+
+	tests := []struct {
+		body string
+		want jsonReadability
+	}{
+		{
+			body: "<html><body></body></html>",
+			want: jsonReadability{},
+		},
+		{
+			body: "<p>The cat sat on the mat.</p><script>var x = 'not counted.';</script>",
+			want: jsonReadability{Words: 6, Sentences: 1, ReadingEase: 116.1, GradeLevel: -1.4},
+		},
+		{
+			// unpunctuated text, such as a list, is one sentence
+			body: "<ul><li>home</li><li>about us</li></ul>",
+			want: jsonReadability{Words: 3, Sentences: 1, ReadingEase: 91, GradeLevel: 1.3},
+		},
+		{
+			body: "<p>Readability is measured. Is it? Yes... it is!</p>",
+			want: jsonReadability{Words: 8, Sentences: 4, ReadingEase: 56.8, GradeLevel: 5.8},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			got := newJSONReadability(measureReadability(visibleText([]byte(tt.body))))
+			if diff := cmp.Diff(tt.want, *got); diff != "" {
+				t.Errorf("readability mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// redact.go redacts the secrets which may be given in the options, such
+// as database passwords and webhook tokens, before the options are
+// recorded in the json output, webhook posts, the serve mode reports and
+// events and the manifest.
+
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// redacted returns a copy of the options with the passwords of database
+// dsns and proxy urls and the paths and queries of webhook urls, which
+// often hold their tokens, replaced by "xxxxx"
+func (o Options) redacted() Options {
+	o.Webhook = redactWebhook(o.Webhook)
+	o.PAC = redactDSN(o.PAC)
+	o.Output = slices.Clone(o.Output)
+	for i, spec := range o.Output {
+		kind, target, ok := strings.Cut(spec, ":")
+		switch {
+		case !ok:
+			continue
+		case kind == "postgres" || kind == "clickhouse":
+			o.Output[i] = kind + ":" + redactDSN(target)
+		case kind == "webhook":
+			o.Output[i] = kind + ":" + redactWebhook(target)
+		}
+	}
+	return o
+}
+
+// redactWebhook returns the webhook url with any password, path and
+// query replaced by "xxxxx", keeping its scheme and host. A webhook
+// which is not a url is replaced as a whole.
+func redactWebhook(webhook string) string {
+	if webhook == "" {
+		return ""
+	}
+	u, err := url.Parse(webhook)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "xxxxx"
+	}
+	if u.Path != "" && u.Path != "/" {
+		u.Path, u.RawPath = "/xxxxx", ""
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "xxxxx"
+	}
+	u.Fragment, u.RawFragment = "", ""
+	return u.Redacted()
+}
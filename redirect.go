@@ -0,0 +1,90 @@
+// redirect.go limits the redirects followed for each url, reporting
+// redirect loops and long redirect chains as errors of their own
+// rather than as generic client errors. Pages of the site redirected
+// off it are reported as external redirects, with their destination,
+// rather than followed, since they may show a hijacked or expired
+// integration.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// MAXREDIRECTS is the default number of redirects followed for a url
+const MAXREDIRECTS = 10
+
+var (
+	// ErrRedirectLoop reports a redirect to a url already visited in
+	// the same chain of redirects
+	ErrRedirectLoop = errors.New("redirect loop")
+	// ErrTooManyRedirects reports a chain of redirects longer than the
+	// maximum
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// checkRedirect returns an http.Client CheckRedirect function following
+// at most maxRedirects redirects and stopping at redirect loops
+func checkRedirect(maxRedirects int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		for _, v := range via {
+			if v.URL.String() == req.URL.String() {
+				return fmt.Errorf("%w back to %s after %d redirects", ErrRedirectLoop, req.URL, len(via))
+			}
+		}
+		if len(via) > maxRedirects {
+			return fmt.Errorf("%w, stopped after %d", ErrTooManyRedirects, maxRedirects)
+		}
+		return nil
+	}
+}
+
+// withMaxRedirects sets the getClient to follow at most maxRedirects
+// redirects for each url
+func (g *getClient) withMaxRedirects(maxRedirects int) {
+	g.client.CheckRedirect = checkRedirect(maxRedirects)
+}
+
+// pageRequest is the context key marking the requests for pages made by
+// get, whose redirects off the site are not followed
+type pageRequest struct{}
+
+// withRedirectScope sets the getClient to stop at redirects of pages on
+// the site of scope to urls off it, so that get reports them as
+// external redirects. It is called after withMaxRedirects.
+func (g *getClient) withRedirectScope(scope *urlScope) {
+	g.site = scope
+	next := g.client.CheckRedirect
+	g.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.Context().Value(pageRequest{}) != nil && scope.onSite(via[0].URL.String()) && !scope.onSite(req.URL.String()) {
+			return http.ErrUseLastResponse
+		}
+		return next(req, via)
+	}
+}
+
+// pageRequest marks req as the request for a page, if the getClient
+// stops at redirects off the site
+func (g *getClient) pageRequest(req *http.Request) *http.Request {
+	if g.site == nil {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), pageRequest{}, true))
+}
+
+// externalRedirect returns the url off the site a response for a page
+// on the site was redirected to, and which was not followed, or "" if it
+// was not redirected off the site
+func (g *getClient) externalRedirect(url string, resp *http.Response) string {
+	if g.site == nil || resp.StatusCode/100 != 3 {
+		return ""
+	}
+	location, err := resp.Location()
+	if err != nil || g.site.onSite(location.String()) || !g.site.onSite(url) {
+		return ""
+	}
+	return redirectURL(url, location)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedirects(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/a", http.StatusMovedPermanently)
+	})
+	// /chain/n redirects n times before reaching a page
+	mux.HandleFunc("/chain/", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/chain/"))
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/chain/%d", n-1), http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintln(w, "<html>arrived</html>")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		maxRedirects int // 0 for the default
+		path         string
+		err          error
+		kind         string
+	}{
+		{path: "/chain/0"},
+		{path: "/chain/3"},
+		{path: "/chain/10"},
+		{path: "/chain/11", err: ErrTooManyRedirects, kind: "too many redirects"},
+		{maxRedirects: 2, path: "/chain/2"},
+		{maxRedirects: 2, path: "/chain/3", err: ErrTooManyRedirects, kind: "too many redirects"},
+		{path: "/a", err: ErrRedirectLoop, kind: "redirect loop"},
+		{maxRedirects: 1, path: "/a", err: ErrRedirectLoop, kind: "redirect loop"}, // loops are reported first
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			g := NewGetClient(1, time.Second)
+			if tt.maxRedirects > 0 {
+				g.withMaxRedirects(tt.maxRedirects)
+			}
+			r, _ := g.get(server.URL+tt.path, "/", nil)
+			if tt.err == nil {
+				if r.err != nil || r.status != http.StatusOK {
+					t.Errorf("unexpected status %d error %v", r.status, r.err)
+				}
+				return
+			}
+			if !errors.Is(r.err, tt.err) {
+				t.Fatalf("got error %v want %v", r.err, tt.err)
+			}
+			if got := errorKind(r); got != tt.kind {
+				t.Errorf("got kind %q want %q", got, tt.kind)
+			}
+		})
+	}
+}
+
+func TestExternalRedirects(t *testing.T) {
+
+	var external int
+	offSite := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		external++
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body>hello from elsewhere</body></html>`)
+	}))
+	defer offSite.Close()
+	// a different host from the site, which is served on 127.0.0.1
+	offSiteURL := strings.Replace(offSite.URL, "127.0.0.1", "localhost", 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/out", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, offSiteURL+"/landing#top", http.StatusFound)
+	})
+	mux.HandleFunc("/via", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/out", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/in", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body>hello <a href="/other">other</a></body></html>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	scope, err := newURLScope(SCOPEHOST, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGetClient(1, time.Second)
+	g.withMaxRedirects(MAXREDIRECTS)
+	g.withRedirectScope(scope)
+
+	for _, tt := range []struct {
+		path     string
+		err      error
+		redirect string
+		links    int
+	}{
+		{"/out", ExternalRedirect, offSiteURL + "/landing", 0},
+		{"/via", ExternalRedirect, offSiteURL + "/landing", 0},
+		{"/in", nil, server.URL + "/page", 1},
+	} {
+		r, links := g.get(server.URL+tt.path, "/", []string{"hello"})
+		if !errors.Is(r.err, tt.err) {
+			t.Errorf("%s: got error %v want %v", tt.path, r.err, tt.err)
+		}
+		if r.redirect != tt.redirect {
+			t.Errorf("%s: got redirect %q want %q", tt.path, r.redirect, tt.redirect)
+		}
+		if len(links) != tt.links {
+			t.Errorf("%s: got %d links want %d", tt.path, len(links), tt.links)
+		}
+	}
+	if external != 0 {
+		t.Errorf("the off site page was fetched %d times", external)
+	}
+
+	// other requests, such as for sitemaps, follow redirects off the site
+	if _, status, err := g.fetch(server.URL + "/out"); err != nil || status != http.StatusOK {
+		t.Errorf("fetch got status %d error %v", status, err)
+	}
+	if external != 1 {
+		t.Errorf("the off site page was fetched %d times want 1", external)
+	}
+}
+
+func TestExternalRedirectScope(t *testing.T) {
+
+	for _, tt := range []struct {
+		spec     string
+		location string
+		want     string
+	}{
+		{SCOPEHOST, "https://promo.example.com/win", "https://promo.example.com/win"},
+		{SCOPEHOST, "https://www.example.com/b", ""},
+		{SCOPEHOST, "http://www.example.com/b", ""},
+		{SCOPEDOMAIN, "https://promo.example.com/win", ""},
+		{SCOPEDOMAIN, "https://example.net/", "https://example.net"},
+	} {
+		scope, err := newURLScope(tt.spec, "https://www.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := NewGetClient(1, time.Second)
+		g.withRedirectScope(scope)
+		resp := &http.Response{
+			StatusCode: http.StatusFound,
+			Header:     http.Header{"Location": {tt.location}},
+			Request:    &http.Request{URL: &url.URL{Scheme: "https", Host: "www.example.com", Path: "/a"}},
+		}
+		if got := g.externalRedirect("https://www.example.com/a", resp); got != tt.want {
+			t.Errorf("%s scope redirect to %s got %q want %q", tt.spec, tt.location, got, tt.want)
+		}
+	}
+}
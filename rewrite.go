@@ -0,0 +1,91 @@
+// rewrite.go provides sed-style regular expression rewrite rules for
+// the urls found during a crawl, for example to crawl the link
+// structure of a production site against a staging deployment.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrRewriteFormat reports a rewrite rule which is not of the form
+// s#pattern#replacement#
+var ErrRewriteFormat = errors.New("rewrite rule should be of the form s#pattern#replacement#, where # is any delimiter")
+
+// rewriteRule replaces matches of a regular expression in a url
+type rewriteRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// rewriteRules is a URLRewriter applying each of its rules in turn
+type rewriteRules []rewriteRule
+
+// newRewriteRules makes rewriteRules from sed-style substitutions of
+// the form s#pattern#replacement#, where the character following the s
+// is the delimiter, which may be escaped with a backslash within the
+// pattern or replacement. The replacement may refer to submatches of
+// the pattern as $1 or ${name}.
+func newRewriteRules(specs []string) (rewriteRules, error) {
+	rules := rewriteRules{}
+	for _, spec := range specs {
+		parts, err := splitRewrite(spec)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite %q: %w", spec, err)
+		}
+		re, err := regexp.Compile(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("rewrite %q: %w", spec, err)
+		}
+		rules = append(rules, rewriteRule{re, parts[1]})
+	}
+	return rules, nil
+}
+
+// splitRewrite splits a sed-style substitution into its pattern and
+// replacement
+func splitRewrite(spec string) ([2]string, error) {
+	var parts [2]string
+	if len(spec) < 4 || spec[0] != 's' {
+		return parts, ErrRewriteFormat
+	}
+	delim := spec[1]
+	var b strings.Builder
+	part := 0
+	rest := spec[2:]
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case c == '\\' && i+1 < len(rest) && rest[i+1] == delim:
+			b.WriteByte(delim)
+			i++
+		case c == delim:
+			if part > 1 {
+				return parts, ErrRewriteFormat
+			}
+			parts[part] = b.String()
+			b.Reset()
+			part++
+		default:
+			if part > 1 {
+				return parts, ErrRewriteFormat // trailing flags
+			}
+			b.WriteByte(c)
+		}
+	}
+	if part != 2 || parts[0] == "" {
+		return parts, ErrRewriteFormat
+	}
+	return parts, nil
+}
+
+// Rewrite applies each rule to url in turn
+func (r rewriteRules) Rewrite(url string) string {
+	for _, rule := range r {
+		url = rule.re.ReplaceAllString(url, rule.replacement)
+	}
+	return url
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewRewriteRules(t *testing.T) {
+
+	tests := []struct {
+		specs []string
+		url   string
+		want  string
+		isErr bool
+	}{
+		{
+			specs: nil,
+			url:   "https://www.example.com/a",
+			want:  "https://www.example.com/a",
+		},
+		{
+			specs: []string{"s#^https://www.example.com#https://staging.example.com#"},
+			url:   "https://www.example.com/a",
+			want:  "https://staging.example.com/a",
+		},
+		{
+			specs: []string{"s|/(\\d+)/|/page-$1/|", "s#staging#test#"},
+			url:   "https://staging.example.com/12/",
+			want:  "https://test.example.com/page-12/",
+		},
+		{ // escaped delimiter
+			specs: []string{`s/\/old\//\/new\//`},
+			url:   "https://www.example.com/old/a",
+			want:  "https://www.example.com/new/a",
+		},
+		{specs: []string{"s#a#b"}, isErr: true},
+		{specs: []string{"s#a#b#g"}, isErr: true},
+		{specs: []string{"s##b#"}, isErr: true},
+		{specs: []string{"x#a#b#"}, isErr: true},
+		{specs: []string{"s#(#b#"}, isErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			rules, err := newRewriteRules(tt.specs)
+			if err != nil {
+				if !tt.isErr {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			if tt.isErr {
+				t.Fatal("expected error")
+			}
+			if got := rules.Rewrite(tt.url); got != tt.want {
+				t.Errorf("got %s want %s", got, tt.want)
+			}
+		})
+	}
+
+	_, err := newRewriteRules([]string{"s#a#b#c#"})
+	if !errors.Is(err, ErrRewriteFormat) {
+		t.Errorf("got error %v want %v", err, ErrRewriteFormat)
+	}
+}
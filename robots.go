@@ -0,0 +1,274 @@
+// robots.go reads the robots.txt file of a site, for the sitemaps it
+// lists, the crawl delay it asks of robots and the paths it allows and
+// disallows them.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ROBOTSAGENT is the name webchk looks for in the User-agent lines of
+// robots.txt files, falling back to the rules for all robots, "*"
+const ROBOTSAGENT = "webchk"
+
+// ErrRobots reports a robots.txt file which could not be read
+var ErrRobots = errors.New("robots.txt error")
+
+// robotsGroup holds the directives for the user agents of a group of
+// User-agent lines
+type robotsGroup struct {
+	agents     []string      // in lowercase
+	crawlDelay time.Duration // between requests, if set
+	rules      []robotsRule  // Allow and Disallow rules, in order
+}
+
+// robotsRule is an Allow or Disallow rule for paths matching pattern,
+// in which "*" matches any characters and a final "$" the end of the
+// path
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsTxt holds the directives read from a robots.txt file
+type robotsTxt struct {
+	sitemaps []string // urls of the sitemaps of the site
+	groups   []robotsGroup
+}
+
+// parseRobots parses a robots.txt file. Directive names are case
+// insensitive and comments, from a "#", are ignored. Consecutive
+// User-agent lines start a group, to which the directives following
+// them apply.
+func parseRobots(body []byte) robotsTxt {
+	r := robotsTxt{}
+	var group *robotsGroup
+	inAgents := false // reading the User-agent lines of a group
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "sitemap":
+			if value != "" {
+				r.sitemaps = append(r.sitemaps, value)
+			}
+			continue
+		case "user-agent":
+			if !inAgents {
+				r.groups = append(r.groups, robotsGroup{})
+				group = &r.groups[len(r.groups)-1]
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+			inAgents = true
+			continue
+		}
+		inAgents = false
+		if group == nil {
+			continue // directives before any User-agent line
+		}
+		switch key {
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				group.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		case "allow", "disallow":
+			if value != "" { // an empty Disallow allows everything
+				group.rules = append(group.rules, robotsRule{key == "allow", value})
+			}
+		}
+	}
+	return r
+}
+
+// group returns the group of directives for agent, or otherwise for all
+// robots, or nil if there is neither
+func (r robotsTxt) group(agent string) *robotsGroup {
+	agent = strings.ToLower(agent)
+	var all *robotsGroup
+	for i, g := range r.groups {
+		for _, a := range g.agents {
+			switch {
+			case a == agent:
+				return &r.groups[i]
+			case a == "*" && all == nil:
+				all = &r.groups[i]
+			}
+		}
+	}
+	return all
+}
+
+// crawlDelay returns the delay between requests asked of webchk, or 0
+// if there is none
+func (r robotsTxt) crawlDelay() time.Duration {
+	if g := r.group(ROBOTSAGENT); g != nil {
+		return g.crawlDelay
+	}
+	return 0
+}
+
+// robotsMatch reports whether a robots.txt path pattern matches path
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(rest, p)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(p):]
+	}
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(rest, last)
+	}
+	return strings.Contains(rest, last)
+}
+
+// allowed reports whether the group allows robots to fetch path, with
+// any query. The longest matching rule applies, an Allow rule winning a
+// tie, and paths matching no rule are allowed, as are all paths if the
+// group is nil.
+func (g *robotsGroup) allowed(path string) bool {
+	if g == nil {
+		return true
+	}
+	allow, longest := true, -1
+	for _, r := range g.rules {
+		if !robotsMatch(r.pattern, path) {
+			continue
+		}
+		if n := len(r.pattern); n > longest || (n == longest && r.allow) {
+			allow, longest = r.allow, n
+		}
+	}
+	return allow
+}
+
+// robotsPolicy applies the rules of a robots.txt file for webchk to the
+// urls of its site
+type robotsPolicy struct {
+	host  string
+	group *robotsGroup
+}
+
+// newRobotsPolicy makes the robotsPolicy of the robots.txt file r of
+// the site of baseURL
+func newRobotsPolicy(baseURL string, r robotsTxt) robotsPolicy {
+	p := robotsPolicy{group: r.group(ROBOTSAGENT)}
+	if u, err := url.Parse(baseURL); err == nil {
+		p.host = strings.ToLower(u.Host)
+	}
+	return p
+}
+
+// disallows reports whether the policy disallows fetching rawURL. Urls
+// of other sites are not disallowed.
+func (p robotsPolicy) disallows(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || strings.ToLower(u.Host) != p.host {
+		return false
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return !p.group.allowed(path)
+}
+
+// Follow meets the URLFilter interface, following the urls the policy
+// does not disallow
+func (p robotsPolicy) Follow(url string) bool {
+	return !p.disallows(url)
+}
+
+// robotsAudit is an OutputSink recording the results of urls fetched
+// although the robotsPolicy disallows them, for a crawl ignoring
+// robots.txt, before writing them to its OutputSink
+type robotsAudit struct {
+	sink       OutputSink
+	policy     robotsPolicy
+	disallowed []string
+}
+
+// Write records the url of the result if it is disallowed and writes
+// the result
+func (a *robotsAudit) Write(r Result) error {
+	if a.policy.disallows(r.url) {
+		a.disallowed = append(a.disallowed, r.url)
+	}
+	return a.sink.Write(r)
+}
+
+// Close closes the sink
+func (a *robotsAudit) Close(stats Stats) error {
+	return a.sink.Close(stats)
+}
+
+// report writes the urls fetched which robots.txt disallows to w
+func (a *robotsAudit) report(w io.Writer) {
+	if len(a.disallowed) == 0 {
+		fmt.Fprintln(w, "robots.txt compliance: no urls fetched were disallowed")
+		return
+	}
+	slices.Sort(a.disallowed)
+	fmt.Fprintf(w, "\n== robots.txt compliance ==\nurls fetched which robots.txt disallows: %d\n", len(a.disallowed))
+	for _, u := range a.disallowed {
+		fmt.Fprintf(w, "  %s\n", u)
+	}
+}
+
+// robotsURL returns the url of the robots.txt file of the site of
+// baseURL
+func robotsURL(baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}).String(), nil
+}
+
+// robots reads the robots.txt file of the site of baseURL with the
+// getClient. A site without a robots.txt file has no directives.
+func (g *getClient) robots(baseURL string) (robotsTxt, error) {
+	robots, err := robotsURL(baseURL)
+	if err != nil {
+		return robotsTxt{}, fmt.Errorf("%w: %w", ErrRobots, err)
+	}
+	body, status, err := g.fetch(robots)
+	switch {
+	case err != nil:
+		return robotsTxt{}, fmt.Errorf("%w: %w", ErrRobots, err)
+	case status == http.StatusNotFound:
+		return robotsTxt{}, nil
+	case status != http.StatusOK:
+		return robotsTxt{}, fmt.Errorf("%w: status %d", ErrRobots, status)
+	}
+	return parseRobots(body), nil
+}
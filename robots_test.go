@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRobots(t *testing.T) {
+
+	body := []byte(`# robots.txt
+User-agent: *
+Disallow: /private/
+SITEMAP: https://example.com/sitemap.xml # the main sitemap
+sitemap:https://example.com/news.xml
+Sitemap:
+not a directive
+`)
+	want := []string{"https://example.com/sitemap.xml", "https://example.com/news.xml"}
+	if diff := cmp.Diff(want, parseRobots(body).sitemaps); diff != "" {
+		t.Errorf("sitemaps mismatch (-want +got):\n%s", diff)
+	}
+	if got := parseRobots(nil).sitemaps; got != nil {
+		t.Errorf("got sitemaps %v for an empty file", got)
+	}
+}
+
+func TestRobotsCrawlDelay(t *testing.T) {
+
+	tests := []struct {
+		name string
+		body string
+		want time.Duration
+	}{
+		{"none", "User-agent: *\nDisallow: /private/\n", 0},
+		{"all robots", "User-agent: *\nCrawl-delay: 2\n", 2 * time.Second},
+		{"fractional", "user-agent: *\ncrawl-delay: 0.5 # seconds\n", 500 * time.Millisecond},
+		{"invalid", "User-agent: *\nCrawl-delay: soon\n", 0},
+		{"other robots", "User-agent: googlebot\nCrawl-delay: 5\n", 0},
+		{
+			"webchk group",
+			"User-agent: *\nCrawl-delay: 10\n\nUser-agent: bingbot\nUser-agent: WebChk\nCrawl-delay: 1\n",
+			time.Second,
+		},
+		{
+			"new group after directives",
+			"User-agent: *\nDisallow: /a\nUser-agent: googlebot\nCrawl-delay: 3\n",
+			0,
+		},
+		{"before any group", "Crawl-delay: 3\nUser-agent: *\n", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRobots([]byte(tt.body)).crawlDelay(); got != tt.want {
+			t.Errorf("%s: got %s want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRobotsURL(t *testing.T) {
+
+	for _, tt := range []struct{ baseURL, want string }{
+		{"https://example.com", "https://example.com/robots.txt"},
+		{"https://example.com/docs/intro?x=1", "https://example.com/robots.txt"},
+		{"http://127.0.0.1:8080/a", "http://127.0.0.1:8080/robots.txt"},
+	} {
+		got, err := robotsURL(tt.baseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("got %s want %s", got, tt.want)
+		}
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/", "/anything", true},
+		{"/private/", "/private/a", true},
+		{"/private/", "/private", false},
+		{"/*.pdf$", "/docs/a.pdf", true},
+		{"/*.pdf$", "/docs/a.pdf?x=1", false},
+		{"/*.pdf", "/docs/a.pdf?x=1", true},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+		{"/page$", "/page", true},
+		{"/page$", "/pages", false},
+		{"*?sort=", "/list?sort=name", true},
+	}
+	for _, tt := range tests {
+		if got := robotsMatch(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("%q %q: got %t want %t", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRobotsPolicy(t *testing.T) {
+
+	body := []byte(`User-agent: *
+Disallow: /
+
+User-agent: webchk
+Disallow: /private/
+Allow: /private/public/
+Disallow: /*.pdf$
+Disallow:
+`)
+	policy := newRobotsPolicy("https://Example.com/start", parseRobots(body))
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com", false},
+		{"https://example.com/about", false},
+		{"https://example.com/private/a", true},
+		{"https://example.com/private/public/a", false},
+		{"https://example.com/docs/a.pdf", true},
+		{"https://example.org/private/a", false}, // another site
+	}
+	for _, tt := range tests {
+		if got := policy.disallows(tt.url); got != tt.want {
+			t.Errorf("%s: got disallowed %t want %t", tt.url, got, tt.want)
+		}
+	}
+	if newRobotsPolicy("https://example.com", robotsTxt{}).disallows("https://example.com/a") {
+		t.Error("url disallowed without a robots.txt file")
+	}
+}
@@ -0,0 +1,67 @@
+// sanitise.go bounds the work done on each page, so that a hostile or
+// broken page, such as one which is enormous, nests elements without
+// end or is not valid utf-8, cannot use pathological amounts of cpu or
+// memory during a crawl.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	// PAGEMAXBYTES is the largest page read; only the first
+	// PAGEMAXBYTES of a larger page are searched for links and matches
+	PAGEMAXBYTES = 20 << 20
+
+	// PAGEMAXLINKS is the most links extracted from a page
+	PAGEMAXLINKS = 10000
+
+	// PAGEMAXDEPTH is the deepest nesting of landmark elements tracked
+	// for the anchors of links
+	PAGEMAXDEPTH = 256
+)
+
+// ErrPageTooLarge reports a page larger than PAGEMAXBYTES
+var ErrPageTooLarge = errors.New("page too large")
+
+// readPage reads at most PAGEMAXBYTES of a page body, reporting
+// ErrPageTooLarge with what was read if the page is larger, decodes it
+// with decode, if given, and makes the page valid utf-8
+func readPage(r io.Reader, decode charsetDecoder) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, PAGEMAXBYTES+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > PAGEMAXBYTES {
+		body, err = body[:PAGEMAXBYTES], fmt.Errorf("%w: only the first %d bytes were read", ErrPageTooLarge, PAGEMAXBYTES)
+	}
+	if decode != nil {
+		decoded, decodeErr := decode(body)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("could not decode page: %w", decodeErr)
+		}
+		body = decoded
+	}
+	return validUTF8(body), err
+}
+
+// validUTF8 replaces each byte of body which is not part of a valid
+// utf-8 sequence with '?', so that the line numbers and byte offsets of
+// matches in the page are unchanged. body is modified in place.
+func validUTF8(body []byte) []byte {
+	if utf8.Valid(body) {
+		return body
+	}
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRune(body[i:])
+		if r == utf8.RuneError && size == 1 {
+			body[i] = '?'
+		}
+		i += size
+	}
+	return body
+}
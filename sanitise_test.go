@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestReadPage(t *testing.T) {
+
+	body, err := readPage(strings.NewReader("<p>caf\xe9 ol\xc3\xa9</p>"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(body), "<p>caf? olé</p>"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	body, err = readPage(strings.NewReader(strings.Repeat("a", PAGEMAXBYTES+10)), nil)
+	if !errors.Is(err, ErrPageTooLarge) {
+		t.Errorf("got error %v want %v", err, ErrPageTooLarge)
+	}
+	if got, want := len(body), PAGEMAXBYTES; got != want {
+		t.Errorf("got %d want %d bytes", got, want)
+	}
+}
+
+func TestValidUTF8(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"", ""},
+		{"plain", "plain"},
+		{"smörgåsbord", "smörgåsbord"},
+		{"\xff\xfe", "??"},
+		{"a\xe2\x82b", "a??b"},  // a truncated sequence
+		{"\xed\xa0\x80", "???"}, // a surrogate
+	} {
+		got := string(validUTF8([]byte(tt.in)))
+		if got != tt.want {
+			t.Errorf("%q: got %q want %q", tt.in, got, tt.want)
+		}
+		if len(got) != len(tt.in) {
+			t.Errorf("%q: length changed from %d to %d", tt.in, len(tt.in), len(got))
+		}
+	}
+}
+
+func TestParsePageLimits(t *testing.T) {
+
+	u, _ := url.Parse("https://example.com/")
+
+	var links strings.Builder
+	for i := range PAGEMAXLINKS + 50 {
+		fmt.Fprintf(&links, `<a href="/p%d">p</a>`, i)
+	}
+	page, err := parsePage([]byte(links.String()), u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(page.links), PAGEMAXLINKS; got != want {
+		t.Errorf("got %d want %d links", got, want)
+	}
+	if got, want := len(page.anchors), PAGEMAXLINKS; got != want {
+		t.Errorf("got %d want %d anchors", got, want)
+	}
+
+	// deeply nested landmarks closed by unrelated elements
+	deep := strings.Repeat("<nav>", 100000) + strings.Repeat("</main>", 100000) +
+		`<a href="/deep">deep</a>`
+	page, err = parsePage([]byte(deep), u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := page.anchors["https://example.com/deep"], (linkAnchor{"deep", "nav"}); got != want {
+		t.Errorf("got anchor %v want %v", got, want)
+	}
+}
+
+// FuzzParsePage checks that parsing any page neither panics nor
+// reports links or matches outside the limits of the page
+func FuzzParsePage(f *testing.F) {
+	for _, s := range []string{
+		`<html lang="en"><base href="/b/"><a href="x?y#z">Next page</a></html>`,
+		`<nav><main><a href="/a" aria-label="a">` + "\n" + `term</a></nav>`,
+		`<link rel="next" href="/2"><link rel="amphtml" href="/amp">`,
+		`<meta name="robots" content="noindex"><a href="%zz">`,
+		"<p>caf\xe9 TERM\n\xff</p><a href='\x00'>",
+		`<a href="http://[::1`,
+	} {
+		f.Add([]byte(s))
+	}
+	u, _ := url.Parse("https://example.com/page")
+	f.Fuzz(func(t *testing.T, body []byte) {
+		body = validUTF8(body)
+		page, _ := parsePage(body, u, []string{"term", "İ"})
+		if len(page.links) > PAGEMAXLINKS || len(page.anchors) > PAGEMAXLINKS {
+			t.Errorf("%d links and %d anchors exceed the limit", len(page.links), len(page.anchors))
+		}
+		for _, l := range page.links {
+			if !utf8.ValidString(l) {
+				t.Errorf("link %q is not valid utf-8", l)
+			}
+		}
+		for _, m := range page.matches {
+			if m.offset < 0 || m.offset > len(body) {
+				t.Errorf("match %v offset %d outside page of %d bytes", m, m.offset, len(body))
+			}
+		}
+		for _, run := range visibleTextRuns(body) {
+			if !utf8.ValidString(run) {
+				t.Errorf("text %q is not valid utf-8", run)
+			}
+		}
+	})
+}
+
+// FuzzValidUTF8 checks that validUTF8 makes any input valid utf-8 of
+// the same length, leaving valid input unchanged
+func FuzzValidUTF8(f *testing.F) {
+	for _, s := range []string{"", "ascii", "smörgåsbord", "\xff", "\xe2\x82", "\xf4\x90\x80\x80"} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, in []byte) {
+		valid := utf8.Valid(in)
+		orig := string(in)
+		got := validUTF8(in)
+		if !utf8.Valid(got) {
+			t.Errorf("%q: got invalid %q", orig, got)
+		}
+		if len(got) != len(orig) {
+			t.Errorf("%q: length changed to %d", orig, len(got))
+		}
+		if valid && string(got) != orig {
+			t.Errorf("%q: valid input changed to %q", orig, got)
+		}
+	})
+}
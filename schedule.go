@@ -0,0 +1,125 @@
+// schedule.go runs crawls on cron schedules in serve mode, so that one
+// long-lived webchk can carry out regular audits of several sites.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNoSiteURL reports a site without a url
+var ErrNoSiteURL = errors.New("site has no url")
+
+// Site is a site to crawl on a schedule. Sites without their own search
+// terms use those given on the command line.
+type Site struct {
+	Name        string   `yaml:"name"`
+	URL         string   `yaml:"url"`
+	Schedule    string   `yaml:"schedule"`
+	SearchTerms []string `yaml:"searchterms"`
+	cron        cronSchedule
+}
+
+// loadSites loads the sites to crawl from a yaml file
+func loadSites(filename string) ([]Site, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read sites file: %w", err)
+	}
+	var sites []Site
+	if err := yaml.Unmarshal(contents, &sites); err != nil {
+		return nil, fmt.Errorf("could not parse sites file: %w", err)
+	}
+	for i := range sites {
+		if sites[i].URL == "" {
+			return nil, fmt.Errorf("site %d %q: %w", i+1, sites[i].Name, ErrNoSiteURL)
+		}
+		sites[i].cron, err = parseCron(sites[i].Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("site %d %q: %w", i+1, sites[i].Name, err)
+		}
+	}
+	return sites, nil
+}
+
+// sites returns the sites to crawl on a schedule: the base url if a
+// schedule is set, and those in the sites file, if any
+func (o Options) sites() ([]Site, error) {
+	sites := []Site{}
+	if o.Schedule != "" {
+		cron, err := parseCron(o.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		sites = append(sites, Site{URL: o.Args.BaseURL, Schedule: o.Schedule, cron: cron})
+	}
+	if o.Sites != "" {
+		more, err := loadSites(o.Sites)
+		if err != nil {
+			return nil, err
+		}
+		sites = append(sites, more...)
+	}
+	return sites, nil
+}
+
+// options returns the options for crawling the site, based on options
+func (s Site) options(options Options) Options {
+	options.Args.BaseURL = s.URL
+	if len(s.SearchTerms) > 0 {
+		options.SearchTerms = s.SearchTerms
+	}
+	return options
+}
+
+// scheduler runs the crawls of sites when they are due, one at a time,
+// so that the crawls do not compete with each other. A crawl due while
+// another is running starts when it finishes, and a crawl which falls
+// due more than once meanwhile runs only once.
+type scheduler struct {
+	sites []Site
+	run   func(Site)
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+// newScheduler makes a scheduler calling run for each site when due
+func newScheduler(sites []Site, run func(Site)) *scheduler {
+	return &scheduler{sites: sites, run: run, now: time.Now, after: time.After}
+}
+
+// start runs the schedule until ctx is done
+func (s *scheduler) start(ctx context.Context) {
+	due := make([]time.Time, len(s.sites))
+	for i, site := range s.sites {
+		due[i] = site.cron.next(s.now())
+	}
+	for {
+		next := -1
+		for i, t := range due {
+			if !t.IsZero() && (next < 0 || t.Before(due[next])) {
+				next = i
+			}
+		}
+		if next < 0 {
+			<-ctx.Done() // nothing left to run
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.after(due[next].Sub(s.now())):
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		s.run(s.sites[next])
+		due[next] = s.sites[next].cron.next(s.now())
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadSites(t *testing.T) {
+
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		t.Helper()
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	sites, err := loadSites(write("ok.yaml", `
+- name: main
+  url: https://www.example.com
+  schedule: "0 2 * * *"
+- name: blog
+  url: https://blog.example.com
+  schedule: "@weekly"
+  searchterms: ["draft"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(sites), 2; got != want {
+		t.Fatalf("got %d want %d sites", got, want)
+	}
+	options := Options{SearchTerms: []string{"welcome"}}
+	if diff := cmp.Diff([]string{"welcome"}, sites[0].options(options).SearchTerms); diff != "" {
+		t.Errorf("search terms mismatch (-want +got):\n%s", diff)
+	}
+	blog := sites[1].options(options)
+	if diff := cmp.Diff([]string{"draft"}, blog.SearchTerms); diff != "" {
+		t.Errorf("search terms mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := blog.Args.BaseURL, "https://blog.example.com"; got != want {
+		t.Errorf("base url got %s want %s", got, want)
+	}
+
+	_, err = loadSites(write("nourl.yaml", `- name: main`))
+	if !errors.Is(err, ErrNoSiteURL) {
+		t.Errorf("got error %v want %v", err, ErrNoSiteURL)
+	}
+	_, err = loadSites(write("badcron.yaml", "- url: https://www.example.com\n  schedule: nightly"))
+	if !errors.Is(err, ErrCronFormat) {
+		t.Errorf("got error %v want %v", err, ErrCronFormat)
+	}
+	if _, err = loadSites(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	o := Options{Schedule: "@daily"}
+	o.Args.BaseURL = "https://www.example.com"
+	sites, err = o.sites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(sites), 1; got != want {
+		t.Errorf("got %d want %d sites", got, want)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+
+	// a fake clock which moves on to each time waited for
+	now := time.Date(2024, 3, 15, 10, 0, 30, 0, time.UTC)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hourly, _ := parseCron("0 * * * *")
+	quarterly, _ := parseCron("*/15 * * * *")
+	sites := []Site{
+		{URL: "https://hourly.example.com", cron: hourly},
+		{URL: "https://quarterly.example.com", cron: quarterly},
+	}
+	got := []string{}
+	s := newScheduler(sites, func(site Site) {
+		got = append(got, now.Format("15:04")+" "+site.URL)
+		if len(got) == 6 {
+			cancel()
+		}
+	})
+	s.now = func() time.Time { return now }
+	s.after = func(d time.Duration) <-chan time.Time {
+		now = now.Add(d)
+		c := make(chan time.Time, 1)
+		c <- now
+		return c
+	}
+	s.start(ctx)
+
+	want := []string{
+		"10:15 https://quarterly.example.com",
+		"10:30 https://quarterly.example.com",
+		"10:45 https://quarterly.example.com",
+		"11:00 https://hourly.example.com",
+		"11:00 https://quarterly.example.com",
+		"11:15 https://quarterly.example.com",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("runs mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,169 @@
+// scope.go decides which urls are within the scope of a crawl: by
+// default those on the host of the base url, or those on its registered
+// domain, under its path or matching a regular expression.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Scopes of a crawl, given with --scope
+const (
+	SCOPEHOST   = "host"   // urls on the host of the base url
+	SCOPEDOMAIN = "domain" // urls on the registered domain of the base url
+	SCOPEPREFIX = "prefix" // urls under the path of the base url
+	SCOPEREGEX  = "regex:" // urls matching the regular expression following
+)
+
+// ErrScopeFormat reports a scope which is not one of the scopes
+var ErrScopeFormat = errors.New("scope should be host, domain, prefix or regex:PATTERN")
+
+// urlScope reports whether urls are within the scope of a crawl. The
+// host, domain and prefix scopes only include urls with the scheme of
+// the base url, if it has one, and compare hosts in lowercase punycode
+// without default ports.
+type urlScope struct {
+	kind    string
+	base    string // the base url, normalised by normaliseURL
+	scheme  string // of the base url
+	host    string // of the base url, normalised by scopeHost
+	domain  string // the registered domain of the host, for SCOPEDOMAIN
+	path    string // of the base url without a trailing slash, for SCOPEPREFIX
+	pattern *regexp.Regexp
+}
+
+// scopeHost returns the host of u in lowercase punycode, without the
+// default port of its scheme
+func scopeHost(u *url.URL) string {
+	v := *u
+	normaliseHost(&v)
+	host := strings.ToLower(v.Host)
+	switch v.Scheme {
+	case "http":
+		host = strings.TrimSuffix(host, ":80")
+	case "https":
+		host = strings.TrimSuffix(host, ":443")
+	}
+	return host
+}
+
+// parseScopeURL parses a url, taking one without a scheme, such as
+// example.com/docs, to start with its host
+func parseScopeURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err == nil && u.Host == "" && !strings.Contains(rawURL, "://") {
+		u, err = url.Parse("//" + rawURL)
+	}
+	return u, err
+}
+
+// hostScope returns the default scope of baseURL, the urls on its host
+func hostScope(baseURL string) *urlScope {
+	s := &urlScope{kind: SCOPEHOST, base: normaliseURL(baseURL)}
+	u, err := parseScopeURL(baseURL)
+	if err != nil {
+		return s // a bad base url is reported when it is fetched
+	}
+	s.scheme, s.host = u.Scheme, scopeHost(u)
+	s.path = strings.TrimSuffix(u.Path, "/")
+	return s
+}
+
+// newURLScope makes the urlScope given by spec for baseURL, the host
+// scope if spec is empty
+func newURLScope(spec, baseURL string) (*urlScope, error) {
+	s := hostScope(baseURL)
+	switch {
+	case spec == "" || spec == SCOPEHOST:
+	case spec == SCOPEDOMAIN:
+		s.kind = SCOPEDOMAIN
+		s.domain = registeredDomain(s.host)
+	case spec == SCOPEPREFIX:
+		s.kind = SCOPEPREFIX
+	case strings.HasPrefix(spec, SCOPEREGEX):
+		pattern, err := regexp.Compile(strings.TrimPrefix(spec, SCOPEREGEX))
+		if err != nil {
+			return nil, fmt.Errorf("scope %q: %w: %w", spec, ErrScopeFormat, err)
+		}
+		s.kind, s.pattern = SCOPEREGEX, pattern
+	default:
+		return nil, fmt.Errorf("scope %q: %w", spec, ErrScopeFormat)
+	}
+	return s, nil
+}
+
+// contains reports whether the url u is within the scope
+func (s *urlScope) contains(u string) bool {
+	if s.kind == SCOPEREGEX {
+		return s.pattern.MatchString(u)
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || (s.scheme != "" && parsed.Scheme != s.scheme) {
+		return false
+	}
+	host := scopeHost(parsed)
+	switch s.kind {
+	case SCOPEDOMAIN:
+		host, _, _ = strings.Cut(host, ":")
+		return host == s.domain || strings.HasSuffix(host, "."+s.domain)
+	case SCOPEPREFIX:
+		path := strings.TrimSuffix(parsed.Path, "/")
+		return host == s.host && (path == s.path || strings.HasPrefix(path, s.path+"/"))
+	}
+	return host == s.host
+}
+
+// onSite reports whether the url u is on the site of the base url:
+// within the scope whether it is on http or https, so that redirects
+// from http to https stay on the site while those to another host, for
+// the host scope, do not
+func (s *urlScope) onSite(u string) bool {
+	if s.contains(u) {
+		return true
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || s.scheme == "" || parsed.Scheme == s.scheme || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	parsed.Host, parsed.Scheme = scopeHost(parsed), s.scheme
+	return s.contains(parsed.String())
+}
+
+// registeredDomain returns the registered domain of host, such as
+// example.co.uk for www.example.co.uk, without any port, or the host
+// itself for hosts such as localhost or an ip address
+func registeredDomain(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// String describes the urls within the scope
+func (s *urlScope) String() string {
+	scheme := ""
+	if s.scheme != "" {
+		scheme = s.scheme + " "
+	}
+	switch s.kind {
+	case SCOPEDOMAIN:
+		return fmt.Sprintf("%s: %surls on %s and its subdomains", s.kind, scheme, s.domain)
+	case SCOPEPREFIX:
+		return fmt.Sprintf("%s: %surls on %s under %s/", s.kind, scheme, s.host, s.path)
+	case SCOPEREGEX:
+		return fmt.Sprintf("regex: urls matching %s", s.pattern)
+	}
+	return fmt.Sprintf("%s: %surls on %s", s.kind, scheme, s.host)
+}
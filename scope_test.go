@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestURLScope(t *testing.T) {
+	type check struct {
+		url  string
+		want bool
+	}
+	for _, tt := range []struct {
+		spec, base  string
+		description string
+		checks      []check
+	}{
+		{
+			"", "https://www.example.com/docs",
+			"host: https urls on www.example.com",
+			[]check{
+				{"https://www.example.com/blog", true},
+				{"https://WWW.example.com:443/a", true},
+				{"https://www.example.com:8443/a", false},
+				{"http://www.example.com/a", false},
+				{"https://shop.example.com/a", false},
+				{"https://other.com/?u=https://www.example.com/docs", false},
+			},
+		},
+		{
+			"host", "x.com",
+			"host: urls on x.com",
+			[]check{
+				{"https://x.com/a", true},
+				{"ftp://x.com/b", true},
+				{"https://y.com/a", false},
+			},
+		},
+		{
+			"domain", "https://www.example.co.uk",
+			"domain: https urls on example.co.uk and its subdomains",
+			[]check{
+				{"https://example.co.uk/a", true},
+				{"https://shop.example.co.uk/a", true},
+				{"https://a.b.example.co.uk:8443/a", true},
+				{"https://other.co.uk/a", false},
+				{"https://notexample.co.uk/a", false},
+				{"http://shop.example.co.uk/a", false},
+			},
+		},
+		{
+			"domain", "http://localhost:8080",
+			"domain: http urls on localhost and its subdomains",
+			[]check{
+				{"http://localhost:8080/a", true},
+				{"http://app.localhost/a", true},
+			},
+		},
+		{
+			"prefix", "https://example.com/docs/",
+			"prefix: https urls on example.com under /docs/",
+			[]check{
+				{"https://example.com/docs", true},
+				{"https://example.com/docs/guide/a", true},
+				{"https://example.com/docsearch", false},
+				{"https://example.com/blog", false},
+				{"https://www.example.com/docs/a", false},
+			},
+		},
+		{
+			"regex:^https://(www|blog)\\.example\\.com/", "https://www.example.com",
+			"regex: urls matching ^https://(www|blog)\\.example\\.com/",
+			[]check{
+				{"https://blog.example.com/a", true},
+				{"https://shop.example.com/a", false},
+				{"http://www.example.com/a", false},
+			},
+		},
+		{
+			"", "https://münchen.example",
+			"host: https urls on xn--mnchen-3ya.example",
+			[]check{
+				{"https://xn--mnchen-3ya.example/a", true},
+				{"https://münchen.example/a", true},
+			},
+		},
+	} {
+		scope, err := newURLScope(tt.spec, tt.base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := scope.String(); got != tt.description {
+			t.Errorf("%s %s: got description %q want %q", tt.spec, tt.base, got, tt.description)
+		}
+		for _, c := range tt.checks {
+			if got := scope.contains(c.url); got != c.want {
+				t.Errorf("%s %s: %s got %t want %t", tt.spec, tt.base, c.url, got, c.want)
+			}
+		}
+	}
+
+	for _, spec := range []string{"site", "regex:(", "Host"} {
+		if _, err := newURLScope(spec, "https://example.com"); !errors.Is(err, ErrScopeFormat) {
+			t.Errorf("%s: got error %v want %v", spec, err, ErrScopeFormat)
+		}
+	}
+}
+
+func TestURLScopeOnSite(t *testing.T) {
+	for _, tt := range []struct {
+		spec, base, url string
+		want            bool
+	}{
+		{"", "https://www.example.com", "https://www.example.com/a", true},
+		{"", "http://www.example.com", "https://www.example.com/a", true},
+		{"", "https://www.example.com", "http://WWW.example.com:80/a", true},
+		{"", "https://www.example.com", "https://example.com/a", false},
+		{"", "https://www.example.com", "https://promo.example.com/a", false},
+		{"", "https://www.example.co.uk", "https://shop.example.co.uk:8443/a", false},
+		{"domain", "https://www.example.co.uk", "https://shop.example.co.uk:8443/a", true},
+		{"domain", "https://www.example.com", "http://promo.example.com/a", true},
+		{"prefix", "https://www.example.com/docs", "https://www.example.com/docs/a", true},
+		{"prefix", "https://www.example.com/docs", "https://www.example.com/blog", false},
+		{"regex:^https://www\\.example\\.com/", "https://www.example.com", "http://www.example.com/a", true},
+		{"regex:^https://www\\.example\\.com/", "https://www.example.com", "https://cdn.example.com/a", false},
+		{"", "https://www.example.com", "https://example.net/a", false},
+		{"", "https://www.example.co.uk", "https://other.co.uk/a", false},
+		{"", "http://127.0.0.1:8080", "http://127.0.0.1:9090/a", false},
+		{"", "http://127.0.0.1:8080", "http://localhost:8080/a", false},
+		{"", "https://www.example.com", "ftp://www.example.com/a", false},
+		{"", "https://www.example.com", "/relative", false},
+	} {
+		scope, err := newURLScope(tt.spec, tt.base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := scope.onSite(tt.url); got != tt.want {
+			t.Errorf("%s scope of %s: %s got %t want %t", tt.spec, tt.base, tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// seeds.go loads further urls to start a crawl from a yaml file, each
+// of which may be requested with its own method, body and headers, so
+// that pages only reachable by a form POST, such as the listings
+// returned by a search endpoint, can be checked and their links
+// followed.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNoSeedURL reports a seed without a url
+var ErrNoSeedURL = errors.New("no url provided")
+
+// SeedRequest is a url to start the crawl from and the request to make
+// for it. The method is GET by default, and a body is sent as a form
+// unless a Content-Type header is given.
+type SeedRequest struct {
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method"`
+	Body    string            `yaml:"body"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// seedRequests are the requests for seeds, by url
+type seedRequests map[string]SeedRequest
+
+// loadSeedRequests loads seeds from a yaml file of a list of
+// SeedRequests, each with a url and optionally a method, a body and a
+// map of headers
+func loadSeedRequests(filename string) (seedRequests, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read seeds file: %w", err)
+	}
+	var seeds []SeedRequest
+	if err := yaml.Unmarshal(contents, &seeds); err != nil {
+		return nil, fmt.Errorf("could not parse seeds file: %w", err)
+	}
+	requests := seedRequests{}
+	for i, s := range seeds {
+		if s.URL == "" {
+			return nil, fmt.Errorf("seed %d: %w", i+1, ErrNoSeedURL)
+		}
+		s.URL = normaliseURL(s.URL)
+		s.Method = strings.ToUpper(s.Method)
+		if s.Method == "" {
+			s.Method = http.MethodGet
+		}
+		if _, err := http.NewRequest(s.Method, s.URL, nil); err != nil {
+			return nil, fmt.Errorf("seed %d: %w", i+1, err)
+		}
+		requests[s.URL] = s
+	}
+	return requests, nil
+}
+
+// links returns links to the seeds, sorted by url, with the seeds file
+// as their referrer
+func (s seedRequests) links(filename string) []refLink {
+	urls := make([]string, 0, len(s))
+	for u := range s {
+		urls = append(urls, u)
+	}
+	slices.Sort(urls)
+	links := []refLink{}
+	for _, u := range urls {
+		links = append(links, refLink{url: u, referrer: filename, depth: 1})
+	}
+	return links
+}
+
+// newRequest makes the request for url, which is a GET request unless
+// url is a seed with its own request
+func (s seedRequests) newRequest(url string) (*http.Request, error) {
+	seed, ok := s[url]
+	if !ok {
+		return http.NewRequest(http.MethodGet, url, nil)
+	}
+	var body io.Reader
+	if seed.Body != "" {
+		body = strings.NewReader(seed.Body)
+	}
+	req, err := http.NewRequest(seed.Method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if seed.Body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for k, v := range seed.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
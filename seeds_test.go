@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadSeedRequests(t *testing.T) {
+
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		t.Helper()
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	seeds, err := loadSeedRequests(write("ok.yaml", `
+- url: https://example.com/search?lang=en
+  method: post
+  body: q=shoes
+  headers:
+    X-Requested-With: XMLHttpRequest
+- url: https://example.com/archive
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := seedRequests{
+		"https://example.com/search?lang=en": {
+			URL:     "https://example.com/search?lang=en",
+			Method:  "POST",
+			Body:    "q=shoes",
+			Headers: map[string]string{"X-Requested-With": "XMLHttpRequest"},
+		},
+		"https://example.com/archive": {URL: "https://example.com/archive", Method: "GET"},
+	}
+	if diff := cmp.Diff(want, seeds); diff != "" {
+		t.Errorf("seeds mismatch (-want +got):\n%s", diff)
+	}
+	links := []string{}
+	for _, l := range seeds.links("seeds.yaml") {
+		links = append(links, fmt.Sprintf("%s %s %d", l.url, l.referrer, l.depth))
+	}
+	wantLinks := []string{
+		"https://example.com/archive seeds.yaml 1",
+		"https://example.com/search?lang=en seeds.yaml 1",
+	}
+	if diff := cmp.Diff(wantLinks, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, tt := range []struct {
+		contents string
+		err      error
+	}{
+		{"- method: POST\n", ErrNoSeedURL},
+		{"- url: https://example.com\n  method: \"BAD METHOD\"\n", nil},
+		{"url: https://example.com\n", nil},
+	} {
+		if _, err := loadSeedRequests(write("bad.yaml", tt.contents)); err == nil {
+			t.Errorf("%q: expected an error", tt.contents)
+		} else if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%q: got error %v want %v", tt.contents, err, tt.err)
+		}
+	}
+	if _, err := loadSeedRequests(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestCrawlSeedRequests(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /search", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "q=shoes" || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" ||
+			r.Header.Get("X-Requested-With") != "XMLHttpRequest" {
+			http.Error(w, "bad search", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `results <a href="/shoes/1">shoe</a>`)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `hello`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	seedsFile := filepath.Join(t.TempDir(), "seeds.yaml")
+	err := os.WriteFile(seedsFile, []byte(fmt.Sprintf(`
+- url: %s/search
+  method: POST
+  body: q=shoes
+  headers:
+    X-Requested-With: XMLHttpRequest
+`, server.URL)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outFile := filepath.Join(t.TempDir(), "out.csv")
+	options := Options{
+		SearchTerms: []string{"hello"},
+		QuerySec:    1000,
+		IdleTimeout: 200 * time.Millisecond,
+		Seeds:       seedsFile,
+		Output:      []string{"csv:" + outFile},
+	}
+	options.Args.BaseURL = server.URL
+
+	var buf strings.Builder
+	diagnostics = &buf
+	defer func() { diagnostics = os.Stderr }()
+
+	stats, err := crawl(options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the base url, the search results and the page linked from them
+	if got, want := stats.Pages, 3; got != want {
+		t.Errorf("got %d want %d pages", got, want)
+	}
+	if got, want := stats.Broken, 0; got != want {
+		out, _ := os.ReadFile(outFile)
+		t.Errorf("got %d want %d broken pages:\n%s", got, want, out)
+	}
+}
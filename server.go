@@ -0,0 +1,341 @@
+// server.go provides serve mode, in which webchk runs an http server
+// alongside a crawl so that its results can be watched live, for
+// example by a browser or curl, without polling. The id of each event
+// is a resumption token, with which a client can reconnect after a
+// network blip and receive the events it missed.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SHUTDOWNTIMEOUT is the longest the server waits for requests to
+// complete when shutting down
+const SHUTDOWNTIMEOUT = 5 * time.Second
+
+var (
+	// ErrResumeToken reports a resumption token which cannot be parsed
+	ErrResumeToken = errors.New("invalid resumption token")
+	// ErrResumeExpired reports a resumption token for events which are
+	// no longer retained
+	ErrResumeExpired = errors.New("the events after this resumption token are no longer retained; the results so far are in /report.json")
+)
+
+// sseEvent is a server-sent event
+type sseEvent struct {
+	name string
+	data []byte
+}
+
+// broker is an OutputSink publishing results as server-sent events.
+// Events are retained so that subscribers joining part way through a
+// crawl, or reconnecting with the resumption token of the last event
+// they saw, receive every event after it. With a replay window only the
+// latest events are retained. The results and stats so far are also
+// retained for reports.
+type broker struct {
+	options Options
+	run     string // identifies the run in resumption tokens
+	window  int    // the number of events retained, or 0 for all
+	mu      sync.Mutex
+	events  []sseEvent
+	first   int           // the number of events no longer retained
+	changed chan struct{} // closed and replaced when events are added
+	done    bool          // no further events will be published
+	results []Result
+	stats   Stats
+}
+
+// newBroker makes a new broker, retaining the events of the replay
+// window of options
+func newBroker(options Options) *broker {
+	run := make([]byte, 6)
+	rand.Read(run) // never fails
+	return &broker{
+		options: options,
+		run:     hex.EncodeToString(run),
+		window:  max(options.EventWindow, 0),
+		changed: make(chan struct{}),
+		stats:   newStats(),
+	}
+}
+
+// token returns the resumption token of event n of the run, counting
+// from 1
+func (b *broker) token(n int) string {
+	return fmt.Sprintf("%s-%d", b.run, n)
+}
+
+// resumeFrom returns the number of events of the run already seen by a
+// subscriber with token. A new subscriber, with an empty token or a
+// token of another run which has been replaced by this one, is sent the
+// events retained. A token may also be just the number of events seen.
+func (b *broker) resumeFrom(token string) (int, error) {
+	run, seen, ok := strings.Cut(token, "-")
+	if !ok {
+		run, seen = b.run, token
+	}
+	n, err := strconv.Atoi(seen)
+	if token != "" && (err != nil || n < 0) {
+		return 0, fmt.Errorf("%q: %w", token, ErrResumeToken)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case token == "" || run != b.run:
+		return b.first, nil
+	case n < b.first:
+		return 0, fmt.Errorf("%q: %w", token, ErrResumeExpired)
+	}
+	return n, nil
+}
+
+// publish adds an event with the json encoding of v as its data
+func (b *broker) publish(name string, v any, done bool) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not encode %s event: %w", name, err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, sseEvent{name, data})
+	if b.window > 0 && len(b.events) > b.window {
+		drop := len(b.events) - b.window
+		b.events = b.events[drop:]
+		b.first += drop
+	}
+	b.done = done
+	close(b.changed)
+	b.changed = make(chan struct{})
+	return nil
+}
+
+// end marks the broker as done without publishing an event, so that
+// subscribers are disconnected
+func (b *broker) end() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return
+	}
+	b.done = true
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Write publishes a result event
+func (b *broker) Write(r Result) error {
+	b.mu.Lock()
+	b.results = append(b.results, r)
+	b.stats.add(r)
+	b.mu.Unlock()
+	return b.publish("result", newJSONResult(r), false)
+}
+
+// Close publishes a done event summarising the run, in the json output
+// format without the results
+func (b *broker) Close(stats Stats) error {
+	b.mu.Lock()
+	b.stats = stats
+	b.mu.Unlock()
+	return b.publish("done", newJSONEnvelope(b.options, stats, []jsonResult{}), true)
+}
+
+// report serves the results so far as a download written by the
+// OutputSink made by newSink
+func (b *broker) report(filename, contentType string, newSink func(w closingWriter) (OutputSink, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b.mu.Lock()
+		results, stats := b.results, b.stats
+		b.mu.Unlock()
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		sink, err := newSink(closingWriter{Writer: w})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, result := range results {
+			if err := sink.Write(result); err != nil {
+				fmt.Fprintln(diagnostics, err)
+				return
+			}
+		}
+		if err := sink.Close(stats); err != nil {
+			fmt.Fprintln(diagnostics, err)
+		}
+	}
+}
+
+// ServeHTTP streams events to a subscriber until the done event has
+// been sent or the subscriber goes away. Event ids are resumption
+// tokens: the run and the index of each event, counting from 1. A
+// subscriber resumes after the event of the token in the Last-Event-ID
+// header or, for clients which cannot set it, the resume query
+// parameter. A subscriber which falls behind the replay window is
+// disconnected, so that resuming reports the events it missed.
+func (b *broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	token := r.URL.Query().Get("resume")
+	if token == "" {
+		token = r.Header.Get("Last-Event-ID")
+	}
+	next, err := b.resumeFrom(token)
+	switch {
+	case errors.Is(err, ErrResumeExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		b.mu.Lock()
+		if next < b.first {
+			b.mu.Unlock()
+			return // missed events, which resuming reports
+		}
+		events, changed, done := b.events[min(next-b.first, len(b.events)):], b.changed, b.done
+		b.mu.Unlock()
+
+		for _, e := range events {
+			next++
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", b.token(next), e.name, e.data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+		if done {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// server is the serve mode http server. It serves the events and
+// reports of the current run, which is replaced by each scheduled
+// crawl.
+type server struct {
+	http   *http.Server
+	mu     sync.Mutex
+	broker *broker // the current run
+}
+
+// newServer makes a server for addr, with a current run for options.
+// Results are streamed from /events, json and csv reports of the
+// results so far are available from /report.json and /report.csv and
+// the dashboard is served from /. With a sqlite output the history of
+// runs is available from /history/runs and the results of a run from
+// /history/runs/{id}. With keys, which may be nil, all but the
+// dashboard need an api key.
+func newServer(addr string, options Options, keys *keyring) *server {
+	s := &server{broker: newBroker(options)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events", keys.requireKey(func(w http.ResponseWriter, r *http.Request) {
+		if b, ok := s.allowed(w, r); ok {
+			b.ServeHTTP(w, r)
+		}
+	}))
+	mux.HandleFunc("GET /report.json", keys.requireKey(func(w http.ResponseWriter, r *http.Request) {
+		if b, ok := s.allowed(w, r); ok {
+			b.report("webchk.json", "application/json", func(w closingWriter) (OutputSink, error) {
+				return newJSONSink(w, b.options), nil
+			})(w, r)
+		}
+	}))
+	mux.HandleFunc("GET /report.csv", keys.requireKey(func(w http.ResponseWriter, r *http.Request) {
+		if b, ok := s.allowed(w, r); ok {
+			b.report("webchk.csv", "text/csv", func(w closingWriter) (OutputSink, error) {
+				return newCSVSink(w)
+			})(w, r)
+		}
+	}))
+	if filename := options.sqliteOutput(); filename != "" {
+		mux.HandleFunc("GET /history/runs", keys.requireKey(historyHandler(filename, historyRuns)))
+		mux.HandleFunc("GET /history/runs/{id}", keys.requireKey(historyHandler(filename, historyResults)))
+		mux.HandleFunc("GET /history/runs/{id}/changes", keys.requireKey(historyHandler(filename, historyChanges)))
+	}
+	mux.Handle("GET /", dashboardHandler())
+	s.http = &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+// current returns the broker of the current run
+func (s *server) current() *broker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.broker
+}
+
+// allowed returns the broker of the current run if the api key of the
+// request may see its site, and otherwise reports that it is forbidden
+func (s *server) allowed(w http.ResponseWriter, r *http.Request) (*broker, bool) {
+	b := s.current()
+	if baseURL := b.options.Args.BaseURL; !allowsSite(r, baseURL) {
+		http.Error(w, fmt.Sprintf("%s: %v", baseURL, ErrSiteForbidden), http.StatusForbidden)
+		return nil, false
+	}
+	return b, true
+}
+
+// newRun replaces the current run with a new one for options, returning
+// its broker. Subscribers to the previous run are disconnected if it
+// had not finished.
+func (s *server) newRun(options Options) *broker {
+	b := newBroker(options)
+	s.mu.Lock()
+	previous := s.broker
+	s.broker = b
+	s.mu.Unlock()
+	previous.end()
+	return b
+}
+
+// listen starts serving in the background, reporting an error if the
+// address cannot be listened on
+func (s *server) listen() error {
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return fmt.Errorf("could not serve: %w", err)
+	}
+	go func() {
+		if err := s.http.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintln(diagnostics, err)
+		}
+	}()
+	return nil
+}
+
+// wait serves until ctx is done and then shuts the server down
+func (s *server) wait(ctx context.Context) error {
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWNTIMEOUT)
+	defer cancel()
+	return s.http.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/goleak"
+)
+
+// readEvents reads server-sent events from r, returning their ids and
+// names and the data of the events
+func readEvents(t *testing.T, r io.Reader) ([]string, []string) {
+	t.Helper()
+	heads, data := []string{}, []string{}
+	var id string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			heads = append(heads, id+" "+strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	return heads, data
+}
+
+func TestBrokerEvents(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	s := newServer("", Options{}, nil)
+	ts := httptest.NewServer(s.http.Handler)
+	defer ts.Close()
+
+	// a subscriber joining before the crawl receives events live
+	resp, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got, want := resp.Header.Get("Content-Type"), "text/event-stream"; got != want {
+		t.Errorf("content type got %s want %s", got, want)
+	}
+	if _, err := drain(testResults(), s.current(), fakeStatser{Pages: 3, Termination: TerminationIdle}); err != nil {
+		t.Fatal(err)
+	}
+	heads, data := readEvents(t, resp.Body)
+	b := s.current()
+	want := []string{b.token(1) + " result", b.token(2) + " result", b.token(3) + " result", b.token(4) + " done"}
+	if diff := cmp.Diff(want, heads); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+	var result jsonResult
+	if err := json.Unmarshal([]byte(data[1]), &result); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := result.URL, "https://example.com/gone"; got != want {
+		t.Errorf("result url got %s want %s", got, want)
+	}
+	var envelope jsonEnvelope
+	if err := json.Unmarshal([]byte(data[3]), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := envelope.Termination, TerminationIdle; got != want {
+		t.Errorf("termination got %s want %s", got, want)
+	}
+
+	// a subscriber joining after the crawl receives every event, and
+	// one reconnecting receives the events it has not seen, from the
+	// start of the run if its token is for an earlier run
+	for _, tt := range []struct {
+		lastEventID string
+		want        []string
+	}{
+		{"", want},
+		{b.token(2), want[2:]},
+		{"2", want[2:]},
+		{b.token(4), []string{}},
+		{"0123456789ab-3", want},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/events", nil)
+		if tt.lastEventID != "" {
+			req.Header.Set("Last-Event-ID", tt.lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		heads, _ := readEvents(t, resp.Body)
+		resp.Body.Close()
+		if diff := cmp.Diff(tt.want, heads); diff != "" {
+			t.Errorf("last event id %q events mismatch (-want +got):\n%s", tt.lastEventID, diff)
+		}
+	}
+}
+
+func TestBrokerReports(t *testing.T) {
+
+	s := newServer("", Options{}, nil)
+	ts := httptest.NewServer(s.http.Handler)
+	defer ts.Close()
+
+	get := func(path string) *http.Response {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// reports are available part way through a crawl
+	if err := s.current().Write(<-testResults()); err != nil {
+		t.Fatal(err)
+	}
+	resp := get("/report.csv")
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(records), 2; got != want {
+		t.Errorf("got %d want %d csv records", got, want)
+	}
+	if got, want := resp.Header.Get("Content-Disposition"), `attachment; filename="webchk.csv"`; got != want {
+		t.Errorf("content disposition got %s want %s", got, want)
+	}
+
+	results := testResults()
+	<-results // already written
+	if _, err := drain(results, s.current(), fakeStatser{Pages: 3, Termination: TerminationIdle}); err != nil {
+		t.Fatal(err)
+	}
+	resp = get("/report.json")
+	var envelope jsonEnvelope
+	err = json.NewDecoder(resp.Body).Decode(&envelope)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(envelope.Results), 3; got != want {
+		t.Errorf("got %d want %d json results", got, want)
+	}
+	if got, want := envelope.Termination, TerminationIdle; got != want {
+		t.Errorf("termination got %s want %s", got, want)
+	}
+}
+
+func TestServerNewRun(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	s := newServer("", Options{}, nil)
+	ts := httptest.NewServer(s.http.Handler)
+	defer ts.Close()
+
+	// a subscriber to an unfinished run is disconnected by a new run
+	resp, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := s.current()
+	if err := first.Write(<-testResults()); err != nil {
+		t.Fatal(err)
+	}
+	run := s.newRun(Options{})
+	heads, _ := readEvents(t, resp.Body)
+	resp.Body.Close()
+	if diff := cmp.Diff([]string{first.token(1) + " result"}, heads); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+	if s.current() != run || run == first {
+		t.Fatal("new run is not current")
+	}
+
+	// new subscribers follow the new run
+	if _, err := drain(testResults(), run, fakeStatser{Pages: 3}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	heads, _ = readEvents(t, resp.Body)
+	resp.Body.Close()
+	if got, want := len(heads), 4; got != want {
+		t.Errorf("got %d want %d events", got, want)
+	}
+}
+
+func TestBrokerResume(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	s := newServer("", Options{EventWindow: 2}, nil)
+	ts := httptest.NewServer(s.http.Handler)
+	defer ts.Close()
+
+	b := s.current()
+	if _, err := drain(testResults(), b, fakeStatser{Pages: 3}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query  string
+		status int
+		want   []string
+	}{
+		{"?resume=" + b.token(2), http.StatusOK, []string{b.token(3) + " result", b.token(4) + " done"}},
+		{"?resume=" + b.token(3), http.StatusOK, []string{b.token(4) + " done"}},
+		{"?resume=" + b.token(1), http.StatusGone, []string{}},
+		{"", http.StatusOK, []string{b.token(3) + " result", b.token(4) + " done"}},
+		{"?resume=x-y", http.StatusBadRequest, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + "/events" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if got := resp.StatusCode; got != tt.status {
+				t.Errorf("got status %d want %d", got, tt.status)
+			}
+			heads, _ := readEvents(t, resp.Body)
+			if diff := cmp.Diff(tt.want, heads); diff != "" {
+				t.Errorf("events mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServerListen(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	s := newServer("127.0.0.1:0", Options{}, nil)
+	if err := s.listen(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.wait(ctx); err != nil {
+		t.Errorf("shutdown error %v", err)
+	}
+
+	if err := newServer("256.0.0.1:0", Options{}, nil).listen(); err == nil {
+		t.Error("expected listen error")
+	}
+}
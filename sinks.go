@@ -0,0 +1,463 @@
+// sinks.go defines the OutputSink interface used to write results and
+// the built-in text, csv and webhook sinks. The json sink is in
+// output.go, the gob sink in gob.go, the sqlite sink in sqlite.go and
+// the postgres and clickhouse sinks in warehouse.go.
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OutputSink is the interface for writing results. Write is called for
+// each result and Close is called once all results have been written.
+type OutputSink interface {
+	Write(Result) error
+	Close(Stats) error
+}
+
+var (
+	// ErrUnknownOutput reports an unknown output sink kind
+	ErrUnknownOutput = errors.New("unknown output")
+	// ErrOutputTarget reports an output sink without a required target
+	ErrOutputTarget = errors.New("output requires a target")
+)
+
+// multiSink writes to each of its OutputSinks in turn, allowing sinks
+// to be stacked
+type multiSink []OutputSink
+
+// Write writes the result to each sink
+func (m multiSink) Write(r Result) error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Write(r))
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes each sink
+func (m multiSink) Close(stats Stats) error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Close(stats))
+	}
+	return errors.Join(errs...)
+}
+
+// sortingSink buffers results, writing them to its OutputSink sorted by
+// url when closed, so that the reports of different runs can be
+// compared
+type sortingSink struct {
+	sink    OutputSink
+	results []Result
+}
+
+// Write records a result
+func (s *sortingSink) Write(r Result) error {
+	s.results = append(s.results, r)
+	return nil
+}
+
+// Close writes the results sorted by url, then referrer, and closes
+// the sink
+func (s *sortingSink) Close(stats Stats) error {
+	slices.SortStableFunc(s.results, func(a, b Result) int {
+		return cmp.Or(cmp.Compare(a.url, b.url), cmp.Compare(a.referrer, b.referrer))
+	})
+	var errs []error
+	for _, r := range s.results {
+		errs = append(errs, s.sink.Write(r))
+	}
+	errs = append(errs, s.sink.Close(stats))
+	return errors.Join(errs...)
+}
+
+// newOutputSinks makes a multiSink from output specifications of the
+// form "kind[:target]", for example "text", "json:results.json" or
+// "webhook:https://example.com/hook". The target of the text, json, csv
+// and gob sinks defaults to stdout, or "-" may be used.
+func newOutputSinks(specs []string, options Options) (multiSink, error) {
+	sinks := multiSink{}
+	for _, spec := range specs {
+		s, err := newOutputSink(spec, options)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+// newOutputSink makes an OutputSink from an output specification
+func newOutputSink(spec string, options Options) (OutputSink, error) {
+	kind, target, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "text", "json", "csv", "gob":
+		w, err := openOutputTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case "text":
+			return newTextSink(w, options), nil
+		case "json":
+			return newJSONSink(w, options), nil
+		case "gob":
+			return newGobSink(w, options)
+		default:
+			return newCSVSink(w)
+		}
+	case "sqlite":
+		if target == "" {
+			return nil, fmt.Errorf("%s %w", kind, ErrOutputTarget)
+		}
+		return newSQLiteSink(target, options)
+	case "webhook":
+		if target == "" {
+			return nil, fmt.Errorf("%s %w", kind, ErrOutputTarget)
+		}
+		return newWebhookSink(&http.Client{Timeout: WEBHOOKTIMEOUT}, target, options), nil
+	case "postgres":
+		if target == "" {
+			return nil, fmt.Errorf("%s %w", kind, ErrOutputTarget)
+		}
+		return newPostgresSink(target, options)
+	case "clickhouse":
+		if target == "" {
+			return nil, fmt.Errorf("%s %w", kind, ErrOutputTarget)
+		}
+		return newClickHouseSink(&http.Client{Timeout: CLICKHOUSETIMEOUT}, target, options)
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownOutput, kind)
+}
+
+// sqliteOutput returns the target of the first sqlite output in the
+// options, or "" if there is none
+func (o Options) sqliteOutput() string {
+	for _, spec := range o.Output {
+		if kind, target, _ := strings.Cut(spec, ":"); kind == "sqlite" {
+			return target
+		}
+	}
+	return ""
+}
+
+// closingWriter is an io.Writer which may also need closing
+type closingWriter struct {
+	io.Writer
+	closer io.Closer
+}
+
+// close closes the writer, if required
+func (c closingWriter) close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
+
+// openOutputTarget opens a file for output, or uses output for an
+// empty target or "-"
+func openOutputTarget(target string) (closingWriter, error) {
+	if target == "" || target == "-" {
+		return closingWriter{Writer: output}, nil
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return closingWriter{}, fmt.Errorf("could not create output file: %w", err)
+	}
+	return closingWriter{f, f}, nil
+}
+
+// statser provides the Stats of a run, such as a dispatch
+type statser interface {
+	Stats() Stats
+}
+
+// drain writes each result from results to sink, closing the sink with
+// the run Stats from s once the results channel is closed. Results
+// continue to be drained after a write error so that the Dispatcher is
+// not blocked.
+func drain(results <-chan Result, sink OutputSink, s statser) (Stats, error) {
+	var writeErr error
+	for r := range results {
+		if err := sink.Write(r); err != nil && writeErr == nil {
+			writeErr = err
+		}
+	}
+	stats := s.Stats()
+	return stats, errors.Join(writeErr, sink.Close(stats))
+}
+
+// textSink is an OutputSink printing results as human readable text
+type textSink struct {
+	w              closingWriter
+	verbose        bool
+	violationKinds map[string]int
+	top            *topReport    // optional
+	groups         *resultGroups // optional, buffering results by group
+	highlight      highlighter   // optional, colouring search terms
+	noindex        []Result      // pages marked noindex, if reported separately
+	separate       bool          // report pages marked noindex separately
+}
+
+// newTextSink makes a new textSink, printing a header to w
+func newTextSink(w closingWriter, options Options) *textSink {
+	fmt.Fprintf(w, "\nCommencing search of %s:\n", options.Args.BaseURL)
+	t := &textSink{w: w, verbose: options.Verbose.level() >= VerbosePages, violationKinds: map[string]int{}}
+	if options.Top > 0 {
+		t.top = newTopReport(options.Top)
+	}
+	if options.GroupBy != "" {
+		t.groups = newResultGroups(options.GroupBy)
+	}
+	if isColourTerminal(w.Writer) {
+		t.highlight = newHighlighter(options.SearchTerms)
+	}
+	t.separate = options.NoIndex == NOINDEXSEPARATE
+	return t
+}
+
+// Write prints a single result, or buffers it if results are grouped.
+// The url is always printed for results with assertion violations.
+func (t *textSink) Write(r Result) error {
+	if t.top != nil {
+		t.top.add(r)
+	}
+	for _, v := range r.violations {
+		t.violationKinds[v.Kind]++
+	}
+	if t.separate && r.noindex {
+		t.noindex = append(t.noindex, r)
+		return nil
+	}
+	if t.groups != nil {
+		t.groups.add(r)
+		return nil
+	}
+	t.print(t.w, r)
+	return nil
+}
+
+// print prints a result and its assertion violations to w
+func (t *textSink) print(w io.Writer, r Result) {
+	t.printResult(w, r)
+	for _, v := range r.violations {
+		fmt.Fprintf(w, "! assertion failed: %s\n", v)
+	}
+}
+
+// printResult prints the url, status, error or matches of a result
+func (t *textSink) printResult(w io.Writer, r Result) {
+	violated := len(r.violations) > 0
+	switch r.err {
+	case NonHTMLPageType:
+		if violated {
+			fmt.Fprintf(w, "%s%s\n", r.url, languageLabel(r))
+			t.printDetail(w, r)
+		}
+		return
+	case ExternalRedirect:
+		fmt.Fprintf(w, "%s%s\n- redirected off the site to %s (from %s)\n", r.url, languageLabel(r), r.redirect, r.referrer)
+		return
+	case MislabelledPage:
+		fmt.Fprintf(w, "%s%s\n- binary content served as %s (from %s)\n", r.url, languageLabel(r), r.contentType, r.referrer)
+		return
+	case StatusNotOk:
+		fmt.Fprintf(w, "%s%s\n- status %d (from %s)\n", r.url, languageLabel(r), r.status, r.referrer)
+		if !r.anchor.isZero() {
+			fmt.Fprintf(w, "- linked by %s\n", r.anchor)
+		}
+		return
+	default:
+		if r.err != nil {
+			fmt.Fprintf(w, "%s%s : error %v\n", r.url, languageLabel(r), r.err)
+			return
+		}
+	}
+	switch {
+	case (t.verbose || violated || len(r.misspellings) > 0) && len(r.matches) == 0:
+		fmt.Fprintf(w, "%s%s%s\n", redirectLabel(r), pageLabel(r), languageLabel(r))
+		t.printDetail(w, r)
+	case len(r.matches) > 0:
+		fmt.Fprintf(w, "%s%s%s\n", redirectLabel(r), pageLabel(r), languageLabel(r))
+		t.printDetail(w, r)
+		for _, m := range r.matches {
+			fmt.Fprintf(w, "> line: %3d match: %s\n", m.line, t.highlight.paint(m.match))
+		}
+	default:
+		return
+	}
+	if r.truncated {
+		fmt.Fprintln(w, "> further matches not shown")
+	}
+	if len(r.misspellings) > 0 {
+		fmt.Fprintf(w, "? misspelt: %s\n", strings.Join(r.misspellings, ", "))
+	}
+}
+
+// redirectLabel returns the url of a result, showing the url it was
+// redirected to, if any
+func redirectLabel(r Result) string {
+	if r.redirect == "" {
+		return r.url
+	}
+	return r.url + " -> " + r.redirect
+}
+
+// printDetail prints the content type and size of a result, and the
+// worker fetching it, in verbose mode. Only the bodies of the pages
+// searched are read, so others have no size.
+func (t *textSink) printDetail(w io.Writer, r Result) {
+	if !t.verbose || r.contentType == "" {
+		return
+	}
+	detail := r.contentType
+	if r.size > 0 {
+		detail += ", " + formatBytes(int64(r.size))
+	}
+	if r.worker > 0 {
+		detail += fmt.Sprintf(", worker %d", r.worker)
+	}
+	fmt.Fprintf(w, "- %s\n", detail)
+}
+
+// printGroups prints the buffered results under the heading of each
+// group, omitting groups with nothing to print
+func (t *textSink) printGroups() {
+	t.groups.each(func(heading string, results []Result) {
+		var buf bytes.Buffer
+		for _, r := range results {
+			t.print(&buf, r)
+		}
+		if buf.Len() > 0 {
+			fmt.Fprintf(t.w, "\n== %s ==\n%s", heading, buf.Bytes())
+		}
+	})
+}
+
+// Close prints any grouped results and pages marked noindex, the number
+// of pages processed, a summary of any assertion violations and the top
+// lists, if requested
+func (t *textSink) Close(stats Stats) error {
+	if t.groups != nil {
+		t.printGroups()
+	}
+	var buf bytes.Buffer
+	for _, r := range t.noindex {
+		t.print(&buf, r)
+	}
+	if buf.Len() > 0 {
+		fmt.Fprintf(t.w, "\n== pages marked noindex ==\n%s", buf.Bytes())
+	}
+	fmt.Fprintln(t.w, "processed", stats.Pages, "pages")
+	if t.verbose && len(stats.WorkerPages) > 0 {
+		fmt.Fprintln(t.w, "pages by worker:", formatWorkerPages(stats.WorkerPages))
+	}
+	if t.verbose && stats.PeakQueueDepth > 0 {
+		fmt.Fprintln(t.w, "peak queue depth:", stats.PeakQueueDepth, "links")
+	}
+	if pacing := stats.pacing(); t.verbose && pacing != "" {
+		fmt.Fprintln(t.w, "pacing:", pacing)
+	}
+	if stats.Violations > 0 {
+		fmt.Fprintln(t.w, stats.Violations, "assertion violations")
+		kinds := []string{}
+		for k := range t.violationKinds {
+			kinds = append(kinds, k)
+		}
+		slices.Sort(kinds)
+		for _, k := range kinds {
+			fmt.Fprintf(t.w, "  %4d %s\n", t.violationKinds[k], k)
+		}
+	}
+	if t.top != nil {
+		t.top.print(t.w)
+	}
+	return t.w.close()
+}
+
+// csvSink is an OutputSink writing a csv row for each result
+type csvSink struct {
+	w   closingWriter
+	csv *csv.Writer
+}
+
+// newCSVSink makes a new csvSink, writing a header row
+func newCSVSink(w closingWriter) (*csvSink, error) {
+	c := &csvSink{w: w, csv: csv.NewWriter(w)}
+	err := c.csv.Write([]string{"url", "referrer", "status", "error", "matches", "violations", "size", "content_type", "link_text", "link_element", "language"})
+	return c, err
+}
+
+// Write writes a result as a csv row. Matches and violations are each
+// joined into a single field.
+func (c *csvSink) Write(r Result) error {
+	matches := make([]string, len(r.matches))
+	for i, m := range r.matches {
+		matches[i] = fmt.Sprintf("%d:%s", m.line, m.match)
+	}
+	violations := make([]string, len(r.violations))
+	for i, v := range r.violations {
+		violations[i] = v.Message
+	}
+	errString := ""
+	if r.err != nil {
+		errString = r.err.Error()
+	}
+	return c.csv.Write([]string{
+		r.url,
+		r.referrer,
+		strconv.Itoa(r.status),
+		errString,
+		strings.Join(matches, "; "),
+		strings.Join(violations, "; "),
+		strconv.Itoa(r.size),
+		r.contentType,
+		r.anchor.text,
+		r.anchor.element,
+		r.language,
+	})
+}
+
+// Close flushes the csv output
+func (c *csvSink) Close(_ Stats) error {
+	c.csv.Flush()
+	return errors.Join(c.csv.Error(), c.w.close())
+}
+
+// webhookSink is an OutputSink posting the results of a run in a
+// jsonEnvelope to a webhook when closed
+type webhookSink struct {
+	client  *http.Client
+	url     string
+	options Options
+	results []jsonResult
+}
+
+// newWebhookSink makes a new webhookSink
+func newWebhookSink(client *http.Client, url string, options Options) *webhookSink {
+	return &webhookSink{client: client, url: url, options: options, results: []jsonResult{}}
+}
+
+// Write records a result
+func (w *webhookSink) Write(r Result) error {
+	w.results = append(w.results, newJSONResult(r))
+	return nil
+}
+
+// Close posts the jsonEnvelope to the webhook
+func (w *webhookSink) Close(stats Stats) error {
+	return postJSON(w.client, w.url, newJSONEnvelope(w.options, stats, w.results))
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTextSink(t *testing.T) {
+
+	resulter := func() <-chan Result {
+		r := make(chan Result, 5)
+		r <- Result{
+			url:     "http://example.com/nomatches",
+			status:  200,
+			matches: []SearchMatch{},
+		}
+		r <- Result{
+			err: NonHTMLPageType,
+		}
+		r <- Result{
+			referrer: "/referrer",
+			url:      "http://example.com/403",
+			status:   403,
+			err:      StatusNotOk,
+		}
+		r <- Result{
+			url:    "http://example.com/unknown",
+			status: 200,
+			err:    errors.New("unknown error"),
+		}
+		r <- Result{
+			url:     "http://example.com/matches",
+			status:  200,
+			matches: []SearchMatch{{2, "hi", 0}, {99, "there", 0}},
+		}
+		close(r)
+		return r
+	}
+
+	var buf bytes.Buffer
+	options := Options{Verbose: verbosity{true}}
+	options.Args.BaseURL = "https://example.com"
+	sink := newTextSink(closingWriter{Writer: &buf}, options)
+	if _, err := drain(resulter(), sink, fakeStatser{Pages: 5}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	want := `
+Commencing search of https://example.com:
+http://example.com/nomatches
+http://example.com/403
+- status 403 (from /referrer)
+http://example.com/unknown : error unknown error
+http://example.com/matches
+> line:   2 match: hi
+> line:  99 match: there
+processed 5 pages
+`
+	got := buf.String()
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTextSinkDetail(t *testing.T) {
+
+	tests := []struct {
+		result  Result
+		verbose bool
+		want    string
+	}{
+		{
+			result:  Result{url: "http://example.com/page", status: 200, size: 2048, contentType: "text/html"},
+			verbose: true,
+			want:    "http://example.com/page\n- text/html, 2.0 kB\n",
+		},
+		{
+			result:  Result{url: "http://example.com/empty", status: 200, contentType: "text/html"},
+			verbose: true,
+			want:    "http://example.com/empty\n- text/html\n",
+		},
+		{
+			result:  Result{url: "http://example.com/untyped", status: 200, size: 10},
+			verbose: true,
+			want:    "http://example.com/untyped\n",
+		},
+		{
+			result: Result{url: "http://example.com/footer", status: 200, matches: []SearchMatch{{1, "hi", 0}}, truncated: true},
+			want:   "http://example.com/footer\n> line:   1 match: hi\n> further matches not shown\n",
+		},
+		{
+			result: Result{url: "http://example.com/typos", status: 200, matches: []SearchMatch{}, misspellings: []string{"recieve", "teh"}},
+			want:   "http://example.com/typos\n? misspelt: recieve, teh\n",
+		},
+		{
+			result: Result{url: "http://example.com/capped", status: 200, matches: []SearchMatch{}, truncated: true},
+			want:   "",
+		},
+		{
+			result: Result{url: "http://example.com/old", status: 200, redirect: "http://example.com/new", matches: []SearchMatch{{1, "hi", 0}}},
+			want:   "http://example.com/old -> http://example.com/new\n> line:   1 match: hi\n",
+		},
+		{
+			result: Result{url: "http://example.com/gone", referrer: "http://example.com", status: 404, err: StatusNotOk, anchor: linkAnchor{"Old page", "footer"}},
+			want:   "http://example.com/gone\n- status 404 (from http://example.com)\n- linked by \"Old page\" in footer\n",
+		},
+		{
+			result: Result{url: "http://example.com/partner", referrer: "http://example.com", status: 302, redirect: "https://expired.example.net/signup", err: ExternalRedirect},
+			want:   "http://example.com/partner\n- redirected off the site to https://expired.example.net/signup (from http://example.com)\n",
+		},
+		{
+			result: Result{url: "http://example.com/report", referrer: "http://example.com", status: 200, contentType: "text/html", err: MislabelledPage},
+			want:   "http://example.com/report\n- binary content served as text/html (from http://example.com)\n",
+		},
+		{
+			result: Result{url: "http://example.com/page", status: 200, size: 2048, contentType: "text/html", matches: []SearchMatch{{1, "hi", 0}}},
+			want:   "http://example.com/page\n> line:   1 match: hi\n",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			sink := &textSink{w: closingWriter{Writer: &buf}, verbose: tt.verbose, violationKinds: map[string]int{}}
+			if err := sink.Write(tt.result); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, buf.String()); diff != "" {
+				t.Errorf("output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTextSinkViolations(t *testing.T) {
+
+	r := make(chan Result, 3)
+	r <- Result{
+		url:        "http://example.com/blog",
+		status:     200,
+		matches:    []SearchMatch{},
+		violations: []Violation{{"missing text", "missing text"}},
+	}
+	r <- Result{
+		url:        "http://example.com/file.pdf",
+		status:     200,
+		err:        NonHTMLPageType,
+		violations: []Violation{{"status", "status 200 want 404"}},
+	}
+	r <- Result{
+		url:     "http://example.com/ok",
+		status:  200,
+		matches: []SearchMatch{},
+	}
+	close(r)
+
+	var buf bytes.Buffer
+	options := Options{}
+	options.Args.BaseURL = "https://example.com"
+	sink := newTextSink(closingWriter{Writer: &buf}, options)
+	if _, err := drain(r, sink, fakeStatser{Pages: 3, Violations: 2}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := `
+Commencing search of https://example.com:
+http://example.com/blog
+! assertion failed: missing text
+http://example.com/file.pdf
+! assertion failed: status 200 want 404
+processed 3 pages
+2 assertion violations
+     1 missing text
+     1 status
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewOutputSink(t *testing.T) {
+
+	dir := t.TempDir()
+	tests := []struct {
+		spec  string
+		want  any
+		isErr bool
+		err   error
+	}{
+		{spec: "text", want: &textSink{}},
+		{spec: "text:-", want: &textSink{}},
+		{spec: "json:" + filepath.Join(dir, "out.json"), want: &jsonSink{}},
+		{spec: "csv:" + filepath.Join(dir, "out.csv"), want: &csvSink{}},
+		{spec: "gob:" + filepath.Join(dir, "out.gob"), want: &gobSink{}},
+		{spec: "sqlite:" + filepath.Join(dir, "out.db"), want: &sqliteSink{}},
+		{spec: "webhook:https://example.com/hook", want: &webhookSink{}},
+		{spec: "sqlite", isErr: true, err: ErrOutputTarget},
+		{spec: "webhook", isErr: true, err: ErrOutputTarget},
+		{spec: "postgres", isErr: true, err: ErrOutputTarget},
+		{spec: "clickhouse", isErr: true, err: ErrOutputTarget},
+		{spec: "xml", isErr: true, err: ErrUnknownOutput},
+		{spec: "csv:" + filepath.Join(dir, "missing", "out.csv"), isErr: true},
+	}
+
+	var buf bytes.Buffer
+	output = &buf
+	defer func() { output = os.Stdout }()
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			sink, err := newOutputSink(tt.spec, Options{})
+			if err != nil {
+				if !tt.isErr {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Errorf("got error %v want %v", err, tt.err)
+				}
+				return
+			}
+			if tt.isErr {
+				t.Fatal("expected error")
+			}
+			if got, want := fmt.Sprintf("%T", sink), fmt.Sprintf("%T", tt.want); got != want {
+				t.Errorf("got sink type %s want %s", got, want)
+			}
+			if _, ok := sink.(*webhookSink); ok {
+				return // closing would post
+			}
+			if err := sink.Close(Stats{}); err != nil {
+				t.Errorf("close error %v", err)
+			}
+		})
+	}
+
+	t.Run("stacked", func(t *testing.T) {
+		sinks, err := newOutputSinks([]string{"text", "csv:-"}, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(sinks), 2; got != want {
+			t.Errorf("got %d want %d sinks", got, want)
+		}
+		_, err = newOutputSinks([]string{"text", "xml"}, Options{})
+		if !errors.Is(err, ErrUnknownOutput) {
+			t.Errorf("got error %v want %v", err, ErrUnknownOutput)
+		}
+	})
+}
+
+// testResults returns a closed channel of results for testing sinks
+func testResults() <-chan Result {
+	r := make(chan Result, 3)
+	r <- Result{
+		url:         "https://example.com",
+		referrer:    "/",
+		status:      200,
+		size:        2048,
+		contentType: "text/html",
+		matches:     []SearchMatch{{3, "hi", 0}, {10, "there", 0}},
+	}
+	r <- Result{
+		url:        "https://example.com/gone",
+		referrer:   "https://example.com",
+		status:     404,
+		err:        StatusNotOk,
+		violations: []Violation{{"status", "status 404 want 200 (/)"}},
+		anchor:     linkAnchor{"Old page", "footer"},
+	}
+	r <- Result{
+		url:      "https://example.com/slow",
+		referrer: "https://example.com",
+		err:      errors.New("timeout"),
+	}
+	close(r)
+	return r
+}
+
+func TestCSVSink(t *testing.T) {
+
+	var buf bytes.Buffer
+	sink, err := newCSVSink(closingWriter{Writer: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := drain(testResults(), sink, fakeStatser{Pages: 3, Termination: TerminationIdle}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("csv read error %v", err)
+	}
+	want := [][]string{
+		{"url", "referrer", "status", "error", "matches", "violations", "size", "content_type", "link_text", "link_element", "language"},
+		{"https://example.com", "/", "200", "", "3:hi; 10:there", "", "2048", "text/html", "", "", ""},
+		{"https://example.com/gone", "https://example.com", "404", "StatusNotOk", "", "status 404 want 200 (/)", "0", "", "Old page", "footer", ""},
+		{"https://example.com/slow", "https://example.com", "0", "timeout", "", "", "0", "", "", "", ""},
+	}
+	if diff := cmp.Diff(want, records); diff != "" {
+		t.Errorf("csv mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+
+	var received jsonEnvelope
+	httpHandler := http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+				t.Errorf("could not decode envelope: %v", err)
+			}
+		},
+	)
+	server := httptest.NewServer(httpHandler)
+	defer server.Close()
+
+	sink := newWebhookSink(&http.Client{Timeout: 300 * time.Millisecond}, server.URL, Options{})
+	if _, err := drain(testResults(), sink, fakeStatser{Pages: 3, Termination: TerminationIdle}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := len(received.Results), 3; got != want {
+		t.Errorf("got %d want %d results", got, want)
+	}
+	if got, want := received.Termination, TerminationIdle; got != want {
+		t.Errorf("termination got %s want %s", got, want)
+	}
+}
+
+// errSink is an OutputSink which always errors
+type errSink struct{ err error }
+
+func (e errSink) Write(Result) error { return e.err }
+func (e errSink) Close(Stats) error  { return e.err }
+
+func TestMultiSink(t *testing.T) {
+
+	var buf bytes.Buffer
+	writeErr := errors.New("write error")
+	sinks := multiSink{
+		newTextSink(closingWriter{Writer: &buf}, Options{}),
+		errSink{writeErr},
+	}
+	_, err := drain(testResults(), sinks, fakeStatser{Pages: 3})
+	if !errors.Is(err, writeErr) {
+		t.Errorf("got error %v want %v", err, writeErr)
+	}
+	// results are drained and written to other sinks despite errors
+	if !bytes.Contains(buf.Bytes(), []byte("processed 3 pages")) {
+		t.Errorf("text sink output unexpected: %s", buf.String())
+	}
+}
+
+func TestSortingSink(t *testing.T) {
+
+	results := make(chan Result, 4)
+	for _, r := range []Result{
+		{url: "https://example.com/b", referrer: "https://example.com"},
+		{url: "https://example.com/a", referrer: "https://example.com/c"},
+		{url: "https://example.com", referrer: "/"},
+		{url: "https://example.com/a", referrer: "https://example.com"},
+	} {
+		results <- r
+	}
+	close(results)
+
+	var buf bytes.Buffer
+	sink, err := newCSVSink(closingWriter{Writer: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := drain(results, &sortingSink{sink: sink}, fakeStatser{}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("csv read error %v", err)
+	}
+	got := []string{}
+	for _, record := range records[1:] {
+		got = append(got, record[0]+" "+record[1])
+	}
+	want := []string{
+		"https://example.com /",
+		"https://example.com/a https://example.com",
+		"https://example.com/a https://example.com/c",
+		"https://example.com/b https://example.com",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("order mismatch (-want +got):\n%s", diff)
+	}
+}
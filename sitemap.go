@@ -0,0 +1,129 @@
+// sitemap.go reads the sitemaps listed in the robots.txt file of a site,
+// following sitemap indexes, for the urls to seed a crawl with.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SITEMAPMAXFILES is the most sitemaps read for a site, including those
+// listed in sitemap indexes
+const SITEMAPMAXFILES = 50
+
+// SITEMAPMAXBYTES is the largest sitemap read, after decompression
+const SITEMAPMAXBYTES = 50 << 20
+
+// ErrSitemap reports a sitemap which could not be read
+var ErrSitemap = errors.New("sitemap error")
+
+// sitemapXML is a sitemap, listing urls, or a sitemap index, listing
+// further sitemaps
+type sitemapXML struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// parseSitemap parses a sitemap or sitemap index, which may be gzipped,
+// returning the urls and further sitemaps it lists
+func parseSitemap(body []byte) (urls, sitemaps []string, err error) {
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		body, err = io.ReadAll(io.LimitReader(zr, SITEMAPMAXBYTES))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	var s sitemapXML
+	if err := xml.Unmarshal(body, &s); err != nil {
+		return nil, nil, err
+	}
+	for _, u := range s.URLs {
+		urls = append(urls, strings.TrimSpace(u.Loc))
+	}
+	for _, sm := range s.Sitemaps {
+		sitemaps = append(sitemaps, strings.TrimSpace(sm.Loc))
+	}
+	return urls, sitemaps, nil
+}
+
+// fetch gets the body of url with the getClient, returning the status of
+// the response
+func (g *getClient) fetch(url string) ([]byte, int, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	g.setHost(req)
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, SITEMAPMAXBYTES))
+	return body, resp.StatusCode, err
+}
+
+// sitemapSeeds returns links to the urls listed in the sitemaps given in
+// the robots.txt file of the site of baseURL, with the sitemap listing
+// each as its referrer. A site without a robots.txt file has no
+// sitemaps. Sitemaps which cannot be read are reported in the error,
+// with the links of the others.
+func (g *getClient) sitemapSeeds(baseURL string) ([]refLink, error) {
+	robots, err := g.robots(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSitemap, err)
+	}
+	seeds := []refLink{}
+	var errs []error
+	queue := robots.sitemaps
+	seen := map[string]bool{}
+	for len(queue) > 0 && len(seen) < SITEMAPMAXFILES {
+		sitemap := queue[0]
+		queue = queue[1:]
+		if seen[sitemap] {
+			continue
+		}
+		seen[sitemap] = true
+		sitemapURL, err := url.Parse(sitemap)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", ErrSitemap, err))
+			continue
+		}
+		body, status, err := g.fetch(sitemap)
+		if err == nil && status != http.StatusOK {
+			err = fmt.Errorf("status %d", status)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrSitemap, sitemap, err))
+			continue
+		}
+		urls, sitemaps, err := parseSitemap(body)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrSitemap, sitemap, err))
+			continue
+		}
+		for _, u := range urls {
+			if link, ok := resolveLink(sitemapURL, u); ok {
+				seeds = append(seeds, refLink{url: link, referrer: sitemap, depth: 1})
+			}
+		}
+		queue = append(queue, sitemaps...)
+	}
+	return seeds, errors.Join(errs...)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// gzipped returns s gzipped
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseSitemap(t *testing.T) {
+
+	urlset := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/</loc><lastmod>2024-01-01</lastmod></url>
+  <url><loc>
+    https://example.com/about
+  </loc></url>
+</urlset>`
+	index := `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/sitemap1.xml</loc></sitemap>
+</sitemapindex>`
+
+	tests := []struct {
+		body         []byte
+		urls, nested []string
+		isErr        bool
+	}{
+		{body: []byte(urlset), urls: []string{"https://example.com/", "https://example.com/about"}},
+		{body: gzipped(t, urlset), urls: []string{"https://example.com/", "https://example.com/about"}},
+		{body: []byte(index), nested: []string{"https://example.com/sitemap1.xml"}},
+		{body: []byte("<urlset><url>"), isErr: true},
+		{body: []byte{0x1f, 0x8b, 0}, isErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			urls, nested, err := parseSitemap(tt.body)
+			if (err != nil) != tt.isErr {
+				t.Fatalf("got error %v want error %t", err, tt.isErr)
+			}
+			if diff := cmp.Diff(tt.urls, urls); diff != "" {
+				t.Errorf("urls mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.nested, nested); diff != "" {
+				t.Errorf("sitemaps mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSitemapSeeds(t *testing.T) {
+
+	var server *httptest.Server
+	robots := ""
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		if robots == "" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, robots)
+	})
+	mux.HandleFunc("/index.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<sitemapindex>
+<sitemap><loc>%[1]s/pages.xml.gz</loc></sitemap>
+<sitemap><loc>%[1]s/missing.xml</loc></sitemap>
+<sitemap><loc>%[1]s/index.xml</loc></sitemap>
+</sitemapindex>`, server.URL)
+	})
+	mux.HandleFunc("/pages.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(gzipped(t, fmt.Sprintf(`<urlset>
+<url><loc>%[1]s/</loc></url>
+<url><loc>%[1]s/a/</loc></url>
+<url><loc>/b#top</loc></url>
+</urlset>`, server.URL)))
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	g := NewGetClient(1, time.Second)
+
+	// no robots.txt
+	seeds, err := g.sitemapSeeds(server.URL)
+	if err != nil || len(seeds) != 0 {
+		t.Errorf("got seeds %v error %v without robots.txt", seeds, err)
+	}
+
+	robots = "User-agent: *\nSitemap: " + server.URL + "/index.xml\n"
+	seeds, err = g.sitemapSeeds(server.URL + "/start")
+	if !errors.Is(err, ErrSitemap) {
+		t.Errorf("got error %v want %v for the missing sitemap", err, ErrSitemap)
+	}
+	got := []string{}
+	for _, s := range seeds {
+		if s.referrer != server.URL+"/pages.xml.gz" || s.depth != 1 {
+			t.Errorf("unexpected seed %+v", s)
+		}
+		got = append(got, s.url)
+	}
+	slices.Sort(got)
+	want := []string{server.URL, server.URL + "/a", server.URL + "/b"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("seeds mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,104 @@
+// sniff.go classifies responses without a useful Content-Type by
+// sniffing the start of their body, so that pages served without a
+// Content-Type or as application/octet-stream are searched if they are
+// html and skipped if they are binary. Binary content served as html,
+// such as a pdf or image behind a misconfigured server, is detected too
+// so that it is reported rather than searched.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// SNIFFBYTES is the number of bytes of a body sniffed, the most
+// http.DetectContentType considers
+const SNIFFBYTES = 512
+
+// BINARYSNIFFBYTES is the number of bytes of a page searched for NUL
+// bytes, which text does not contain, as git does
+const BINARYSNIFFBYTES = 8000
+
+// genericContentTypes are the Content-Types which say nothing about
+// the content of a response
+var genericContentTypes = map[string]bool{
+	"":                         true,
+	"application/octet-stream": true,
+	"binary/octet-stream":      true,
+	"application/unknown":      true,
+	"application/x-unknown":    true,
+	"unknown/unknown":          true,
+}
+
+// genericContentType reports whether the Content-Type ct is missing or
+// generic
+func genericContentType(ct string) bool {
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(ct, ";")
+	}
+	return genericContentTypes[strings.ToLower(strings.TrimSpace(mediaType))]
+}
+
+// hasExtension reports whether the last segment of the path of u has
+// a file extension, such as .zip
+func hasExtension(u *url.URL) bool {
+	return path.Ext(path.Base(u.Path)) != ""
+}
+
+// sniffContentType returns the Content-Type of body detected from its
+// first SNIFFBYTES by http.DetectContentType, and a reader of the whole
+// body, including the bytes sniffed
+func sniffContentType(body io.Reader) (string, io.Reader, error) {
+	head, err := io.ReadAll(io.LimitReader(body, SNIFFBYTES))
+	if err != nil {
+		return "", nil, err
+	}
+	return http.DetectContentType(head), io.MultiReader(bytes.NewReader(head), body), nil
+}
+
+// binarySignatures are the magic numbers starting binary files often
+// served as html by misconfigured servers, such as documents, archives,
+// images and fonts. Files whose signatures include a NUL byte, such as
+// mp4 video, are found by their NUL bytes.
+var binarySignatures = [][]byte{
+	[]byte("%PDF-"),
+	[]byte("PK\x03\x04"), []byte("PK\x05\x06"), // zip, and office documents
+	[]byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), // older office documents
+	[]byte("\x1f\x8b"),                         // gzip
+	[]byte("7z\xbc\xaf\x27\x1c"),
+	[]byte("Rar!\x1a\x07"),
+	[]byte("\xfd7zXZ"),
+	[]byte("\x28\xb5\x2f\xfd"), // zstd
+	[]byte("\x89PNG\r\n\x1a\n"),
+	[]byte("GIF87a"), []byte("GIF89a"),
+	[]byte("\xff\xd8\xff"),     // jpeg
+	[]byte("RIFF"),             // webp, wav and avi
+	[]byte("\x1a\x45\xdf\xa3"), // webm and mkv
+	[]byte("OggS"),
+	[]byte("wOFF"), []byte("wOF2"),
+	[]byte("\x7fELF"),
+}
+
+// binaryContent reports whether body, read as a page, is binary: its
+// first BINARYSNIFFBYTES include a NUL byte, which text does not, or it
+// starts with the signature of a binary file, such as a pdf or zip file.
+// Other control characters, which pages pasted from word processors
+// often include, do not make a page binary.
+func binaryContent(body []byte) bool {
+	if bytes.IndexByte(body[:min(len(body), BINARYSNIFFBYTES)], 0) >= 0 {
+		return true
+	}
+	for _, signature := range binarySignatures {
+		if bytes.HasPrefix(body, signature) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGenericContentType(t *testing.T) {
+	for _, tt := range []struct {
+		ct   string
+		want bool
+	}{
+		{"", true},
+		{"application/octet-stream", true},
+		{"Application/Octet-Stream; charset=binary", true},
+		{"binary/octet-stream", true},
+		{"text/html; charset=utf-8", false},
+		{"application/pdf", false},
+		{"text/plain", false},
+	} {
+		if got := genericContentType(tt.ct); got != tt.want {
+			t.Errorf("%q: got %t want %t", tt.ct, got, tt.want)
+		}
+	}
+}
+
+func TestSniffContentType(t *testing.T) {
+	page := "<!DOCTYPE html><p>" + strings.Repeat("hello ", 200) + "</p>"
+	ct, r, err := sniffContentType(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ct, "text/html; charset=utf-8"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+	body, _ := io.ReadAll(r)
+	if got := string(body); got != page {
+		t.Errorf("body changed by sniffing, got %d bytes want %d", len(got), len(page))
+	}
+}
+
+func TestGetURLSniffing(t *testing.T) {
+
+	html := `<html><body>hello <a href="/linked">linked</a></body></html>`
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR" + strings.Repeat("\x00", 40)
+	httpHandler := http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, ct := html, "application/octet-stream"
+			switch r.URL.Path {
+			case "/none":
+				ct = ""
+			case "/image":
+				body = png
+			case "/text":
+				body = "hello, just text"
+			}
+			w.Header()["Content-Type"] = []string{ct} // not sniffed by the server
+			if ct == "" {
+				w.Header()["Content-Type"] = nil
+			}
+			fmt.Fprint(w, body)
+		},
+	)
+	server := httptest.NewServer(httpHandler)
+	defer server.Close()
+
+	g := NewGetClient(1, 0)
+	for _, tt := range []struct {
+		path        string
+		contentType string
+		err         error
+		links       int
+	}{
+		{"/none", "text/html; charset=utf-8", nil, 1},
+		{"/octet", "text/html; charset=utf-8", nil, 1},
+		{"/image", "image/png", NonHTMLPageType, 0},
+		{"/text", "text/plain; charset=utf-8", NonHTMLPageType, 0},
+		{"/page.bin", "application/octet-stream", NonHTMLPageType, 0}, // not sniffed
+	} {
+		result, links := g.get(server.URL+tt.path, "/", []string{"hello"})
+		if result.err != tt.err {
+			t.Errorf("%s: got error %v want %v", tt.path, result.err, tt.err)
+		}
+		if result.contentType != tt.contentType {
+			t.Errorf("%s: got content type %q want %q", tt.path, result.contentType, tt.contentType)
+		}
+		if len(links) != tt.links {
+			t.Errorf("%s: got %d links want %d", tt.path, len(links), tt.links)
+		}
+		if tt.err == nil && len(result.matches) != 1 {
+			t.Errorf("%s: got %d matches want 1", tt.path, len(result.matches))
+		}
+	}
+}
+
+func TestBinaryContent(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"html", "<!DOCTYPE html><p>hello</p>", false},
+		{"text", "hello, just text", false},
+		{"empty", "", false},
+		{"utf-8", "\xef\xbb\xbfhéllo wörld", false},
+		{"xml", `<?xml version="1.0"?><urlset/>`, false},
+		{"pdf", "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj", true},
+		{"zip", "PK\x03\x04\x14\x00\x00\x00", true},
+		{"nul after the sniffed bytes", strings.Repeat("a", 1000) + "\x00", true},
+		{"png", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", true},
+		{"gif", "GIF89a\x01\x01", true},
+		{"gzip", "\x1f\x8b\x08\x08", true},
+		{"html with control characters", "<!DOCTYPE html><p>pasted\x0b from \x1b[1mword\x7f</p>", false},
+		{"control bytes", "\x01\x02\x03 garbage", false},
+	} {
+		if got := binaryContent([]byte(tt.body)); got != tt.want {
+			t.Errorf("%s: got %t want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetURLMislabelled(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if r.URL.Path == "/pasted" {
+				fmt.Fprint(w, "<html><body><p>\x0bhello\x1f</p><a href=\"/linked\">x</a></body></html>")
+				return
+			}
+			fmt.Fprint(w, "%PDF-1.7\n<a href=\"/linked\">hello</a>\x00\x00")
+		},
+	))
+	defer server.Close()
+
+	// a page with stray control characters is still searched
+	result, links := NewGetClient(1, 0).get(server.URL+"/pasted", "/", []string{"hello"})
+	if result.err != nil || len(result.matches) != 1 || len(links) != 1 {
+		t.Errorf("pasted page got error %v, %d matches and %d links", result.err, len(result.matches), len(links))
+	}
+
+	result, links = NewGetClient(1, 0).get(server.URL, "/", []string{"hello"})
+	if result.err != MislabelledPage {
+		t.Errorf("got error %v want %v", result.err, MislabelledPage)
+	}
+	if len(result.matches) != 0 || len(links) != 0 {
+		t.Errorf("got %d matches and %d links want none", len(result.matches), len(links))
+	}
+	if result.size == 0 {
+		t.Error("the size of the page should be recorded")
+	}
+	stats := newStats()
+	stats.add(result)
+	if stats.Errors != 1 || stats.ErrorKinds["binary served as html"] != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,188 @@
+// spell.go checks the spelling of the visible text of pages against a
+// dictionary of the words of a language, together with any extra words
+// such as product names, reporting the words not found on each page.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// ErrNoDictionary reports a language without a dictionary
+var ErrNoDictionary = errors.New("no dictionary found")
+
+// dictionaryDirs are the directories searched for the dictionary of a
+// language
+var dictionaryDirs = []string{"/usr/share/dict", "/usr/share/hunspell", "/usr/share/myspell", "/usr/share/myspell/dicts"}
+
+// dictionaryNames are the names of the word lists of some languages as
+// commonly installed, in addition to the language itself and its
+// hunspell dictionary
+var dictionaryNames = map[string][]string{
+	"en_GB": {"british-english"},
+	"en_US": {"american-english"},
+	"en_CA": {"canadian-english"},
+	"de_DE": {"ngerman"},
+	"fr_FR": {"french"},
+	"es_ES": {"spanish"},
+	"it_IT": {"italian"},
+}
+
+// wordPattern matches the words of visible text, including those with
+// apostrophes such as "don't"
+var wordPattern = regexp.MustCompile(`\p{L}+(?:['’]\p{L}+)*`)
+
+// invisibleElements are the html elements whose text is not visible
+var invisibleElements = map[string]bool{"script": true, "style": true, "noscript": true, "template": true}
+
+// spellChecker checks words against a dictionary
+type spellChecker struct {
+	words map[string]struct{}
+}
+
+// newSpellChecker makes a spellChecker for the dictionary of lang,
+// found in dictionaryDirs, and the word lists in extra
+func newSpellChecker(lang string, extra []string) (*spellChecker, error) {
+	s := &spellChecker{words: map[string]struct{}{}}
+	filename, err := findDictionary(lang)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range append([]string{filename}, extra...) {
+		if err := s.load(f); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// findDictionary returns the file name of the dictionary of lang, such
+// as en_GB or en-GB
+func findDictionary(lang string) (string, error) {
+	lang = strings.ReplaceAll(lang, "-", "_")
+	names := append([]string{lang, lang + ".dic"}, dictionaryNames[lang]...)
+	for _, dir := range dictionaryDirs {
+		for _, name := range names {
+			filename := filepath.Join(dir, name)
+			if fi, err := os.Stat(filename); err == nil && fi.Mode().IsRegular() {
+				return filename, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w for %s in %s", ErrNoDictionary, lang, strings.Join(dictionaryDirs, ", "))
+}
+
+// load adds the words in a word list, with one word to a line, or a
+// hunspell dictionary, whose affixes are ignored
+func (s *spellChecker) load(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("could not open dictionary: %w", err)
+	}
+	defer f.Close()
+	return s.read(f, strings.HasSuffix(filename, ".dic"))
+}
+
+// read adds the words read from r, skipping the word count on the first
+// line of a hunspell dictionary
+func (s *spellChecker) read(r io.Reader, hunspell bool) error {
+	scanner := bufio.NewScanner(r)
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimSpace(scanner.Text())
+		if first && hunspell {
+			continue
+		}
+		if hunspell {
+			line, _, _ = strings.Cut(line, "/")
+			line, _, _ = strings.Cut(line, "\t")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s.words[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read dictionary: %w", err)
+	}
+	return nil
+}
+
+// known reports whether word, or its lowercase form, is in the
+// dictionary
+func (s *spellChecker) known(word string) bool {
+	if _, ok := s.words[word]; ok {
+		return true
+	}
+	_, ok := s.words[strings.ToLower(word)]
+	return ok
+}
+
+// check returns the words of the visible text of an html page which are
+// not in the dictionary, sorted without duplicates. Capitalised words
+// are not reported, as names cannot be told from misspellings.
+func (s *spellChecker) check(body []byte) []string {
+	misspelt := []string{}
+	for _, word := range visibleWords(body) {
+		word = strings.ReplaceAll(word, "’", "'")
+		if s.known(word) || unicode.IsUpper([]rune(word)[0]) {
+			continue
+		}
+		misspelt = append(misspelt, word)
+	}
+	slices.Sort(misspelt)
+	return slices.Compact(misspelt)
+}
+
+// visibleWords returns the words of the visible text of an html page
+func visibleWords(body []byte) []string {
+	return wordPattern.FindAllString(visibleText(body), -1)
+}
+
+// visibleText returns the visible text of an html page, with a space
+// between the text of each element
+func visibleText(body []byte) string {
+	var text strings.Builder
+	for _, t := range visibleTextRuns(body) {
+		text.WriteString(t)
+		text.WriteByte(' ')
+	}
+	return text.String()
+}
+
+// visibleTextRuns returns the text of each element of an html page
+// which is visible, in order
+func visibleTextRuns(body []byte) []string {
+	runs := []string{}
+	hidden := 0 // depth within invisible elements
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return runs
+		case html.StartTagToken:
+			if name, _ := z.TagName(); invisibleElements[string(name)] {
+				hidden++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); invisibleElements[string(name)] && hidden > 0 {
+				hidden--
+			}
+		case html.TextToken:
+			if hidden == 0 {
+				runs = append(runs, string(z.Text()))
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSpellChecker(t *testing.T) {
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	write("british-english", "the\nwelcome\nto\nour\ncolour\npage\ndon't\nwrote\n")
+	write("xx_XX.dic", "2\nbonjour/S\nmonde\n")
+	extra := write("extra.txt", "# product names\nwebchk\n")
+
+	defer func(dirs []string) { dictionaryDirs = dirs }(dictionaryDirs)
+	dictionaryDirs = []string{filepath.Join(dir, "missing"), dir}
+
+	s, err := newSpellChecker("en-GB", []string{extra})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `<html><head><title>Welcome</title><style>.colr{}</style></head>
+<body><p>Welcome to our colour page, teh webchk page. Don’t mispell &amp; recieve.</p>
+<script>var colr = 1;</script><p>Rory wrote teh page</p></body></html>`
+	want := []string{"mispell", "recieve", "teh"}
+	if diff := cmp.Diff(want, s.check([]byte(body))); diff != "" {
+		t.Errorf("misspellings mismatch (-want +got):\n%s", diff)
+	}
+
+	s, err = newSpellChecker("xx_XX", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"hello"}, s.check([]byte("<p>bonjour hello monde</p>"))); diff != "" {
+		t.Errorf("hunspell misspellings mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := newSpellChecker("zz_ZZ", nil); !errors.Is(err, ErrNoDictionary) {
+		t.Errorf("got error %v want %v", err, ErrNoDictionary)
+	}
+	if _, err := newSpellChecker("en_GB", []string{filepath.Join(dir, "none.txt")}); err == nil || !strings.Contains(err.Error(), "could not open") {
+		t.Errorf("got error %v for a missing dictionary", err)
+	}
+}
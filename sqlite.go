@@ -0,0 +1,195 @@
+// sqlite.go provides an OutputSink storing runs and their results in a
+// sqlite database, using the pure go modernc.org/sqlite driver so that
+// webchk can continue to be built without cgo.
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema is the database schema. Each run is recorded in runs,
+// with the results, matches and violations of the run linked to it. The
+// runs are read back by history.go.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id          INTEGER PRIMARY KEY,
+	baseurl     TEXT NOT NULL,
+	start       TEXT NOT NULL,
+	end         TEXT,
+	termination TEXT,
+	pages       INTEGER,
+	errors      INTEGER,
+	broken      INTEGER,
+	violations  INTEGER,
+	tags        TEXT
+);
+CREATE TABLE IF NOT EXISTS results (
+	id       INTEGER PRIMARY KEY,
+	run_id   INTEGER NOT NULL REFERENCES runs(id),
+	url      TEXT NOT NULL,
+	referrer TEXT,
+	status   INTEGER,
+	error    TEXT,
+	size     INTEGER,
+	content_type TEXT,
+	checksum TEXT,
+	text     TEXT,
+	language TEXT
+);
+CREATE TABLE IF NOT EXISTS matches (
+	result_id INTEGER NOT NULL REFERENCES results(id),
+	line      INTEGER,
+	term      TEXT,
+	byte_offset INTEGER
+);
+CREATE TABLE IF NOT EXISTS violations (
+	result_id INTEGER NOT NULL REFERENCES results(id),
+	kind      TEXT,
+	message   TEXT
+);
+CREATE INDEX IF NOT EXISTS results_run_id ON results(run_id);
+CREATE INDEX IF NOT EXISTS matches_result_id ON matches(result_id);
+CREATE INDEX IF NOT EXISTS violations_result_id ON violations(result_id);
+`
+
+// sqliteMigrations are the columns added to the tables of databases
+// made by earlier versions, by table and column
+var sqliteMigrations = []struct{ table, column, kind string }{
+	{"results", "size", "INTEGER"},
+	{"results", "content_type", "TEXT"},
+	{"matches", "byte_offset", "INTEGER"},
+	{"results", "checksum", "TEXT"},
+	{"results", "text", "TEXT"},
+	{"runs", "tags", "TEXT"},
+	{"results", "language", "TEXT"},
+}
+
+// migrateSQLite adds any missing columns to a database made by an
+// earlier version
+func migrateSQLite(db *sql.DB) error {
+	for _, m := range sqliteMigrations {
+		ok, err := hasColumn(db, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.kind))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasColumn reports whether table has column
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+	return n > 0, err
+}
+
+// sqliteSink is an OutputSink writing results to a sqlite database
+type sqliteSink struct {
+	db    *sql.DB
+	runID int64
+}
+
+// newSQLiteSink opens or creates the sqlite database at filename and
+// records the start of a new run
+func newSQLiteSink(filename string, options Options) (*sqliteSink, error) {
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open sqlite database: %w", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create sqlite schema: %w", err)
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not migrate sqlite schema: %w", err)
+	}
+	res, err := db.Exec(
+		"INSERT INTO runs (baseurl, start, tags) VALUES (?, ?, NULLIF(?, ''))",
+		options.Args.BaseURL, time.Now().UTC().Format(time.RFC3339Nano), tagsJSON(options.tags()),
+	)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not record run: %w", err)
+	}
+	s := &sqliteSink{db: db}
+	s.runID, err = res.LastInsertId()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not record run: %w", err)
+	}
+	return s, nil
+}
+
+// Write writes a result and its matches and violations in a single
+// transaction
+func (s *sqliteSink) Write(r Result) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sqlite error: %w", err)
+	}
+	defer tx.Rollback() // no-op after commit
+
+	errString := ""
+	if r.err != nil {
+		errString = r.err.Error()
+	}
+	res, err := tx.Exec(
+		"INSERT INTO results (run_id, url, referrer, status, error, size, content_type, checksum, text, language) VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))",
+		s.runID, r.url, r.referrer, r.status, errString, r.size, r.contentType, r.checksum, r.text, r.language,
+	)
+	if err != nil {
+		return fmt.Errorf("sqlite result error: %w", err)
+	}
+	resultID, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("sqlite result error: %w", err)
+	}
+	for _, m := range r.matches {
+		if _, err := tx.Exec(
+			"INSERT INTO matches (result_id, line, term, byte_offset) VALUES (?, ?, ?, ?)",
+			resultID, m.line, m.match, m.offset,
+		); err != nil {
+			return fmt.Errorf("sqlite match error: %w", err)
+		}
+	}
+	for _, v := range r.violations {
+		if _, err := tx.Exec(
+			"INSERT INTO violations (result_id, kind, message) VALUES (?, ?, ?)",
+			resultID, v.Kind, v.Message,
+		); err != nil {
+			return fmt.Errorf("sqlite violation error: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Close records the run stats and closes the database
+func (s *sqliteSink) Close(stats Stats) error {
+	_, err := s.db.Exec(
+		`UPDATE runs SET start = ?, end = ?, termination = ?,
+		pages = ?, errors = ?, broken = ?, violations = ? WHERE id = ?`,
+		stats.Start.UTC().Format(time.RFC3339Nano),
+		stats.End.UTC().Format(time.RFC3339Nano),
+		stats.Termination,
+		stats.Pages, stats.Errors, stats.Broken, stats.Violations,
+		s.runID,
+	)
+	if err != nil {
+		err = fmt.Errorf("sqlite run error: %w", err)
+	}
+	return errors.Join(err, s.db.Close())
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSQLiteSink(t *testing.T) {
+
+	filename := filepath.Join(t.TempDir(), "webchk.db")
+	options := Options{Tags: []string{"env=prod"}}
+	options.Args.BaseURL = "https://example.com"
+
+	// two runs to the same database
+	for range 2 {
+		sink, err := newSQLiteSink(filename, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := drain(testResults(), sink, fakeStatser{
+			Pages:       3,
+			Errors:      1,
+			Broken:      1,
+			Violations:  1,
+			Start:       time.Now(),
+			End:         time.Now(),
+			Termination: TerminationIdle,
+		}); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	count := func(query string) int {
+		var n int
+		if err := db.QueryRow(query).Scan(&n); err != nil {
+			t.Fatalf("query %s error %v", query, err)
+		}
+		return n
+	}
+	got := []int{
+		count("SELECT COUNT(*) FROM runs"),
+		count("SELECT COUNT(*) FROM results"),
+		count("SELECT COUNT(*) FROM matches"),
+		count("SELECT COUNT(*) FROM violations"),
+		count("SELECT COUNT(*) FROM results WHERE run_id = 2"),
+		count("SELECT SUM(pages) FROM runs"),
+		count("SELECT SUM(broken) FROM runs WHERE termination = 'idle timeout'"),
+		count(`SELECT COUNT(*) FROM runs WHERE json_extract(tags, '$.env') = 'prod'`),
+	}
+	want := []int{2, 6, 4, 2, 3, 6, 2, 2}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("counts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSQLiteMigration(t *testing.T) {
+
+	// a results table made before the size and content type were
+	// recorded
+	filename := filepath.Join(t.TempDir(), "webchk.db")
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE results (
+		id INTEGER PRIMARY KEY, run_id INTEGER NOT NULL, url TEXT NOT NULL,
+		referrer TEXT, status INTEGER, error TEXT)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := Options{}
+	options.Args.BaseURL = "https://example.com"
+	sink, err := newSQLiteSink(filename, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := drain(testResults(), sink, fakeStatser{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var size int
+	var contentType string
+	err = db.QueryRow("SELECT size, content_type FROM results WHERE url = 'https://example.com'").Scan(&size, &contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := [2]any{size, contentType}, [2]any{2048, "text/html"}; got != want {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
@@ -0,0 +1,93 @@
+// dashboard.js follows the webchk event stream, keeping a running count
+// of results and listing the pages with matches (or all pages) subject
+// to a text filter.
+
+"use strict";
+
+const results = [];
+const counts = { pages: 0, matched: 0, errors: 0, broken: 0, violations: 0 };
+
+const $ = (id) => document.getElementById(id);
+
+function problems(r) {
+  const p = r.violations.map((v) => v.message);
+  if (r.error && r.error !== "NonHTMLPageType") {
+    p.unshift(r.error === "StatusNotOk" ? `status ${r.status}` : r.error);
+  }
+  return p;
+}
+
+function count(r) {
+  counts.pages++;
+  if (r.matches.length > 0) counts.matched++;
+  if (r.error === "StatusNotOk") counts.broken++;
+  else if (r.error && r.error !== "NonHTMLPageType") counts.errors++;
+  counts.violations += r.violations.length;
+  for (const [k, v] of Object.entries(counts)) $(k).textContent = v;
+}
+
+function visible(r) {
+  if (!$("all").checked && r.matches.length === 0) return false;
+  const f = $("filter").value.trim().toLowerCase();
+  if (f === "") return true;
+  return r.url.toLowerCase().includes(f) ||
+    r.matches.some((m) => m.match.toLowerCase().includes(f));
+}
+
+function row(r) {
+  const tr = document.createElement("tr");
+  const cells = [
+    r.url,
+    r.status || "",
+    r.matches.map((m) => `${m.line}: ${m.match}`).join("\n"),
+    problems(r).join("\n"),
+  ];
+  cells.forEach((text, i) => {
+    const td = document.createElement("td");
+    if (i === 0) {
+      const a = document.createElement("a");
+      a.href = text;
+      a.textContent = text;
+      td.appendChild(a);
+    } else {
+      td.textContent = text;
+    }
+    tr.appendChild(td);
+  });
+  if (problems(r).length > 0) tr.className = "problem";
+  return tr;
+}
+
+function render() {
+  const tbody = $("results");
+  tbody.replaceChildren(...results.filter(visible).map(row));
+}
+
+$("filter").addEventListener("input", render);
+$("all").addEventListener("change", render);
+
+// an api key given to the dashboard as the key query parameter is
+// passed on to the event stream and the reports
+const key = new URLSearchParams(location.search).get("key");
+const withKey = (url) => (key ? `${url}?key=${encodeURIComponent(key)}` : url);
+document.querySelectorAll("nav a").forEach((a) => {
+  a.href = withKey(a.getAttribute("href"));
+});
+
+const events = new EventSource(withKey("events"));
+events.onopen = () => {
+  $("state").textContent = "running";
+};
+events.addEventListener("result", (e) => {
+  const r = JSON.parse(e.data);
+  results.push(r);
+  count(r);
+  if (visible(r)) $("results").appendChild(row(r));
+});
+events.addEventListener("done", (e) => {
+  const summary = JSON.parse(e.data);
+  events.close(); // stop the browser reconnecting
+  const state = $("state");
+  state.textContent = `finished: ${summary.termination} after ${summary.duration}`;
+  state.className = "done";
+});
@@ -0,0 +1,167 @@
+// stats.go records statistics about a crawl. Stats are collected by
+// the Dispatcher as results are produced.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+// Stats records the counts of results of interest in a run together
+// with the run timings, the reason it terminated and the peak depth of
+// the queue of links waiting to be processed. The time the workers
+// spent waiting for the rate limiter and fetching pages shows which of
+// the rate and the number of workers limits a crawl.
+type Stats struct {
+	Pages          int            // all results
+	Bytes          int64          // bytes of html read
+	Errors         int            // results which could not be retrieved or processed
+	Broken         int            // results with a non-200 status
+	Violations     int            // assertion violations
+	ErrorKinds     map[string]int // errors and broken results by kind
+	PeakQueueDepth int            // the most links waiting to be processed
+	Dropped        int            // links dropped as the link buffer was full
+	Discovered     []int          // unique urls queued, by depth from the base url
+	WorkerPages    []int          // results fetched by each worker, from worker 1
+	RateWait       time.Duration  // total time workers waited for the rate limiter
+	FetchTime      time.Duration  // total time workers spent fetching pages
+	Start          time.Time
+	End            time.Time
+	Duration       time.Duration
+	Termination    string
+	Scope          string // describing the urls followed
+}
+
+// newStats returns a Stats for a run starting now
+func newStats() Stats {
+	return Stats{Start: time.Now(), ErrorKinds: map[string]int{}}
+}
+
+// add adds a result to the stats
+func (s *Stats) add(r Result) {
+	s.Pages++
+	s.Bytes += int64(r.size)
+	s.Violations += len(r.violations)
+	s.RateWait += r.rateWait
+	s.FetchTime += r.elapsed
+	if r.worker > 0 {
+		for len(s.WorkerPages) < r.worker {
+			s.WorkerPages = append(s.WorkerPages, 0)
+		}
+		s.WorkerPages[r.worker-1]++
+	}
+	switch {
+	case r.err == StatusNotOk:
+		s.Broken++
+	case r.err != nil && r.err != NonHTMLPageType:
+		s.Errors++
+	default:
+		return
+	}
+	if s.ErrorKinds == nil {
+		s.ErrorKinds = map[string]int{}
+	}
+	s.ErrorKinds[errorKind(r)]++
+}
+
+// discover records a unique url queued for processing at depth
+func (s *Stats) discover(depth int) {
+	for len(s.Discovered) <= depth {
+		s.Discovered = append(s.Discovered, 0)
+	}
+	s.Discovered[depth]++
+}
+
+// finish records the end of a run and the reason it terminated
+func (s *Stats) finish(termination string) {
+	s.End = time.Now()
+	s.Duration = s.End.Sub(s.Start)
+	s.Termination = termination
+}
+
+// pacing describes how the time of the workers of a run was spent:
+// waiting for the rate limiter, fetching pages or otherwise idle, such
+// as waiting for links to fetch, and so what limited the crawl. It is
+// empty if the run recorded no workers or took no time.
+func (s Stats) pacing() string {
+	workers := time.Duration(len(s.WorkerPages))
+	total := workers * s.Duration
+	if total <= 0 {
+		return ""
+	}
+	idle := max(total-s.RateWait-s.FetchTime, 0)
+	percent := func(d time.Duration) float64 { return 100 * float64(d) / float64(total) }
+	limit := "the workers were mostly idle, waiting for links to fetch"
+	switch {
+	case s.RateWait >= s.FetchTime && s.RateWait >= idle:
+		limit = "the rate limit (-q) is the bottleneck"
+	case s.FetchTime >= idle:
+		limit = "the number of workers (-w) is the bottleneck"
+	}
+	return fmt.Sprintf("%d workers for %s: %.0f%% waiting for the rate limit, %.0f%% fetching, %.0f%% idle; %s",
+		workers, s.Duration.Round(time.Millisecond), percent(s.RateWait), percent(s.FetchTime), percent(idle), limit)
+}
+
+// bufferAdvice suggests a size for the link buffer of a run which
+// dropped links when its buffer of size links filled. The links found
+// for each page fetched are taken as the fan-out of the site, and the
+// queue is expected to grow by that much again as the links waiting in
+// a full buffer are fetched, so the size suggested is the buffer size
+// times the fan-out, at least doubled and rounded up to two significant
+// figures.
+func (s Stats) bufferAdvice(size int) string {
+	found := s.Dropped
+	for _, n := range s.Discovered {
+		found += n
+	}
+	fanout := float64(found) / float64(max(s.Pages, 1))
+	suggested := roundUpFigures(int(math.Ceil(float64(size)*max(fanout, 2))), 2)
+	return fmt.Sprintf("the link buffer of %d was full and %d links were dropped; %d pages found %d links, %.1f for each page; try -z %d",
+		size, s.Dropped, s.Pages, found, fanout, suggested)
+}
+
+// roundUpFigures rounds n up to figures significant figures
+func roundUpFigures(n, figures int) int {
+	unit := 1
+	for limit := int(math.Pow10(figures)); n > limit*unit; {
+		unit *= 10
+	}
+	return (n + unit - 1) / unit * unit
+}
+
+// errorKind categorises the error of a result, for example as "status
+// 404" or "timeout"
+func errorKind(r Result) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case r.err == StatusNotOk:
+		return fmt.Sprintf("status %d", r.status)
+	case errors.Is(r.err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(r.err, ErrRedirectLoop):
+		return "redirect loop"
+	case errors.Is(r.err, ErrTooManyRedirects):
+		return "too many redirects"
+	case errors.Is(r.err, ErrPanic):
+		return "panic"
+	case errors.Is(r.err, ErrPageTooLarge):
+		return "page too large"
+	case r.err == MislabelledPage:
+		return "binary served as html"
+	case r.err == ExternalRedirect:
+		return "external redirect"
+	case errors.As(r.err, &dnsErr):
+		return "dns"
+	case errors.As(r.err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(r.err, &netErr):
+		return "connection"
+	}
+	return "processing"
+}
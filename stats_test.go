@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// fakeStatser provides fixed Stats
+type fakeStatser Stats
+
+func (f fakeStatser) Stats() Stats {
+	return Stats(f)
+}
+
+func TestStatsAdd(t *testing.T) {
+	s := newStats()
+	for _, r := range []Result{
+		{status: 200, size: 100, elapsed: 2 * time.Second, rateWait: time.Second},
+		{status: 200, err: NonHTMLPageType, elapsed: time.Second},
+		{status: 404, err: StatusNotOk, violations: []Violation{{"status", "status 404 want 200"}}},
+		{err: errors.New("connection refused")},
+		{status: 200, size: 50, violations: []Violation{{"a", "a"}, {"b", "b"}}},
+	} {
+		s.add(r)
+	}
+	s.finish(TerminationIdle)
+	want := Stats{
+		Pages:       5,
+		Bytes:       150,
+		Errors:      1,
+		Broken:      1,
+		Violations:  3,
+		ErrorKinds:  map[string]int{"status 404": 1, "processing": 1},
+		RateWait:    time.Second,
+		FetchTime:   3 * time.Second,
+		Termination: TerminationIdle,
+	}
+	if diff := cmp.Diff(want, s, cmpopts.IgnoreFields(Stats{}, "Start", "End", "Duration")); diff != "" {
+		t.Errorf("stats mismatch (-want +got):\n%s", diff)
+	}
+	if s.End.Before(s.Start) || s.Duration != s.End.Sub(s.Start) {
+		t.Errorf("unexpected timings %v %v %v", s.Start, s.End, s.Duration)
+	}
+}
+
+func TestStatsPacing(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		stats Stats
+		want  string
+	}{
+		{"no workers", Stats{Duration: time.Second}, ""},
+		{
+			"rate",
+			Stats{WorkerPages: []int{3, 2}, Duration: 10 * time.Second, RateWait: 15 * time.Second, FetchTime: 4 * time.Second},
+			"2 workers for 10s: 75% waiting for the rate limit, 20% fetching, 5% idle; the rate limit (-q) is the bottleneck",
+		},
+		{
+			"workers",
+			Stats{WorkerPages: []int{3, 2}, Duration: 10 * time.Second, RateWait: 2 * time.Second, FetchTime: 16 * time.Second},
+			"2 workers for 10s: 10% waiting for the rate limit, 80% fetching, 10% idle; the number of workers (-w) is the bottleneck",
+		},
+		{
+			"idle",
+			Stats{WorkerPages: []int{1, 0}, Duration: 10 * time.Second, RateWait: time.Second, FetchTime: 2 * time.Second},
+			"2 workers for 10s: 5% waiting for the rate limit, 10% fetching, 85% idle; the workers were mostly idle, waiting for links to fetch",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stats.pacing(); got != tt.want {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsBufferAdvice(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		stats Stats
+		size  int
+		want  string
+	}{
+		{
+			"wide",
+			Stats{Pages: 200, Discovered: []int{1, 60, 2441}, Dropped: 500},
+			2500,
+			"the link buffer of 2500 was full and 500 links were dropped; 200 pages found 3002 links, 15.0 for each page; try -z 38000",
+		},
+		{
+			"narrow",
+			Stats{Pages: 100, Discovered: []int{1, 20, 120}, Dropped: 10},
+			50,
+			"the link buffer of 50 was full and 10 links were dropped; 100 pages found 151 links, 1.5 for each page; try -z 100",
+		},
+		{
+			"no pages",
+			Stats{Discovered: []int{1, 9}, Dropped: 1},
+			10,
+			"the link buffer of 10 was full and 1 links were dropped; 0 pages found 11 links, 11.0 for each page; try -z 110",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stats.bufferAdvice(tt.size); got != tt.want {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundUpFigures(t *testing.T) {
+
+	for n, want := range map[int]int{7: 7, 100: 100, 101: 110, 5000: 5000, 12345: 13000, 99501: 100000} {
+		if got := roundUpFigures(n, 2); got != want {
+			t.Errorf("roundUpFigures(%d) got %d want %d", n, got, want)
+		}
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+
+	tests := []struct {
+		r    Result
+		kind string
+	}{
+		{Result{status: 503, err: StatusNotOk}, "status 503"},
+		{Result{err: fmt.Errorf("x: %w", context.DeadlineExceeded)}, "timeout"},
+		{Result{err: &url.Error{Op: "Get", URL: "x", Err: &net.DNSError{Err: "no such host"}}}, "dns"},
+		{Result{err: &url.Error{Op: "Get", URL: "x", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}}, "connection"},
+		{Result{err: fmt.Errorf("links error: %w", errors.New("bad html"))}, "processing"},
+		{Result{err: &url.Error{Op: "Get", URL: "x", Err: ErrRedirectLoop}}, "redirect loop"},
+		{Result{err: &url.Error{Op: "Get", URL: "x", Err: ErrTooManyRedirects}}, "too many redirects"},
+		{Result{status: 200, err: MislabelledPage}, "binary served as html"},
+		{Result{status: 302, err: ExternalRedirect}, "external redirect"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			if got, want := errorKind(tt.r), tt.kind; got != want {
+				t.Errorf("got %s want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// tags.go parses the key=value tags given to a run, such as the
+// environment, release or team, which are recorded with its results so
+// that the results of many crawls stored together can be filtered and
+// attributed.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTagFormat reports a tag which is not of the form key=value
+var ErrTagFormat = errors.New("tag should be key=value, with a key of letters, digits, '_', '-' or '.', for example env=staging")
+
+// validTagKey reports whether key is a valid tag key
+func validTagKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTags parses tags of the form key=value, returning nil if there
+// are none. A key may only be given once.
+func parseTags(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	tags := map[string]string{}
+	for _, spec := range specs {
+		key, value, ok := strings.Cut(spec, "=")
+		if !ok || !validTagKey(key) {
+			return nil, fmt.Errorf("tag %q: %w", spec, ErrTagFormat)
+		}
+		if _, ok := tags[key]; ok {
+			return nil, fmt.Errorf("tag %q: key %q given more than once: %w", spec, key, ErrTagFormat)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// tags returns the tags of the options, which have been validated
+func (o Options) tags() map[string]string {
+	tags, _ := parseTags(o.Tags)
+	return tags
+}
+
+// tagsJSON returns tags as a json object with sorted keys, for storing
+// in a database, or "" if there are none
+func tagsJSON(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(tags) // a map of strings always marshals
+	return string(b)
+}
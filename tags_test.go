@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTags(t *testing.T) {
+
+	tests := []struct {
+		specs []string
+		want  map[string]string
+		err   error
+	}{
+		{specs: nil, want: nil},
+		{specs: []string{"env=staging"}, want: map[string]string{"env": "staging"}},
+		{
+			specs: []string{"env=prod", "release=v2.1=rc1", "team.name=web", "note="},
+			want:  map[string]string{"env": "prod", "release": "v2.1=rc1", "team.name": "web", "note": ""},
+		},
+		{specs: []string{"env"}, err: ErrTagFormat},
+		{specs: []string{"=prod"}, err: ErrTagFormat},
+		{specs: []string{"my env=prod"}, err: ErrTagFormat},
+		{specs: []string{"env=prod", "env=staging"}, err: ErrTagFormat},
+	}
+	for _, tt := range tests {
+		got, err := parseTags(tt.specs)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%v got error %v want %v", tt.specs, err, tt.err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%v tags mismatch (-want +got):\n%s", tt.specs, diff)
+		}
+	}
+}
+
+func TestTagsJSON(t *testing.T) {
+
+	if got := tagsJSON(nil); got != "" {
+		t.Errorf("got %q for no tags", got)
+	}
+	got := tagsJSON(map[string]string{"team": "web", "env": "prod"})
+	if want := `{"env":"prod","team":"web"}`; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
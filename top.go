@@ -0,0 +1,115 @@
+// top.go ranks the results of a crawl for the top lists printed at the
+// end of the text summary: the slowest and largest pages, the pages
+// with the most matches and the hosts with the most errors.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// rankEntry is a url or host and the value it is ranked by
+type rankEntry struct {
+	name  string
+	value int64
+}
+
+// ranking keeps the n entries with the highest values, highest first.
+// Entries with equal values are kept in the order they were added.
+type ranking struct {
+	n       int
+	entries []rankEntry
+}
+
+// add adds an entry if its value is positive and among the n highest
+func (r *ranking) add(name string, value int64) {
+	if value <= 0 {
+		return
+	}
+	if len(r.entries) == r.n && value <= r.entries[r.n-1].value {
+		return
+	}
+	i, _ := slices.BinarySearchFunc(r.entries, value, func(e rankEntry, v int64) int {
+		if e.value >= v {
+			return -1 // after entries with the same value
+		}
+		return 1
+	})
+	r.entries = slices.Insert(r.entries, i, rankEntry{name, value})
+	if len(r.entries) > r.n {
+		r.entries = r.entries[:r.n]
+	}
+}
+
+// topReport records the top n results of a crawl by several measures
+type topReport struct {
+	n          int
+	slowest    ranking
+	largest    ranking
+	matches    ranking
+	hostErrors map[string]int
+}
+
+// newTopReport makes a new topReport of the top n results
+func newTopReport(n int) *topReport {
+	return &topReport{
+		n:          n,
+		slowest:    ranking{n: n},
+		largest:    ranking{n: n},
+		matches:    ranking{n: n},
+		hostErrors: map[string]int{},
+	}
+}
+
+// add ranks a result. Pages which are not html are not ranked, as
+// their bodies are not read, but their errors are counted.
+func (t *topReport) add(r Result) {
+	if r.err != nil && r.err != NonHTMLPageType {
+		host := r.url
+		if u, err := url.Parse(r.url); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		t.hostErrors[host]++
+		return
+	}
+	if r.err == NonHTMLPageType {
+		return
+	}
+	t.slowest.add(r.url, int64(r.elapsed))
+	t.largest.add(r.url, int64(r.size))
+	t.matches.add(r.url, int64(len(r.matches)))
+}
+
+// print prints each non-empty top list
+func (t *topReport) print(w io.Writer) {
+	printRanking := func(title string, r ranking, format func(int64) string) {
+		if len(r.entries) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "%s:\n", title)
+		for _, e := range r.entries {
+			fmt.Fprintf(w, "  %10s %s\n", format(e.value), e.name)
+		}
+	}
+	printRanking("slowest pages", t.slowest, func(v int64) string {
+		return time.Duration(v).Round(time.Millisecond).String()
+	})
+	printRanking("largest pages", t.largest, formatBytes)
+	count := func(v int64) string { return fmt.Sprint(v) }
+	printRanking("pages with most matches", t.matches, count)
+
+	hosts := ranking{n: t.n}
+	names := []string{}
+	for h := range t.hostErrors {
+		names = append(names, h)
+	}
+	slices.Sort(names) // rank hosts with equal counts by name
+	for _, h := range names {
+		hosts.add(h, int64(t.hostErrors[h]))
+	}
+	printRanking("hosts with most errors", hosts, count)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRanking(t *testing.T) {
+
+	tests := []struct {
+		n      int
+		values []int64
+		want   []rankEntry
+	}{
+		{
+			n:      3,
+			values: []int64{},
+			want:   nil,
+		},
+		{
+			n:      3,
+			values: []int64{0, -1},
+			want:   nil, // not positive
+		},
+		{
+			n:      3,
+			values: []int64{2, 5, 1, 9, 3},
+			want:   []rankEntry{{"3", 9}, {"1", 5}, {"4", 3}},
+		},
+		{
+			n:      2,
+			values: []int64{4, 4, 4},
+			want:   []rankEntry{{"0", 4}, {"1", 4}}, // first added first
+		},
+		{
+			n:      4,
+			values: []int64{1, 2},
+			want:   []rankEntry{{"1", 2}, {"0", 1}},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			r := ranking{n: tt.n}
+			for j, v := range tt.values {
+				r.add(fmt.Sprint(j), v)
+			}
+			if diff := cmp.Diff(tt.want, r.entries, cmp.AllowUnexported(rankEntry{})); diff != "" {
+				t.Errorf("ranking mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTopReport(t *testing.T) {
+
+	top := newTopReport(2)
+	for _, r := range []Result{
+		{url: "https://example.com", elapsed: 120 * time.Millisecond, size: 2500, matches: []SearchMatch{{1, "hi", 0}}},
+		{url: "https://example.com/big", elapsed: 30 * time.Millisecond, size: 90000},
+		{url: "https://example.com/slow", elapsed: 2 * time.Second, size: 100, matches: []SearchMatch{{1, "hi", 0}, {2, "there", 0}}},
+		{url: "https://example.com/image.png", err: NonHTMLPageType},
+		{url: "https://example.com/gone", status: 404, err: StatusNotOk},
+		{url: "https://example.org/a", err: errors.New("timeout")},
+		{url: "https://example.org/b", err: errors.New("timeout")},
+		{url: "https://example.net/c", err: errors.New("timeout")},
+	} {
+		top.add(r)
+	}
+
+	var buf bytes.Buffer
+	top.print(&buf)
+	want := `slowest pages:
+          2s https://example.com/slow
+       120ms https://example.com
+largest pages:
+     90.0 kB https://example.com/big
+      2.5 kB https://example.com
+pages with most matches:
+           2 https://example.com/slow
+           1 https://example.com
+hosts with most errors:
+           2 example.org
+           1 example.com
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("output mismatch (-want +got):\n%s", diff)
+	}
+
+	// nothing is printed for empty lists
+	buf.Reset()
+	newTopReport(10).print(&buf)
+	if got := buf.String(); got != "" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
@@ -0,0 +1,255 @@
+// validate.go checks that the command line options are consistent with
+// each other before a crawl starts, rather than the crawl failing or
+// behaving unexpectedly part way through.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrTimeoutTooSmall reports an overall timeout shorter than the
+	// http timeout
+	ErrTimeoutTooSmall = errors.New("timeout should not be smaller than the http timeout")
+	// ErrIdleTimeoutTooLarge reports an idle timeout longer than the
+	// overall timeout
+	ErrIdleTimeoutTooLarge = errors.New("idle timeout should not be larger than the overall timeout")
+	// ErrRateTooSlow reports a rate limit which spaces requests further
+	// apart than the idle timeout
+	ErrRateTooSlow = errors.New("querysec is too low for the idle timeout")
+	// ErrNotPositive reports an option which must be 1 or more
+	ErrNotPositive = errors.New("option must be 1 or more")
+	// ErrTooFewHTTPWorkers reports fewer http workers than workers
+	ErrTooFewHTTPWorkers = errors.New("httpworkers should not be fewer than workers")
+	// ErrScheduleNeedsServe reports schedules set outside serve mode
+	ErrScheduleNeedsServe = errors.New("schedules are only run in serve mode")
+	// ErrAPIKeysNeedServe reports api keys given outside serve mode
+	ErrAPIKeysNeedServe = errors.New("api keys are only used in serve mode")
+	// ErrRunNeedsHistory reports a run given without a history database
+	ErrRunNeedsHistory = errors.New("a run can only be shown from a history database")
+	// ErrQueryNeedsRun reports a query of results given without a run
+	ErrQueryNeedsRun = errors.New("results can only be queried from a run")
+	// ErrResumeNeedsJournal reports resuming without a journal
+	ErrResumeNeedsJournal = errors.New("a crawl can only be resumed from a journal")
+	// ErrJSONPathNeedsJSONLinks reports JSONPath expressions given
+	// without json link discovery
+	ErrJSONPathNeedsJSONLinks = errors.New("JSONPath expressions are only used with json link discovery")
+	// ErrEmailNeedsSMTP reports email reports without an SMTP server or
+	// sender
+	ErrEmailNeedsSMTP = errors.New("email reports need an SMTP server and sender")
+	// ErrUnknownGroupBy reports grouping by something other than
+	// status, dir, term or referrer
+	ErrUnknownGroupBy = errors.New("results can only be grouped by status, dir, term or referrer")
+	// ErrUnknownProfile reports a request header profile other than
+	// chrome, firefox or bot
+	ErrUnknownProfile = errors.New("the request header profile can only be chrome, firefox or bot")
+	// ErrUnknownNoindex reports reporting pages marked noindex other
+	// than by hiding them or separately
+	ErrUnknownNoindex = errors.New("pages marked noindex can only be hidden or reported separately")
+	// ErrBoilerplateFraction reports a boilerplate fraction which is
+	// not a fraction of the pages
+	ErrBoilerplateFraction = errors.New("boilerplate should be a fraction of the pages from 0 to 1")
+	// ErrFirstMatchBoilerplate reports stopping at the first match of
+	// each page while discarding matches on boilerplate lines
+	ErrFirstMatchBoilerplate = errors.New("the first match of a page cannot be reported while matches on boilerplate are discarded")
+	// ErrDictionaryNeedsSpellcheck reports dictionaries given without
+	// spellchecking
+	ErrDictionaryNeedsSpellcheck = errors.New("dictionaries are only used when spellchecking")
+	// ErrHARBodiesNeedsHAR reports recording bodies without a HAR file
+	ErrHARBodiesNeedsHAR = errors.New("bodies are only recorded in a har file")
+	// ErrUnixSocketProxy reports a proxy chosen for a crawl over a unix
+	// socket
+	ErrUnixSocketProxy = errors.New("proxies cannot be used with a unix socket")
+	// ErrRecordReplay reports recording responses while replaying them
+	ErrRecordReplay = errors.New("responses cannot be recorded while they are replayed")
+	// ErrBufferTooSmall reports a link buffer smaller than the number
+	// of workers
+	ErrBufferTooSmall = errors.New("buffersize should not be smaller than workers")
+	// ErrChangesNeedSQLite reports watching for changes without a
+	// database to record the pages in
+	ErrChangesNeedSQLite = errors.New("changes can only be found from a sqlite output")
+	// ErrDiffNeedsChanges reports a diff file given without --changes
+	ErrDiffNeedsChanges = errors.New("diffs can only be made of changed pages")
+)
+
+// validate checks the options for values which are invalid or
+// inconsistent with each other, given the http timeout, returning all
+// the problems found joined together.
+func (o Options) validate(httpTimeout time.Duration) error {
+	var errs []error
+
+	for _, p := range []struct {
+		name  string
+		value int
+	}{
+		{"querysec", o.QuerySec},
+		{"buffersize", o.BufferSize},
+		{"results-buffer", o.ResultsSize},
+		{"workers", o.Workers},
+		{"httpworkers", o.HTTPWorkers},
+	} {
+		if p.value < 1 {
+			errs = append(errs, fmt.Errorf("%s is %d: %w", p.name, p.value, ErrNotPositive))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...) // the checks below rely on these
+	}
+
+	if o.IdleTimeout < httpTimeout {
+		errs = append(errs, fmt.Errorf(
+			"idle timeout %s is less than the http timeout %s; set --idle-timeout to at least %s: %w",
+			o.IdleTimeout, httpTimeout, httpTimeout, ErrDispatchTimeoutTooSmall,
+		))
+	}
+	if o.Timeout > 0 && o.Timeout < httpTimeout {
+		errs = append(errs, fmt.Errorf(
+			"timeout %s is less than the http timeout %s; set -t to at least %s or 0s for no timeout: %w",
+			o.Timeout, httpTimeout, httpTimeout, ErrTimeoutTooSmall,
+		))
+	}
+	if o.Timeout > 0 && o.IdleTimeout > o.Timeout {
+		errs = append(errs, fmt.Errorf(
+			"idle timeout %s is more than the timeout %s; reduce --idle-timeout or increase -t: %w",
+			o.IdleTimeout, o.Timeout, ErrIdleTimeoutTooLarge,
+		))
+	}
+	if interval := time.Second / time.Duration(o.QuerySec); interval >= o.IdleTimeout {
+		errs = append(errs, fmt.Errorf(
+			"querysec %d spaces requests %s apart, which is not less than the idle timeout %s; increase -q or --idle-timeout: %w",
+			o.QuerySec, interval, o.IdleTimeout, ErrRateTooSlow,
+		))
+	}
+	if o.HTTPWorkers < o.Workers {
+		errs = append(errs, fmt.Errorf(
+			"httpworkers %d is less than workers %d, so workers will wait for connections; set -x to at least %d: %w",
+			o.HTTPWorkers, o.Workers, o.Workers, ErrTooFewHTTPWorkers,
+		))
+	}
+	if o.BufferSize < o.Workers {
+		errs = append(errs, fmt.Errorf(
+			"buffersize %d is less than workers %d, so the buffer will fill immediately; set -z to at least %d: %w",
+			o.BufferSize, o.Workers, o.Workers, ErrBufferTooSmall,
+		))
+	}
+	if o.Serve == "" && (o.Schedule != "" || o.Sites != "") {
+		errs = append(errs, fmt.Errorf(
+			"--schedule and --sites need --serve, for example --serve localhost:8080: %w",
+			ErrScheduleNeedsServe,
+		))
+	}
+	if o.Serve == "" && o.APIKeys != "" {
+		errs = append(errs, fmt.Errorf(
+			"--api-keys needs --serve, for example --serve localhost:8080: %w",
+			ErrAPIKeysNeedServe,
+		))
+	}
+	if o.Run != 0 && o.History == "" {
+		errs = append(errs, fmt.Errorf(
+			"--run needs --history, for example --history webchk.db: %w",
+			ErrRunNeedsHistory,
+		))
+	}
+	if o.Run == 0 && (o.resultQuery() != (resultQuery{}) || o.RunCSV) {
+		errs = append(errs, fmt.Errorf(
+			"--status, --term, --url, --limit, --offset and --csv need --run, for example --run 12: %w",
+			ErrQueryNeedsRun,
+		))
+	}
+	if o.RunStatus < 0 || o.RunLimit < 0 || o.RunOffset < 0 {
+		errs = append(errs, fmt.Errorf("--status, --limit and --offset cannot be negative: %w", ErrResultQuery))
+	}
+	if o.Changes && o.sqliteOutput() == "" {
+		errs = append(errs, fmt.Errorf(
+			"--changes needs a sqlite output, for example -o sqlite:webchk.db: %w",
+			ErrChangesNeedSQLite,
+		))
+	}
+	if o.Diff != "" && !o.Changes {
+		errs = append(errs, fmt.Errorf(
+			"--diff needs --changes: %w",
+			ErrDiffNeedsChanges,
+		))
+	}
+	if o.Resume && o.Journal == "" {
+		errs = append(errs, fmt.Errorf(
+			"--resume needs --journal, for example --journal webchk.journal: %w",
+			ErrResumeNeedsJournal,
+		))
+	}
+	if len(o.JSONPath) > 0 && !o.JSONLinks {
+		errs = append(errs, fmt.Errorf(
+			"--json-path needs --json-links: %w",
+			ErrJSONPathNeedsJSONLinks,
+		))
+	}
+	for _, expr := range o.JSONPath {
+		if _, err := parseJSONPath(expr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(o.EmailTo) > 0 && (o.SMTP == "" || o.SMTPFrom == "") {
+		errs = append(errs, fmt.Errorf(
+			"--email-to needs --smtp and --smtp-from, for example --smtp mail.example.com:587 --smtp-from webchk@example.com: %w",
+			ErrEmailNeedsSMTP,
+		))
+	}
+	if len(o.Dictionary) > 0 && o.Spellcheck == "" {
+		errs = append(errs, fmt.Errorf("--dictionary needs --spellcheck: %w", ErrDictionaryNeedsSpellcheck))
+	}
+	if o.UnixSocket != "" && o.PAC != "" {
+		errs = append(errs, fmt.Errorf("--pac with --unix-socket: %w", ErrUnixSocketProxy))
+	}
+	if o.HARBodies && o.HAR == "" {
+		errs = append(errs, fmt.Errorf("--har-bodies needs --har: %w", ErrHARBodiesNeedsHAR))
+	}
+	if o.Record != "" && o.Replay != "" {
+		errs = append(errs, fmt.Errorf("--record with --replay: %w", ErrRecordReplay))
+	}
+	if o.Boilerplate < 0 || o.Boilerplate > 1 {
+		errs = append(errs, fmt.Errorf("--boilerplate %g: %w", o.Boilerplate, ErrBoilerplateFraction))
+	}
+	if o.FirstMatch && o.Boilerplate > 0 {
+		errs = append(errs, fmt.Errorf(
+			"--first-match stops at the first match, which --boilerplate may then discard; use one or the other: %w",
+			ErrFirstMatchBoilerplate,
+		))
+	}
+	switch o.GroupBy {
+	case "", GROUPSTATUS, GROUPDIR, GROUPTERM, GROUPREF:
+	default:
+		errs = append(errs, fmt.Errorf("--group-by %q: %w", o.GroupBy, ErrUnknownGroupBy))
+	}
+	if o.StartAt != "" {
+		if _, err := parseClockTime(o.StartAt); err != nil {
+			errs = append(errs, fmt.Errorf("--start-at %w", err))
+		}
+	}
+	if o.Window != "" {
+		if _, err := parseTimeWindow(o.Window); err != nil {
+			errs = append(errs, fmt.Errorf("--only-between %w", err))
+		}
+	}
+	switch o.NoIndex {
+	case "", NOINDEXHIDE, NOINDEXSEPARATE:
+	default:
+		errs = append(errs, fmt.Errorf("--noindex %q: %w", o.NoIndex, ErrUnknownNoindex))
+	}
+	switch o.Profile {
+	case "", PROFILECHROME, PROFILEFIREFOX, PROFILEBOT:
+	default:
+		errs = append(errs, fmt.Errorf("--profile %q: %w", o.Profile, ErrUnknownProfile))
+	}
+	if _, err := parseTags(o.Tags); err != nil {
+		errs = append(errs, fmt.Errorf("--tag %w", err))
+	}
+	if o.Schedule != "" {
+		if _, err := parseCron(o.Schedule); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
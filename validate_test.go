@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+
+	valid := func() Options {
+		return Options{
+			QuerySec:    10,
+			Timeout:     2 * time.Minute,
+			IdleTimeout: 1800 * time.Millisecond,
+			BufferSize:  2500,
+			ResultsSize: 100,
+			Workers:     8,
+			HTTPWorkers: 8,
+		}
+	}
+
+	tests := []struct {
+		modify func(o *Options)
+		errs   []error
+	}{
+		{
+			modify: func(o *Options) {},
+		},
+		{
+			modify: func(o *Options) { o.Timeout = 0 }, // no overall timeout
+		},
+		{
+			modify: func(o *Options) { o.IdleTimeout = time.Second },
+			errs:   []error{ErrDispatchTimeoutTooSmall},
+		},
+		{
+			modify: func(o *Options) { o.Timeout = time.Second },
+			errs:   []error{ErrTimeoutTooSmall, ErrIdleTimeoutTooLarge},
+		},
+		{
+			modify: func(o *Options) { o.IdleTimeout = 3 * time.Minute },
+			errs:   []error{ErrIdleTimeoutTooLarge},
+		},
+		{
+			modify: func(o *Options) { o.QuerySec = 0; o.Workers = -1 },
+			errs:   []error{ErrNotPositive},
+		},
+		{
+			modify: func(o *Options) { o.QuerySec = 1; o.IdleTimeout = time.Second },
+			errs:   []error{ErrDispatchTimeoutTooSmall, ErrRateTooSlow},
+		},
+		{
+			modify: func(o *Options) { o.HTTPWorkers = 4 },
+			errs:   []error{ErrTooFewHTTPWorkers},
+		},
+		{
+			modify: func(o *Options) { o.BufferSize = 4 },
+			errs:   []error{ErrBufferTooSmall},
+		},
+		{
+			modify: func(o *Options) { o.Serve = ":8080"; o.Schedule = "0 2 * * *"; o.Sites = "sites.yaml" },
+		},
+		{
+			modify: func(o *Options) { o.Sites = "sites.yaml" },
+			errs:   []error{ErrScheduleNeedsServe},
+		},
+		{
+			modify: func(o *Options) { o.FirstMatch, o.Boilerplate = true, 0.5 },
+			errs:   []error{ErrFirstMatchBoilerplate},
+		},
+		{
+			modify: func(o *Options) { o.APIKeys = "keys.yaml" },
+			errs:   []error{ErrAPIKeysNeedServe},
+		},
+		{
+			modify: func(o *Options) { o.Schedule = "nightly" },
+			errs:   []error{ErrScheduleNeedsServe, ErrCronFormat},
+		},
+		{
+			modify: func(o *Options) {
+				o.EmailTo = []string{"a@example.com"}
+				o.SMTP = "localhost:25"
+				o.SMTPFrom = "w@example.com"
+			},
+		},
+		{
+			modify: func(o *Options) { o.JSONLinks = true; o.JSONPath = []string{"$.items[*].url"} },
+		},
+		{
+			modify: func(o *Options) { o.JSONPath = []string{"items"} },
+			errs:   []error{ErrJSONPathNeedsJSONLinks, ErrJSONPathFormat},
+		},
+		{
+			modify: func(o *Options) { o.Resume = true },
+			errs:   []error{ErrResumeNeedsJournal},
+		},
+		{
+			modify: func(o *Options) { o.EmailTo = []string{"a@example.com"}; o.SMTP = "localhost:25" },
+			errs:   []error{ErrEmailNeedsSMTP},
+		},
+		{
+			modify: func(o *Options) { o.GroupBy = GROUPDIR },
+		},
+		{
+			modify: func(o *Options) { o.Dictionary = []string{"extra.txt"} },
+			errs:   []error{ErrDictionaryNeedsSpellcheck},
+		},
+		{
+			modify: func(o *Options) { o.UnixSocket, o.PAC = "/run/app.sock", "proxy.pac" },
+			errs:   []error{ErrUnixSocketProxy},
+		},
+		{
+			modify: func(o *Options) { o.HARBodies = true },
+			errs:   []error{ErrHARBodiesNeedsHAR},
+		},
+		{
+			modify: func(o *Options) { o.HAR, o.HARBodies = "crawl.har", true },
+		},
+		{
+			modify: func(o *Options) { o.Boilerplate = 0.5 },
+		},
+		{
+			modify: func(o *Options) { o.Boilerplate = 50 },
+			errs:   []error{ErrBoilerplateFraction},
+		},
+		{
+			modify: func(o *Options) { o.GroupBy = "host" },
+			errs:   []error{ErrUnknownGroupBy},
+		},
+		{
+			modify: func(o *Options) { o.Record, o.Replay = "fixtures", "fixtures" },
+			errs:   []error{ErrRecordReplay},
+		},
+		{
+			modify: func(o *Options) { o.StartAt, o.Window = "02:00", "22:00-04:00" },
+		},
+		{
+			modify: func(o *Options) { o.StartAt, o.Window = "2am", "01:00" },
+			errs:   []error{ErrClockTime, ErrTimeWindow},
+		},
+		{
+			modify: func(o *Options) { o.NoIndex = NOINDEXSEPARATE },
+		},
+		{
+			modify: func(o *Options) { o.NoIndex = "skip" },
+			errs:   []error{ErrUnknownNoindex},
+		},
+		{
+			modify: func(o *Options) { o.Tags = []string{"env=staging", "release=2.1"} },
+		},
+		{
+			modify: func(o *Options) { o.Profile = PROFILEFIREFOX },
+		},
+		{
+			modify: func(o *Options) { o.Profile = "safari" },
+			errs:   []error{ErrUnknownProfile},
+		},
+		{
+			modify: func(o *Options) { o.History, o.Run, o.RunStatus, o.RunLimit, o.RunCSV = "webchk.db", 12, 404, 50, true },
+		},
+		{
+			modify: func(o *Options) { o.RunTerm = "welcome" },
+			errs:   []error{ErrQueryNeedsRun},
+		},
+		{
+			modify: func(o *Options) { o.History, o.Run, o.RunOffset = "webchk.db", 12, -1 },
+			errs:   []error{ErrResultQuery},
+		},
+		{
+			modify: func(o *Options) { o.Tags = []string{"staging"} },
+			errs:   []error{ErrTagFormat},
+		},
+		{
+			modify: func(o *Options) { o.Changes, o.Output = true, []string{"sqlite:webchk.db"} },
+		},
+		{
+			modify: func(o *Options) { o.Changes = true },
+			errs:   []error{ErrChangesNeedSQLite},
+		},
+		{
+			modify: func(o *Options) { o.Diff = "changes.diff" },
+			errs:   []error{ErrDiffNeedsChanges},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			o := valid()
+			tt.modify(&o)
+			err := o.validate(HTTPTIMEOUT)
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			for _, e := range tt.errs {
+				if !errors.Is(err, e) {
+					t.Errorf("error %v does not contain %v", err, e)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+// verbose.go provides the levels of verbose output set by repeating -v.
+// At the first level every page is printed with its content type and
+// size; at the second the links not followed are also reported with the
+// reason, as are redirects; and at the third the timing and headers of
+// each request. The reports of the second and third levels are written
+// to diagnostics, keeping the results output unchanged.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The verbose levels
+const (
+	VerbosePages    = 1 // print every page
+	VerboseLinks    = 2 // also report links not followed, and redirects
+	VerboseRequests = 3 // also report the timing and headers of requests
+)
+
+// verbosity is the verbose level, given by the number of times -v is
+// specified
+type verbosity []bool
+
+// level returns the verbose level
+func (v verbosity) level() int {
+	return len(v)
+}
+
+// MarshalJSON records the level in the options of the json output
+func (v verbosity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.level())
+}
+
+// UnmarshalJSON reads the level recorded by MarshalJSON, or the true or
+// false of documents written before there were levels
+func (v *verbosity) UnmarshalJSON(b []byte) error {
+	var level int
+	if err := json.Unmarshal(b, &level); err != nil {
+		var verbose bool
+		if json.Unmarshal(b, &verbose) != nil {
+			return err
+		}
+		if verbose {
+			level = VerbosePages
+		}
+	}
+	*v = nil
+	for range level {
+		*v = append(*v, true)
+	}
+	return nil
+}
+
+// verboseLog writes the reports of a verbose level to w, one line at a
+// time so that it is safe for concurrent use
+type verboseLog struct {
+	w     io.Writer
+	level int
+	mu    sync.Mutex
+}
+
+// newVerboseLog makes a verboseLog for level writing to w, or nil if the
+// level makes no reports
+func newVerboseLog(w io.Writer, level int) *verboseLog {
+	if level < VerboseLinks {
+		return nil
+	}
+	return &verboseLog{w: w, level: level}
+}
+
+// enabled reports whether reports of level are written. A nil
+// verboseLog writes none.
+func (v *verboseLog) enabled(level int) bool {
+	return v != nil && v.level >= level
+}
+
+// printf writes a report of level
+func (v *verboseLog) printf(level int, format string, args ...any) {
+	if !v.enabled(level) {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fmt.Fprintf(v.w, format+"\n", args...)
+}
+
+// Skip reasons report why a link is not followed
+const (
+	SkipScheme   = "scheme not followed"
+	SkipExternal = "outside the scope"
+	SkipSuffix   = "skipped suffix"
+	SkipFilter   = "excluded by a filter"
+	SkipSeen     = "seen before" // not reported, as most links are
+	// SkipHostErrors reports a url whose host used up its error budget
+	SkipHostErrors = "host error budget used up"
+)
+
+// verboseTransport is an http.RoundTripper reporting the redirects
+// returned by transport and, at the requests level, the timing and
+// headers of every request
+type verboseTransport struct {
+	transport http.RoundTripper
+	log       *verboseLog
+	now       func() time.Time
+}
+
+// newVerboseTransport makes a verboseTransport for transport, or
+// http.DefaultTransport if transport is nil
+func newVerboseTransport(transport http.RoundTripper, log *verboseLog) *verboseTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &verboseTransport{transport: transport, log: log, now: time.Now}
+}
+
+// RoundTrip meets the http.RoundTripper interface
+func (t *verboseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := t.now()
+	resp, err := t.transport.RoundTrip(req)
+	elapsed := t.now().Sub(start).Round(time.Millisecond)
+	if err != nil {
+		t.log.printf(VerboseRequests, "request %s %s failed after %s: %v", req.Method, req.URL, elapsed, err)
+		return resp, err
+	}
+	if location := resp.Header.Get("Location"); location != "" && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		t.log.printf(VerboseLinks, "redirect %s -> %s (status %d)", req.URL, location, resp.StatusCode)
+	}
+	if t.log.enabled(VerboseRequests) {
+		lines := []string{fmt.Sprintf("request %s %s status %d in %s", req.Method, req.URL, resp.StatusCode, elapsed)}
+		lines = append(lines, headerLines("> ", req.Header)...)
+		lines = append(lines, headerLines("< ", resp.Header)...)
+		t.log.printf(VerboseRequests, "%s", strings.Join(lines, "\n"))
+	}
+	return resp, nil
+}
+
+// headerLines returns a line for each header value starting with
+// prefix, sorted by name
+func headerLines(prefix string, header http.Header) []string {
+	lines := []string{}
+	for name, values := range header {
+		for _, v := range values {
+			lines = append(lines, prefix+name+": "+v)
+		}
+	}
+	slices.Sort(lines)
+	return lines
+}
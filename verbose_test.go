@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerbosityJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want int
+	}{
+		{"0", 0},
+		{"2", VerboseLinks},
+		{"true", VerbosePages}, // before levels
+		{"false", 0},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
+			var v verbosity
+			if err := json.Unmarshal([]byte(tt.json), &v); err != nil {
+				t.Fatal(err)
+			}
+			if got := v.level(); got != tt.want {
+				t.Errorf("got %d want %d", got, tt.want)
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(b), fmt.Sprint(tt.want); got != want {
+				t.Errorf("marshalled %s want %s", got, want)
+			}
+		})
+	}
+	var v verbosity
+	if err := json.Unmarshal([]byte(`"loud"`), &v); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestVerboseLog(t *testing.T) {
+	if v := newVerboseLog(&bytes.Buffer{}, VerbosePages); v != nil {
+		t.Error("expected no log at the pages level")
+	}
+	var v *verboseLog
+	v.printf(VerboseLinks, "nothing") // a nil log writes nothing
+
+	var buf bytes.Buffer
+	v = newVerboseLog(&buf, VerboseLinks)
+	v.printf(VerboseLinks, "link %d", 1)
+	v.printf(VerboseRequests, "request %d", 2)
+	if got, want := buf.String(), "link 1\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestVerboseTransport(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/old" {
+				http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprintln(w, "hello")
+		},
+	))
+	defer server.Close()
+
+	tests := []struct {
+		level int
+		want  []string
+	}{
+		{
+			level: VerboseLinks,
+			want: []string{
+				"redirect " + server.URL + "/old -> /new (status 301)",
+			},
+		},
+		{
+			level: VerboseRequests,
+			want: []string{
+				"request GET " + server.URL + "/old status 301 in 5ms",
+				"< Location: /new",
+				"redirect " + server.URL + "/old -> /new (status 301)",
+				"request GET " + server.URL + "/new status 200 in 5ms",
+				"> Referer: " + server.URL + "/old",
+				"< Content-Type: text/plain",
+			},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
+			var buf bytes.Buffer
+			transport := newVerboseTransport(nil, newVerboseLog(&buf, tt.level))
+			clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			transport.now = func() time.Time {
+				clock = clock.Add(5 * time.Millisecond)
+				return clock
+			}
+			client := &http.Client{Transport: transport}
+			resp, err := client.Get(server.URL + "/old")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			for _, w := range tt.want {
+				if !strings.Contains(buf.String(), w+"\n") {
+					t.Errorf("%q not found in\n%s", w, buf.String())
+				}
+			}
+			if tt.level < VerboseRequests && strings.Contains(buf.String(), "request") {
+				t.Errorf("unexpected request report in\n%s", buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// visited.go provides the default VisitedSet of urls seen during a
+// crawl, which is safe for concurrent use so that workers can discard
+// links which have already been seen before sending them back to the
+// dispatcher.
+
+package main
+
+import (
+	"hash/maphash"
+	"strings"
+	"sync"
+)
+
+// VISITEDSHARDS is the number of independently locked shards in a
+// visitedSet, reducing lock contention between workers
+const VISITEDSHARDS = 32
+
+// visitedShard is a locked part of a visitedSet
+type visitedShard struct {
+	sync.Mutex
+	urls map[string]struct{}
+}
+
+// visitedSet is a VisitedSet of urls sharded by the hash of the url.
+// Urls are compared without a trailing slash.
+type visitedSet struct {
+	seed   maphash.Seed
+	shards [VISITEDSHARDS]visitedShard
+}
+
+// newVisitedSet makes a new, empty, visitedSet
+func newVisitedSet() *visitedSet {
+	v := &visitedSet{seed: maphash.MakeSeed()}
+	for i := range v.shards {
+		v.shards[i].urls = map[string]struct{}{}
+	}
+	return v
+}
+
+// shard returns the shard for u and the key of u within it
+func (v *visitedSet) shard(u string) (*visitedShard, string) {
+	u = strings.TrimSuffix(u, "/")
+	return &v.shards[maphash.String(v.seed, u)%VISITEDSHARDS], u
+}
+
+// Follow adds u to the set, returning true if it was not already
+// present
+func (v *visitedSet) Follow(u string) bool {
+	s, key := v.shard(u)
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.urls[key]; ok {
+		return false
+	}
+	s.urls[key] = struct{}{}
+	return true
+}
+
+// Seen reports whether u is in the set
+func (v *visitedSet) Seen(u string) bool {
+	s, key := v.shard(u)
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.urls[key]
+	return ok
+}
+
+// len returns the number of urls in the set
+func (v *visitedSet) len() int {
+	n := 0
+	for i := range v.shards {
+		v.shards[i].Lock()
+		n += len(v.shards[i].urls)
+		v.shards[i].Unlock()
+	}
+	return n
+}
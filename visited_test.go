@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestVisitedSet(t *testing.T) {
+
+	tests := []struct {
+		url      string
+		followed bool
+		seen     bool // after following
+	}{
+		// beware order is important
+		{"https://example.com/a", true, true},
+		{"https://example.com/a", false, true},
+		{"https://example.com/a/", false, true}, // without slash
+		{"https://example.com/b/", true, true},
+		{"https://example.com/b", false, true},
+	}
+
+	v := newVisitedSet()
+	if v.Seen("https://example.com/a") {
+		t.Fatal("empty set should not contain url")
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			if got, want := v.Follow(tt.url), tt.followed; got != want {
+				t.Errorf("%s follow got %t want %t", tt.url, got, want)
+			}
+			if got, want := v.Seen(tt.url), tt.seen; got != want {
+				t.Errorf("%s seen got %t want %t", tt.url, got, want)
+			}
+		})
+	}
+	if got, want := v.len(), 2; got != want {
+		t.Errorf("len got %d want %d", got, want)
+	}
+}
+
+func TestVisitedSetConcurrent(t *testing.T) {
+
+	const goroutines, urls = 8, 1000
+	v := newVisitedSet()
+	var added atomic.Int64
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range urls {
+				if v.Follow(fmt.Sprintf("https://example.com/%d", i)) {
+					added.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, want := added.Load(), int64(urls); got != want {
+		t.Errorf("added got %d want %d", got, want)
+	}
+	if got, want := v.len(), urls; got != want {
+		t.Errorf("len got %d want %d", got, want)
+	}
+}
@@ -0,0 +1,186 @@
+// warehouse.go provides OutputSinks streaming results to the analytics
+// databases teams may already run, Postgres and ClickHouse, in batches,
+// as a row for each request with its metrics and a row for each run.
+// The Postgres writer is in postgres.go and the ClickHouse writer in
+// clickhouse.go.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WAREHOUSEBATCHSIZE is the number of results written to a warehouse
+// in each batch
+const WAREHOUSEBATCHSIZE = 500
+
+// dsnPassword matches the password of a key=value dsn, such as
+// "host=db user=webchk password=secret", which may be quoted
+var dsnPassword = regexp.MustCompile(`(?i)(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|[^\s]*)`)
+
+// redactDSN returns the dsn, a url or key=value pairs, with any password
+// replaced by "xxxxx", so that it may be recorded
+func redactDSN(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" {
+		return dsnPassword.ReplaceAllString(dsn, "${1}xxxxx")
+	}
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", "xxxxx")
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
+
+// warehouseResult is a result as a row of the webchk_results table,
+// with the metrics of its request
+type warehouseResult struct {
+	RunID       int64
+	URL         string
+	Referrer    string
+	Status      int
+	Error       string
+	ErrorKind   string
+	ContentType string
+	Size        int
+	ElapsedMS   int64
+	Depth       int
+	Worker      int
+	Matches     int
+	Terms       string // the distinct terms matched, comma separated
+	Violations  int
+	FetchedAt   time.Time
+	Tags        map[string]string // of the run
+}
+
+// newWarehouseResult makes the row of a result of run runID, with tags,
+// written at now
+func newWarehouseResult(runID int64, tags map[string]string, r Result, now time.Time) warehouseResult {
+	w := warehouseResult{
+		RunID:       runID,
+		Tags:        tags,
+		URL:         r.url,
+		Referrer:    r.referrer,
+		Status:      r.status,
+		ContentType: r.contentType,
+		Size:        r.size,
+		ElapsedMS:   r.elapsed.Milliseconds(),
+		Depth:       r.depth,
+		Worker:      r.worker,
+		Matches:     len(r.matches),
+		Violations:  len(r.violations),
+		FetchedAt:   now.UTC(),
+	}
+	if r.err != nil && r.err != NonHTMLPageType {
+		w.Error, w.ErrorKind = r.err.Error(), errorKind(r)
+	}
+	terms := []string{}
+	for _, m := range r.matches {
+		if !slices.Contains(terms, m.match) {
+			terms = append(terms, m.match)
+		}
+	}
+	w.Terms = strings.Join(terms, ",")
+	return w
+}
+
+// warehouseRun is a run as a row of the webchk_runs table
+type warehouseRun struct {
+	ID          int64
+	BaseURL     string
+	Start       time.Time
+	End         time.Time
+	Termination string
+	Pages       int
+	Errors      int
+	Broken      int
+	Violations  int
+	Bytes       int64
+	Tags        map[string]string
+}
+
+// warehouseWriter writes the rows of runs and results to a warehouse
+type warehouseWriter interface {
+	writeResults([]warehouseResult) error
+	writeRun(warehouseRun) error
+	close() error
+}
+
+// warehouseSink is an OutputSink writing results to a warehouse in
+// batches of batchSize, and the run when it is closed
+type warehouseSink struct {
+	name      string // of the warehouse, for errors
+	writer    warehouseWriter
+	runID     int64
+	baseURL   string
+	tags      map[string]string
+	batchSize int
+	batch     []warehouseResult
+}
+
+// newWarehouseSink makes a warehouseSink writing to writer. Runs are
+// identified by the time they start in nanoseconds, as ClickHouse has
+// no sequences.
+func newWarehouseSink(name string, writer warehouseWriter, options Options) *warehouseSink {
+	return &warehouseSink{
+		name:      name,
+		writer:    writer,
+		runID:     time.Now().UnixNano(),
+		baseURL:   options.Args.BaseURL,
+		tags:      options.tags(),
+		batchSize: WAREHOUSEBATCHSIZE,
+	}
+}
+
+// Write adds a result to the batch, writing the batch when it is full.
+// A batch which cannot be written is dropped, and reported.
+func (w *warehouseSink) Write(r Result) error {
+	w.batch = append(w.batch, newWarehouseResult(w.runID, w.tags, r, time.Now()))
+	if len(w.batch) < w.batchSize {
+		return nil
+	}
+	return w.flush()
+}
+
+// flush writes the results in the batch
+func (w *warehouseSink) flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+	err := w.writer.writeResults(w.batch)
+	n := len(w.batch)
+	w.batch = w.batch[:0]
+	if err != nil {
+		return fmt.Errorf("%s: could not write %d results: %w", w.name, n, err)
+	}
+	return nil
+}
+
+// Close writes the remaining results and the run, and closes the
+// connection to the warehouse
+func (w *warehouseSink) Close(stats Stats) error {
+	err := w.flush()
+	run := warehouseRun{
+		ID:          w.runID,
+		BaseURL:     w.baseURL,
+		Start:       stats.Start.UTC(),
+		End:         stats.End.UTC(),
+		Termination: stats.Termination,
+		Pages:       stats.Pages,
+		Errors:      stats.Errors,
+		Broken:      stats.Broken,
+		Violations:  stats.Violations,
+		Bytes:       stats.Bytes,
+		Tags:        w.tags,
+	}
+	if runErr := w.writer.writeRun(run); runErr != nil {
+		err = errors.Join(err, fmt.Errorf("%s: could not write run: %w", w.name, runErr))
+	}
+	return errors.Join(err, w.writer.close())
+}
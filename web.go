@@ -4,8 +4,9 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"cmp"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,45 +22,120 @@ import (
 // that client, which are parameterised to allow for convenient swapping
 // out during testing
 type getClient struct {
-	client     *http.Client
-	getURL     func(url, referrer string, searchTerms []string) (Result, []string)
-	getLinks   func(body []byte, url *url.URL) ([]string, error)
-	getMatches func(body []byte, searchTerms []string) []SearchMatch
+	client      *http.Client
+	hostHeader  string             // optional, sent with the requests to baseHost
+	baseHost    string             // the host of the base url
+	assertions  assertions         // optional per-url assertions
+	languages   languages          // optional languages of the pages to search
+	caps        *matchCaps         // optional caps on the matches reported
+	fold        bool               // also match search terms folded by foldText
+	firstMatch  bool               // only report the first match of each page
+	site        *urlScope          // optional, stopping at redirects off the site
+	boilerplate *boilerplateFilter // optional, excluding repeated lines from matching
+	spell       *spellChecker      // optional
+	readability bool               // measure the readability of pages
+	amp         bool               // follow the AMP alternates of pages
+	checksums   bool               // record checksums of the visible text of pages
+	seeds       seedRequests       // optional requests for seeds, by url
+	texts       bool               // record the visible text of pages
+	decode      charsetDecoder     // optional, decoding pages from an assumed charset
+	getURL      func(url, referrer string, searchTerms []string) (Result, []string)
+	getVariant  func(url, referrer, language string, searchTerms []string) (Result, []string)
+	parse       func(body []byte, url *url.URL, searchTerms []string, firstMatch bool) (parsedPage, error)
+	parseAsset  func(body []byte, url *url.URL, contentType string) []string // optional
+	parseJSON   func(body []byte, url *url.URL) ([]string, error)            // optional
 }
 
-// NewGetClient initialises a new getClient.
-func NewGetClient(httpWorkers int, httpTimeout time.Duration) *getClient {
-	if httpWorkers == 0 {
-		httpWorkers = HTTPWORKERS
-	}
+// NewGetClient initialises a new getClient. The transport made by
+// NewTransport is configured with options.
+func NewGetClient(httpWorkers int, httpTimeout time.Duration, options ...ClientOption) *getClient {
 	if httpTimeout == 0 {
 		httpTimeout = HTTPTIMEOUT
 	}
 	g := getClient{}
+	transport := NewTransport(httpWorkers)
+	for _, o := range options {
+		o(transport)
+	}
 	g.client = &http.Client{
-		Transport: &http.Transport{
-			MaxConnsPerHost: httpWorkers,
-		},
-		Timeout: httpTimeout,
+		Transport:     transport,
+		Timeout:       httpTimeout,
+		CheckRedirect: checkRedirect(MAXREDIRECTS),
 	}
 	g.getURL = g.get
-	g.getLinks = getLinks
-	g.getMatches = getMatches
+	g.getVariant = g.getLanguage
+	g.parse = htmlParser(linkTags)
 	return &g
 }
 
+// NewTransport makes the http.Transport of a getClient, allowing
+// httpWorkers connections to each host
+func NewTransport(httpWorkers int) *http.Transport {
+	if httpWorkers == 0 {
+		httpWorkers = HTTPWORKERS
+	}
+	transport := &http.Transport{
+		MaxConnsPerHost:     httpWorkers,
+		MaxIdleConnsPerHost: httpWorkers, // keep a connection for each
+	}
+	return transport
+}
+
+// withAssets sets the getClient to also extract the links to
+// stylesheets and scripts from pages, and the links from stylesheets
+// and scripts
+func (g *getClient) withAssets() {
+	g.parse = htmlParser(assetTags)
+	g.parseAsset = parseAsset
+}
+
+// withFirstMatch sets the getClient to stop matching the search terms
+// against each page at its first match, for audits which only need to
+// know which pages match
+func (g *getClient) withFirstMatch() {
+	g.firstMatch = true
+}
+
+// withJSONLinks sets the getClient to extract links from json
+// responses, selected by paths if any are given
+func (g *getClient) withJSONLinks(paths []jsonPath) {
+	g.parseJSON = jsonLinker(paths)
+}
+
 // Result is url result provided by a call to a web page
 type Result struct {
 	url, referrer string        // full url and referrer
 	status        int           // http statuscode if not 200
+	size          int           // size of the body read in bytes
+	contentType   string        // the Content-Type of the response
+	redirect      string        // the url redirected to, if any
+	language      string        // the Accept-Language the page was fetched with, if any
+	depth         int           // number of links followed from the base url
+	elapsed       time.Duration // time taken to retrieve the url
+	rateWait      time.Duration // time the worker waited for the rate limiter
+	worker        int           // the worker fetching the url, from 1
+	retryAfter    time.Duration // maintenance window reported with a 503 status
+	next          []string      // links to the next page of a paginated listing
+	anchors       linkAnchors   // anchors of the links found, by link
+	anchor        linkAnchor    // the anchor of the link followed to this url
+	page          int           // page of a paginated listing, from 2, or 0
 	matches       []SearchMatch // search term matches from this URL
+	truncated     bool          // matches were dropped by the match caps
+	misspellings  []string      // words of the page not in the dictionary
+	readability   *readability  // counts of the visible text, if measured
+	noindex       bool          // marked noindex, by a meta element or header
+	amp           string        // the url of the AMP alternate of the page, if any
+	checksum      string        // of the visible text of the page, if recorded
+	text          string        // the visible text of the page as lines, if recorded
+	violations    []Violation   // assertion violations for this URL
 	err           error
 }
 
 // SearchMatch is a record of a search term match in an html file
 type SearchMatch struct {
-	line  int    // line number
-	match string // the match term
+	line   int    // line number
+	match  string // the match term
+	offset int    // byte offset of the first match on the line in the page
 }
 
 // String prints a SearchMatch
@@ -71,100 +147,453 @@ func (s SearchMatch) String() string {
 // from the page and reports if there are any matches to the
 // searchTerms.
 func (g *getClient) get(url, referrer string, searchTerms []string) (Result, []string) {
+	return g.getLanguage(url, referrer, "", searchTerms)
+}
+
+// getLanguage gets a URL as get does, asking for the page in language
+// with an Accept-Language header if language is set.
+func (g *getClient) getLanguage(url, referrer, language string, searchTerms []string) (Result, []string) {
 	r := Result{
 		url:      url,
 		referrer: referrer,
+		language: language,
 		matches:  []SearchMatch{},
 	}
 	links := []string{}
 
-	resp, err := g.client.Get(url)
+	req, err := g.seeds.newRequest(url)
+	if err != nil {
+		r.err = err
+		return r, links
+	}
+	req = g.pageRequest(req)
+	if language != "" {
+		req.Header.Set("Accept-Language", language)
+	}
+	g.setHost(req)
+	resp, err := g.client.Do(req)
 	if err != nil {
 		r.err = err
 		return r, links
 	}
+	defer resp.Body.Close() // release the connection however the response is handled
 	r.status = resp.StatusCode
+	r.contentType = resp.Header.Get("Content-Type")
+	r.redirect = redirectURL(url, resp.Request.URL)
+	r.violations = g.assertions.checkStatus(url, r.status)
+	r.violations = append(r.violations, g.assertions.checkHeaders(url, resp.Header)...)
+	if r.status == http.StatusServiceUnavailable {
+		r.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	if redirect := g.externalRedirect(url, resp); redirect != "" {
+		r.redirect, r.err = redirect, ExternalRedirect
+		return r, links
+	}
 	if r.status != http.StatusOK {
 		r.err = StatusNotOk
 		return r, links
 	}
-	if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, "text/html") {
+	ct := resp.Header.Get("Content-Type")
+	var content io.Reader = resp.Body
+	// a response with no useful Content-Type or file extension is
+	// classified by its first bytes
+	if genericContentType(ct) && !hasExtension(resp.Request.URL) {
+		ct, content, err = sniffContentType(resp.Body)
+		if err != nil {
+			r.err = fmt.Errorf("file reading error: %w", err)
+			return r, links
+		}
+		r.contentType = ct
+	}
+	isHTML := strings.Contains(ct, "text/html")
+	isAsset := g.parseAsset != nil && assetType(ct) != ""
+	isXML := !isHTML && strings.Contains(ct, "xml") // possibly a feed
+	isJSON := g.parseJSON != nil && jsonType(ct)
+	if !isHTML && !isAsset && !isXML && !isJSON {
 		r.err = NonHTMLPageType
 		return r, links
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body) // read into body for multiple uses
-	if err != nil {
+	body, err := readPage(content, g.decode) // read into body for multiple uses
+	if err != nil && !errors.Is(err, ErrPageTooLarge) {
 		r.err = fmt.Errorf("file reading error: %w", err)
 		return r, links
 	}
+	r.err = err // a page too large is searched as far as it was read
+	switch {
+	case isAsset:
+		r.size = len(body)
+		return r, g.parseAsset(body, resp.Request.URL, ct)
+	case isJSON:
+		r.size = len(body)
+		links, err = g.parseJSON(body, resp.Request.URL)
+		if err != nil {
+			r.err = fmt.Errorf("links error: %w", err)
+		}
+		return r, links
+	case isXML:
+		links, ok := parseFeed(body, resp.Request.URL)
+		if !ok {
+			r.err = NonHTMLPageType
+			return r, []string{}
+		}
+		r.size = len(body)
+		return r, links
+	}
+	r.size = len(body)
+	if binaryContent(body) {
+		r.err = MislabelledPage // not searched, nor its links followed
+		return r, links
+	}
+
+	r.violations = append(r.violations, g.assertions.checkBody(url, body)...)
 
-	links, err = g.getLinks(body, resp.Request.URL)
+	page, err := g.parse(body, resp.Request.URL, searchTerms, g.firstMatch)
+	if g.fold {
+		page.matches = foldMatches(body, searchTerms, page.matches, g.firstMatch)
+	}
+	if g.firstMatch && len(page.matches) > 1 {
+		page.matches = page.matches[:1] // the first line of those found folded
+	}
+	r.matches, r.next = g.boilerplate.filter(body, page.matches), page.next
+	r.anchors = page.anchors
+	r.noindex = page.noindex || headerNoindex(resp.Header)
+	r.amp = page.amp
+	if g.amp && r.amp != "" {
+		page.links = append(page.links, r.amp)
+	}
+	lang := page.lang
+	if lang == "" {
+		lang = resp.Header.Get("Content-Language")
+	}
+	if !g.languages.match(lang) {
+		r.matches = []SearchMatch{} // not in a language searched
+	}
+	r.matches, r.truncated = g.caps.apply(r.matches)
+	if g.spell != nil {
+		r.misspellings = g.spell.check(body)
+	}
+	if g.readability {
+		rd := measureReadability(visibleText(body))
+		r.readability = &rd
+	}
+	if g.checksums {
+		r.checksum = contentChecksum(body)
+	}
+	if g.texts {
+		r.text = strings.Join(visibleLines(body), "\n")
+	}
 	if err != nil {
 		r.err = fmt.Errorf("links error: %w", err)
-		return r, links
 	}
+	return r, page.links
+}
 
-	r.matches = g.getMatches(body, searchTerms)
+// redirectURL returns the url a request for url was finally redirected
+// to, without its fragment or trailing slash, or "" if it was not
+// redirected
+func redirectURL(url string, final *url.URL) string {
+	u := *final
+	u.Fragment = ""
+	redirect := strings.TrimSuffix(u.String(), "/")
+	if redirect == strings.TrimSuffix(url, "/") {
+		return ""
+	}
+	return redirect
+}
+
+// linkTags are the attributes of html elements holding links to pages,
+// by element
+var linkTags = map[string]string{"a": "href"}
+
+// assetTags are the attributes of html elements holding links to pages,
+// stylesheets and scripts, by element
+var assetTags = map[string]string{"a": "href", "link": "href", "script": "src"}
 
-	return r, links
+// parsedPage holds what is extracted from an html page: its links,
+// sorted without duplicates, the links to the next page if it is a page
+// of a paginated listing and the search term matches
+type parsedPage struct {
+	links   []string
+	next    []string    // also in links
+	anchors linkAnchors // the first anchor of each link
+	matches []SearchMatch
+	lang    string // the lang attribute of the html element
+	noindex bool   // a robots meta element includes noindex
+	amp     string // the AMP alternate of the page, with its query
 }
 
-// getLinks extracts the links from an html page by parsing it in to an
-// x/html tree returning a slice of links or error. The tree parser is
-// taken from the blue book.
-func getLinks(body []byte, url *url.URL) ([]string, error) {
-	links := []string{}
-	doc, err := html.Parse(bytes.NewReader(body))
-	if err != nil {
-		err = fmt.Errorf("could not parse file: %w", err)
-		return links, err
-	}
-	// Find any links
-	var visit func(n *html.Node) []string // declare here as recursive
-	visit = func(n *html.Node) []string {
-		if n.Type == html.ElementNode && n.Data == "a" {
-			for _, a := range n.Attr {
-				if a.Key == "href" {
-					linkURL, err := url.Parse(a.Val)
-					if err != nil {
-						continue // ignore bad urls
+// parsePage makes a single pass over an html page with the x/html
+// tokenizer, extracting the links resolved against url and matching
+// searchTerms against each line of the page, including its markup.
+// Matching is case insensitive and only one match is reported for each
+// term on a line. Links to the next page of a listing, with rel="next"
+// or text such as "Next page", keep their query strings.
+func parsePage(body []byte, url *url.URL, searchTerms []string) (parsedPage, error) {
+	return parseHTML(body, url, searchTerms, linkTags, false)
+}
+
+// parsePageAssets is parsePage also extracting the links to stylesheets
+// and scripts
+func parsePageAssets(body []byte, url *url.URL, searchTerms []string) (parsedPage, error) {
+	return parseHTML(body, url, searchTerms, assetTags, false)
+}
+
+// htmlParser returns the parse function of a getClient, parsing pages
+// with parseHTML for the links in the attributes given by tags
+func htmlParser(tags map[string]string) func(body []byte, url *url.URL, searchTerms []string, firstMatch bool) (parsedPage, error) {
+	return func(body []byte, url *url.URL, searchTerms []string, firstMatch bool) (parsedPage, error) {
+		return parseHTML(body, url, searchTerms, tags, firstMatch)
+	}
+}
+
+// parseHTML parses an html page for parsePage, extracting the links in
+// the attributes given by tags. Links are resolved against the href of
+// the first base element with one, which must come before the links it
+// applies to, and otherwise against url. With firstMatch matching stops
+// at the first match, while links are still extracted from the whole
+// page.
+func parseHTML(body []byte, url *url.URL, searchTerms []string, tags map[string]string, firstMatch bool) (parsedPage, error) {
+	page := parsedPage{links: []string{}, next: []string{}, anchors: linkAnchors{}}
+	matcher := newLineMatcher(searchTerms)
+	matcher.first = firstMatch
+	base, hasBase := url, false
+	addNext := func(href string) {
+		if link, ok := resolvePageLink(base, href); ok && len(page.links) < PAGEMAXLINKS {
+			page.links = append(page.links, link)
+			page.next = append(page.next, link)
+		}
+	}
+	// the anchor being read, to check its text for a next page link and
+	// record it with the landmark elements open
+	var anchorHref, anchorLabel, anchorElement string
+	var anchorBuf strings.Builder
+	inAnchor := false
+	open := landmarks{}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				page.matches = matcher.matches
+				return page, fmt.Errorf("could not parse file: %w", err)
+			}
+			break
+		}
+		// write the raw token before the tokenizer lowercases names in
+		// place
+		matcher.write(z.Raw())
+		switch tt {
+		case html.TextToken:
+			if inAnchor {
+				anchorBuf.Write(z.Text())
+			}
+			continue
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			open.close(string(name))
+			if string(name) == "a" && inAnchor {
+				if isNextPageText(anchorBuf.String()) {
+					addNext(anchorHref)
+				}
+				text := cmp.Or(anchorText(anchorBuf.String()), anchorLabel)
+				if link, ok := resolveLink(base, anchorHref); ok {
+					if _, found := page.anchors[link]; !found && len(page.anchors) < PAGEMAXLINKS {
+						page.anchors[link] = linkAnchor{text, anchorElement}
 					}
-					linkURL.RawQuery, linkURL.Fragment = "", "" // remove items after path
-					link := linkURL.String()
-					link = strings.TrimSpace(strings.TrimSuffix(link, "/"))
-					links = append(links, link)
 				}
+				inAnchor = false
+			}
+			continue
+		case html.StartTagToken, html.SelfClosingTagToken:
+		default:
+			continue
+		}
+		name, hasAttr := z.TagName()
+		if tt == html.StartTagToken {
+			open.open(string(name))
+		}
+		if string(name) == "base" && !hasBase {
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) != "href" {
+					continue
+				}
+				if b, err := url.Parse(strings.TrimSpace(string(val))); err == nil {
+					base, hasBase = b, true
+				}
+			}
+			continue
+		}
+		if string(name) == "html" {
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) == "lang" {
+					page.lang = string(val)
+				}
+			}
+			continue
+		}
+		if string(name) == "meta" {
+			var robots bool
+			var content string
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				switch string(key) {
+				case "name":
+					robots = strings.EqualFold(strings.TrimSpace(string(val)), "robots")
+				case "content":
+					content = string(val)
+				}
+			}
+			page.noindex = page.noindex || (robots && noindexDirective(content))
+			continue
+		}
+		attr, ok := tags[string(name)]
+		isLink := string(name) == "link" // which may be to a feed or next page
+		if !ok && !isLink {
+			continue
+		}
+		attrs := map[string]string{}
+		for hasAttr {
+			var key, val []byte
+			key, val, hasAttr = z.TagAttr()
+			attrs[string(key)] = string(val)
+		}
+		href, hasHref := attrs["href"]
+		switch {
+		case hasHref && (isNextRel(attrs["rel"]) || isNextPageText(attrs["aria-label"])):
+			addNext(href)
+			continue
+		case isLink && hasHref && isAMPRel(attrs["rel"]):
+			if link, ok := resolvePageLink(base, href); ok && page.amp == "" {
+				page.amp = link
 			}
+			continue
+		case string(name) == "a" && tt == html.StartTagToken && hasHref:
+			inAnchor, anchorHref, anchorElement = true, href, open.innermost()
+			anchorLabel = anchorText(cmp.Or(attrs["aria-label"], attrs["title"]))
+			anchorBuf.Reset()
+		}
+		if !ok && feedType(attrs["type"]) {
+			attr = "href"
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			links = visit(c)
+		if val, found := attrs[attr]; found && attr != "" && len(page.links) < PAGEMAXLINKS {
+			if link, ok := resolveLink(base, val); ok {
+				page.links = append(page.links, link)
+			}
 		}
-		slices.Sort(links)
-		links = slices.Compact(links)
-		return links
 	}
-	links = visit(doc)
+	matcher.close()
+	slices.Sort(page.links)
+	page.links = slices.Compact(page.links)
+	page.matches = matcher.matches
+	return page, nil
+}
+
+// resolveLink resolves link against the url of the page it was found
+// on, removing any query and fragment and trailing slash and
+// normalising an internationalised host to punycode and the
+// percent-encoding of the path, reporting false for links which cannot
+// be parsed
+func resolveLink(url *url.URL, link string) (string, bool) {
+	linkURL, err := url.Parse(link)
+	if err != nil {
+		return "", false // ignore bad urls
+	}
+	normaliseHost(linkURL)
+	normalisePercent(linkURL)
+	linkURL.RawQuery, linkURL.Fragment = "", "" // remove items after path
+	link = linkURL.String()
+	return strings.TrimSpace(strings.TrimSuffix(link, "/")), true
+}
+
+// lineMatcher matches search terms against the lines of a page written
+// to it in pieces
+type lineMatcher struct {
+	terms   []string // search terms as given
+	lower   [][]byte // search terms in lowercase
+	line    []byte   // the current line
+	lineNo  int
+	start   int // byte offset of the current line
+	matches []SearchMatch
+	first   bool // stop at the first match
+}
 
-	return links, nil
+// newLineMatcher makes a new lineMatcher for searchTerms
+func newLineMatcher(searchTerms []string) *lineMatcher {
+	m := &lineMatcher{terms: searchTerms, matches: []SearchMatch{}}
+	for _, st := range searchTerms {
+		m.lower = append(m.lower, bytes.ToLower([]byte(st)))
+	}
+	return m
 }
 
-// getMatches finds if any of the search terms match text in the
-// body. Matching is case insensitive.
-func getMatches(body []byte, searchTerms []string) []SearchMatch {
-	matches := []SearchMatch{}
-	if len(searchTerms) == 0 {
-		return matches
+// write matches each line completed by p, keeping the remainder
+func (m *lineMatcher) write(p []byte) {
+	if len(m.terms) == 0 || m.done() {
+		return
+	}
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			m.line = append(m.line, p...)
+			return
+		}
+		m.line = append(m.line, p[:i]...)
+		m.matchLine()
+		if m.done() {
+			return
+		}
+		p = p[i+1:]
 	}
-	scanner := bufio.NewScanner(bytes.NewReader(body))
-	lineNo := 0
-	for scanner.Scan() {
-		lineNo++
-		for _, st := range searchTerms {
-			if strings.Contains(strings.ToLower(scanner.Text()), strings.ToLower(st)) {
-				matches = append(matches, SearchMatch{lineNo, st})
+}
+
+// close matches the last line, if it was not terminated by a newline
+func (m *lineMatcher) close() {
+	if len(m.line) > 0 && !m.done() {
+		m.matchLine()
+	}
+}
+
+// matchLine records the matches in the current line and starts the
+// next
+func (m *lineMatcher) matchLine() {
+	m.lineNo++
+	lower := bytes.ToLower(m.line)
+	for i, st := range m.lower {
+		if j := bytes.Index(lower, st); j >= 0 {
+			if len(lower) != len(m.line) {
+				j = foldIndex(m.line, m.terms[i]) // lowercasing changed offsets
+			}
+			m.matches = append(m.matches, SearchMatch{m.lineNo, m.terms[i], m.start + j})
+			if m.first {
+				break
 			}
 		}
 	}
-	return matches
+	m.start += len(m.line) + 1
+	m.line = m.line[:0]
+}
+
+// done reports whether matching has stopped at the first match
+func (m *lineMatcher) done() bool {
+	return m.first && len(m.matches) > 0
+}
+
+// foldIndex returns the byte offset of the first case insensitive match
+// of term in line, or 0 if none is found
+func foldIndex(line []byte, term string) int {
+	for i := range line {
+		if len(line)-i < len(term) {
+			break
+		}
+		if bytes.EqualFold(line[i:i+len(term)], []byte(term)) {
+			return i
+		}
+	}
+	return 0
 }
@@ -3,7 +3,9 @@ package main
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -13,7 +15,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 )
 
-func TestGetMatches(t *testing.T) {
+func TestParsePageMatches(t *testing.T) {
 	tests := []struct {
 		body        []byte
 		searchTerms []string
@@ -65,7 +67,11 @@ func TestGetMatches(t *testing.T) {
 	}
 	for i, tt := range tests {
 		t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
-			matches := getMatches(tt.body, tt.searchTerms)
+			page, err := parsePage(tt.body, &url.URL{}, tt.searchTerms)
+			if err != nil {
+				t.Fatalf("unexpected err %v", err)
+			}
+			matches := page.matches
 			if got, want := len(matches), tt.hits; got != want {
 				t.Errorf("got %d != want %d", got, want)
 				t.Logf("%#v", tt)
@@ -81,7 +87,7 @@ func TestGetMatches(t *testing.T) {
 }
 
 // could use github.com/google/go-cmp/cmp/cmpopts
-func TestGetLinks(t *testing.T) {
+func TestParsePageLinks(t *testing.T) {
 	tests := []struct {
 		body  []byte
 		url   string
@@ -130,6 +136,24 @@ func TestGetLinks(t *testing.T) {
 			links: []string{"https://e.com/two"}, // compacted
 			isErr: false,
 		},
+		{
+			body:  []byte(`<html><head><base href="/docs/v2/"></head><body><a href="one">one</a><a href="/two">two</a></html>`),
+			url:   "https://e.com/q",
+			links: []string{"https://e.com/docs/v2/one", "https://e.com/two"}, // relative to base
+			isErr: false,
+		},
+		{
+			body:  []byte(`<html><head><base href="https://cdn.e.com/a/"><base href="/b/"></head><body><a href="one">one</a></html>`),
+			url:   "https://e.com/q",
+			links: []string{"https://cdn.e.com/a/one"}, // first base only
+			isErr: false,
+		},
+		{
+			body:  []byte(`<html><head><base target="_blank"><base href="b/"></head><body><a href="one">one</a></html>`),
+			url:   "https://e.com/q/",
+			links: []string{"https://e.com/q/b/one"}, // base resolved against url
+			isErr: false,
+		},
 	}
 	for i, tt := range tests {
 		t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
@@ -137,7 +161,8 @@ func TestGetLinks(t *testing.T) {
 			if err != nil {
 				t.Fatalf("could not parse url %v", err)
 			}
-			links, err := getLinks(tt.body, url)
+			page, err := parsePage(tt.body, url, nil)
+			links := page.links
 			if err != nil {
 				if !tt.isErr {
 					t.Fatalf("unexpected err %v", err)
@@ -153,6 +178,33 @@ func TestGetLinks(t *testing.T) {
 	}
 }
 
+func TestParsePage(t *testing.T) {
+
+	body := []byte(`<html>
+<body>
+<p>Welcome to <b>Example</b></p>
+<A HREF="/about/">about</A> <a href="/news#latest">news</a>
+<a href="/about">welcome</a>
+</body>
+</html>`)
+	pageURL, err := url.Parse("https://e.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := parsePage(body, pageURL, []string{"welcome", "to <b>example", "news"})
+	if err != nil {
+		t.Fatalf("unexpected err %v", err)
+	}
+	links, matches := page.links, page.matches
+	if diff := cmp.Diff([]string{"https://e.com/about", "https://e.com/news"}, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+	wantMatches := []SearchMatch{{3, "welcome", 17}, {3, "to <b>example", 25}, {4, "news", 85}, {5, "welcome", 124}}
+	if diff := cmp.Diff(wantMatches, matches, cmp.AllowUnexported(SearchMatch{})); diff != "" {
+		t.Errorf("matches mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestGetMakeClient(t *testing.T) {
 
 	tp := func(td string) time.Duration {
@@ -206,22 +258,18 @@ func TestGetURL(t *testing.T) {
 	defer server.Close()
 	server.Config.ReadTimeout = 200 * time.Millisecond
 
-	// indirect getLinks and getMatch
+	// indirect parsePage
 	var linkError error = nil
 	var aLinkError = errors.New("link error")
-	getLinker := func(body []byte, url *url.URL) ([]string, error) {
-		return []string{}, linkError
-	}
-	getMatcher := func(body []byte, searchTerms []string) []SearchMatch {
-		return []SearchMatch{}
+	parser := func(body []byte, url *url.URL, searchTerms []string, firstMatch bool) (parsedPage, error) {
+		return parsedPage{links: []string{}, matches: []SearchMatch{}}, linkError
 	}
 
 	// make new get client
 	g := getClient{}
 	g.client = server.Client()
 	g.client.Timeout = 300 * time.Millisecond
-	g.getLinks = getLinker
-	g.getMatches = getMatcher
+	g.parse = parser
 
 	tests := []struct {
 		// server
@@ -323,7 +371,180 @@ func TestGetURL(t *testing.T) {
 			if diff := cmp.Diff(tt.result.url, result.url); diff != "" {
 				t.Errorf("result url mismatch (-want +got):\n%s", diff)
 			}
+			if diff := cmp.Diff(tt.serverHeader, result.contentType); tt.serverOK && diff != "" {
+				t.Errorf("result content type mismatch (-want +got):\n%s", diff)
+			}
+
+		})
+	}
+}
+
+func TestGetURLUnixSocket(t *testing.T) {
+
+	var gotHost, gotPath string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			gotHost, gotPath = r.Host, r.URL.Path
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintln(w, "hello world")
+		},
+	))
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "app.sock"))
+	if err != nil {
+		t.Skipf("unix sockets are not available: %v", err)
+	}
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	g := NewGetClient(1, 300*time.Millisecond, WithDialContext(unixSocketDialer(listener.Addr().String())))
+	result, _ := g.get("http://app.internal/status", "/", []string{"hello"})
+	if result.err != nil {
+		t.Fatalf("unexpected error %v", result.err)
+	}
+	if gotHost != "app.internal" || gotPath != "/status" {
+		t.Errorf("got host %s path %s", gotHost, gotPath)
+	}
+	if got, want := len(result.matches), 1; got != want {
+		t.Errorf("got %d want %d matches", got, want)
+	}
+}
+
+func TestRedirectURL(t *testing.T) {
+
+	tests := []struct {
+		url   string
+		final string
+		want  string
+	}{
+		{"https://example.com/a", "https://example.com/a", ""},
+		{"https://example.com/a", "https://example.com/a/", ""},
+		{"https://example.com/a/", "https://example.com/a#top", ""},
+		{"http://example.com/a", "https://example.com/a", "https://example.com/a"},
+		{"https://example.com/old", "https://example.com/new/#top", "https://example.com/new"},
+		{"https://example.com/old", "https://example.com/new?id=1", "https://example.com/new?id=1"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			final, err := url.Parse(tt.final)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := redirectURL(tt.url, final); got != tt.want {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchOffsets(t *testing.T) {
 
+	tests := []struct {
+		body []byte
+		term string
+		want []SearchMatch
+	}{
+		{[]byte("hi there"), "there", []SearchMatch{{1, "there", 3}}},
+		{[]byte("one\ntwo THERE there"), "there", []SearchMatch{{2, "there", 8}}},
+		{[]byte("one\r\ntwo\n\nthere"), "there", []SearchMatch{{4, "there", 10}}},
+		// lowercasing İ lengthens the line, so the offset is found again
+		{[]byte("İstanbul there"), "there", []SearchMatch{{1, "there", 10}}},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			page, err := parsePage(tt.body, &url.URL{}, []string{tt.term})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, page.matches, cmp.AllowUnexported(SearchMatch{})); diff != "" {
+				t.Errorf("matches mismatch (-want +got):\n%s", diff)
+			}
 		})
 	}
 }
+
+func TestFirstMatch(t *testing.T) {
+
+	body := []byte("<html><body>\n<p>one two</p>\n<p>two <a href=\"/a\">one</a></p>\n<a href=\"/b\">b</a>\n</body></html>")
+	pageURL, _ := url.Parse("https://example.com/")
+	terms := []string{"one", "two"}
+
+	page, err := parseHTML(body, pageURL, terms, linkTags, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]SearchMatch{{2, "one", 16}}, page.matches, cmp.AllowUnexported(SearchMatch{})); diff != "" {
+		t.Errorf("matches mismatch (-want +got):\n%s", diff)
+	}
+	// links are still extracted from the whole page
+	if diff := cmp.Diff([]string{"https://example.com/a", "https://example.com/b"}, page.links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+	all, _ := parsePage(body, pageURL, terms)
+	if got, want := len(all.matches), 4; got != want {
+		t.Errorf("got %d want %d matches without first match", got, want)
+	}
+
+	// the client reports the first match, including those found folded
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(body)
+		fmt.Fprint(w, "\n<p>café</p>\n<p>cafe</p>")
+	}))
+	defer server.Close()
+	for _, fold := range []bool{false, true} {
+		g := NewGetClient(1, time.Second)
+		g.withAssets()
+		g.withFirstMatch()
+		g.fold = fold
+		r, links := g.get(server.URL, "", []string{"cafe"})
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		start := len(body) + len("\n<p>café</p>\n") // of the last line
+		want := []SearchMatch{{7, "cafe", start + 3}}
+		if fold {
+			want = []SearchMatch{{6, "cafe", len(body) + 4}}
+		}
+		if diff := cmp.Diff(want, r.matches, cmp.AllowUnexported(SearchMatch{})); diff != "" {
+			t.Errorf("fold %t matches mismatch (-want +got):\n%s", fold, diff)
+		}
+		if got := len(links); got != 2 {
+			t.Errorf("got %d want 2 links", got)
+		}
+	}
+
+	// first match does not depend on the order the client is set up in
+	assets := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><link rel=\"stylesheet\" href=\"/s.css\"></head><body>\n<p>Café</p>\n<p>cafe</p>\n</body></html>")
+	}))
+	defer assets.Close()
+	for _, setup := range [][]func(*getClient){
+		{(*getClient).withAssets, (*getClient).withFirstMatch},
+		{(*getClient).withFirstMatch, (*getClient).withAssets},
+	} {
+		g := NewGetClient(1, time.Second)
+		g.fold = true
+		for _, f := range setup {
+			f(g)
+		}
+		parse, parsedFirst := g.parse, false
+		g.parse = func(body []byte, url *url.URL, searchTerms []string, firstMatch bool) (parsedPage, error) {
+			parsedFirst = firstMatch
+			return parse(body, url, searchTerms, firstMatch)
+		}
+		r, links := g.get(assets.URL, "", []string{"cafe"})
+		if !parsedFirst {
+			t.Error("the page was not parsed for its first match")
+		}
+		if got, want := len(r.matches), 1; got != want || r.matches[0].line != 2 {
+			t.Errorf("got matches %v want 1 on line 2", r.matches)
+		}
+		if got, want := links, []string{assets.URL + "/s.css"}; !cmp.Equal(got, want) {
+			t.Errorf("got links %v want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// window.go schedules crawls of production sites for low traffic
+// times, delaying the start of a crawl until a time of day and pausing
+// requests outside a daily window of times.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClockTime reports a time of day which is not of the form hh:mm
+	ErrClockTime = errors.New("time of day should be given as hh:mm, for example 02:00")
+	// ErrTimeWindow reports a window of times which is not of the form
+	// hh:mm-hh:mm
+	ErrTimeWindow = errors.New("window should be given as hh:mm-hh:mm, for example 01:00-05:00")
+)
+
+// clockTime is a time of day, in minutes after midnight
+type clockTime int
+
+// parseClockTime parses a time of day of the form hh:mm
+func parseClockTime(s string) (clockTime, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q: %w", s, ErrClockTime)
+	}
+	return clockTime(t.Hour()*60 + t.Minute()), nil
+}
+
+// String prints a clockTime as hh:mm
+func (c clockTime) String() string {
+	return fmt.Sprintf("%02d:%02d", c/60, c%60)
+}
+
+// next returns the next time from now, in the location of now, at the
+// time of day, which is now if it is that time
+func (c clockTime) next(now time.Time) time.Time {
+	y, m, d := now.Date()
+	t := time.Date(y, m, d, int(c/60), int(c%60), 0, 0, now.Location())
+	if t.Before(now.Truncate(time.Minute)) {
+		t = time.Date(y, m, d+1, int(c/60), int(c%60), 0, 0, now.Location())
+	}
+	return t
+}
+
+// waitUntil waits until the next time of day c, returning an error if
+// ctx is done first
+func waitUntil(ctx context.Context, c clockTime) error {
+	timer := time.NewTimer(time.Until(c.next(time.Now())))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// timeWindow is a daily window of times in which requests may be made,
+// from start up to end, which may be on the next day. A nil timeWindow
+// is always open. It is safe for concurrent use.
+type timeWindow struct {
+	start, end clockTime
+	now        func() time.Time
+	mu         sync.Mutex
+	reported   time.Time // the end of the last pause reported
+}
+
+// parseTimeWindow parses a window of the form hh:mm-hh:mm, such as
+// 01:00-05:00 or, over midnight, 22:00-04:00
+func parseTimeWindow(s string) (*timeWindow, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", s, ErrTimeWindow)
+	}
+	start, err := parseClockTime(from)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", s, ErrTimeWindow)
+	}
+	end, err := parseClockTime(to)
+	if err != nil || end == start {
+		return nil, fmt.Errorf("%q: %w", s, ErrTimeWindow)
+	}
+	return &timeWindow{start: start, end: end, now: time.Now}, nil
+}
+
+// String prints a timeWindow as hh:mm-hh:mm
+func (w *timeWindow) String() string {
+	return w.start.String() + "-" + w.end.String()
+}
+
+// remaining returns how long it is until the window next opens, or 0 if
+// it is open
+func (w *timeWindow) remaining() time.Duration {
+	if w == nil {
+		return 0
+	}
+	now := w.now()
+	minute := clockTime(now.Hour()*60 + now.Minute())
+	open := minute >= w.start && minute < w.end
+	if w.end < w.start { // over midnight
+		open = minute >= w.start || minute < w.end
+	}
+	if open {
+		return 0
+	}
+	return w.start.next(now).Sub(now)
+}
+
+// wait waits until the window is open, returning an error if ctx is
+// done first. Each pause is reported to diagnostics once.
+func (w *timeWindow) wait(ctx context.Context, diagnostics io.Writer) error {
+	for {
+		d := w.remaining()
+		if d == 0 {
+			return nil
+		}
+		w.mu.Lock()
+		if until := w.now().Add(d).Truncate(time.Minute); until.After(w.reported) {
+			w.reported = until
+			fmt.Fprintf(diagnostics, "outside the crawl window %s, pausing requests until %s\n", w, w.start)
+		}
+		w.mu.Unlock()
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
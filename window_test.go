@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+
+	for _, tt := range []struct {
+		spec string
+		want string
+		err  error
+	}{
+		{"01:00-05:00", "01:00-05:00", nil},
+		{" 22:30 - 4:15 ", "22:30-04:15", nil},
+		{"01:00", "", ErrTimeWindow},
+		{"01:00-01:00", "", ErrTimeWindow},
+		{"1am-5am", "", ErrTimeWindow},
+		{"01:00-25:00", "", ErrTimeWindow},
+	} {
+		w, err := parseTimeWindow(tt.spec)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%q: got error %v want %v", tt.spec, err, tt.err)
+			continue
+		}
+		if err == nil && w.String() != tt.want {
+			t.Errorf("%q: got %s want %s", tt.spec, w, tt.want)
+		}
+	}
+}
+
+func TestClockTimeNext(t *testing.T) {
+
+	at := func(hour, minute, second int) time.Time {
+		return time.Date(2024, 5, 1, hour, minute, second, 0, time.UTC)
+	}
+	for _, tt := range []struct {
+		clock string
+		now   time.Time
+		want  time.Time
+	}{
+		{"02:00", at(1, 30, 0), at(2, 0, 0)},
+		{"02:00", at(2, 0, 30), at(2, 0, 0)}, // now
+		{"02:00", at(2, 1, 0), at(26, 0, 0)}, // tomorrow
+		{"00:00", at(23, 59, 59), at(24, 0, 0)},
+	} {
+		c, err := parseClockTime(tt.clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.next(tt.now); !got.Equal(tt.want) {
+			t.Errorf("%s from %s: got %s want %s", tt.clock, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestTimeWindowRemaining(t *testing.T) {
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 5, 1, hour, minute, 0, 0, time.UTC)
+	}
+	for _, tt := range []struct {
+		window string
+		now    time.Time
+		want   time.Duration
+	}{
+		{"01:00-05:00", at(1, 0), 0},
+		{"01:00-05:00", at(4, 59), 0},
+		{"01:00-05:00", at(5, 0), 20 * time.Hour},
+		{"01:00-05:00", at(0, 30), 30 * time.Minute},
+		{"22:00-04:00", at(23, 0), 0},
+		{"22:00-04:00", at(3, 0), 0},
+		{"22:00-04:00", at(12, 0), 10 * time.Hour},
+	} {
+		w, err := parseTimeWindow(tt.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.now = func() time.Time { return tt.now }
+		if got := w.remaining(); got != tt.want {
+			t.Errorf("%s at %s: got %s want %s", tt.window, tt.now.Format("15:04"), got, tt.want)
+		}
+	}
+	var always *timeWindow
+	if got := always.remaining(); got != 0 {
+		t.Errorf("nil window got %s want 0", got)
+	}
+}
+
+func TestTimeWindowWait(t *testing.T) {
+
+	var buf strings.Builder
+	w, err := parseTimeWindow("01:00-05:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	for range 2 {
+		if err := w.wait(ctx, &buf); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error %v want %v", err, context.DeadlineExceeded)
+		}
+	}
+	if got, want := buf.String(), "outside the crawl window 01:00-05:00, pausing requests until 01:00\n"; got != want {
+		t.Errorf("got report %q want %q", got, want)
+	}
+
+	now = time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	if err := w.wait(ctx, &buf); err != nil {
+		t.Errorf("open window got error %v", err)
+	}
+}
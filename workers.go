@@ -0,0 +1,88 @@
+// workers.go records what each worker of the Dispatcher is fetching,
+// so that a starved or stuck worker can be found when tuning the
+// numbers of workers and http workers.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// busyWorkers records the url each worker, numbered from 1, is
+// fetching and when it started. It is safe for concurrent use.
+type busyWorkers struct {
+	mu     sync.Mutex
+	urls   []string // "" if the worker is not fetching
+	starts []time.Time
+}
+
+// newBusyWorkers makes a busyWorkers for workers
+func newBusyWorkers(workers int) *busyWorkers {
+	return &busyWorkers{urls: make([]string, workers), starts: make([]time.Time, workers)}
+}
+
+// start records that worker id started fetching url at now
+func (w *busyWorkers) start(id int, url string, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.urls[id-1], w.starts[id-1] = url, now
+}
+
+// done records that worker id finished fetching
+func (w *busyWorkers) done(id int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.urls[id-1] = ""
+}
+
+// slowest reports the worker which has been fetching its url the
+// longest at now, and ok false if no worker is fetching
+func (w *busyWorkers) slowest(now time.Time) (id int, url string, elapsed time.Duration, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, u := range w.urls {
+		if u == "" {
+			continue
+		}
+		if d := now.Sub(w.starts[i]); !ok || d > elapsed {
+			id, url, elapsed, ok = i+1, u, d, true
+		}
+	}
+	return id, url, elapsed, ok
+}
+
+// busy returns the number of workers fetching
+func (w *busyWorkers) busy() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := 0
+	for _, u := range w.urls {
+		if u != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// report describes the workers fetching at now for the heartbeat
+func (w *busyWorkers) report(now time.Time) string {
+	id, url, elapsed, ok := w.slowest(now)
+	if !ok {
+		return fmt.Sprintf("0/%d workers fetching", len(w.urls))
+	}
+	return fmt.Sprintf("%d/%d workers fetching, longest worker %d for %s on %s",
+		w.busy(), len(w.urls), id, elapsed.Round(time.Second), url)
+}
+
+// formatWorkerPages prints the pages fetched by each worker, such as
+// "1:12 2:11 3:0"
+func formatWorkerPages(pages []int) string {
+	s := make([]string, len(pages))
+	for i, n := range pages {
+		s[i] = fmt.Sprintf("%d:%d", i+1, n)
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/goleak"
+)
+
+func TestBusyWorkers(t *testing.T) {
+
+	now := time.Date(2024, 4, 1, 2, 0, 0, 0, time.UTC)
+	w := newBusyWorkers(3)
+	if got, want := w.report(now), "0/3 workers fetching"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	w.start(1, "https://example.com/a", now.Add(-2*time.Second))
+	w.start(3, "https://example.com/stuck", now.Add(-45*time.Second))
+	w.start(2, "https://example.com/b", now.Add(-time.Second))
+	w.done(2)
+	if got, want := w.report(now), "2/3 workers fetching, longest worker 3 for 45s on https://example.com/stuck"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := formatWorkerPages([]int{12, 0, 3}), "1:12 2:0 3:3"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestDispatcherWorkers(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	getURLer := func(url, referrer string, searchTerms []string) (Result, []string) {
+		return Result{url: url, status: 200, matches: []SearchMatch{}}, prefixer("a", "b", "c")()
+	}
+	gc := NewGetClient(3, 20*time.Millisecond)
+	gc.getURL = getURLer
+
+	d := NewDispatch("https://example.com",
+		WithWorkers(3),
+		WithRate(100000),
+		WithDispatcherTimeout(50*time.Millisecond),
+		WithClient(gc),
+	)
+	counts := make([]int, 3)
+	for r := range d.Dispatcher() {
+		if r.worker < 1 || r.worker > 3 {
+			t.Fatalf("%s: worker %d out of range", r.url, r.worker)
+		}
+		counts[r.worker-1]++
+	}
+	if diff := cmp.Diff(counts, d.Stats().WorkerPages); diff != "" {
+		t.Errorf("worker pages mismatch (-results +stats):\n%s", diff)
+	}
+}